@@ -0,0 +1,100 @@
+package metadataserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// AccessLogFormat defines the format of the access log records.
+type AccessLogFormat int
+
+const (
+	// AccessLogCommon writes records in Common Log Format.
+	AccessLogCommon AccessLogFormat = iota
+	// AccessLogJSON writes records as JSON lines.
+	AccessLogJSON
+)
+
+// clfTimeFormat is the time format of Common Log Format.
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+type accessLogRecord struct {
+	Time       time.Time `json:"time"`
+	RemoteAddr string    `json:"remoteAddr"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	Size       int       `json:"size"`
+	DurationMs float64   `json:"durationMs"`
+	UserAgent  string    `json:"userAgent,omitempty"`
+}
+
+// WithAccessLog sets a new server with the writer to which a record is written for each served request.
+// Access log is written independently of the logger set with [WithLogger].
+func WithAccessLog(w io.Writer, format AccessLogFormat) Option {
+	return func(s *Server) {
+		s.accessLog = &accessLog{w: w, format: format}
+	}
+}
+
+type accessLog struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format AccessLogFormat
+}
+
+func (l *accessLog) write(rec accessLogRecord) error {
+	var line []byte
+	switch l.format {
+	case AccessLogJSON:
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		line = append(data, '\n')
+	default:
+		host, _, err := net.SplitHostPort(rec.RemoteAddr)
+		if err != nil {
+			host = rec.RemoteAddr
+		}
+		line = fmt.Appendf(nil, "%s - - [%s] \"%s %s %s\" %d %d\n",
+			host, rec.Time.Format(clfTimeFormat), rec.Method, rec.Path, rec.Proto, rec.Status, rec.Size)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err := l.w.Write(line)
+	return err
+}
+
+func (s *Server) logAccess(next http.Handler) http.Handler {
+	if s.accessLog == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := newStatusRecorder(w)
+		defer rw.release()
+		next.ServeHTTP(rw, r)
+		err := s.accessLog.write(accessLogRecord{
+			Time:       start,
+			RemoteAddr: r.RemoteAddr,
+			Method:     r.Method,
+			Path:       r.URL.RequestURI(),
+			Proto:      r.Proto,
+			Status:     rw.status,
+			Size:       rw.size,
+			DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+			UserAgent:  r.UserAgent(),
+		})
+		if err != nil {
+			s.logger.ErrorContext(r.Context(), "failed to write access log", slog.String("error", err.Error()))
+		}
+	})
+}
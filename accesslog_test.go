@@ -0,0 +1,57 @@
+package metadataserver_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestAccessLog(t *testing.T) {
+	tests := []struct {
+		name   string
+		format metadataserver.AccessLogFormat
+		check  func(t *testing.T, line []byte)
+	}{
+		{
+			name:   "common",
+			format: metadataserver.AccessLogCommon,
+			check: func(t *testing.T, line []byte) {
+				re := regexp.MustCompile(`^127\.0\.0\.1 - - \[[^\]]+\] "GET /computeMetadata/v1/project/project-id HTTP/1\.1" 200 15\n$`)
+				if !re.Match(line) {
+					t.Errorf("unexpected access log record: %q", line)
+				}
+			},
+		},
+		{
+			name:   "json",
+			format: metadataserver.AccessLogJSON,
+			check: func(t *testing.T, line []byte) {
+				var got map[string]any
+				if err := json.Unmarshal(line, &got); err != nil {
+					t.Fatalf("expected no errors, got: %v", err)
+				}
+				if got["path"] != "/computeMetadata/v1/project/project-id" || got["status"] != float64(http.StatusOK) || got["size"] != float64(15) {
+					t.Errorf("unexpected access log record: %q", line)
+				}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			s, err := metadataserver.New(metadataserver.WithAccessLog(&buf, test.format))
+			if err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			ts := httptest.NewServer(s.HttpHandler())
+			defer ts.Close()
+			getStatus(t, ts.URL+metadataserver.DefaultEndpoint+"/project/project-id")
+			test.check(t, buf.Bytes())
+		})
+	}
+}
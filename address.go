@@ -0,0 +1,68 @@
+package metadataserver
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// WithDualStack sets a new server to accept requests over both IPv4 and IPv6.
+// If the server's address is a loopback address, the server also listens on the loopback address of the other family,
+// e.g. on "::1" for "127.0.0.1". If the address is unspecified, the server listens on "::" that accepts IPv4 requests too.
+// Other addresses are not supported.
+func WithDualStack() Option {
+	return func(s *Server) {
+		s.dualStack = true
+	}
+}
+
+// normalizeAddress removes the brackets of the IPv6 literal, e.g. "[::1]" becomes "::1".
+func normalizeAddress(addr string) string {
+	if len(addr) > 2 && addr[0] == '[' && addr[len(addr)-1] == ']' {
+		return addr[1 : len(addr)-1]
+	}
+	return addr
+}
+
+// checkAddress returns an error if the address is neither an IP address nor a hostname.
+// Addresses with colons must be IPv6 literals, optionally with a zone, e.g. "fe80::1%eth0".
+func checkAddress(addr string) error {
+	if strings.ContainsAny(addr, ":[]") {
+		if _, err := netip.ParseAddr(addr); err != nil {
+			return fmt.Errorf("invalid IPv6 address: %w", err)
+		}
+	}
+	return nil
+}
+
+// listenHosts returns the host that the server listens on and the additional host of the other IP family
+// if the server is dual-stack. The additional host is empty if it is not needed.
+func (s *Server) listenHosts() (string, string, error) {
+	if !s.dualStack {
+		return s.config.Address, "", nil
+	}
+	ip, err := netip.ParseAddr(s.config.Address)
+	switch {
+	case err != nil:
+	case ip.IsUnspecified():
+		return "::", "", nil
+	case ip == netip.IPv6Loopback():
+		return s.config.Address, "127.0.0.1", nil
+	case ip.Unmap().IsLoopback():
+		return s.config.Address, "::1", nil
+	}
+	return "", "", fmt.Errorf("dual-stack requires a loopback or unspecified address, got %q", s.config.Address)
+}
+
+// listenDualStack listens on the additional host of the dual-stack server at the port of the server's listener.
+func (s *Server) listenDualStack(l net.Listener) (net.Listener, error) {
+	port := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+	addr := net.JoinHostPort(s.dualStackHost, port)
+	l2, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, bindError("tcp", addr, err)
+	}
+	return l2, nil
+}
@@ -0,0 +1,98 @@
+package metadataserver_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func skipWithoutIPv6(t *testing.T) {
+	t.Helper()
+	l, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback is not available: %v", err)
+	}
+	l.Close()
+}
+
+func getProjectID(t *testing.T, host string, port int) {
+	t.Helper()
+	res, err := http.Get("http://" + net.JoinHostPort(host, strconv.Itoa(port)) + metadataserver.DefaultEndpoint + "/project/project-id")
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK || string(body) != "test-project-id" {
+		t.Errorf("%s: expected status %d with %q, got: %d %q", host, http.StatusOK, "test-project-id", res.StatusCode, body)
+	}
+}
+
+func TestIPv6Address(t *testing.T) {
+	skipWithoutIPv6(t)
+	for _, address := range []string{"::1", "[::1]"} {
+		t.Run(address, func(t *testing.T) {
+			port := freePort()
+			s, err := metadataserver.New(metadataserver.WithAddress(address), metadataserver.WithPort(port))
+			if err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			if err := s.Start(context.Background()); err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			defer s.Stop(context.Background())
+			getProjectID(t, "::1", port)
+		})
+	}
+}
+
+func TestDualStack(t *testing.T) {
+	skipWithoutIPv6(t)
+	for _, address := range []string{"127.0.0.1", "::1"} {
+		t.Run(address, func(t *testing.T) {
+			port := freePort()
+			s, err := metadataserver.New(metadataserver.WithAddress(address), metadataserver.WithPort(port), metadataserver.WithDualStack())
+			if err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			if err := s.Start(context.Background()); err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			defer s.Stop(context.Background())
+			getProjectID(t, "127.0.0.1", port)
+			getProjectID(t, "::1", port)
+		})
+	}
+}
+
+func TestAddressErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []metadataserver.Option
+		want    string
+	}{
+		{
+			name:    "invalid IPv6",
+			options: []metadataserver.Option{metadataserver.WithAddress("fd00::zz")},
+			want:    `invalid IPv6 address: ParseAddr("fd00::zz"): each colon-separated field must have at least one digit (at "zz")`,
+		},
+		{
+			name:    "dual-stack",
+			options: []metadataserver.Option{metadataserver.WithAddress("169.254.169.254"), metadataserver.WithDualStack()},
+			want:    `dual-stack requires a loopback or unspecified address, got "169.254.169.254"`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := metadataserver.New(test.options...)
+			if err == nil || err.Error() != test.want {
+				t.Errorf("expected error %q, got: %v", test.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package metadataserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// Reset discards all values set with [Server.SetValue], statuses set with [Server.SetStatus],
+// enables all disabled paths, clears the request history, statistics, token statistics, the token quota and captures
+// and resets the stateful handlers that implement [HandlerResetter], e.g. [Counter].
+func (s *Server) Reset() {
+	s.reset(AuditSourceAPI)
+}
+
+func (s *Server) reset(source string) {
+	// the handlers are reset without holding the lock so they can call the server
+	defer s.resetHandlers()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.auditLocked(source, ActionReset, "", "", "")
+	now := s.now()
+	for k, v := range s.values {
+		s.publishLocked(ChangeEvent{Time: now, Path: k, OldValue: v, Deleted: true})
+	}
+	s.values = nil
+	s.statuses = nil
+	s.disabled = nil
+	s.history = nil
+	s.historyNext = 0
+	s.stats = nil
+	s.tokenStats = TokenStats{}
+	s.unmatched = nil
+	s.seenClients = nil
+	s.unexpected = nil
+	for _, e := range s.expectations {
+		e.calls = 0
+	}
+	s.tokenFailures.Store(0)
+	if s.capture != nil {
+		s.capture.reset()
+	}
+	if s.tokenQuota != nil {
+		s.tokenQuota.reset()
+	}
+}
+
+// adminHandler returns the handler of the admin API that controls the server at runtime.
+//
+// The admin API serves the following endpoints:
+//
+//	GET    /routes         lists paths of the served metadata
+//	GET    /values/{path}  returns the metadata value at the path
+//	PUT    /values/{path}  sets the metadata value at the path to the request body
+//	DELETE /values/{path}  deletes the value that was set at the path
+//	POST   /disable/{path} disables serving metadata at the path
+//	POST   /enable/{path}  enables serving metadata at the path
+//	GET    /history        lists the most recent served requests
+//	GET    /stats          returns request statistics per path
+//	GET    /tokens         returns statistics of the issued access and identity tokens
+//	GET    /unmatched      lists the paths of the requests that did not match any metadata
+//	GET    /audit          lists the most recent changes made at runtime
+//	GET    /events         streams requests, value changes and scenario progress as Server-Sent Events
+//	POST   /reset          discards the runtime changes and clears the request history
+//	POST   /scenarios      runs the scenario that is defined in the request body
+//	GET    /               shows the admin web page
+//	POST   /ui/values      sets the metadata value from the admin web page form
+//	POST   /pause          pauses serving metadata
+//	POST   /resume         resumes serving metadata
+//	GET    /version        returns the version and build information of the server
+//	GET    /state          returns the state of the server: the address, the number of routes, the uptime and the last error
+//	POST   /fail-token     makes the token endpoints to fail ?count=N times with ?status=S
+//	POST   /trigger/{event} triggers the event of the instance, e.g. "maintenance", with the optional ?value=V
+func (s *Server) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.serveAdminPage)
+	mux.HandleFunc("POST /ui/values", s.setValueFromForm)
+	mux.HandleFunc("GET /routes", func(w http.ResponseWriter, r *http.Request) {
+		s.writeJSON(w, r, s.Paths())
+	})
+	mux.HandleFunc("GET /values/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		v, ok := s.GetValue(r.PathValue("path"))
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, v)
+	})
+	mux.HandleFunc("PUT /values/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			readBodyError(w, err)
+			return
+		}
+		s.setValue(r.PathValue("path"), string(data), r.RemoteAddr)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("DELETE /values/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		s.deleteValue(r.PathValue("path"), r.RemoteAddr)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /disable/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		s.disablePath(r.PathValue("path"), r.RemoteAddr)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /enable/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		s.enablePath(r.PathValue("path"), r.RemoteAddr)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("GET /history", func(w http.ResponseWriter, r *http.Request) {
+		s.writeJSON(w, r, s.History())
+	})
+	mux.HandleFunc("GET /events", s.serveEvents)
+	mux.HandleFunc("GET /tokens", func(w http.ResponseWriter, r *http.Request) {
+		s.writeJSON(w, r, s.TokenStats())
+	})
+	mux.HandleFunc("GET /unmatched", func(w http.ResponseWriter, r *http.Request) {
+		s.writeJSON(w, r, s.UnmatchedRequests())
+	})
+	mux.HandleFunc("GET /audit", func(w http.ResponseWriter, r *http.Request) {
+		s.writeJSON(w, r, s.AuditLog())
+	})
+	mux.HandleFunc("GET /stats", func(w http.ResponseWriter, r *http.Request) {
+		s.writeJSON(w, r, s.Stats())
+	})
+	mux.HandleFunc("POST /reset", func(w http.ResponseWriter, r *http.Request) {
+		s.reset(r.RemoteAddr)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /pause", func(w http.ResponseWriter, r *http.Request) {
+		s.pause(r.RemoteAddr)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /resume", func(w http.ResponseWriter, r *http.Request) {
+		s.resume(r.RemoteAddr)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("GET /version", func(w http.ResponseWriter, r *http.Request) {
+		s.writeJSON(w, r, ReadBuildInfo())
+	})
+	mux.HandleFunc("GET /state", func(w http.ResponseWriter, r *http.Request) {
+		s.writeJSON(w, r, s.State())
+	})
+	mux.HandleFunc("POST /fail-token", func(w http.ResponseWriter, r *http.Request) {
+		var status, count int
+		for name, v := range map[string]*int{"status": &status, "count": &count} {
+			if q := r.URL.Query().Get(name); q != "" {
+				n, err := strconv.Atoi(q)
+				if err != nil || n < 0 {
+					http.Error(w, fmt.Sprintf("invalid %s %q", name, q), http.StatusBadRequest)
+					return
+				}
+				*v = n
+			}
+		}
+		if err := s.failTokenEndpoint(status, count, r.RemoteAddr); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /trigger/{event}", func(w http.ResponseWriter, r *http.Request) {
+		if err := s.triggerEvent(r.PathValue("event"), r.URL.Query().Get("value"), r.RemoteAddr); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /scenarios", func(w http.ResponseWriter, r *http.Request) {
+		var sc Scenario
+		if err := json.NewDecoder(r.Body).Decode(&sc); err != nil {
+			readBodyError(w, err)
+			return
+		}
+		if err := s.RunScenario(context.Background(), &sc); err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, ErrServerIsNotRunning) {
+				status = http.StatusConflict
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+	return mux
+}
+
+// WithAdminToken sets a new server with a shared secret that is required to access the admin API.
+// Requests to the admin API must provide the token in the "Authorization: Bearer <token>" header.
+//
+// Mind the order of options when use with [WithConfiguration] and [WithConfigFile].
+func WithAdminToken(token string) Option {
+	return func(s *Server) {
+		if s.config == nil {
+			s.config = NewConfiguration(DefaultConfigurationHandlers)
+		}
+		s.config.AdminToken = token
+	}
+}
+
+func (s *Server) requireAdminToken(next http.Handler) http.Handler {
+	if s.config.AdminToken == "" {
+		return next
+	}
+	want := []byte("Bearer " + s.config.AdminToken)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.loginAdminPage(w, r) {
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 && !s.adminPageAuthorized(r) {
+			s.logger.DebugContext(r.Context(), "admin request is unauthorized", slog.String("remoteAddr", r.RemoteAddr))
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metadataserver"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AdminHttpHandler returns collection of HTTP handlers of the admin API
+func (s *Server) AdminHttpHandler() http.Handler {
+	return s.adminMux
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, r *http.Request, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.logger.ErrorContext(r.Context(), "failed to write admin response", slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,269 @@
+package metadataserver_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/minherz/metadataserver"
+)
+
+func TestAdminAPI(t *testing.T) {
+	s, err := metadataserver.New(metadataserver.WithHandlers(map[string]metadataserver.Metadata{
+		"instance/zone": func() string { return "us-central1-a" },
+	}))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	ts := httptest.NewServer(s.HttpHandler())
+	defer ts.Close()
+	admin := httptest.NewServer(s.AdminHttpHandler())
+	defer admin.Close()
+
+	if got := adminRequest(t, http.MethodPut, admin.URL+"/values/instance/attributes/my-flag", "on"); got != "" {
+		t.Errorf("expected empty response, got: %q", got)
+	}
+	if got := adminRequest(t, http.MethodGet, admin.URL+"/values/instance/attributes/my-flag", ""); got != "on" {
+		t.Errorf("expected value %q, got: %q", "on", got)
+	}
+	var routes []string
+	if err := json.Unmarshal([]byte(adminRequest(t, http.MethodGet, admin.URL+"/routes", "")), &routes); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if diff := cmp.Diff([]string{"instance/attributes/my-flag", "instance/zone"}, routes); diff != "" {
+		t.Errorf("routes mismatch (-want +got):\n%s", diff)
+	}
+
+	res, err := http.Get(ts.URL + metadataserver.DefaultEndpoint + "/instance/attributes/my-flag")
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	res.Body.Close()
+	var history []metadataserver.RequestRecord
+	if err := json.Unmarshal([]byte(adminRequest(t, http.MethodGet, admin.URL+"/history", "")), &history); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if len(history) != 1 || history[0].Path != metadataserver.DefaultEndpoint+"/instance/attributes/my-flag" || history[0].Status != http.StatusOK {
+		t.Errorf("unexpected history: %+v", history)
+	}
+
+	adminRequest(t, http.MethodPost, admin.URL+"/reset", "")
+	if _, ok := s.GetValue("instance/attributes/my-flag"); ok {
+		t.Errorf("expected value to be reset")
+	}
+	if len(s.History()) != 0 {
+		t.Errorf("expected history to be reset, got: %+v", s.History())
+	}
+}
+
+func TestAdminListener(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+	port := freePort()
+	s, err := metadataserver.New(
+		metadataserver.WithAddress("127.0.0.1"),
+		metadataserver.WithPort(freePort()),
+		metadataserver.WithAdminPort(port))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	defer s.Stop(context.Background())
+	got := adminRequest(t, http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/values/project/project-id", port), "")
+	if got != "test-project-id" {
+		t.Errorf("expected value %q, got: %q", "test-project-id", got)
+	}
+}
+
+func adminRequest(t *testing.T, method, url, body string) string {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if res.StatusCode >= http.StatusBadRequest {
+		t.Fatalf("%s %s: unexpected status %d", method, url, res.StatusCode)
+	}
+	return string(data)
+}
+
+func TestAdminToken(t *testing.T) {
+	s, err := metadataserver.New(metadataserver.WithAdminToken("secret"))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	admin := httptest.NewServer(s.AdminHttpHandler())
+	defer admin.Close()
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{name: "no_token", want: http.StatusUnauthorized},
+		{name: "wrong_token", token: "Bearer guess", want: http.StatusUnauthorized},
+		{name: "valid_token", token: "Bearer secret", want: http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, admin.URL+"/routes", nil)
+			if test.token != "" {
+				req.Header.Set("Authorization", test.token)
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			res.Body.Close()
+			if res.StatusCode != test.want {
+				t.Errorf("expected status %d, got: %d", test.want, res.StatusCode)
+			}
+		})
+	}
+}
+
+// adminPageCSRF returns the CSRF token of the admin web page.
+func adminPageCSRF(t *testing.T, client *http.Client, url string) string {
+	t.Helper()
+	res, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	data, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	m := regexp.MustCompile(`name="csrf" value="([^"]+)"`).FindStringSubmatch(string(data))
+	if m == nil {
+		t.Fatalf("expected CSRF token in the admin page, got status %d: %s", res.StatusCode, data)
+	}
+	return m[1]
+}
+
+func TestAdminPage(t *testing.T) {
+	s, err := metadataserver.New()
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	admin := httptest.NewServer(s.AdminHttpHandler())
+	defer admin.Close()
+
+	res, err := http.PostForm(admin.URL+"/ui/values", map[string][]string{
+		"path":  {"instance/attributes/my-flag"},
+		"value": {"forged"},
+	})
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("expected status %d without CSRF token, got: %d", http.StatusForbidden, res.StatusCode)
+	}
+
+	res, err = http.PostForm(admin.URL+"/ui/values", map[string][]string{
+		"csrf":  {adminPageCSRF(t, http.DefaultClient, admin.URL+"/")},
+		"path":  {"instance/attributes/my-flag"},
+		"value": {"<on>"},
+	})
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	data, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got: %d", http.StatusOK, res.StatusCode)
+	}
+	if got, _ := s.GetValue("instance/attributes/my-flag"); got != "<on>" {
+		t.Errorf("expected value %q, got: %q", "<on>", got)
+	}
+	for _, want := range []string{"project/project-id", "instance/attributes/my-flag", "&lt;on&gt;"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("expected admin page to contain %q", want)
+		}
+	}
+}
+
+func TestAdminPageWithToken(t *testing.T) {
+	s, err := metadataserver.New(metadataserver.WithAdminToken("secret"))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/admin/", http.StripPrefix("/admin", s.AdminHttpHandler()))
+	admin := httptest.NewServer(mux)
+	defer admin.Close()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	client := &http.Client{Jar: jar}
+
+	res, err := client.Get(admin.URL + "/admin/")
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected status %d without token, got: %d", http.StatusUnauthorized, res.StatusCode)
+	}
+	csrf := adminPageCSRF(t, client, admin.URL+"/admin/?token=secret")
+	res, err = client.PostForm(admin.URL+"/admin/ui/values", map[string][]string{
+		"csrf":  {csrf},
+		"path":  {"instance/attributes/my-flag"},
+		"value": {"on"},
+	})
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || res.Request.URL.Path != "/admin/" {
+		t.Errorf("expected redirect to %q with status %d, got: %q with status %d", "/admin/", http.StatusOK, res.Request.URL.Path, res.StatusCode)
+	}
+	if got, _ := s.GetValue("instance/attributes/my-flag"); got != "on" {
+		t.Errorf("expected value %q, got: %q", "on", got)
+	}
+	res, err = client.Post(admin.URL+"/admin/reset", "", nil)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected the cookie not to authorize the admin API, got status %d", res.StatusCode)
+	}
+}
+
+func TestHistoryLimit(t *testing.T) {
+	s, err := metadataserver.New()
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	h := s.HttpHandler()
+	for i := 0; i < 150; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, fmt.Sprintf("%s/entry%d", metadataserver.DefaultEndpoint, i), nil))
+	}
+	history := s.History()
+	if len(history) != 100 {
+		t.Fatalf("expected 100 records, got: %d", len(history))
+	}
+	if first, last := history[0].Path, history[99].Path; first != metadataserver.DefaultEndpoint+"/entry50" || last != metadataserver.DefaultEndpoint+"/entry149" {
+		t.Errorf("expected records from entry50 to entry149, got: %q..%q", first, last)
+	}
+}
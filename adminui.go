@@ -0,0 +1,140 @@
+package metadataserver
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"html/template"
+	"log/slog"
+	"net/http"
+)
+
+// adminTokenCookie is the cookie that keeps the admin token for the admin web page.
+const adminTokenCookie = "metadataserver-admin-token"
+
+var adminPage = template.Must(template.New("admin").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Metadata server</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+input[type=text] { width: 30em; }
+</style>
+</head>
+<body>
+<h1>Metadata server</h1>
+<p>Serving at <code>{{.Address}}{{.Endpoint}}</code></p>
+<h2>Routes</h2>
+<table>
+<tr><th>Path</th><th>Value</th><th>Hits</th></tr>
+{{range .Routes}}<tr>
+<td><code>{{.Path}}</code></td>
+<td><form method="post" action="ui/values"><input type="hidden" name="csrf" value="{{$.CSRF}}"><input type="hidden" name="path" value="{{.Path}}"><input type="text" name="value" value="{{.Value}}"> <input type="submit" value="Set"></form></td>
+<td>{{.Hits}}</td>
+</tr>{{end}}
+<tr>
+<td colspan="3"><form method="post" action="ui/values"><input type="hidden" name="csrf" value="{{.CSRF}}"><input type="text" name="path" placeholder="new/path"> <input type="text" name="value" placeholder="value"> <input type="submit" value="Add"></form></td>
+</tr>
+</table>
+<h2>Recent requests</h2>
+<table>
+<tr><th>Time</th><th>Method</th><th>Path</th><th>Status</th><th>Client</th></tr>
+{{range .History}}<tr><td>{{.Time.Format "15:04:05.000"}}</td><td>{{.Method}}</td><td><code>{{.Path}}</code></td><td>{{.Status}}</td><td>{{.RemoteAddr}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+type adminPageRoute struct {
+	Path  string
+	Value string
+	Hits  int
+}
+
+type adminPageData struct {
+	Address  string
+	Endpoint string
+	CSRF     string
+	Routes   []adminPageRoute
+	History  []RequestRecord
+}
+
+func (s *Server) serveAdminPage(w http.ResponseWriter, r *http.Request) {
+	stats := s.Stats()
+	data := adminPageData{
+		Address:  s.server.Addr,
+		Endpoint: s.config.Endpoint,
+		CSRF:     s.adminCSRF,
+		History:  s.History(),
+	}
+	for _, p := range s.Paths() {
+		v, _ := s.GetValue(p)
+		data.Routes = append(data.Routes, adminPageRoute{Path: p, Value: v, Hits: stats[p].Requests})
+	}
+	// show the most recent requests first
+	for i, j := 0, len(data.History)-1; i < j; i, j = i+1, j-1 {
+		data.History[i], data.History[j] = data.History[j], data.History[i]
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := adminPage.Execute(w, data); err != nil {
+		s.logger.ErrorContext(r.Context(), "failed to render admin page", slog.String("error", err.Error()))
+	}
+}
+
+// setValueFromForm sets the value from the form of the admin web page.
+// The form must carry the CSRF token of the page, so other sites cannot submit it on behalf of the user.
+func (s *Server) setValueFromForm(w http.ResponseWriter, r *http.Request) {
+	if subtle.ConstantTimeCompare([]byte(r.PostFormValue("csrf")), []byte(s.adminCSRF)) != 1 {
+		http.Error(w, "invalid CSRF token", http.StatusForbidden)
+		return
+	}
+	p := r.PostFormValue("path")
+	if normalizeKey(p) == "" {
+		http.Error(w, "path is required", http.StatusBadRequest)
+		return
+	}
+	s.setValue(p, r.PostFormValue("value"), r.RemoteAddr)
+	seeOther(w, "../")
+}
+
+// loginAdminPage accepts the admin token from the "token" query parameter of the admin web page, keeps it
+// in a cookie and redirects to the page without the token. Browsers cannot send the Authorization header,
+// so the cookie authorizes the requests of the page. It returns false for other requests.
+func (s *Server) loginAdminPage(w http.ResponseWriter, r *http.Request) bool {
+	token := r.URL.Query().Get("token")
+	if r.Method != http.MethodGet || r.URL.Path != "/" || token == "" {
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.config.AdminToken)) != 1 {
+		return false
+	}
+	http.SetCookie(w, &http.Cookie{Name: adminTokenCookie, Value: token, HttpOnly: true, SameSite: http.SameSiteStrictMode})
+	seeOther(w, "./")
+	return true
+}
+
+// adminPageAuthorized reports whether the request of the admin web page carries the admin token in the cookie.
+func (s *Server) adminPageAuthorized(r *http.Request) bool {
+	if r.URL.Path != "/" && r.URL.Path != "/ui/values" {
+		return false
+	}
+	c, err := r.Cookie(adminTokenCookie)
+	return err == nil && subtle.ConstantTimeCompare([]byte(c.Value), []byte(s.config.AdminToken)) == 1
+}
+
+// seeOther redirects to the location relative to the request path.
+// Unlike [http.Redirect] it keeps the location relative, so the redirect works when the admin API is served
+// under a path prefix, e.g. with [http.StripPrefix] or behind a proxy.
+func seeOther(w http.ResponseWriter, location string) {
+	w.Header().Set("Location", location)
+	w.WriteHeader(http.StatusSeeOther)
+}
+
+func newCSRFToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,47 @@
+package metadataserver
+
+import "fmt"
+
+// WithAliases sets a new server with the alias paths of the metadata.
+// The keys of the map are the alias paths and the values are the paths of the metadata that is served at the aliases,
+// e.g. the legacy form of a path. Reading or changing the value at an alias reads or changes the value at the path,
+// including the changes made with [Server.SetValue].
+//
+// Mind the order of options when use with [WithConfiguration] and [WithConfigFile].
+func WithAliases(aliases map[string]string) Option {
+	return func(s *Server) {
+		if s.config == nil {
+			s.config = NewConfiguration(DefaultConfigurationHandlers)
+		}
+		s.config.Aliases = aliases
+	}
+}
+
+// newAliases normalizes the configured aliases of the routes.
+// It returns an error if an alias refers to another alias or if a handler is registered at the alias path.
+func newAliases(configured map[string]string, routes *routeTrie) (map[string]string, error) {
+	if len(configured) == 0 {
+		return nil, nil
+	}
+	aliases := make(map[string]string, len(configured))
+	for alias, target := range configured {
+		aliases[normalizeKey(alias)] = normalizeKey(target)
+	}
+	for alias, target := range aliases {
+		if _, ok := aliases[target]; ok {
+			return nil, fmt.Errorf("alias %q refers to alias %q", alias, target)
+		}
+		if rt := routes.lookup(alias); rt != nil && rt.key == alias {
+			return nil, fmt.Errorf("alias %q conflicts with the metadata handler at the same path", alias)
+		}
+	}
+	return aliases, nil
+}
+
+// aliasMap returns the normalized aliases of the server.
+func (s *Server) aliasMap() map[string]string {
+	if m := s.aliases.Load(); m != nil {
+		return *m
+	}
+	return nil
+}
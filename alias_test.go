@@ -0,0 +1,64 @@
+package metadataserver_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestAliases(t *testing.T) {
+	s, err := metadataserver.New(metadataserver.WithConfigFile("test/fixtures/config_aliases.json"))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	get := func(path string) (int, string) {
+		rec := httptest.NewRecorder()
+		s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/"+path, nil))
+		body, _ := io.ReadAll(rec.Body)
+		return rec.Code, string(body)
+	}
+	const zone = "projects/123456789/zones/us-central1-a"
+	if _, got := get("instance/legacy/zone"); got != zone {
+		t.Errorf("expected alias value %q, got: %q", zone, got)
+	}
+	if _, got := get("instance/legacy/"); got != "zone\n" {
+		t.Errorf("expected alias in directory listing, got: %q", got)
+	}
+
+	s.SetValue("instance/legacy/zone", "projects/123456789/zones/europe-west1-b")
+	for _, p := range []string{"instance/zone", "instance/legacy/zone"} {
+		if _, got := get(p); got != "projects/123456789/zones/europe-west1-b" {
+			t.Errorf("%s: expected changed value, got: %q", p, got)
+		}
+	}
+	s.DeleteValue("instance/zone")
+	if v, _ := s.GetValue("instance/legacy/zone"); v != zone {
+		t.Errorf("expected restored value %q, got: %q", zone, v)
+	}
+	s.DisablePath("instance/zone")
+	if status, _ := get("instance/legacy/zone"); status != http.StatusNotFound {
+		t.Errorf("expected status %d for disabled alias, got: %d", http.StatusNotFound, status)
+	}
+}
+
+func TestAliasErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		aliases map[string]string
+		want    string
+	}{
+		{"chain", map[string]string{"a": "b", "b": "project/project-id"}, `alias "a" refers to alias "b"`},
+		{"conflict", map[string]string{"project/project-id": "instance/zone"}, `alias "project/project-id" conflicts with the metadata handler at the same path`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := metadataserver.New(metadataserver.WithAliases(test.aliases))
+			if err == nil || err.Error() != test.want {
+				t.Errorf("expected error %q, got: %v", test.want, err)
+			}
+		})
+	}
+}
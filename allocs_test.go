@@ -0,0 +1,57 @@
+//go:build !race
+
+package metadataserver_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+// TestAllocationBudget fails when the request path exceeds the allocation budget documented in README.md.
+// The race detector allocates on its own, so the test is skipped with -race.
+func TestAllocationBudget(t *testing.T) {
+	t.Setenv("two", "two")
+	c, err := metadataserver.NewConfigFromFile("test/fixtures/config_literal_handlers.json")
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	literal, err := metadataserver.New(metadataserver.WithConfiguration(c))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	funcs, err := metadataserver.New(metadataserver.WithHandlers(map[string]metadataserver.Metadata{
+		"instance/zone": func() string { return "projects/123/zones/us-central1-a" },
+		"instance/service-accounts/default/token": func() string {
+			return `{"access_token":"ya29.token","expires_in":3599,"token_type":"Bearer"}`
+		},
+	}))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	tests := []struct {
+		name   string
+		s      *metadataserver.Server
+		path   string
+		budget float64
+	}{
+		{"literal value", literal, "/entry1", 0},
+		{"environment-based value", literal, "/entry2", 0},
+		{"handler function", funcs, "/instance/zone", 0},
+		{"token", funcs, "/instance/service-accounts/default/token", 2},
+	}
+	for _, test := range tests {
+		h := test.s.HttpHandler()
+		r := httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+test.path, nil)
+		w := &discardResponseWriter{header: make(http.Header)}
+		allocs := testing.AllocsPerRun(100, func() {
+			clear(w.header)
+			h.ServeHTTP(w, r)
+		})
+		if allocs > test.budget {
+			t.Errorf("%s: expected at most %v allocations per request, got: %v", test.name, test.budget, allocs)
+		}
+	}
+}
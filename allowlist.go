@@ -0,0 +1,89 @@
+package metadataserver
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// WithAllowedClients sets a new server to serve only requests from the client addresses in the CIDR ranges,
+// e.g. "10.0.0.0/8" or "127.0.0.1". Requests from other addresses are rejected with 403 (Forbidden).
+// New returns an error if any of the ranges is invalid.
+func WithAllowedClients(cidrs ...string) Option {
+	return func(s *Server) {
+		s.allowedClientRanges = append(s.allowedClientRanges, cidrs...)
+	}
+}
+
+// parseAllowedClients parses the allowed client ranges.
+func parseAllowedClients(cidrs []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		p, err := parseClientRange(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed client %q: %w", cidr, err)
+		}
+		prefixes = append(prefixes, p)
+	}
+	return prefixes, nil
+}
+
+// parseClientRange parses the CIDR range. A single address is treated as a range of one address.
+func parseClientRange(cidr string) (netip.Prefix, error) {
+	if !strings.Contains(cidr, "/") {
+		addr, err := netip.ParseAddr(cidr)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	p, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return p.Masked(), nil
+}
+
+func (s *Server) allowClients(next http.Handler) http.Handler {
+	if s.allowedClients == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.clientAllowed(r.RemoteAddr) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		s.handlerLogger.DebugContext(r.Context(), "request from not allowed client is rejected",
+			slog.String("path", r.URL.Path), slog.String("remoteAddr", r.RemoteAddr))
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	})
+}
+
+func (s *Server) clientAllowed(remoteAddr string) bool {
+	addr, ok := clientAddr(remoteAddr)
+	if !ok {
+		return false
+	}
+	for _, p := range s.allowedClients {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientAddr returns the IP address of the client from the request's remote address.
+func clientAddr(remoteAddr string) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
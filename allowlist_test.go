@@ -0,0 +1,39 @@
+package metadataserver_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestAllowedClients(t *testing.T) {
+	s, err := metadataserver.New(metadataserver.WithAllowedClients("10.0.0.0/8", "192.168.1.1", "fd00::/8"))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	tests := []struct {
+		ip   string
+		want int
+	}{
+		{"10.1.2.3", http.StatusOK},
+		{"192.168.1.1", http.StatusOK},
+		{"192.168.1.2", http.StatusForbidden},
+		{"[fd00::1]", http.StatusOK},
+		{"[::1]", http.StatusForbidden},
+		{"127.0.0.1", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.ip, func(t *testing.T) {
+			if rec := serveFrom(s, test.ip, "project/project-id"); rec.Code != test.want {
+				t.Errorf("expected status %d, got: %d", test.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestAllowedClientsInvalid(t *testing.T) {
+	if _, err := metadataserver.New(metadataserver.WithAllowedClients("10.0.0.0/33")); err == nil {
+		t.Errorf("expected error for invalid range")
+	}
+}
@@ -0,0 +1,72 @@
+package metadataserver
+
+import (
+	"strconv"
+	"time"
+)
+
+// auditSize is the maximum number of records kept in the audit log.
+const auditSize = 1000
+
+// AuditSourceAPI is the source of changes that are made by calling the server's methods.
+const AuditSourceAPI = "api"
+
+// AuditSourceGuest is the source of the guest attributes that the clients write to the metadata server.
+const AuditSourceGuest = "guest"
+
+// Actions that are recorded in the audit log in addition to the scenario step actions.
+const (
+	// ActionDisable disables serving the metadata at the path. See [Server.DisablePath].
+	ActionDisable = "disable"
+	// ActionEnable enables serving the metadata at the path. See [Server.EnablePath].
+	ActionEnable = "enable"
+	// ActionPause pauses serving metadata. See [Server.Pause].
+	ActionPause = "pause"
+	// ActionResume resumes serving metadata. See [Server.Resume].
+	ActionResume = "resume"
+	// ActionFailToken makes the token endpoints to fail. See [Server.FailTokenEndpoint].
+	ActionFailToken = "fail-token"
+)
+
+// AuditRecord describes a change that was made to the server at runtime.
+// The source is the remote address of the admin API client, "scenario:" followed by the scenario name,
+// [AuditSourceAPI] for calls of the server's methods or [AuditSourceGuest] for the written guest attributes.
+type AuditRecord struct {
+	Time     time.Time `json:"time"`
+	Source   string    `json:"source"`
+	Action   string    `json:"action"`
+	Path     string    `json:"path,omitempty"`
+	OldValue string    `json:"oldValue,omitempty"`
+	Value    string    `json:"value,omitempty"`
+}
+
+// AuditLog returns the most recent changes made to the server starting from the oldest one.
+// Unlike the request history, the audit log is not cleared by [Server.Reset].
+func (s *Server) AuditLog() []AuditRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	log := make([]AuditRecord, 0, len(s.audit))
+	log = append(log, s.audit[s.auditNext:]...)
+	return append(log, s.audit[:s.auditNext]...)
+}
+
+// auditLocked adds the record to the audit log.
+// The caller must hold s.mu.
+func (s *Server) auditLocked(source, action, path, oldValue, value string) {
+	record := AuditRecord{Time: s.now(), Source: source, Action: action, Path: path, OldValue: oldValue, Value: value}
+	if len(s.audit) == auditSize {
+		// overwrite the oldest record
+		s.audit[s.auditNext] = record
+		s.auditNext = (s.auditNext + 1) % auditSize
+		return
+	}
+	s.audit = append(s.audit, record)
+}
+
+// statusText returns the status code as audit value. Status 0 means that the forced status is removed.
+func statusText(status int) string {
+	if status == 0 {
+		return ""
+	}
+	return strconv.Itoa(status)
+}
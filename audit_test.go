@@ -0,0 +1,130 @@
+package metadataserver_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/minherz/metadataserver"
+)
+
+func TestAuditLog(t *testing.T) {
+	s, err := metadataserver.New()
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	admin := httptest.NewServer(s.AdminHttpHandler())
+	defer admin.Close()
+
+	s.SetValue("instance/attributes/my-flag", "on")
+	adminRequest(t, http.MethodPut, admin.URL+"/values/instance/attributes/my-flag", "off")
+	adminRequest(t, http.MethodPost, admin.URL+"/disable/instance/zone", "")
+	s.SetStatus("instance/hostname", http.StatusServiceUnavailable)
+	s.SetStatus("instance/hostname", 0)
+	s.Resume()
+	s.Pause()
+	adminRequest(t, http.MethodPost, admin.URL+"/resume", "")
+	adminRequest(t, http.MethodPost, admin.URL+"/reset", "")
+	s.DeleteValue("instance/attributes/my-flag")
+
+	var got []metadataserver.AuditRecord
+	if err := json.Unmarshal([]byte(adminRequest(t, http.MethodGet, admin.URL+"/audit", "")), &got); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	for i, r := range got {
+		if r.Time.IsZero() {
+			t.Errorf("expected record %d to have time", i)
+		}
+		if r.Source != metadataserver.AuditSourceAPI && !strings.HasPrefix(r.Source, "127.0.0.1:") {
+			t.Errorf("unexpected source of record %d: %q", i, r.Source)
+		}
+	}
+	want := []metadataserver.AuditRecord{
+		{Source: metadataserver.AuditSourceAPI, Action: metadataserver.ActionSet, Path: "instance/attributes/my-flag", Value: "on"},
+		{Action: metadataserver.ActionSet, Path: "instance/attributes/my-flag", OldValue: "on", Value: "off"},
+		{Action: metadataserver.ActionDisable, Path: "instance/zone"},
+		{Source: metadataserver.AuditSourceAPI, Action: metadataserver.ActionStatus, Path: "instance/hostname", Value: "503"},
+		{Source: metadataserver.AuditSourceAPI, Action: metadataserver.ActionStatus, Path: "instance/hostname", OldValue: "503"},
+		{Source: metadataserver.AuditSourceAPI, Action: metadataserver.ActionPause},
+		{Action: metadataserver.ActionResume},
+		{Action: metadataserver.ActionReset},
+	}
+	ignoreAdminSource := cmp.FilterValues(func(x, y string) bool {
+		return strings.HasPrefix(x, "127.0.0.1:") || strings.HasPrefix(y, "127.0.0.1:")
+	}, cmp.Ignore())
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(metadataserver.AuditRecord{}, "Time"), ignoreAdminSource); diff != "" {
+		t.Errorf("audit log mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(got, s.AuditLog(), cmpopts.EquateApproxTime(0)); diff != "" {
+		t.Errorf("AuditLog() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRecordsUseServerClock(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s, err := metadataserver.New(metadataserver.WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	ch := s.Subscribe("")
+	s.SetValue("instance/attributes/my-flag", "on")
+	s.HttpHandler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/instance/attributes/my-flag", nil))
+	s.Reset()
+	s.Unsubscribe(ch)
+
+	var times []time.Time
+	for e := range ch {
+		times = append(times, e.Time)
+	}
+	for _, r := range s.AuditLog() {
+		times = append(times, r.Time)
+	}
+	if len(s.History()) != 0 {
+		t.Errorf("expected no history after reset, got: %v", s.History())
+	}
+	s.HttpHandler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/instance/id", nil))
+	for _, r := range s.History() {
+		times = append(times, r.Time)
+	}
+	// 2 change events, 2 audit records and 1 request
+	if len(times) != 5 {
+		t.Fatalf("expected 5 records, got: %d", len(times))
+	}
+	for i, got := range times {
+		if !got.Equal(now) {
+			t.Errorf("record %d: expected time %v of the server clock, got: %v", i, now, got)
+		}
+	}
+}
+
+func TestAuditLogScenario(t *testing.T) {
+	s, err := metadataserver.New(metadataserver.WithScenario(&metadataserver.Scenario{
+		Name: "maintenance",
+		Steps: []metadataserver.ScenarioStep{
+			{Action: metadataserver.ActionSet, Path: "instance/maintenance-event", Value: "MIGRATE_ON_HOST_MAINTENANCE"},
+		},
+	}), metadataserver.WithAddress("127.0.0.1"), metadataserver.WithPort(freePort()))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	defer s.Stop(context.Background())
+
+	for i := 0; i < 100 && len(s.AuditLog()) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	want := []metadataserver.AuditRecord{
+		{Source: "scenario:maintenance", Action: metadataserver.ActionSet, Path: "instance/maintenance-event", Value: "MIGRATE_ON_HOST_MAINTENANCE"},
+	}
+	if diff := cmp.Diff(want, s.AuditLog(), cmpopts.IgnoreFields(metadataserver.AuditRecord{}, "Time")); diff != "" {
+		t.Errorf("audit log mismatch (-want +got):\n%s", diff)
+	}
+}
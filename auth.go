@@ -0,0 +1,55 @@
+package metadataserver
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+)
+
+// WithMetadataToken sets a new server to require the token to read metadata.
+// Requests must provide the token in the "Authorization: Bearer <token>" header.
+// Health checks are served without the token.
+func WithMetadataToken(token string) Option {
+	return func(s *Server) {
+		s.metadataToken = token
+	}
+}
+
+// WithMetadataBasicAuth sets a new server to require HTTP Basic authentication with the credentials to read metadata.
+// Health checks are served without the credentials.
+func WithMetadataBasicAuth(user, password string) Option {
+	return func(s *Server) {
+		s.metadataUser = user
+		s.metadataPassword = password
+	}
+}
+
+func (s *Server) requireMetadataAuth(next http.Handler) http.Handler {
+	if s.metadataToken == "" && s.metadataUser == "" {
+		return next
+	}
+	wantToken := []byte("Bearer " + s.metadataToken)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.metadataToken != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), wantToken) == 1 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if s.metadataUser != "" {
+			user, password, ok := r.BasicAuth()
+			if ok && subtle.ConstantTimeCompare([]byte(user), []byte(s.metadataUser)) == 1 &&
+				subtle.ConstantTimeCompare([]byte(password), []byte(s.metadataPassword)) == 1 {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		s.handlerLogger.DebugContext(r.Context(), "metadata request is unauthorized",
+			slog.String("path", r.URL.Path), slog.String("remoteAddr", r.RemoteAddr))
+		if s.metadataToken != "" {
+			w.Header().Add("WWW-Authenticate", `Bearer realm="metadataserver"`)
+		}
+		if s.metadataUser != "" {
+			w.Header().Add("WWW-Authenticate", `Basic realm="metadataserver"`)
+		}
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	})
+}
@@ -0,0 +1,45 @@
+package metadataserver_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestMetadataAuth(t *testing.T) {
+	s, err := metadataserver.New(
+		metadataserver.WithMetadataToken("secret"),
+		metadataserver.WithMetadataBasicAuth("user", "password"))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	tests := []struct {
+		name  string
+		setup func(r *http.Request)
+		path  string
+		want  int
+	}{
+		{"no credentials", func(r *http.Request) {}, metadataserver.DefaultEndpoint + "/project/project-id", http.StatusUnauthorized},
+		{"valid token", func(r *http.Request) { r.Header.Set("Authorization", "Bearer secret") }, metadataserver.DefaultEndpoint + "/project/project-id", http.StatusOK},
+		{"invalid token", func(r *http.Request) { r.Header.Set("Authorization", "Bearer other") }, metadataserver.DefaultEndpoint + "/project/project-id", http.StatusUnauthorized},
+		{"valid basic", func(r *http.Request) { r.SetBasicAuth("user", "password") }, metadataserver.DefaultEndpoint + "/project/project-id", http.StatusOK},
+		{"invalid basic", func(r *http.Request) { r.SetBasicAuth("user", "other") }, metadataserver.DefaultEndpoint + "/project/project-id", http.StatusUnauthorized},
+		{"health check", func(r *http.Request) {}, metadataserver.HealthPath, http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, test.path, nil)
+			test.setup(r)
+			rec := httptest.NewRecorder()
+			s.HttpHandler().ServeHTTP(rec, r)
+			if rec.Code != test.want {
+				t.Errorf("expected status %d, got: %d", test.want, rec.Code)
+			}
+			if test.want == http.StatusUnauthorized && len(rec.Header().Values("WWW-Authenticate")) != 2 {
+				t.Errorf("expected WWW-Authenticate headers, got: %v", rec.Header())
+			}
+		})
+	}
+}
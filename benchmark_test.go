@@ -0,0 +1,48 @@
+package metadataserver_test
+
+import (
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+// The allocation budget of the request path that these benchmarks measure is documented in README.md
+// and enforced by TestAllocationBudget.
+
+func BenchmarkEnvHandler(b *testing.B) {
+	b.Setenv("two", "two")
+	c, err := metadataserver.NewConfigFromFile("test/fixtures/config_literal_handlers.json")
+	if err != nil {
+		b.Fatalf("expected no errors, got: %v", err)
+	}
+	s, err := metadataserver.New(metadataserver.WithConfiguration(c))
+	if err != nil {
+		b.Fatalf("expected no errors, got: %v", err)
+	}
+	benchmarkHandler(b, s, "/entry2")
+}
+
+func BenchmarkRecursiveJSON(b *testing.B) {
+	s, err := metadataserver.New(metadataserver.WithHandlers(map[string]metadataserver.Metadata{
+		"instance/id":                        func() string { return "1234567890" },
+		"instance/zone":                      func() string { return "projects/123/zones/us-central1-a" },
+		"instance/attributes/enable-oslogin": func() string { return "TRUE" },
+		"instance/network-interfaces/0/ip":   func() string { return "10.128.0.2" },
+	}))
+	if err != nil {
+		b.Fatalf("expected no errors, got: %v", err)
+	}
+	benchmarkHandler(b, s, "/instance/?recursive=true")
+}
+
+func BenchmarkTokenHandler(b *testing.B) {
+	s, err := metadataserver.New(metadataserver.WithHandlers(map[string]metadataserver.Metadata{
+		"instance/service-accounts/default/token": func() string {
+			return `{"access_token":"ya29.token","expires_in":3599,"token_type":"Bearer"}`
+		},
+	}))
+	if err != nil {
+		b.Fatalf("expected no errors, got: %v", err)
+	}
+	benchmarkHandler(b, s, "/instance/service-accounts/default/token")
+}
@@ -0,0 +1,57 @@
+package metadataserver
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+var (
+	// ErrBindFailed indicates that the server cannot listen on the address for any reason. The error is [BindError].
+	ErrBindFailed error = errors.New("failed to listen")
+	// ErrPortInUse indicates that the server cannot listen on the address because another process uses it.
+	ErrPortInUse error = errors.New("address is already in use")
+	// ErrPermissionDenied indicates that the server is not allowed to listen on the address, e.g. on a privileged port.
+	ErrPermissionDenied error = errors.New("permission denied")
+)
+
+// BindError describes the failure to listen on the address of the server, the admin API, the DNS stub or a profile.
+// Use [errors.Is] with [ErrPortInUse] or [ErrPermissionDenied] to check the reason, e.g. to fall back to another port:
+//
+//	var bindErr *metadataserver.BindError
+//	if errors.As(err, &bindErr) && errors.Is(err, metadataserver.ErrPortInUse) {
+//		log.Printf("%s is busy", bindErr.Addr)
+//	}
+type BindError struct {
+	// Network is "tcp" or "udp".
+	Network string
+	// Addr is the address that the server failed to listen on.
+	Addr string
+	// Err is the error of the listener.
+	Err error
+}
+
+func (e *BindError) Error() string {
+	return fmt.Sprintf("failed to listen on %s %s: %v", e.Network, e.Addr, e.Err)
+}
+
+// Unwrap returns [ErrBindFailed], the reason of the failure, [ErrPortInUse] or [ErrPermissionDenied], if it is known
+// and the error of the listener.
+func (e *BindError) Unwrap() []error {
+	switch {
+	case errors.Is(e.Err, syscall.EADDRINUSE):
+		return []error{ErrBindFailed, ErrPortInUse, e.Err}
+	case errors.Is(e.Err, os.ErrPermission):
+		return []error{ErrBindFailed, ErrPermissionDenied, e.Err}
+	}
+	return []error{ErrBindFailed, e.Err}
+}
+
+// bindError returns [BindError] of the failure to listen on the address or nil if err is nil.
+func bindError(network, addr string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &BindError{Network: network, Addr: addr, Err: err}
+}
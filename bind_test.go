@@ -0,0 +1,108 @@
+package metadataserver_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestBindErrors(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	defer l.Close()
+	busy := l.Addr().(*net.TCPAddr).Port
+	tests := []struct {
+		name    string
+		options []metadataserver.Option
+		addr    string
+	}{
+		{
+			name:    "server",
+			options: []metadataserver.Option{metadataserver.WithPort(busy)},
+			addr:    l.Addr().String(),
+		},
+		{
+			name:    "admin",
+			options: []metadataserver.Option{metadataserver.WithPort(freePort()), metadataserver.WithAdminPort(busy)},
+			addr:    l.Addr().String(),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := metadataserver.New(append(test.options, metadataserver.WithAddress("127.0.0.1"))...)
+			if err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			err = s.Start(context.Background())
+			if err == nil {
+				s.Stop(context.Background())
+				t.Fatal("expected error, got nil")
+			}
+			if !errors.Is(err, metadataserver.ErrPortInUse) {
+				t.Errorf("expected ErrPortInUse, got: %v", err)
+			}
+			if errors.Is(err, metadataserver.ErrPermissionDenied) {
+				t.Errorf("expected not ErrPermissionDenied, got: %v", err)
+			}
+			var bindErr *metadataserver.BindError
+			if !errors.As(err, &bindErr) || bindErr.Addr != test.addr || bindErr.Network != "tcp" {
+				t.Errorf("expected BindError of tcp %s, got: %#v", test.addr, bindErr)
+			}
+		})
+	}
+}
+
+func TestBindPermissionDenied(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("privileged ports are available")
+	}
+	s, err := metadataserver.New(metadataserver.WithAddress("127.0.0.1"), metadataserver.WithPort(1))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	err = s.Start(context.Background())
+	if err == nil {
+		s.Stop(context.Background())
+		t.Skip("privileged ports are available")
+	}
+	if !errors.Is(err, metadataserver.ErrPermissionDenied) {
+		t.Errorf("expected ErrPermissionDenied, got: %v", err)
+	}
+}
+
+func TestBindErrorReason(t *testing.T) {
+	tests := []struct {
+		err  error
+		want error
+	}{
+		{syscall.EADDRINUSE, metadataserver.ErrPortInUse},
+		{syscall.EACCES, metadataserver.ErrPermissionDenied},
+		{syscall.EPERM, metadataserver.ErrPermissionDenied},
+	}
+	for _, test := range tests {
+		t.Run(test.err.Error(), func(t *testing.T) {
+			err := error(&metadataserver.BindError{
+				Network: "tcp",
+				Addr:    "169.254.169.254:80",
+				Err:     &net.OpError{Op: "listen", Net: "tcp", Err: &os.SyscallError{Syscall: "bind", Err: test.err}},
+			})
+			if !errors.Is(err, test.want) {
+				t.Errorf("expected %v, got: %v", test.want, err)
+			}
+			if !errors.Is(err, test.err) {
+				t.Errorf("expected %v, got: %v", test.err, err)
+			}
+			if !errors.Is(err, metadataserver.ErrBindFailed) {
+				t.Errorf("expected %v, got: %v", metadataserver.ErrBindFailed, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package metadataserver
+
+import (
+	"path"
+	"strings"
+	"time"
+)
+
+// WithBootDelay sets a new server to respond with 404 (Not Found) at the paths until the delay passes since the server starts,
+// emulating the metadata of a freshly booted VM that becomes available with a delay, e.g. guest attributes or network configuration.
+// Use it to validate the retry logic of the clients that read metadata at startup.
+// Paths are relative to the server's endpoint and can use patterns supported by [path.Match].
+// A path also delays the metadata under it. If no paths are defined the delay applies to all metadata.
+// Set several delays to emulate the boot sequence, e.g. the network configuration after 2s and guest attributes after 10s.
+// The delays are counted by the server's clock (see [WithClock]) from [Server.Start] or from [New] if the server is not started,
+// e.g. when its handler is used with [httptest.NewServer]. The delayed metadata is hidden from directory listings too.
+func WithBootDelay(delay time.Duration, paths ...string) Option {
+	return func(s *Server) {
+		s.bootDelays = append(s.bootDelays, bootDelay{delay: delay, paths: paths})
+	}
+}
+
+type bootDelay struct {
+	delay time.Duration
+	paths []string
+}
+
+// matches reports whether the delay applies to the metadata at the key or to one of its parent directories.
+func (bd bootDelay) matches(key string) bool {
+	if len(bd.paths) == 0 {
+		return true
+	}
+	for _, p := range bd.paths {
+		p = normalizeKey(p)
+		for k := key; ; {
+			if ok, _ := path.Match(p, k); ok {
+				return true
+			}
+			i := strings.LastIndexByte(k, '/')
+			if i < 0 {
+				break
+			}
+			k = k[:i]
+		}
+	}
+	return false
+}
+
+// booting reports whether the metadata at the key is not available yet because of the boot delay.
+func (s *Server) booting(key string) bool {
+	if len(s.bootDelays) == 0 {
+		return false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.bootingLocked(key)
+}
+
+// bootingLocked is like booting but expects the caller to hold s.mu.
+func (s *Server) bootingLocked(key string) bool {
+	if len(s.bootDelays) == 0 {
+		return false
+	}
+	elapsed := s.now().Sub(s.bootTime)
+	for _, bd := range s.bootDelays {
+		if elapsed < bd.delay && bd.matches(key) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package metadataserver_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestBootDelay(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s, err := metadataserver.New(
+		metadataserver.WithClock(func() time.Time { return now }),
+		metadataserver.WithHandlers(map[string]metadataserver.Metadata{
+			"instance/zone":                        func() string { return "us-central1-a" },
+			"instance/network-interfaces/0/ip":     func() string { return "10.0.0.2" },
+			"instance/guest-attributes/agent/name": func() string { return "agent" },
+		}),
+		metadataserver.WithBootDelay(2*time.Second, "instance/network-interfaces"),
+		metadataserver.WithBootDelay(10*time.Second, "instance/guest-attributes/*"),
+	)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	get := func(path string) (int, string) {
+		rec := httptest.NewRecorder()
+		s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+path, nil))
+		body, _ := io.ReadAll(rec.Body)
+		return rec.Code, string(body)
+	}
+	tests := []struct {
+		name       string
+		elapsed    time.Duration
+		path       string
+		wantStatus int
+		want       string
+	}{
+		{"not delayed", 0, "/instance/zone", http.StatusOK, "us-central1-a"},
+		{"network booting", time.Second, "/instance/network-interfaces/0/ip", http.StatusNotFound, ""},
+		{"listing while booting", time.Second, "/instance/", http.StatusOK, "zone\n"},
+		{"network ready", 2 * time.Second, "/instance/network-interfaces/0/ip", http.StatusOK, "10.0.0.2"},
+		{"guest attributes booting", 5 * time.Second, "/instance/guest-attributes/agent/name", http.StatusNotFound, ""},
+		{"listing after network", 5 * time.Second, "/instance/", http.StatusOK, "network-interfaces/\nzone\n"},
+		{"guest attributes ready", 10 * time.Second, "/instance/guest-attributes/agent/name", http.StatusOK, "agent"},
+	}
+	start := now
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			now = start.Add(test.elapsed)
+			status, body := get(test.path)
+			if status != test.wantStatus {
+				t.Fatalf("expected status %d, got: %d", test.wantStatus, status)
+			}
+			if test.wantStatus == http.StatusOK && body != test.want {
+				t.Errorf("expected %q, got: %q", test.want, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package metadataserver
+
+import (
+	"sync"
+	"time"
+)
+
+// Cached returns a handler that caches the value returned by the handler for the ttl duration.
+// Concurrent calls that happen while the value is evaluated wait for the same evaluation
+// instead of calling the handler again.
+// Use zero ttl to only coalesce concurrent evaluations.
+func Cached(ttl time.Duration, h Metadata) Metadata {
+	c := &cachedMetadata{ttl: ttl, handler: h}
+	return c.get
+}
+
+type cachedMetadata struct {
+	ttl     time.Duration
+	handler Metadata
+
+	mu      sync.Mutex
+	value   string
+	expires time.Time
+	call    *metadataCall
+}
+
+// metadataCall describes in-flight evaluation of the handler.
+type metadataCall struct {
+	done  chan struct{}
+	value string
+}
+
+func (c *cachedMetadata) get() string {
+	c.mu.Lock()
+	if time.Now().Before(c.expires) {
+		v := c.value
+		c.mu.Unlock()
+		return v
+	}
+	if call := c.call; call != nil {
+		c.mu.Unlock()
+		<-call.done
+		return call.value
+	}
+	call := &metadataCall{done: make(chan struct{})}
+	c.call = call
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		c.call = nil
+		c.mu.Unlock()
+		close(call.done)
+	}()
+	call.value = c.handler()
+	c.mu.Lock()
+	c.value = call.value
+	c.expires = time.Now().Add(c.ttl)
+	c.mu.Unlock()
+	return call.value
+}
@@ -0,0 +1,64 @@
+package metadataserver_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestCached(t *testing.T) {
+	var calls atomic.Int32
+	h := metadataserver.Cached(time.Hour, func() string {
+		calls.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		return "value"
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got := h(); got != "value" {
+				t.Errorf("expected value %q, got: %q", "value", got)
+			}
+		}()
+	}
+	wg.Wait()
+	h()
+	if got := calls.Load(); got != 1 {
+		t.Errorf("expected 1 evaluation, got: %d", got)
+	}
+}
+
+func TestCachedExpiration(t *testing.T) {
+	var calls atomic.Int32
+	h := metadataserver.Cached(10*time.Millisecond, func() string {
+		calls.Add(1)
+		return "value"
+	})
+	h()
+	h()
+	time.Sleep(20 * time.Millisecond)
+	h()
+	if got := calls.Load(); got != 2 {
+		t.Errorf("expected 2 evaluations, got: %d", got)
+	}
+}
+
+func TestConfigTTL(t *testing.T) {
+	t.Setenv("two", "first")
+	c, err := metadataserver.NewConfigFromFile("test/fixtures/config_ttl_handlers.json")
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if got := c.Handlers["entry2"](); got != "first" {
+		t.Errorf("expected value %q, got: %q", "first", got)
+	}
+	t.Setenv("two", "second")
+	if got := c.Handlers["entry2"](); got != "first" {
+		t.Errorf("expected cached value %q, got: %q", "first", got)
+	}
+}
@@ -0,0 +1,81 @@
+package metadataserver
+
+import (
+	"net/http"
+	"time"
+)
+
+// CachePolicy describes the caching headers of the metadata responses at the paths.
+// Paths are relative to the server's endpoint and can use patterns supported by [path.Match].
+// If no paths are defined the policy applies to all metadata.
+type CachePolicy struct {
+	Paths []string
+	// CacheControl is the value of the Cache-Control header, e.g. "no-cache" or "max-age=60".
+	// The header is not set if it is empty.
+	CacheControl string
+	// Expires sets the Expires header to the time of the server's clock shifted by the duration.
+	// Negative duration marks responses as already expired. The header is not set if it is zero.
+	Expires time.Duration
+}
+
+// NoCachePolicy is the caching policy of the real metadata server: clients must revalidate the values before using them.
+var NoCachePolicy = CachePolicy{CacheControl: "no-cache"}
+
+type jsonCachePolicy struct {
+	Paths        []string `json:"paths,omitempty"`
+	CacheControl string   `json:"cacheControl,omitempty"`
+	Expires      string   `json:"expires,omitempty"`
+}
+
+// WithCachePolicy sets a new server to add the caching headers of the policy to metadata responses.
+// Policies with paths take precedence over policies without paths. Among them the first matching policy applies.
+// The caching headers override the same headers that are set with [WithResponseHeaders].
+//
+// Mind the order of options when use with [WithConfiguration] and [WithConfigFile].
+func WithCachePolicy(policy CachePolicy) Option {
+	return func(s *Server) {
+		if s.config == nil {
+			s.config = NewConfiguration(DefaultConfigurationHandlers)
+		}
+		s.config.CachePolicies = append(s.config.CachePolicies, policy)
+	}
+}
+
+// cachePolicy returns the policy that applies to the metadata at the key or nil if no policy applies.
+func (s *Server) cachePolicy(key string) *CachePolicy {
+	var global *CachePolicy
+	for i := range s.config.CachePolicies {
+		p := &s.config.CachePolicies[i]
+		if len(p.Paths) == 0 {
+			if global == nil {
+				global = p
+			}
+			continue
+		}
+		if (ResponseHeaders{Paths: p.Paths}).matches(key, true) {
+			return p
+		}
+	}
+	return global
+}
+
+// cacheHeaders adds the caching headers of the matching policy to the metadata responses.
+func (s *Server) cacheHeaders(next http.Handler) http.Handler {
+	if len(s.config.CachePolicies) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key, ok := s.keyOf(r.URL.Path); ok {
+			if p := s.cachePolicy(key); p != nil {
+				h := w.Header()
+				if p.CacheControl != "" {
+					h.Set("Cache-Control", p.CacheControl)
+				}
+				if p.Expires != 0 {
+					h.Set("Expires", s.now().Add(p.Expires).UTC().Format(http.TimeFormat))
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
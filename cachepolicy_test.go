@@ -0,0 +1,77 @@
+package metadataserver_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/minherz/metadataserver"
+)
+
+func TestCachePolicy(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	s, err := metadataserver.New(
+		metadataserver.WithHandlers(map[string]metadataserver.Metadata{
+			"project/project-id":                      func() string { return "test-project" },
+			"instance/service-accounts/default/token": func() string { return "token" },
+		}),
+		metadataserver.WithResponseHeaders(map[string]string{"Cache-Control": "private"}),
+		metadataserver.WithCachePolicy(metadataserver.NoCachePolicy),
+		metadataserver.WithCachePolicy(metadataserver.CachePolicy{
+			Paths:        []string{"instance/service-accounts/*/token"},
+			CacheControl: "max-age=60",
+			Expires:      time.Minute,
+		}),
+		metadataserver.WithClock(func() time.Time { return now }),
+	)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	tests := []struct {
+		path         string
+		cacheControl string
+		expires      string
+	}{
+		{
+			path:         metadataserver.DefaultEndpoint + "/project/project-id",
+			cacheControl: "no-cache",
+		},
+		{
+			path:         metadataserver.DefaultEndpoint + "/instance/service-accounts/default/token",
+			cacheControl: "max-age=60",
+			expires:      "Fri, 01 Mar 2024 12:01:00 GMT",
+		},
+		{
+			path:         "/other",
+			cacheControl: "private",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, test.path, nil))
+			if got := rec.Header().Get("Cache-Control"); got != test.cacheControl {
+				t.Errorf("expected Cache-Control %q, got: %q", test.cacheControl, got)
+			}
+			if got := rec.Header().Get("Expires"); got != test.expires {
+				t.Errorf("expected Expires %q, got: %q", test.expires, got)
+			}
+		})
+	}
+}
+
+func TestCachePolicyFromFile(t *testing.T) {
+	c, err := metadataserver.NewConfigFromFile("test/fixtures/config_cache.json")
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	want := []metadataserver.CachePolicy{
+		{CacheControl: "no-cache"},
+		{Paths: []string{"instance/service-accounts/*/token"}, CacheControl: "no-store", Expires: -time.Second},
+	}
+	if diff := cmp.Diff(want, c.CachePolicies); diff != "" {
+		t.Errorf("cache policies mismatch (-want +got):\n%s", diff)
+	}
+}
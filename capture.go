@@ -0,0 +1,99 @@
+package metadataserver
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"sync"
+	"time"
+)
+
+// Capture describes a request and a response that were captured on the wire.
+type Capture struct {
+	Time     time.Time `json:"time"`
+	Request  string    `json:"request"`
+	Response string    `json:"response"`
+}
+
+// WithCapture sets a new server to capture full requests and responses including headers and bodies.
+// The server keeps up to limit of the most recent captures that are returned by [Server.Captures].
+// If the writer is not nil, each capture is also written to it.
+func WithCapture(limit int, w io.Writer) Option {
+	return func(s *Server) {
+		s.capture = &captureBuffer{limit: limit, w: w}
+	}
+}
+
+type captureBuffer struct {
+	mu       sync.Mutex
+	limit    int
+	w        io.Writer
+	captures []Capture
+}
+
+// Captures returns the most recent captured requests and responses starting from the oldest one.
+// It returns nil if the capture is not enabled with [WithCapture].
+func (s *Server) Captures() []Capture {
+	if s.capture == nil {
+		return nil
+	}
+	s.capture.mu.Lock()
+	defer s.capture.mu.Unlock()
+	return append([]Capture(nil), s.capture.captures...)
+}
+
+func (b *captureBuffer) add(c Capture) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.limit > 0 {
+		if len(b.captures) == b.limit {
+			b.captures = b.captures[1:]
+		}
+		b.captures = append(b.captures, c)
+	}
+	if b.w == nil {
+		return nil
+	}
+	_, err := io.WriteString(b.w, c.Time.Format(time.RFC3339Nano)+"\n"+c.Request+"\n\n"+c.Response+"\n\n")
+	return err
+}
+
+func (b *captureBuffer) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.captures = nil
+}
+
+func (s *Server) captureTraffic(next http.Handler) http.Handler {
+	if s.capture == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		start := time.Now()
+		req, err := httputil.DumpRequest(r, true)
+		if err != nil {
+			s.logger.ErrorContext(ctx, "failed to capture request", slog.String("error", err.Error()))
+		}
+		rw := &statusRecorder{ResponseWriter: w, status: http.StatusOK, body: &bytes.Buffer{}}
+		next.ServeHTTP(rw, r)
+		res, err := httputil.DumpResponse(&http.Response{
+			Status:        http.StatusText(rw.status),
+			StatusCode:    rw.status,
+			Proto:         r.Proto,
+			ProtoMajor:    r.ProtoMajor,
+			ProtoMinor:    r.ProtoMinor,
+			Header:        w.Header(),
+			Body:          io.NopCloser(rw.body),
+			ContentLength: int64(rw.body.Len()),
+		}, true)
+		if err != nil {
+			s.logger.ErrorContext(ctx, "failed to capture response", slog.String("error", err.Error()))
+		}
+		if err := s.capture.add(Capture{Time: start, Request: string(req), Response: string(res)}); err != nil {
+			s.logger.ErrorContext(ctx, "failed to write capture", slog.String("error", err.Error()))
+		}
+	})
+}
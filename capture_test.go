@@ -0,0 +1,49 @@
+package metadataserver_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestCapture(t *testing.T) {
+	var buf bytes.Buffer
+	s, err := metadataserver.New(metadataserver.WithCapture(1, &buf))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	ts := httptest.NewServer(s.HttpHandler())
+	defer ts.Close()
+
+	for _, p := range []string{"/instance/zone", "/project/project-id"} {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+metadataserver.DefaultEndpoint+p, nil)
+		req.Header.Set("Metadata-Flavor", "Google")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("expected no errors, got: %v", err)
+		}
+		res.Body.Close()
+	}
+
+	got := s.Captures()
+	if len(got) != 1 {
+		t.Fatalf("expected 1 capture, got: %d", len(got))
+	}
+	for _, want := range []string{"GET /computeMetadata/v1/project/project-id HTTP/1.1", "Metadata-Flavor: Google"} {
+		if !strings.Contains(got[0].Request, want) {
+			t.Errorf("expected request capture to contain %q, got: %q", want, got[0].Request)
+		}
+	}
+	for _, want := range []string{"200 OK", "test-project-id"} {
+		if !strings.Contains(got[0].Response, want) {
+			t.Errorf("expected response capture to contain %q, got: %q", want, got[0].Response)
+		}
+	}
+	if !strings.Contains(buf.String(), "/instance/zone") || !strings.Contains(buf.String(), "404 Not Found") {
+		t.Errorf("expected all captures to be written, got: %q", buf.String())
+	}
+}
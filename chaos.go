@@ -0,0 +1,160 @@
+package metadataserver
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// Chaos defines the probabilities of faults that the server injects in responses.
+// Each probability is a number between 0 and 1. The faults are exclusive: at most one fault is injected per request,
+// so the sum of the probabilities must not exceed 1 either. Otherwise [New] returns [ConfigError].
+type Chaos struct {
+	// Reset is the probability to abort the connection with TCP reset instead of responding.
+	Reset float64
+	// Truncate is the probability to write only the headers and a half of the response body and to close the connection.
+	Truncate float64
+	// GarbleHeaders is the probability to write malformed response headers.
+	GarbleHeaders float64
+	// Seed makes the faults reproducible. The faults are random if it is 0.
+	Seed uint64
+}
+
+// WithChaos sets a new server to inject faults in responses with the probabilities of the chaos,
+// e.g. to validate resilience of low-level HTTP clients against misbehaving metadata endpoints.
+func WithChaos(c Chaos) Option {
+	return func(s *Server) {
+		s.chaos = &chaosInjector{Chaos: c}
+	}
+}
+
+// validate returns an error if the probabilities are not between 0 and 1 or their sum exceeds 1.
+func (c Chaos) validate() error {
+	for _, p := range []struct {
+		name  string
+		value float64
+	}{{"Reset", c.Reset}, {"Truncate", c.Truncate}, {"GarbleHeaders", c.GarbleHeaders}} {
+		if !(p.value >= 0 && p.value <= 1) {
+			return fmt.Errorf("chaos %s probability %v is not between 0 and 1", p.name, p.value)
+		}
+	}
+	// the tolerance allows sums like 0.1 + 0.2 + 0.7 that are not exact in floating point
+	if sum := c.Reset + c.Truncate + c.GarbleHeaders; sum > 1+1e-9 {
+		return fmt.Errorf("chaos probabilities sum up to %v that exceeds 1", sum)
+	}
+	return nil
+}
+
+// chaosFault identifies a fault that is injected in the response.
+type chaosFault int
+
+const (
+	faultNone chaosFault = iota
+	faultReset
+	faultTruncate
+	faultGarbleHeaders
+)
+
+// chaosInjector selects faults with the probabilities of the chaos.
+type chaosInjector struct {
+	Chaos
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+func (c *chaosInjector) fault() chaosFault {
+	c.mu.Lock()
+	if c.rnd == nil {
+		seed := c.Seed
+		if seed == 0 {
+			seed = rand.Uint64()
+		}
+		c.rnd = rand.New(rand.NewPCG(seed, seed))
+	}
+	p := c.rnd.Float64()
+	c.mu.Unlock()
+	switch {
+	case p < c.Reset:
+		return faultReset
+	case p < c.Reset+c.Truncate:
+		return faultTruncate
+	case p < c.Reset+c.Truncate+c.GarbleHeaders:
+		return faultGarbleHeaders
+	}
+	return faultNone
+}
+
+func (s *Server) injectChaos(next http.Handler) http.Handler {
+	if s.chaos == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fault := s.chaos.fault()
+		if fault == faultNone {
+			next.ServeHTTP(w, r)
+			return
+		}
+		var bw *responseBuffer
+		if fault != faultReset {
+			bw = newResponseBuffer()
+			next.ServeHTTP(bw, r)
+		}
+		conn, rw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			s.handlerLogger.DebugContext(r.Context(), "chaos fault is not injected", slog.String("error", err.Error()))
+			if bw != nil {
+				bw.copyTo(w)
+			} else {
+				next.ServeHTTP(w, r)
+			}
+			return
+		}
+		defer conn.Close()
+		switch fault {
+		case faultReset:
+			s.handlerLogger.DebugContext(r.Context(), "connection is reset by chaos", slog.String("path", r.URL.Path))
+			if tc, ok := conn.(*net.TCPConn); ok {
+				tc.SetLinger(0)
+			}
+		case faultTruncate:
+			s.handlerLogger.DebugContext(r.Context(), "response is truncated by chaos", slog.String("path", r.URL.Path))
+			body := bw.body.Bytes()
+			// the declared length is never written so the client sees the unexpected end of the response
+			bw.header.Set("Content-Length", strconv.Itoa(max(len(body), 1)))
+			writeRawHeader(rw.Writer, bw, false)
+			rw.Write(body[:len(body)/2])
+			rw.Flush()
+		case faultGarbleHeaders:
+			s.handlerLogger.DebugContext(r.Context(), "response headers are garbled by chaos", slog.String("path", r.URL.Path))
+			writeRawHeader(rw.Writer, bw, true)
+			rw.Write(bw.body.Bytes())
+			rw.Flush()
+		}
+	})
+}
+
+// writeRawHeader writes the status line and the headers of the buffered response.
+// The headers of the garbled response are written without the colon separators.
+func writeRawHeader(w *bufio.Writer, bw *responseBuffer, garbled bool) {
+	status := bw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	fmt.Fprintf(w, "HTTP/1.1 %d %s\r\n", status, http.StatusText(status))
+	sep := ": "
+	if garbled {
+		sep = " "
+		bw.header.Set("Metadata-Flavor", "Google")
+	}
+	for k, vs := range bw.header {
+		for _, v := range vs {
+			fmt.Fprintf(w, "%s%s%s\r\n", k, sep, v)
+		}
+	}
+	w.WriteString("Connection: close\r\n\r\n")
+}
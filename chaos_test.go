@@ -0,0 +1,83 @@
+package metadataserver_test
+
+import (
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestChaos(t *testing.T) {
+	tests := []struct {
+		name  string
+		chaos metadataserver.Chaos
+	}{
+		{"reset", metadataserver.Chaos{Reset: 1}},
+		{"truncate", metadataserver.Chaos{Truncate: 1}},
+		{"garble headers", metadataserver.Chaos{GarbleHeaders: 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := metadataserver.New(metadataserver.WithChaos(test.chaos))
+			if err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			server := httptest.NewServer(s.HttpHandler())
+			defer server.Close()
+			resp, err := http.Get(server.URL + metadataserver.DefaultEndpoint + "/project/project-id")
+			if err == nil {
+				_, err = io.ReadAll(resp.Body)
+				resp.Body.Close()
+			}
+			if err == nil {
+				t.Errorf("expected the client to fail")
+			}
+		})
+	}
+}
+
+func TestChaosSeed(t *testing.T) {
+	s, err := metadataserver.New(metadataserver.WithChaos(metadataserver.Chaos{Reset: 0.5, Seed: 42}))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	server := httptest.NewServer(s.HttpHandler())
+	defer server.Close()
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	failed := 0
+	for i := 0; i < 20; i++ {
+		resp, err := client.Get(server.URL + metadataserver.DefaultEndpoint + "/project/project-id")
+		if err != nil {
+			failed++
+			continue
+		}
+		resp.Body.Close()
+	}
+	if failed == 0 || failed == 20 {
+		t.Errorf("expected some of the requests to fail, got %d failures", failed)
+	}
+}
+
+func TestChaosInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		chaos   metadataserver.Chaos
+		wantErr bool
+	}{
+		{"negative", metadataserver.Chaos{Reset: -0.1}, true},
+		{"above one", metadataserver.Chaos{Truncate: 1.5}, true},
+		{"not a number", metadataserver.Chaos{GarbleHeaders: math.NaN()}, true},
+		{"sum above one", metadataserver.Chaos{Reset: 0.6, Truncate: 0.6}, true},
+		{"sum of one", metadataserver.Chaos{Reset: 0.1, Truncate: 0.2, GarbleHeaders: 0.7}, false},
+	}
+	for _, test := range tests {
+		_, err := metadataserver.New(metadataserver.WithChaos(test.chaos))
+		if got := errors.Is(err, metadataserver.ErrConfigInvalid); got != test.wantErr {
+			t.Errorf("%s: expected %v error: %v, got: %v", test.name, metadataserver.ErrConfigInvalid, test.wantErr, err)
+		}
+	}
+}
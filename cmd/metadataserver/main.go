@@ -0,0 +1,343 @@
+// Command metadataserver runs the metadata server simulator.
+//
+// Usage:
+//
+//	metadataserver [flags]
+//	metadataserver record [-url URL] [-o FILE]
+//	metadataserver validate FILE...
+//	metadataserver routes FILE
+//	metadataserver replay [-url URL] FILE
+//	metadataserver load [-url URL] [-c N] [-n N] [-d DURATION] [-max-p99 DURATION] [-max-error-rate RATE] PATH[=WEIGHT]...
+//	metadataserver version
+//
+// Without a command it serves metadata until it receives SIGINT or SIGTERM.
+// Run "metadataserver -h" to see the flags.
+//
+// The record command crawls a live metadata server and writes its metadata as a configuration file
+// that can be loaded with the --config flag.
+//
+// The validate command prints all problems of the configuration files and fails if any of them is invalid.
+//
+// The routes command prints the metadata paths of the configuration file and the sources of their values.
+//
+// The replay command re-sends the requests recorded in the HAR or capture file to the metadata server
+// and prints the responses that differ from the recorded ones.
+//
+// The load command sends the mix of requests at the metadata paths with the relative weights to the metadata server,
+// prints latency percentiles and error rates and fails if the p99 latency or the error rate exceed the limits.
+//
+// The version command prints the version of the metadata server.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/minherz/metadataserver"
+	"github.com/minherz/metadataserver/metadataserverload"
+)
+
+const (
+	defaultRecordURL = "http://metadata.google.internal" + metadataserver.DefaultEndpoint
+	defaultReplayURL = "http://" + metadataserver.DefaultAddress
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := run(ctx, os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "record":
+			return record(ctx, args[1:], stdout)
+		case "validate":
+			return validate(args[1:], stdout)
+		case "routes":
+			return routes(args[1:], stdout)
+		case "replay":
+			return replay(ctx, args[1:], stdout)
+		case "load":
+			return load(ctx, args[1:], stdout)
+		case "version":
+			fmt.Fprintln(stdout, metadataserver.Version())
+			return nil
+		}
+	}
+	return serve(ctx, args, stderr)
+}
+
+func serve(ctx context.Context, args []string, stderr io.Writer) error {
+	fs := flag.NewFlagSet("metadataserver", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configFile := fs.String("config", "", "JSON configuration file")
+	address := fs.String("address", metadataserver.DefaultAddress, "IP address to serve metadata at")
+	port := fs.Int("port", metadataserver.DefaultPort, "port to serve metadata at")
+	endpoint := fs.String("endpoint", metadataserver.DefaultEndpoint, "path of the metadata endpoint")
+	adminPort := fs.Int("admin-port", 0, "port to serve the admin API at; the admin API is disabled if 0")
+	dualStack := fs.Bool("dual-stack", false, "serve metadata over IPv4 and IPv6 at a loopback or unspecified address")
+	trafficDump := fs.String("traffic-dump", "", "file to write the served requests to when the server stops, as HAR if the file has the .har extension or as JSON")
+	watch := fs.Bool("watch", false, "reload metadata when the configuration file changes, including ConfigMap updates in Kubernetes")
+	preflight := fs.Bool("preflight", false, "fail to start if environment variables or files that metadata reads are missing")
+	rootListing := fs.Bool("root-listing", false, "list the directories above the endpoint at \"/\" like the real metadata server lists API versions")
+	provider := fs.String("provider", "", fmt.Sprintf("preset metadata of the provider, one of %v", providerNames()))
+	var level slog.Level
+	fs.TextVar(&level, "log-level", slog.LevelInfo, "minimal level of log records: DEBUG, INFO, WARN or ERROR")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unknown command %q", fs.Arg(0))
+	}
+
+	logger := slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: level}))
+	opts := []metadataserver.Option{metadataserver.WithLogger(logger), metadataserver.WithLogLevel(level)}
+	if *configFile != "" && *provider != "" {
+		return errors.New("--config and --provider cannot be used together")
+	}
+	if *watch && *configFile == "" {
+		return errors.New("--watch requires --config")
+	}
+	if *configFile != "" {
+		c, err := metadataserver.NewConfigFromFile(*configFile)
+		if err != nil {
+			return fmt.Errorf("failed to load config from file %q: %w", *configFile, err)
+		}
+		if *watch {
+			opts = append(opts, metadataserver.WithConfigWatch(*configFile, 0))
+		} else {
+			opts = append(opts, metadataserver.WithConfiguration(c))
+		}
+	}
+	if *provider != "" {
+		handlers, ok := providers[*provider]
+		if !ok {
+			return fmt.Errorf("unknown provider %q, use one of %v", *provider, providerNames())
+		}
+		opts = append(opts, metadataserver.WithHandlers(handlers))
+	}
+	// flags that are set explicitly override values from the configuration file
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "address":
+			opts = append(opts, metadataserver.WithAddress(*address))
+		case "port":
+			opts = append(opts, metadataserver.WithPort(*port))
+		case "endpoint":
+			opts = append(opts, metadataserver.WithEndpoint(*endpoint))
+		case "admin-port":
+			opts = append(opts, metadataserver.WithAdminPort(*adminPort))
+		}
+	})
+
+	if *dualStack {
+		opts = append(opts, metadataserver.WithDualStack())
+	}
+	if *trafficDump != "" {
+		opts = append(opts, metadataserver.WithCapture(1000, nil), metadataserver.WithTrafficDump(*trafficDump))
+	}
+	if *preflight {
+		opts = append(opts, metadataserver.WithPreflight())
+	}
+	if *rootListing {
+		opts = append(opts, metadataserver.WithRootListing())
+	}
+	s, err := metadataserver.New(opts...)
+	if err != nil {
+		return err
+	}
+	if err := s.Start(ctx); err != nil {
+		return err
+	}
+	c := s.Configuration()
+	logger.InfoContext(ctx, "metadata server is running", slog.String("address", c.Address), slog.Int("port", c.Port))
+	<-ctx.Done()
+	logger.InfoContext(ctx, "metadata server is stopping")
+	return s.Stop(context.Background())
+}
+
+func record(ctx context.Context, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("record", flag.ContinueOnError)
+	endpoint := fs.String("url", defaultRecordURL, "URL of the metadata endpoint to record")
+	output := fs.String("o", "", "file to write the configuration to; standard output is used if empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	rec := &metadataserver.Recorder{}
+	if *output == "" {
+		return rec.Record(ctx, *endpoint, stdout)
+	}
+	return writeFile(*output, func(w io.Writer) error {
+		return rec.Record(ctx, *endpoint, w)
+	})
+}
+
+// writeFile writes the file through a temporary file in the same directory that replaces the file when write succeeds,
+// so the file is not left partially written if the write fails.
+func writeFile(name string, write func(w io.Writer) error) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	if err := write(f); err != nil {
+		return err
+	}
+	if err := f.Chmod(0o644); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+func validate(files []string, stdout io.Writer) error {
+	if len(files) == 0 {
+		return errors.New("usage: metadataserver validate FILE...")
+	}
+	invalid := 0
+	for _, name := range files {
+		errs := metadataserver.ValidateConfigFile(name)
+		for _, err := range errs {
+			fmt.Fprintf(stdout, "%s: %v\n", name, err)
+		}
+		if len(errs) > 0 {
+			invalid++
+		}
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%d of %d configuration files are invalid", invalid, len(files))
+	}
+	return nil
+}
+
+func routes(args []string, stdout io.Writer) error {
+	if len(args) != 1 {
+		return errors.New("usage: metadataserver routes FILE")
+	}
+	c, err := metadataserver.NewConfigFromFile(args[0])
+	if err != nil {
+		return err
+	}
+	s, err := metadataserver.New(metadataserver.WithConfiguration(c))
+	if err != nil {
+		return err
+	}
+	endpoint := strings.TrimSuffix(s.Configuration().Endpoint, "/")
+	routes := s.Routes()
+	profiles := slices.ContainsFunc(routes, func(r metadataserver.RouteInfo) bool { return r.Profile != "" })
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	if profiles {
+		fmt.Fprintln(tw, "PATH\tSOURCE\tPROFILE")
+	} else {
+		fmt.Fprintln(tw, "PATH\tSOURCE")
+	}
+	for _, r := range routes {
+		if profiles {
+			fmt.Fprintf(tw, "%s/%s\t%s\t%s\n", endpoint, r.Path, r.Source, r.Profile)
+		} else {
+			fmt.Fprintf(tw, "%s/%s\t%s\n", endpoint, r.Path, r.Source)
+		}
+	}
+	return tw.Flush()
+}
+
+func replay(ctx context.Context, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	baseURL := fs.String("url", defaultReplayURL, "URL of the metadata server to send the requests to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: metadataserver replay [-url URL] FILE")
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var exchanges []metadataserver.Exchange
+	if strings.HasSuffix(f.Name(), ".har") {
+		exchanges, err = metadataserver.ParseHAR(f)
+	} else {
+		exchanges, err = metadataserver.ParseCaptures(f)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read requests from %q: %w", f.Name(), err)
+	}
+	rs := &metadataserver.Resender{}
+	diffs, err := rs.Resend(ctx, *baseURL, exchanges)
+	if err != nil {
+		return err
+	}
+	for _, d := range diffs {
+		fmt.Fprintln(stdout, d)
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("%d of %d responses differ", len(diffs), len(exchanges))
+	}
+	return nil
+}
+
+func load(ctx context.Context, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("load", flag.ContinueOnError)
+	baseURL := fs.String("url", defaultReplayURL, "URL of the metadata server to send the requests to")
+	concurrency := fs.Int("c", 1, "number of requests that are sent in parallel")
+	requests := fs.Int("n", 0, "number of requests to send")
+	duration := fs.Duration("d", 0, "time to send requests for")
+	maxP99 := fs.Duration("max-p99", 0, "fail if the p99 latency exceeds the duration; zero disables the check")
+	maxErrorRate := fs.Float64("max-error-rate", 0, "fail if the share of failed requests exceeds the rate")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("usage: metadataserver load [-url URL] [-c N] [-n N] [-d DURATION] [-max-p99 DURATION] [-max-error-rate RATE] PATH[=WEIGHT]...")
+	}
+	runner := &metadataserverload.Runner{Concurrency: *concurrency, Requests: *requests, Duration: *duration}
+	for _, arg := range fs.Args() {
+		r := metadataserverload.Request{Path: arg}
+		if i := strings.LastIndex(arg, "="); i > 0 {
+			if w, err := strconv.Atoi(arg[i+1:]); err == nil {
+				r.Path, r.Weight = arg[:i], w
+			}
+		}
+		runner.Mix = append(runner.Mix, r)
+	}
+	report, err := runner.Run(ctx, *baseURL)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, report)
+	if *maxP99 > 0 && report.P99 > *maxP99 {
+		return fmt.Errorf("p99 latency %s exceeds %s", report.P99, *maxP99)
+	}
+	if report.ErrorRate() > *maxErrorRate {
+		return fmt.Errorf("error rate %.2f%% exceeds %.2f%%", 100*report.ErrorRate(), 100*(*maxErrorRate))
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minherz/metadataserver"
+)
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestServe(t *testing.T) {
+	port := strconv.Itoa(freePort(t))
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error)
+	go func() {
+		result <- run(ctx, []string{"--address", "127.0.0.1", "--port", port, "--provider", "gke"}, io.Discard, io.Discard)
+	}()
+
+	url := "http://127.0.0.1:" + port + metadataserver.DefaultEndpoint + "/instance/attributes/cluster-name"
+	var body []byte
+	for i := 0; i < 20 && body == nil; i++ {
+		time.Sleep(50 * time.Millisecond)
+		resp, err := http.Get(url)
+		if err != nil {
+			continue
+		}
+		body, _ = io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	if string(body) != "test-cluster" {
+		t.Errorf("expected response %q, got: %q", "test-cluster", string(body))
+	}
+	cancel()
+	if err := <-result; err != nil {
+		t.Errorf("expected no errors, got: %v", err)
+	}
+}
+
+func TestServeErrors(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	defer l.Close()
+	busyPort := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"port in use", []string{"--address", "127.0.0.1", "--port", busyPort}},
+		{"unknown provider", []string{"--provider", "unknown"}},
+		{"missing config", []string{"--config", "missing.json"}},
+		{"config with provider", []string{"--config", "../../test/fixtures/config_handlers.json", "--provider", "gce"}},
+		{"unknown flag", []string{"--unknown"}},
+		{"unknown command", []string{"unknown"}},
+		{"watch without config", []string{"--watch"}},
+		{"preflight", []string{"--address", "127.0.0.1", "--port", "0", "--config", "../../test/fixtures/config_file_handlers.json", "--preflight"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := run(context.Background(), test.args, io.Discard, io.Discard); err == nil {
+				t.Errorf("expected error, got none")
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	var out bytes.Buffer
+	if err := run(context.Background(), []string{"validate", "../../test/fixtures/config_mixed_handlers.json"}, &out, io.Discard); err != nil {
+		t.Errorf("expected no errors, got: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("expected no output, got: %q", out.String())
+	}
+	out.Reset()
+	if err := run(context.Background(), []string{"validate", "../../test/fixtures/config_invalid.json"}, &out, io.Discard); err == nil {
+		t.Errorf("expected error, got none")
+	}
+	if !strings.Contains(out.String(), `metadata "empty": one of [value env file template expr time counter plugin] is required`) {
+		t.Errorf("expected diagnostics in output, got: %q", out.String())
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	var out bytes.Buffer
+	if err := run(context.Background(), []string{"routes", "../../test/fixtures/config_mixed_handlers.json"}, &out, io.Discard); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	want := "PATH                        SOURCE\n" +
+		"/computeMetadata/v1/entry1  value\n" +
+		"/computeMetadata/v1/entry2  env two\n"
+	if out.String() != want {
+		t.Errorf("expected output:\n%s\ngot:\n%s", want, out.String())
+	}
+}
+
+func TestRoutesOfDerivedMetadata(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "config.json")
+	data := `{"projectId": "test-project", "zone": "us-central1-a", "serviceAccounts": [{"email": "sa@test-project.iam.gserviceaccount.com"}], "aliases": {"zone": "instance/zone"}}`
+	if err := os.WriteFile(name, []byte(data), 0o600); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	var out bytes.Buffer
+	if err := run(context.Background(), []string{"routes", name}, &out, io.Discard); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	sources := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n")[1:] {
+		path, source, _ := strings.Cut(line, " ")
+		sources[path] = strings.TrimSpace(source)
+	}
+	want := map[string]string{
+		"/computeMetadata/v1/instance/region":                         "zone",
+		"/computeMetadata/v1/instance/zone":                           "zone",
+		"/computeMetadata/v1/project/project-id":                      "project",
+		"/computeMetadata/v1/instance/service-accounts/default/email": "service account sa@test-project.iam.gserviceaccount.com",
+		"/computeMetadata/v1/zone":                                    "alias instance/zone",
+	}
+	for path, source := range want {
+		if sources[path] != source {
+			t.Errorf("expected source %q of %q, got: %q", source, path, sources[path])
+		}
+	}
+	for path, source := range sources {
+		if source == "" {
+			t.Errorf("expected the source of %q", path)
+		}
+	}
+}
+
+func TestVersion(t *testing.T) {
+	var out bytes.Buffer
+	if err := run(context.Background(), []string{"version"}, &out, io.Discard); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if want := metadataserver.Version() + "\n"; out.String() != want {
+		t.Errorf("expected %q, got: %q", want, out.String())
+	}
+}
+
+func TestRecord(t *testing.T) {
+	s, err := metadataserver.New()
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	server := httptest.NewServer(s.HttpHandler())
+	defer server.Close()
+	dir := t.TempDir()
+	output := filepath.Join(dir, "recorded.json")
+	if err := run(context.Background(), []string{"record", "-url", server.URL + metadataserver.DefaultEndpoint, "-o", output}, io.Discard, io.Discard); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if _, err := metadataserver.NewConfigFromFile(output); err != nil {
+		t.Errorf("expected the recorded configuration to load, got: %v", err)
+	}
+
+	failed := filepath.Join(dir, "failed.json")
+	if err := run(context.Background(), []string{"record", "-url", "http://127.0.0.1:" + strconv.Itoa(freePort(t)), "-o", failed}, io.Discard, io.Discard); err == nil {
+		t.Errorf("expected an error recording from unreachable server")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "recorded.json" {
+		t.Errorf("expected no files of the failed recording, got: %v", entries)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	s, err := metadataserver.New(metadataserver.WithHandlers(map[string]metadataserver.Metadata{
+		"instance/zone": func() string { return "projects/123/zones/europe-west1-b" },
+	}))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	server := httptest.NewServer(s.HttpHandler())
+	defer server.Close()
+	var out bytes.Buffer
+	err = run(context.Background(), []string{"replay", "-url", server.URL, "../../test/fixtures/replay.har"}, &out, io.Discard)
+	if want := "2 of 3 responses differ"; err == nil || err.Error() != want {
+		t.Errorf("expected error %q, got: %v", want, err)
+	}
+	want := "GET /computeMetadata/v1/instance/service-accounts/default/token: got status 404, want 503\n" +
+		"GET /computeMetadata/v1/instance/service-accounts/default/token: got status 404, want 200\n"
+	if out.String() != want {
+		t.Errorf("expected output:\n%s\ngot:\n%s", want, out.String())
+	}
+}
+
+func TestLoad(t *testing.T) {
+	s, err := metadataserver.New(metadataserver.WithHandlers(map[string]metadataserver.Metadata{
+		"instance/zone": func() string { return "projects/123/zones/europe-west1-b" },
+	}))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	server := httptest.NewServer(s.HttpHandler())
+	defer server.Close()
+
+	var out bytes.Buffer
+	if err := run(context.Background(), []string{"load", "-url", server.URL, "-c", "2", "-n", "20", "instance/zone=3", "instance/"}, &out, io.Discard); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if !strings.HasPrefix(out.String(), "20 requests in ") || !strings.Contains(out.String(), "\n  instance/zone: 15 requests, 0.00% errors") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+
+	err = run(context.Background(), []string{"load", "-url", server.URL, "-n", "10", "instance/missing"}, io.Discard, io.Discard)
+	if want := "error rate 100.00% exceeds 0.00%"; err == nil || err.Error() != want {
+		t.Errorf("expected error %q, got: %v", want, err)
+	}
+	if err := run(context.Background(), []string{"load"}, io.Discard, io.Discard); err == nil {
+		t.Errorf("expected usage error, got nil")
+	}
+}
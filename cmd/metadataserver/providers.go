@@ -0,0 +1,44 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/minherz/metadataserver"
+)
+
+// providers keeps preset metadata of the supported providers.
+var providers = map[string]map[string]metadataserver.Metadata{
+	"gce": {
+		"project/project-id":         literal("test-project-id"),
+		"project/numeric-project-id": literal("123456789012"),
+		"instance/id":                literal("1234567890123456789"),
+		"instance/name":              literal("test-instance"),
+		"instance/hostname":          literal("test-instance.us-central1-a.c.test-project-id.internal"),
+		"instance/zone":              literal("projects/123456789012/zones/us-central1-a"),
+	},
+	"gke": {
+		"project/project-id":                   literal("test-project-id"),
+		"project/numeric-project-id":           literal("123456789012"),
+		"instance/id":                          literal("1234567890123456789"),
+		"instance/name":                        literal("gke-test-cluster-default-pool-node"),
+		"instance/zone":                        literal("projects/123456789012/zones/us-central1-a"),
+		"instance/attributes/cluster-location": literal("us-central1"),
+		"instance/attributes/cluster-name":     literal("test-cluster"),
+		"instance/attributes/cluster-uid":      literal("0123456789abcdef0123456789abcdef"),
+	},
+}
+
+func literal(value string) metadataserver.Metadata {
+	return func() string {
+		return value
+	}
+}
+
+func providerNames() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,71 @@
+package metadataserver
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// WithFirstConnectionDelay sets a new server to wait for the given duration before it serves the first request
+// from each new client address, emulating the cold-path latency of the first connection to the metadata server
+// on a freshly booted VM, e.g. the slow resolution of "metadata.google.internal".
+// Use it to tune the startup timeouts of the clients like Application Default Credentials libraries.
+// The clients are identified by their IP address rather than by the connection, so new connections
+// from the seen address (e.g. after the client closes its keep-alive connection) are not delayed.
+// Later requests from the same address are not delayed until the server is reset with [Server.Reset].
+// The server remembers up to 10000 addresses and forgets one of them when a new client exceeds the limit.
+func WithFirstConnectionDelay(d time.Duration) Option {
+	return func(s *Server) {
+		s.firstConnectionDelay = d
+	}
+}
+
+// seenClientsSize is the maximum number of client addresses that the server remembers.
+const seenClientsSize = 10000
+
+// firstSeen reports whether the request is the first request from its client address and records the address.
+func (s *Server) firstSeen(r *http.Request) bool {
+	client := r.RemoteAddr
+	if addr, ok := clientAddr(r.RemoteAddr); ok {
+		client = addr.String()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.seenClients[client] {
+		return false
+	}
+	if s.seenClients == nil {
+		s.seenClients = make(map[string]bool)
+	}
+	if len(s.seenClients) >= seenClientsSize {
+		// forget an arbitrary address to keep the memory bounded
+		for c := range s.seenClients {
+			delete(s.seenClients, c)
+			break
+		}
+	}
+	s.seenClients[client] = true
+	return true
+}
+
+// delayNewClients delays the first request from each new client address.
+// The request is not served if it is canceled during the delay.
+func (s *Server) delayNewClients(next http.Handler) http.Handler {
+	if s.firstConnectionDelay <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.firstSeen(r) {
+			s.handlerLogger.DebugContext(r.Context(), "first request from new client is delayed",
+				slog.String("remoteAddr", r.RemoteAddr), slog.Duration("delay", s.firstConnectionDelay))
+			timer := time.NewTimer(s.firstConnectionDelay)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-r.Context().Done():
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
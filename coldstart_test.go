@@ -0,0 +1,52 @@
+package metadataserver_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestFirstConnectionDelay(t *testing.T) {
+	const delay = 200 * time.Millisecond
+	s, err := metadataserver.New(metadataserver.WithFirstConnectionDelay(delay))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		reset      bool
+		wantDelay  bool
+	}{
+		{name: "new client", remoteAddr: "10.0.0.1:1234", wantDelay: true},
+		{name: "same client", remoteAddr: "10.0.0.1:1234"},
+		{name: "same client other port", remoteAddr: "10.0.0.1:5678"},
+		{name: "other client", remoteAddr: "10.0.0.2:1234", wantDelay: true},
+		{name: "after reset", remoteAddr: "10.0.0.1:1234", reset: true, wantDelay: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.reset {
+				s.Reset()
+			}
+			r := httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/project/project-id", nil)
+			r.RemoteAddr = test.remoteAddr
+			rec := httptest.NewRecorder()
+			start := time.Now()
+			s.HttpHandler().ServeHTTP(rec, r)
+			elapsed := time.Since(start)
+			if rec.Code != http.StatusOK {
+				t.Errorf("expected status %d, got: %d", http.StatusOK, rec.Code)
+			}
+			if test.wantDelay && elapsed < delay {
+				t.Errorf("expected delay of at least %v, got: %v", delay, elapsed)
+			}
+			if !test.wantDelay && elapsed >= delay {
+				t.Errorf("expected no delay, got: %v", elapsed)
+			}
+		})
+	}
+}
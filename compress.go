@@ -0,0 +1,137 @@
+package metadataserver
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+)
+
+var varyAcceptEncodingHeader = []string{"Accept-Encoding"}
+
+// DefaultCompressionThreshold is the minimal size of the response in bytes that is compressed by default.
+const DefaultCompressionThreshold = 1024
+
+// WithCompressionThreshold sets a new server with the minimal size of the response in bytes
+// that is compressed with gzip when the client accepts it.
+// Use a negative size to disable compression.
+func WithCompressionThreshold(size int) Option {
+	return func(s *Server) {
+		s.compressionThreshold = &size
+	}
+}
+
+// compress encodes the responses with gzip if the client accepts it.
+// HEAD requests are compressed too, so [Server.serveHead] reports the same headers and length as GET.
+func (s *Server) compress(next http.Handler) http.Handler {
+	threshold := DefaultCompressionThreshold
+	if s.compressionThreshold != nil {
+		threshold = *s.compressionThreshold
+	}
+	if threshold < 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h := w.Header(); h["Vary"] == nil {
+			h["Vary"] = varyAcceptEncodingHeader
+		} else {
+			h.Add("Vary", "Accept-Encoding")
+		}
+		if !acceptsGzip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipResponseWriter{ResponseWriter: w, threshold: threshold, status: http.StatusOK}
+		defer gw.close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip reports whether the request's Accept-Encoding header allows gzip.
+func acceptsGzip(r *http.Request) bool {
+	for _, h := range r.Header.Values("Accept-Encoding") {
+		for _, enc := range strings.Split(h, ",") {
+			name, params, _ := strings.Cut(strings.TrimSpace(enc), ";")
+			if strings.TrimSpace(name) != "gzip" {
+				continue
+			}
+			q := strings.ReplaceAll(params, " ", "")
+			return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+		}
+	}
+	return false
+}
+
+// gzipResponseWriter buffers the response until it reaches the threshold.
+// Responses that reach the threshold are compressed, smaller responses are written as is.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	threshold   int
+	status      int
+	wroteHeader bool
+	buf         []byte
+	gz          *gzip.Writer
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = status
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified || w.encoded() {
+		w.ResponseWriter.WriteHeader(status)
+		w.threshold = -1
+	}
+}
+
+// encoded reports whether the response is already encoded, e.g. by the upstream server.
+func (w *gzipResponseWriter) encoded() bool {
+	return w.Header().Get("Content-Encoding") != ""
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader && w.encoded() {
+		w.WriteHeader(w.status)
+	}
+	w.wroteHeader = true
+	if w.threshold < 0 {
+		return w.ResponseWriter.Write(b)
+	}
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+	w.buf = append(w.buf, b...)
+	if len(w.buf) < w.threshold {
+		return len(b), nil
+	}
+	h := w.Header()
+	// the content type is detected from the uncompressed body, net/http does not detect it for encoded responses
+	if _, ok := h["Content-Type"]; !ok {
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	h.Del("Content-Length")
+	h.Set("Content-Encoding", "gzip")
+	w.ResponseWriter.WriteHeader(w.status)
+	w.gz = gzip.NewWriter(w.ResponseWriter)
+	if _, err := w.gz.Write(w.buf); err != nil {
+		return 0, err
+	}
+	w.buf = nil
+	return len(b), nil
+}
+
+func (w *gzipResponseWriter) close() {
+	if w.threshold < 0 {
+		return
+	}
+	if w.gz != nil {
+		w.gz.Close()
+		return
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(w.buf)
+}
+
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,98 @@
+package metadataserver_test
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestCompression(t *testing.T) {
+	large := strings.Repeat("startup-script ", 100)
+	tests := []struct {
+		name           string
+		opts           []metadataserver.Option
+		path           string
+		acceptEncoding string
+		wantEncoding   string
+		want           string
+	}{
+		{
+			name:           "large_response",
+			path:           "/large",
+			acceptEncoding: "gzip, deflate",
+			wantEncoding:   "gzip",
+			want:           large,
+		},
+		{
+			name:           "small_response",
+			path:           "/small",
+			acceptEncoding: "gzip",
+			want:           "small",
+		},
+		{
+			name: "no_accept_encoding",
+			path: "/large",
+			want: large,
+		},
+		{
+			name:           "gzip_not_acceptable",
+			path:           "/large",
+			acceptEncoding: "gzip;q=0",
+			want:           large,
+		},
+		{
+			name:           "custom_threshold",
+			opts:           []metadataserver.Option{metadataserver.WithCompressionThreshold(1)},
+			path:           "/small",
+			acceptEncoding: "gzip",
+			wantEncoding:   "gzip",
+			want:           "small",
+		},
+		{
+			name:           "disabled",
+			opts:           []metadataserver.Option{metadataserver.WithCompressionThreshold(-1)},
+			path:           "/large",
+			acceptEncoding: "gzip",
+			want:           large,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := append(test.opts, metadataserver.WithHandlers(map[string]metadataserver.Metadata{
+				"large": func() string { return large },
+				"small": func() string { return "small" },
+			}))
+			s, err := metadataserver.New(opts...)
+			if err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			req := httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+test.path, nil)
+			if test.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", test.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+			s.HttpHandler().ServeHTTP(rec, req)
+			if got := rec.Header().Get("Content-Encoding"); got != test.wantEncoding {
+				t.Errorf("expected encoding %q, got: %q", test.wantEncoding, got)
+			}
+			var body io.Reader = rec.Body
+			if test.wantEncoding == "gzip" {
+				if body, err = gzip.NewReader(rec.Body); err != nil {
+					t.Fatalf("expected no errors, got: %v", err)
+				}
+			}
+			got, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			if string(got) != test.want {
+				t.Errorf("expected response of %d bytes, got: %d bytes", len(test.want), len(got))
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package metadataserver
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"time"
+)
+
+// WithConcurrencyLimit sets a new server to evaluate at most limit requests for the metadata at the paths at the same time.
+// Paths are relative to the server's endpoint and can use patterns supported by [path.Match].
+// If no paths are defined the limit applies to all metadata. The limit is shared by all paths of the option.
+// Excess requests wait up to the wait duration for one of the requests to complete
+// and are rejected with 503 (Service Unavailable) if none does. Use zero wait to reject excess requests immediately.
+// A request that times out (see [WithHandlerTimeout]) keeps its slot until its handler returns
+// and the wait for the slot counts towards the timeout.
+// The limit must be positive, otherwise [New] returns [ConfigError].
+func WithConcurrencyLimit(limit int, wait time.Duration, paths ...string) Option {
+	return func(s *Server) {
+		s.concurrencyLimits = append(s.concurrencyLimits, &concurrencyLimit{
+			limit: limit,
+			wait:  wait,
+			paths: paths,
+		})
+	}
+}
+
+type concurrencyLimit struct {
+	limit int
+	// slots holds a value for each request that is being served
+	slots chan struct{}
+	wait  time.Duration
+	paths []string
+}
+
+// initConcurrencyLimits validates the concurrency limits and allocates their slots.
+func (s *Server) initConcurrencyLimits() error {
+	for _, cl := range s.concurrencyLimits {
+		if cl.limit <= 0 {
+			return fmt.Errorf("concurrency limit %d is not positive", cl.limit)
+		}
+		cl.slots = make(chan struct{}, cl.limit)
+	}
+	return nil
+}
+
+func (cl *concurrencyLimit) matches(key string) bool {
+	if len(cl.paths) == 0 {
+		return true
+	}
+	for _, p := range cl.paths {
+		if ok, _ := path.Match(normalizeKey(p), key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// acquire takes a slot within the wait duration. It returns false if no slot is released in time
+// or the request is canceled.
+func (cl *concurrencyLimit) acquire(r *http.Request) bool {
+	select {
+	case cl.slots <- struct{}{}:
+		return true
+	default:
+	}
+	if cl.wait <= 0 {
+		return false
+	}
+	timer := time.NewTimer(cl.wait)
+	defer timer.Stop()
+	select {
+	case cl.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+	case <-r.Context().Done():
+	}
+	return false
+}
+
+func (cl *concurrencyLimit) release() {
+	<-cl.slots
+}
+
+// limitConcurrency serves the request when all concurrency limits that apply to its path have a free slot.
+func (s *Server) limitConcurrency(next http.Handler) http.Handler {
+	if len(s.concurrencyLimits) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, ok := s.keyOf(r.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		for _, cl := range s.concurrencyLimits {
+			if !cl.matches(key) {
+				continue
+			}
+			if !cl.acquire(r) {
+				s.handlerLogger.DebugContext(r.Context(), "request exceeds concurrency limit",
+					slog.String("handler", r.URL.Path), slog.Int("limit", cl.limit))
+				http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+				return
+			}
+			defer cl.release()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,113 @@
+package metadataserver_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/minherz/metadataserver"
+)
+
+// newBlockingServer returns a server which "instance/attributes/exec" handler signals entered and blocks until release is closed.
+func newBlockingServer(t *testing.T, wait time.Duration, entered chan<- struct{}, release <-chan struct{}, opts ...metadataserver.Option) func(path string) int {
+	opts = append([]metadataserver.Option{
+		metadataserver.WithHandlers(map[string]metadataserver.Metadata{
+			"instance/attributes/exec": func() string {
+				entered <- struct{}{}
+				<-release
+				return "done"
+			},
+			"project/project-id": func() string { return "test-project-id" },
+		}),
+		metadataserver.WithConcurrencyLimit(1, wait, "instance/attributes/*"),
+	}, opts...)
+	s, err := metadataserver.New(opts...)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	return func(path string) int {
+		rec := httptest.NewRecorder()
+		s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/"+path, nil))
+		return rec.Code
+	}
+}
+
+func TestConcurrencyLimitReject(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	serve := newBlockingServer(t, 0, entered, release)
+	first := make(chan int)
+	go func() { first <- serve("instance/attributes/exec") }()
+	<-entered
+
+	if got := serve("instance/attributes/exec"); got != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got: %d", http.StatusServiceUnavailable, got)
+	}
+	if got := serve("project/project-id"); got != http.StatusOK {
+		t.Errorf("expected status %d for path without limit, got: %d", http.StatusOK, got)
+	}
+	close(release)
+	if got := <-first; got != http.StatusOK {
+		t.Errorf("expected status %d of first request, got: %d", http.StatusOK, got)
+	}
+}
+
+func TestConcurrencyLimitQueue(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	serve := newBlockingServer(t, 5*time.Second, entered, release)
+	first, second := make(chan int), make(chan int)
+	go func() { first <- serve("instance/attributes/exec") }()
+	<-entered
+	go func() { second <- serve("instance/attributes/exec") }()
+
+	select {
+	case <-entered:
+		t.Fatalf("expected second request to wait")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	<-entered
+	for _, ch := range []chan int{first, second} {
+		if got := <-ch; got != http.StatusOK {
+			t.Errorf("expected status %d, got: %d", http.StatusOK, got)
+		}
+	}
+}
+
+func TestConcurrencyLimitHandlerTimeout(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	serve := newBlockingServer(t, 0, entered, release, metadataserver.WithHandlerTimeout(20*time.Millisecond))
+	first := make(chan int)
+	go func() { first <- serve("instance/attributes/exec") }()
+	<-entered
+	if got := <-first; got != http.StatusGatewayTimeout {
+		t.Fatalf("expected status %d, got: %d", http.StatusGatewayTimeout, got)
+	}
+
+	// the timed out handler still runs, so it keeps the slot
+	if got := serve("instance/attributes/exec"); got != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d while the timed out handler runs, got: %d", http.StatusServiceUnavailable, got)
+	}
+	close(release)
+	go func() {
+		for range entered {
+		}
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for serve("instance/attributes/exec") != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the slot to be released when the handler returns")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestConcurrencyLimitInvalid(t *testing.T) {
+	for _, limit := range []int{0, -1} {
+		_, err := metadataserver.New(metadataserver.WithConcurrencyLimit(limit, 0))
+		if !errors.Is(err, metadataserver.ErrConfigInvalid) {
+			t.Errorf("limit %d: expected %v, got: %v", limit, metadataserver.ErrConfigInvalid, err)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package metadataserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+)
+
+// jsonCase describes one of the values of the conditional metadata in the configuration file.
+// The value is served when the request matches all conditions of the case.
+type jsonCase struct {
+	Header   map[string]string `json:"header"`
+	Query    map[string]string `json:"query"`
+	ClientIP string            `json:"clientIP"`
+	Value    any               `json:"value"`
+}
+
+// conditionalCase is a parsed [jsonCase].
+type conditionalCase struct {
+	header  map[string]string
+	query   map[string]string
+	clients netip.Prefix
+	value   string
+}
+
+// conditionalMetadata serves the value of the first case that matches the request
+// or the default value if none of the cases matches.
+type conditionalMetadata struct {
+	cases []conditionalCase
+	// def is the default value or nil if the metadata is not found when none of the cases matches
+	def *string
+}
+
+// newConditionalMetadata creates the conditional metadata from the "cases" and optional "value" fields of the metadata definition.
+func newConditionalMetadata(cases, def any) (*conditionalMetadata, error) {
+	data, err := json.Marshal(cases)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var jcs []jsonCase
+	if err := dec.Decode(&jcs); err != nil {
+		return nil, err
+	}
+	if len(jcs) == 0 {
+		return nil, errors.New("at least one case is required")
+	}
+	m := &conditionalMetadata{cases: make([]conditionalCase, 0, len(jcs))}
+	for i, jc := range jcs {
+		if jc.Value == nil {
+			return nil, fmt.Errorf("case %d: value is required", i)
+		}
+		c := conditionalCase{header: jc.Header, query: jc.Query, value: fmt.Sprintf("%v", jc.Value)}
+		if jc.ClientIP != "" {
+			p, err := parseClientRange(jc.ClientIP)
+			if err != nil {
+				return nil, fmt.Errorf("case %d: invalid clientIP %q: %w", i, jc.ClientIP, err)
+			}
+			c.clients = p
+		}
+		m.cases = append(m.cases, c)
+	}
+	if def != nil {
+		v := fmt.Sprintf("%v", def)
+		m.def = &v
+	}
+	return m, nil
+}
+
+func (m *conditionalMetadata) serve(ctx context.Context, r *http.Request) (Response, error) {
+	for _, c := range m.cases {
+		if c.matches(r) {
+			return Response{Body: c.value}, nil
+		}
+	}
+	if m.def == nil {
+		return Response{Status: http.StatusNotFound, Body: http.StatusText(http.StatusNotFound) + "\n"}, nil
+	}
+	return Response{Body: *m.def}, nil
+}
+
+// matches reports whether the request matches all conditions of the case.
+func (c conditionalCase) matches(r *http.Request) bool {
+	for k, v := range c.header {
+		if r.Header.Get(k) != v {
+			return false
+		}
+	}
+	if len(c.query) > 0 {
+		q := r.URL.Query()
+		for k, v := range c.query {
+			if q.Get(k) != v {
+				return false
+			}
+		}
+	}
+	if c.clients.IsValid() {
+		addr, ok := clientAddr(r.RemoteAddr)
+		if !ok || !c.clients.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
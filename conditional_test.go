@@ -0,0 +1,50 @@
+package metadataserver_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestConditionalMetadata(t *testing.T) {
+	s, err := metadataserver.New(metadataserver.WithConfigFile("test/fixtures/config_conditional.json"))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	tests := []struct {
+		name       string
+		path       string
+		ip         string
+		userAgent  string
+		wantStatus int
+		wantBody   string
+	}{
+		{"default", "instance/zone", "10.0.0.1", "", http.StatusOK, "us-central1-a"},
+		{"header", "instance/zone", "10.0.0.1", "legacy-agent", http.StatusOK, "us-east1-b"},
+		{"query and client", "instance/zone?alt=text", "10.1.2.3", "", http.StatusOK, "europe-west1-c"},
+		{"query from other client", "instance/zone?alt=text", "172.16.0.1", "", http.StatusOK, "us-central1-a"},
+		{"client", "instance/attributes/canary", "192.168.1.7", "", http.StatusOK, "true"},
+		{"no default", "instance/attributes/canary", "192.168.1.8", "", http.StatusNotFound, "Not Found\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/"+test.path, nil)
+			r.RemoteAddr = test.ip + ":12345"
+			r.Header.Set("User-Agent", test.userAgent)
+			rec := httptest.NewRecorder()
+			s.HttpHandler().ServeHTTP(rec, r)
+			if rec.Code != test.wantStatus {
+				t.Errorf("expected status %d, got: %d", test.wantStatus, rec.Code)
+			}
+			if got := rec.Body.String(); got != test.wantBody {
+				t.Errorf("expected body %q, got: %q", test.wantBody, got)
+			}
+		})
+	}
+	c := s.Configuration()
+	if got := c.Source("instance/zone"); got != "cases" {
+		t.Errorf("expected source %q, got: %q", "cases", got)
+	}
+}
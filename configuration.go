@@ -1,29 +1,168 @@
 package metadataserver
 
 import (
+	"context"
+	"crypto"
 	"encoding/json"
 	"fmt"
+	"io"
+	"maps"
+	"net/http"
 	"os"
+	"path/filepath"
+	"slices"
+	"time"
 )
 
 // Metadata is a type used to describe metadata values
 type Metadata func() string
 
+// MetadataFunc is a type used to describe metadata values that depend on the request.
+// The handler can vary the value by query parameters or headers of the request.
+// If the handler returns an error, the server responds with 500 (Internal Server Error).
+type MetadataFunc func(ctx context.Context, r *http.Request) (string, error)
+
+// Response describes the complete response to the metadata request.
+// Zero status means 200 (OK).
+type Response struct {
+	Status  int
+	Headers http.Header
+	Body    string
+}
+
+// ResponseFunc is a type used to describe metadata handlers that control the response status and headers,
+// e.g. to respond with 404 (Not Found) for absent keys or to flap with 503 (Service Unavailable).
+// If the handler returns an error, the server responds with 500 (Internal Server Error).
+type ResponseFunc func(ctx context.Context, r *http.Request) (Response, error)
+
+// BytesMetadata is a type used to describe binary or pre-marshaled metadata values.
+// The handler returns the value and its content type, e.g. "application/json".
+// Empty content type means "application/octet-stream".
+type BytesMetadata func() ([]byte, string)
+
+// StreamMetadata is a type used to describe large metadata values that are streamed to the client.
+// If the returned reader implements [io.Closer], it is closed after the value is served.
+type StreamMetadata func() io.Reader
+
 // Configuration object stores metadata server configuration values
 type Configuration struct {
-	Port            int
-	Address         string
-	Endpoint        string
-	Handlers        map[string]Metadata
-	ShutdownTimeout int
+	Port             int
+	Address          string
+	Endpoint         string
+	Handlers         map[string]Metadata
+	FuncHandlers     map[string]MetadataFunc
+	BytesHandlers    map[string]BytesMetadata
+	ResponseHandlers map[string]ResponseFunc
+	StatefulHandlers map[string]Handler
+	StreamHandlers   map[string]StreamMetadata
+	ShutdownTimeout  int
+	AdminPort        int
+	AdminToken       string
+	Webhooks         []Webhook
+	ResponseHeaders  []ResponseHeaders
+	Aliases          map[string]string
+	Profiles         []Profile
+	ProjectID        string
+	ProjectNumber    int64
+	Zone             string
+	ServiceAccounts  []ServiceAccount
+	// SigningKey signs the identity tokens of the service accounts; the identity tokens are not served if it is nil
+	SigningKey    crypto.Signer
+	CachePolicies []CachePolicy
+	Redirects     []Redirect
+	// DirectoryRedirect is the status of the redirects of directories without the trailing slash; zero disables them
+	DirectoryRedirect int
+	// Preflight enables the checks of the environment variables and files that the handlers read when the server starts
+	Preflight bool
+	// RootListing enables the listing of the directories above the endpoint, e.g. at "/"
+	RootListing bool
+
+	// literals keeps static values of the handlers loaded from the configuration file or set by the project
+	literals map[string]string
+	// sources describes where the values of the handlers loaded from the configuration file come from
+	sources map[string]string
+	// envVars and files keep the environment variables and files that the handlers loaded from the configuration file read
+	envVars map[string]string
+	files   map[string]string
+	// parsed keeps the values of the kinds in valueKinds that the server evaluates for each request
+	parsed map[string]parsedValue
+}
+
+// Source describes where the value of the metadata at the key comes from,
+// e.g. "value", "env X_A", "file startup.sh", "expr", "counter", "time" or "env X_A, ttl 30s" for handlers loaded from a configuration file
+// or "service account EMAIL" for the handlers of the service accounts.
+// It returns "func" for handlers that are set in code and an empty string if there is no handler for the key.
+func (c *Configuration) Source(key string) string {
+	if src, ok := c.sources[key]; ok {
+		return src
+	}
+	if _, ok := c.Handlers[key]; ok {
+		return "func"
+	}
+	if _, ok := c.FuncHandlers[key]; ok {
+		return "func"
+	}
+	if _, ok := c.BytesHandlers[key]; ok {
+		return "bytes"
+	}
+	if _, ok := c.ResponseHandlers[key]; ok {
+		return "func"
+	}
+	if _, ok := c.StatefulHandlers[key]; ok {
+		return "handler"
+	}
+	if _, ok := c.StreamHandlers[key]; ok {
+		return "stream"
+	}
+	return ""
+}
+
+// clone returns a copy of the configuration that does not share maps and slices with c,
+// so the copy is not affected when the server replaces or changes them. Handlers are not copied.
+func (c *Configuration) clone() Configuration {
+	cc := *c
+	cc.Handlers = maps.Clone(c.Handlers)
+	cc.FuncHandlers = maps.Clone(c.FuncHandlers)
+	cc.BytesHandlers = maps.Clone(c.BytesHandlers)
+	cc.ResponseHandlers = maps.Clone(c.ResponseHandlers)
+	cc.StatefulHandlers = maps.Clone(c.StatefulHandlers)
+	cc.StreamHandlers = maps.Clone(c.StreamHandlers)
+	cc.Aliases = maps.Clone(c.Aliases)
+	cc.Webhooks = slices.Clone(c.Webhooks)
+	cc.ResponseHeaders = slices.Clone(c.ResponseHeaders)
+	cc.Profiles = slices.Clone(c.Profiles)
+	cc.ServiceAccounts = slices.Clone(c.ServiceAccounts)
+	cc.CachePolicies = slices.Clone(c.CachePolicies)
+	cc.Redirects = slices.Clone(c.Redirects)
+	cc.literals = maps.Clone(c.literals)
+	cc.sources = maps.Clone(c.sources)
+	cc.envVars = maps.Clone(c.envVars)
+	cc.files = maps.Clone(c.files)
+	cc.parsed = maps.Clone(c.parsed)
+	return cc
 }
 
 type jsonConfiguration struct {
-	Address         string         `json:"address"`
-	Endpoint        string         `json:"endpoint"`
-	Handlers        map[string]any `json:"metadata"`
-	Port            int            `json:"port"`
-	ShutdownTimeout int            `json:"shutdownTimeout"`
+	Address           string               `json:"address"`
+	Aliases           map[string]string    `json:"aliases"`
+	AdminPort         int                  `json:"adminPort"`
+	AdminToken        string               `json:"adminToken"`
+	Cache             []jsonCachePolicy    `json:"cache"`
+	DirectoryRedirect int                  `json:"directoryRedirect"`
+	Endpoint          string               `json:"endpoint"`
+	Handlers          map[string]any       `json:"metadata"`
+	Headers           []ResponseHeaders    `json:"headers"`
+	Port              int                  `json:"port"`
+	Preflight         bool                 `json:"preflight"`
+	Profiles          []jsonProfile        `json:"profiles"`
+	ProjectID         string               `json:"projectId"`
+	ProjectNumber     int64                `json:"projectNumber"`
+	Redirects         []Redirect           `json:"redirects"`
+	RootListing       bool                 `json:"rootListing"`
+	ServiceAccounts   []jsonServiceAccount `json:"serviceAccounts"`
+	Zone              string               `json:"zone"`
+	ShutdownTimeout   int                  `json:"shutdownTimeout"`
+	Webhooks          []Webhook            `json:"webhooks"`
 }
 
 const (
@@ -41,6 +180,7 @@ var DefaultConfigurationHandlers = map[string]Metadata{
 var EmptyConfigurationHandlers = map[string]Metadata{}
 
 // NewConfigFromFile instantiates a new `Configuration` object from a file.
+// The problems of the file's content are returned as [ConfigError] that matches [ErrConfigInvalid] with [errors.Is].
 func NewConfigFromFile(path string) (*Configuration, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -48,12 +188,18 @@ func NewConfigFromFile(path string) (*Configuration, error) {
 	}
 	var jc jsonConfiguration
 	if err := json.Unmarshal(data, &jc); err != nil {
-		return nil, err
+		return nil, configError(err)
 	}
 	c := NewConfiguration(DefaultConfigurationHandlers)
 	if jc.Port > 0 {
 		c.Port = jc.Port
 	}
+	if jc.AdminPort > 0 {
+		c.AdminPort = jc.AdminPort
+	}
+	if jc.AdminToken != "" {
+		c.AdminToken = jc.AdminToken
+	}
 	if jc.ShutdownTimeout > 0 {
 		c.ShutdownTimeout = jc.ShutdownTimeout
 	}
@@ -66,7 +212,56 @@ func NewConfigFromFile(path string) (*Configuration, error) {
 		}
 		c.Endpoint = jc.Endpoint
 	}
-	c.Handlers = convert(jc.Handlers)
+	c.Webhooks = jc.Webhooks
+	c.ResponseHeaders = jc.Headers
+	c.Aliases = jc.Aliases
+	c.Redirects = jc.Redirects
+	c.DirectoryRedirect = jc.DirectoryRedirect
+	c.Preflight = jc.Preflight
+	c.RootListing = jc.RootListing
+	c.ProjectID = jc.ProjectID
+	c.ProjectNumber = jc.ProjectNumber
+	c.Zone = jc.Zone
+	for _, jsa := range jc.ServiceAccounts {
+		sa := ServiceAccount{Email: jsa.Email, Scopes: jsa.Scopes, Token: jsa.Token}
+		if jsa.TokenLifetime != "" {
+			d, err := time.ParseDuration(jsa.TokenLifetime)
+			if err != nil {
+				return nil, configError(fmt.Errorf("invalid token lifetime of service account %q: %w", jsa.Email, err))
+			}
+			sa.TokenLifetime = d
+		}
+		c.ServiceAccounts = append(c.ServiceAccounts, sa)
+	}
+	for _, jcp := range jc.Cache {
+		cp := CachePolicy{Paths: jcp.Paths, CacheControl: jcp.CacheControl}
+		if jcp.Expires != "" {
+			d, err := time.ParseDuration(jcp.Expires)
+			if err != nil {
+				return nil, configError(fmt.Errorf("invalid expires of cache policy: %w", err))
+			}
+			cp.Expires = d
+		}
+		c.CachePolicies = append(c.CachePolicies, cp)
+	}
+	if err := convert(c, jc.Handlers, filepath.Dir(path)); err != nil {
+		return nil, configError(err)
+	}
+	for _, jp := range jc.Profiles {
+		pc := &Configuration{}
+		if err := convert(pc, jp.Handlers, filepath.Dir(path)); err != nil {
+			return nil, configError(fmt.Errorf("profile %q: %w", jp.Name, err))
+		}
+		c.Profiles = append(c.Profiles, Profile{
+			Name:       jp.Name,
+			PathPrefix: jp.PathPrefix,
+			Hosts:      jp.Hosts,
+			Port:       jp.Port,
+			Clients:    jp.Clients,
+			Handlers:   pc.Handlers,
+			config:     pc,
+		})
+	}
 	return c, nil
 }
 
@@ -85,25 +280,132 @@ func NewConfiguration(handlers map[string]Metadata) *Configuration {
 	}
 }
 
-func convert(m map[string]any) map[string]Metadata {
-	result := make(map[string]Metadata)
+// convert sets handlers of the configuration from the JSON metadata definitions.
+// Metadata with "cases" is served by [ResponseFunc] that selects the value by the request.
+// Static values of the handlers that return literals are stored in c.literals.
+// Relative paths of file-based values are resolved against the base directory.
+// Handlers with "ttl" are wrapped with [Cached].
+// Handlers with "plugin" are loaded with [LoadPluginHandler].
+// Values of the kinds in valueKinds, e.g. templates, expressions and time values, are stored in c.parsed.
+// Metadata with "counter" is served by [Counter].
+func convert(c *Configuration, m map[string]any, baseDir string) error {
+	c.Handlers = make(map[string]Metadata)
+	c.literals = make(map[string]string)
+	c.sources = make(map[string]string)
+	c.envVars = make(map[string]string)
+	c.files = make(map[string]string)
+	c.parsed = make(map[string]parsedValue)
 	for k, v := range m {
 		if dataMap, ok := v.(map[string]any); ok {
+			if v2, ok := dataMap["cases"]; ok {
+				m, err := newConditionalMetadata(v2, dataMap["value"])
+				if err != nil {
+					return fmt.Errorf("invalid cases of metadata %q: %w", k, err)
+				}
+				if c.ResponseHandlers == nil {
+					c.ResponseHandlers = make(map[string]ResponseFunc)
+				}
+				c.ResponseHandlers[k] = m.serve
+				c.sources[k] = "cases"
+				continue
+			}
 			if v2, ok := dataMap["value"]; ok {
 				s := fmt.Sprintf("%v", v2)
-				result[k] = func() string {
+				c.Handlers[k] = func() string {
 					return s
 				}
+				c.literals[k] = s
+				c.sources[k] = "value"
+				continue
+			}
+			if kind, v2 := definedKind(dataMap); kind != nil {
+				pv, err := kind.parse(k, v2)
+				if err != nil {
+					return fmt.Errorf("invalid %s of metadata %q: %w", kind.name, k, err)
+				}
+				c.parsed[k] = parsedValue{kind: kind, value: pv}
+				c.sources[k] = kind.field
+				continue
+			}
+			if v2, ok := dataMap["counter"]; ok {
+				counter, err := newCounterFromSpec(v2)
+				if err != nil {
+					return fmt.Errorf("invalid counter of metadata %q: %w", k, err)
+				}
+				if c.StatefulHandlers == nil {
+					c.StatefulHandlers = make(map[string]Handler)
+				}
+				c.StatefulHandlers[k] = counter
+				c.sources[k] = "counter"
+				continue
+			}
+			if v2, ok := dataMap["file"]; ok {
+				name := fmt.Sprintf("%v", v2)
+				if !filepath.IsAbs(name) {
+					name = filepath.Join(baseDir, name)
+				}
+				if c.StreamHandlers == nil {
+					c.StreamHandlers = make(map[string]StreamMetadata)
+				}
+				c.StreamHandlers[k] = FileMetadata(name)
+				c.sources[k] = "file " + name
+				c.files[k] = name
+				continue
+			}
+			if v2, ok := dataMap["plugin"]; ok {
+				name := fmt.Sprintf("%v", v2)
+				if !filepath.IsAbs(name) {
+					name = filepath.Join(baseDir, name)
+				}
+				symbol, _ := dataMap["symbol"].(string)
+				fn, err := LoadPluginHandler(name, symbol)
+				if err != nil {
+					return fmt.Errorf("invalid plugin of metadata %q: %w", k, err)
+				}
+				if c.FuncHandlers == nil {
+					c.FuncHandlers = make(map[string]MetadataFunc)
+				}
+				c.FuncHandlers[k] = fn
+				c.sources[k] = "plugin " + name
 				continue
 			}
 			if v2, ok := dataMap["env"]; ok {
 				s := fmt.Sprintf("%v", v2)
-				result[k] = func() string {
+				c.Handlers[k] = func() string {
 					return os.Getenv(s)
 				}
-				continue
+				c.sources[k] = "env " + s
+				c.envVars[k] = s
+			}
+			if ttl, ok := dataMap["ttl"]; ok && c.Handlers[k] != nil {
+				d, err := time.ParseDuration(fmt.Sprintf("%v", ttl))
+				if err != nil {
+					return fmt.Errorf("invalid ttl of metadata %q: %w", k, err)
+				}
+				c.Handlers[k] = Cached(d, c.Handlers[k])
+				c.sources[k] += ", ttl " + d.String()
 			}
 		}
 	}
-	return result
+	return nil
+}
+
+// FileMetadata returns a handler that streams the content of the file.
+func FileMetadata(name string) StreamMetadata {
+	return func() io.Reader {
+		f, err := os.Open(name)
+		if err != nil {
+			return errReader{err}
+		}
+		return f
+	}
+}
+
+// errReader is a reader that fails with the error.
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
 }
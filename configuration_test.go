@@ -4,13 +4,17 @@ import (
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 
 	"github.com/minherz/metadataserver"
 )
 
-var opt = cmp.Comparer(func(x, y metadataserver.Metadata) bool {
-	return x() == y()
-})
+var opt = cmp.Options{
+	cmp.Comparer(func(x, y metadataserver.Metadata) bool {
+		return x() == y()
+	}),
+	cmpopts.IgnoreUnexported(metadataserver.Configuration{}),
+}
 
 func TestNewConfiguration(t *testing.T) {
 	tests := []struct {
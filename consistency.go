@@ -0,0 +1,185 @@
+package metadataserver
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Paths of the instance metadata that CheckConsistency compares with the project and the zone.
+const (
+	MachineTypePath = "instance/machine-type"
+	HostnamePath    = "instance/hostname"
+	NetworkPath     = "instance/network-interfaces/*/network"
+)
+
+// identityFact is a value of the instance identity, e.g. the project number, and the part of the configuration that defines it.
+type identityFact struct {
+	source string
+	value  string
+}
+
+// identityFacts collects the values of the instance identity by their kinds: "project ID", "project number", "zone" and "region".
+type identityFacts map[string][]identityFact
+
+func (f identityFacts) add(kind, source, value string) {
+	if value != "" {
+		f[kind] = append(f[kind], identityFact{source: source, value: value})
+	}
+}
+
+// addResource adds the project and the zone of the resource name or URL,
+// e.g. "projects/123/zones/us-central1-a" or "https://www.googleapis.com/compute/v1/projects/p/zones/z/machineTypes/t".
+// The project is the project number if it is numeric and the project ID otherwise.
+func (f identityFacts) addResource(source, value string) {
+	parts := strings.Split(value, "/")
+	for i := 0; i+1 < len(parts); i++ {
+		switch parts[i] {
+		case "projects":
+			if _, err := strconv.ParseInt(parts[i+1], 10, 64); err == nil {
+				f.add("project number", source, parts[i+1])
+			} else {
+				f.add("project ID", source, parts[i+1])
+			}
+		case "zones":
+			f.add("zone", source, parts[i+1])
+		case "regions":
+			f.add("region", source, parts[i+1])
+		}
+	}
+}
+
+// addHostname adds the zone and the project ID of the zonal DNS name, e.g. "vm-1.us-central1-a.c.my-project.internal".
+func (f identityFacts) addHostname(source, value string) {
+	labels := strings.Split(value, ".")
+	if len(labels) == 5 && labels[2] == "c" && labels[4] == "internal" {
+		f.add("zone", source, labels[1])
+		f.add("project ID", source, labels[3])
+	}
+}
+
+// addIdentityToken adds the google.compute_engine claims of the identity token issued with format=full.
+// The signature of the token is not verified.
+func (f identityFacts) addIdentityToken(source, token string) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return
+	}
+	var claims struct {
+		Google struct {
+			ComputeEngine struct {
+				ProjectID     string `json:"project_id"`
+				ProjectNumber any    `json:"project_number"`
+				Zone          string `json:"zone"`
+			} `json:"compute_engine"`
+		} `json:"google"`
+	}
+	d := json.NewDecoder(bytes.NewReader(payload))
+	d.UseNumber()
+	if err := d.Decode(&claims); err != nil {
+		return
+	}
+	ce := claims.Google.ComputeEngine
+	f.add("project ID", source+" claim project_id", ce.ProjectID)
+	if ce.ProjectNumber != nil {
+		f.add("project number", source+" claim project_number", fmt.Sprint(ce.ProjectNumber))
+	}
+	f.add("zone", source+" claim zone", ce.Zone)
+}
+
+// CheckConsistency cross-validates the values of the instance identity and returns their contradictions, e.g.
+// the project number in the zone that differs from the configured project number, the region that is not the region
+// of the zone or the identity token which claims belong to another project. It compares
+//   - the project ID, the project number and the zone of the configuration,
+//   - the metadata at [ProjectIDPath], [ProjectNumberPath], [ZonePath], [RegionPath], [MachineTypePath] and [HostnamePath],
+//   - the networks of the network interfaces at [NetworkPath],
+//   - the google.compute_engine claims of static identity tokens at [IdentityPath].
+//
+// Only the static values are compared: the "value" metadata of the configuration file and the metadata
+// that the project, the zone and the service accounts add. Handlers are not called.
+// Values that are not defined or cannot be parsed are skipped. It returns nil if no contradiction is found.
+func (c *Configuration) CheckConsistency() []error {
+	values := make(map[string]string)
+	for k, v := range c.literals {
+		if k = normalizeKey(k); identityKey(k) {
+			values[k] = v
+		}
+	}
+	facts := make(identityFacts)
+	facts.add("project ID", "projectId", c.ProjectID)
+	if c.ProjectNumber > 0 {
+		facts.add("project number", "projectNumber", strconv.FormatInt(c.ProjectNumber, 10))
+	}
+	if c.Zone != "" {
+		facts.add("zone", "zone", path.Base(c.Zone))
+	}
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v, source := values[k], fmt.Sprintf("metadata %q", k)
+		switch {
+		case k == ProjectIDPath:
+			facts.add("project ID", source, v)
+		case k == ProjectNumberPath:
+			facts.add("project number", source, v)
+		case k == ZonePath && !strings.Contains(v, "/"):
+			facts.add("zone", source, v)
+		case k == RegionPath && !strings.Contains(v, "/"):
+			facts.add("region", source, v)
+		case k == HostnamePath:
+			facts.addHostname(source, v)
+		case matchKey(IdentityPath, k):
+			facts.addIdentityToken(source, v)
+		default:
+			facts.addResource(source, v)
+		}
+	}
+	var errs []error
+	for _, kind := range []string{"project ID", "project number", "zone", "region"} {
+		fs := facts[kind]
+		for _, fact := range fs {
+			if fact.value != fs[0].value {
+				errs = append(errs, fmt.Errorf("%s: %s %q contradicts %q of %s", fact.source, kind, fact.value, fs[0].value, fs[0].source))
+			}
+		}
+	}
+	for _, zone := range facts["zone"] {
+		region, ok := zoneRegion(zone.value)
+		if !ok {
+			continue
+		}
+		for _, fact := range facts["region"] {
+			if fact.value != region {
+				errs = append(errs, fmt.Errorf("%s: region %q contradicts the zone %q of %s", fact.source, fact.value, zone.value, zone.source))
+			}
+		}
+		break
+	}
+	return errs
+}
+
+// identityKey reports whether the metadata at the key defines the instance identity.
+func identityKey(key string) bool {
+	switch key {
+	case ProjectIDPath, ProjectNumberPath, ZonePath, RegionPath, MachineTypePath, HostnamePath:
+		return true
+	}
+	return matchKey(NetworkPath, key) || matchKey(IdentityPath, key)
+}
+
+func matchKey(pattern, key string) bool {
+	ok, _ := path.Match(pattern, key)
+	return ok
+}
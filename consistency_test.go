@@ -0,0 +1,149 @@
+package metadataserver_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/minherz/metadataserver"
+)
+
+// unsignedToken returns the JWT with the payload and a fake signature.
+func unsignedToken(payload string) string {
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(`{"alg":"RS256"}`)) + "." + enc.EncodeToString([]byte(payload)) + ".c2ln"
+}
+
+func TestCheckConsistency(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		values map[string]string
+		want   []string
+	}{
+		{
+			name:   "consistent",
+			config: `"projectId": "test-project", "projectNumber": 123, "zone": "us-central1-a"`,
+			values: map[string]string{
+				"instance/region":                            "projects/123/regions/us-central1",
+				"instance/machine-type":                      "projects/123/machineTypes/e2-medium",
+				"instance/hostname":                          "vm-1.us-central1-a.c.test-project.internal",
+				"instance/network-interfaces/0/network":      "projects/123/networks/default",
+				"instance/service-accounts/default/identity": unsignedToken(`{"google":{"compute_engine":{"project_id":"test-project","project_number":123,"zone":"us-central1-a"}}}`),
+			},
+		},
+		{
+			name:   "zone and region",
+			config: `"projectId": ""`,
+			values: map[string]string{
+				"instance/zone":   "projects/123/zones/us-central1-a",
+				"instance/region": "projects/123/regions/europe-west1",
+			},
+			want: []string{
+				`metadata "instance/region": region "europe-west1" contradicts the zone "us-central1-a" of metadata "instance/zone"`,
+			},
+		},
+		{
+			name:   "project number",
+			config: `"projectNumber": 123`,
+			values: map[string]string{
+				"instance/machine-type":                 "https://www.googleapis.com/compute/v1/projects/456/zones/us-central1-a/machineTypes/e2-medium",
+				"instance/network-interfaces/0/network": "projects/123/networks/default",
+				"project/numeric-project-id":            "789",
+			},
+			want: []string{
+				`metadata "instance/machine-type": project number "456" contradicts "123" of projectNumber`,
+				`metadata "project/numeric-project-id": project number "789" contradicts "123" of projectNumber`,
+			},
+		},
+		{
+			name:   "hostname and token claims",
+			config: `"projectId": "test-project", "zone": "us-central1-a"`,
+			values: map[string]string{
+				"instance/hostname":                          "vm-1.us-east1-b.c.other-project.internal",
+				"instance/service-accounts/default/identity": unsignedToken(`{"google":{"compute_engine":{"project_id":"test-project","project_number":"456","zone":"europe-west1-b"}}}`),
+			},
+			want: []string{
+				`metadata "instance/hostname": project ID "other-project" contradicts "test-project" of projectId`,
+				`metadata "instance/hostname": zone "us-east1-b" contradicts "us-central1-a" of zone`,
+				`metadata "instance/service-accounts/default/identity" claim zone: zone "europe-west1-b" contradicts "us-central1-a" of zone`,
+			},
+		},
+		{
+			name:   "unparsed values",
+			config: `"projectNumber": 123`,
+			values: map[string]string{
+				"instance/zone":     "desired-zone-name",
+				"instance/hostname": "localhost",
+				"instance/service-accounts/default/identity": "not-a-token",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			metadata := make(map[string]any)
+			for k, v := range test.values {
+				metadata[k] = map[string]string{"value": v}
+			}
+			data, err := json.Marshal(metadata)
+			if err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			name := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(name, []byte(`{`+test.config+`, "metadata": `+string(data)+`}`), 0o600); err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			c, err := metadataserver.NewConfigFromFile(name)
+			if err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			var got []string
+			for _, err := range c.CheckConsistency() {
+				got = append(got, err.Error())
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("contradictions mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCheckConsistencyDoesNotCallHandlers(t *testing.T) {
+	c := &metadataserver.Configuration{
+		ProjectNumber: 123,
+		Handlers: map[string]metadataserver.Metadata{
+			"instance/zone": func() string {
+				t.Errorf("expected the handler not to be called")
+				return "projects/456/zones/us-central1-a"
+			},
+		},
+	}
+	if errs := c.CheckConsistency(); len(errs) != 0 {
+		t.Errorf("expected no contradictions, got: %v", errs)
+	}
+}
+
+func TestValidateConfigFileConsistency(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "config.json")
+	config := `{
+		"projectNumber": 123,
+		"metadata": {
+			"instance/zone": {"value": "projects/123/zones/us-central1-a"},
+			"instance/region": {"value": "projects/456/regions/us-central1"}
+		}
+	}`
+	if err := os.WriteFile(name, []byte(config), 0o644); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	want := []string{`metadata "instance/region": project number "456" contradicts "123" of projectNumber`}
+	var got []string
+	for _, err := range metadataserver.ValidateConfigFile(name) {
+		got = append(got, err.Error())
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("diagnostics mismatch (-want +got):\n%s", diff)
+	}
+}
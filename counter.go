@@ -0,0 +1,84 @@
+package metadataserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+)
+
+// HandlerResetter is implemented by stateful handlers that restore their initial state when the server is reset (see [Server.Reset]).
+type HandlerResetter interface {
+	Reset()
+}
+
+// Counter is a stateful handler which value increments each time it is served.
+// The first request gets the start value. Use it to probe how many times clients poll the metadata.
+// Only GET requests of the counter's path increment it; HEAD requests and templates that reference the counter
+// get the value that the next GET request gets.
+type Counter struct {
+	start, step int64
+	n           atomic.Int64
+}
+
+// NewCounter returns a counter that starts at the start value and increments by the step.
+func NewCounter(start, step int64) *Counter {
+	return &Counter{start: start, step: step}
+}
+
+func (c *Counter) Serve(ctx context.Context, r *http.Request) (Response, error) {
+	n := c.n.Load()
+	if r.Method == http.MethodGet && !isReference(ctx) {
+		n = c.n.Add(1) - 1
+	}
+	return Response{Body: strconv.FormatInt(c.start+n*c.step, 10)}, nil
+}
+
+// Count returns the number of times the counter was served since it was created or reset.
+func (c *Counter) Count() int64 {
+	return c.n.Load()
+}
+
+// Reset restarts the counter from the start value.
+func (c *Counter) Reset() {
+	c.n.Store(0)
+}
+
+// newCounterFromSpec returns the counter of the JSON definition {"start": 0, "step": 1}.
+// The step is 1 if it is not set.
+func newCounterFromSpec(v any) (*Counter, error) {
+	spec, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("expected object, got %T", v)
+	}
+	values := map[string]int64{"start": 0, "step": 1}
+	for k, fv := range spec {
+		if _, ok := values[k]; !ok {
+			return nil, fmt.Errorf("unknown field %q", k)
+		}
+		f, ok := fv.(float64)
+		if !ok || f != float64(int64(f)) {
+			return nil, fmt.Errorf("%s must be an integer, got %v", k, fv)
+		}
+		values[k] = int64(f)
+	}
+	return NewCounter(values["start"], values["step"]), nil
+}
+
+// resetHandlers resets the stateful handlers of the server and its profiles that implement [HandlerResetter].
+func (s *Server) resetHandlers() {
+	handlers := []map[string]Handler{s.statefulHandlers()}
+	for _, p := range s.profiles {
+		if p.config != nil {
+			handlers = append(handlers, p.config.StatefulHandlers)
+		}
+	}
+	for _, hs := range handlers {
+		for _, h := range hs {
+			if r, ok := h.(HandlerResetter); ok {
+				r.Reset()
+			}
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package metadataserver_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/minherz/metadataserver"
+)
+
+func TestCounter(t *testing.T) {
+	s, err := metadataserver.New(metadataserver.WithConfigFile("test/fixtures/config_counter.json"))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	get := func(path string) string {
+		rec := httptest.NewRecorder()
+		s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/"+path, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("expected status %d, got: %d", http.StatusOK, rec.Code)
+		}
+		return rec.Body.String()
+	}
+	var got []string
+	for range 3 {
+		got = append(got, get("instance/attributes/polls"), get("instance/attributes/sequence"))
+	}
+	want := []string{"0", "100", "1", "110", "2", "120"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("values mismatch (-want +got):\n%s", diff)
+	}
+
+	s.Reset()
+	if got := get("instance/attributes/sequence"); got != "100" {
+		t.Errorf("expected %q after reset, got: %q", "100", got)
+	}
+}
+
+func TestCounterHandler(t *testing.T) {
+	c := metadataserver.NewCounter(5, -1)
+	s, err := metadataserver.New(metadataserver.WithHandler("instance/attributes/countdown", c))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	for _, want := range []string{"5", "4", "3"} {
+		if got, _ := s.GetValue("instance/attributes/countdown"); got != want {
+			t.Errorf("expected %q, got: %q", want, got)
+		}
+	}
+	if c.Count() != 3 {
+		t.Errorf("expected count 3, got: %d", c.Count())
+	}
+	s.Reset()
+	if c.Count() != 0 {
+		t.Errorf("expected count 0 after reset, got: %d", c.Count())
+	}
+}
+
+func TestCounterCountsOnlyDirectRequests(t *testing.T) {
+	c := metadataserver.NewCounter(0, 1)
+	s, err := metadataserver.New(
+		metadataserver.WithHandler("instance/attributes/polls", c),
+		metadataserver.WithHandlers(map[string]metadataserver.Metadata{"instance/attributes/role": func() string { return "web" }}),
+	)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	serve := func(method, path string) string {
+		rec := httptest.NewRecorder()
+		s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(method, metadataserver.DefaultEndpoint+"/"+path, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s %s: expected status %d, got: %d", method, path, http.StatusOK, rec.Code)
+		}
+		return rec.Body.String()
+	}
+	serve(http.MethodGet, "instance/attributes/")
+	serve(http.MethodGet, "instance/attributes/?recursive=true")
+	serve(http.MethodGet, "instance/?recursive=true")
+	serve(http.MethodHead, "instance/attributes/polls")
+	if c.Count() != 0 {
+		t.Errorf("expected count 0 after listing the directory, got: %d", c.Count())
+	}
+	if got := serve(http.MethodGet, "instance/attributes/polls"); got != "0" {
+		t.Errorf("expected %q, got: %q", "0", got)
+	}
+	if c.Count() != 1 {
+		t.Errorf("expected count 1, got: %d", c.Count())
+	}
+}
+
+func TestCounterErrors(t *testing.T) {
+	tests := []struct {
+		counter string
+		want    string
+	}{
+		{`"1"`, `invalid counter of metadata "a": expected object, got string`},
+		{`{"start": 1.5}`, `invalid counter of metadata "a": start must be an integer, got 1.5`},
+		{`{"by": 1}`, `invalid counter of metadata "a": unknown field "by"`},
+	}
+	for _, test := range tests {
+		t.Run(test.counter, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "config.json")
+			data := `{"metadata": {"a": {"counter": ` + test.counter + `}}}`
+			if err := os.WriteFile(name, []byte(data), 0o600); err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			_, err := metadataserver.NewConfigFromFile(name)
+			if err == nil || err.Error() != test.want {
+				t.Errorf("expected error %q, got: %v", test.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package metadataserver
+
+import (
+	"encoding/json"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// instanceDescription is a subset of the Compute Engine instance resource
+// that is printed by "gcloud compute instances describe --format=json".
+type instanceDescription struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Hostname    string `json:"hostname"`
+	Description string `json:"description"`
+	Zone        string `json:"zone"`
+	MachineType string `json:"machineType"`
+	CPUPlatform string `json:"cpuPlatform"`
+	Tags        struct {
+		Items []string `json:"items"`
+	} `json:"tags"`
+	Metadata struct {
+		Items []instanceMetadataItem `json:"items"`
+	} `json:"metadata"`
+	NetworkInterfaces []instanceNetworkInterface `json:"networkInterfaces"`
+	Disks             []instanceDisk             `json:"disks"`
+	ServiceAccounts   []instanceServiceAccount   `json:"serviceAccounts"`
+	Scheduling        struct {
+		AutomaticRestart  *bool  `json:"automaticRestart"`
+		OnHostMaintenance string `json:"onHostMaintenance"`
+		Preemptible       bool   `json:"preemptible"`
+	} `json:"scheduling"`
+}
+
+type instanceMetadataItem struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type instanceNetworkInterface struct {
+	Network       string                 `json:"network"`
+	NetworkIP     string                 `json:"networkIP"`
+	AccessConfigs []instanceAccessConfig `json:"accessConfigs"`
+}
+
+type instanceAccessConfig struct {
+	NatIP string `json:"natIP"`
+	Type  string `json:"type"`
+}
+
+type instanceDisk struct {
+	DeviceName string `json:"deviceName"`
+	Index      int    `json:"index"`
+	Mode       string `json:"mode"`
+	Type       string `json:"type"`
+}
+
+type instanceServiceAccount struct {
+	Email  string   `json:"email"`
+	Scopes []string `json:"scopes"`
+}
+
+// NewConfigFromInstanceDescribe instantiates a new `Configuration` object from the JSON that is printed by
+// "gcloud compute instances describe --format=json".
+// The metadata tree includes the instance's identity, zone, machine type, network interfaces, disks,
+// service accounts, scheduling and custom metadata attributes.
+func NewConfigFromInstanceDescribe(r io.Reader) (*Configuration, error) {
+	var d instanceDescription
+	if err := json.NewDecoder(r).Decode(&d); err != nil {
+		return nil, err
+	}
+	return d.configuration()
+}
+
+// configuration returns a new configuration with the metadata of the instance.
+func (d *instanceDescription) configuration() (*Configuration, error) {
+	values := make(map[string]string)
+	set := func(key, value string) {
+		if value != "" {
+			values[key] = value
+		}
+	}
+	project := resourceProject(d.Zone)
+	set("project/project-id", project)
+	set("instance/id", d.ID)
+	set("instance/name", d.Name)
+	set("instance/hostname", d.Hostname)
+	if d.Hostname == "" && d.Name != "" && project != "" {
+		set("instance/hostname", d.Name+"."+path.Base(d.Zone)+".c."+project+".internal")
+	}
+	set("instance/description", d.Description)
+	set("instance/zone", relativeResourceName(d.Zone))
+	set("instance/machine-type", relativeResourceName(d.MachineType))
+	set("instance/cpu-platform", d.CPUPlatform)
+	if d.Tags.Items != nil {
+		tags, err := json.Marshal(d.Tags.Items)
+		if err != nil {
+			return nil, err
+		}
+		set("instance/tags", string(tags))
+	}
+	for _, item := range d.Metadata.Items {
+		values["instance/attributes/"+item.Key] = item.Value
+	}
+	for i, ni := range d.NetworkInterfaces {
+		prefix := "instance/network-interfaces/" + strconv.Itoa(i) + "/"
+		set(prefix+"ip", ni.NetworkIP)
+		set(prefix+"network", relativeResourceName(ni.Network))
+		for j, ac := range ni.AccessConfigs {
+			set(prefix+"access-configs/"+strconv.Itoa(j)+"/external-ip", ac.NatIP)
+			set(prefix+"access-configs/"+strconv.Itoa(j)+"/type", ac.Type)
+		}
+	}
+	for _, disk := range d.Disks {
+		prefix := "instance/disks/" + strconv.Itoa(disk.Index) + "/"
+		set(prefix+"device-name", disk.DeviceName)
+		set(prefix+"mode", disk.Mode)
+		set(prefix+"type", disk.Type)
+	}
+	for i, sa := range d.ServiceAccounts {
+		accounts := []string{sa.Email}
+		if i == 0 {
+			accounts = append(accounts, "default")
+		}
+		for _, account := range accounts {
+			prefix := "instance/service-accounts/" + account + "/"
+			set(prefix+"email", sa.Email)
+			set(prefix+"scopes", strings.Join(sa.Scopes, "\n"))
+		}
+	}
+	if d.Scheduling.AutomaticRestart != nil {
+		set("instance/scheduling/automatic-restart", strings.ToUpper(strconv.FormatBool(*d.Scheduling.AutomaticRestart)))
+	}
+	set("instance/scheduling/on-host-maintenance", d.Scheduling.OnHostMaintenance)
+	set("instance/scheduling/preemptible", strings.ToUpper(strconv.FormatBool(d.Scheduling.Preemptible)))
+
+	m := make(map[string]any, len(values))
+	for k, v := range values {
+		m[k] = map[string]any{"value": v}
+	}
+	c := NewConfiguration(DefaultConfigurationHandlers)
+	if err := convert(c, m, ""); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// relativeResourceName returns the resource name relative to the Compute Engine API URL,
+// e.g. "projects/my-project/zones/us-central1-a".
+func relativeResourceName(selfLink string) string {
+	if i := strings.Index(selfLink, "projects/"); i >= 0 {
+		return selfLink[i:]
+	}
+	return selfLink
+}
+
+// resourceProject returns the project ID of the resource URL.
+func resourceProject(selfLink string) string {
+	_, rest, ok := strings.Cut(selfLink, "projects/")
+	if !ok {
+		return ""
+	}
+	project, _, _ := strings.Cut(rest, "/")
+	return project
+}
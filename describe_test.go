@@ -0,0 +1,53 @@
+package metadataserver_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/minherz/metadataserver"
+)
+
+func TestNewConfigFromInstanceDescribe(t *testing.T) {
+	f, err := os.Open("test/fixtures/instance_describe.json")
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	defer f.Close()
+	c, err := metadataserver.NewConfigFromInstanceDescribe(f)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	want := map[string]string{
+		"project/project-id":                    "my-project",
+		"instance/id":                           "1234567890123456789",
+		"instance/name":                         "test-instance",
+		"instance/hostname":                     "test-instance.us-central1-a.c.my-project.internal",
+		"instance/zone":                         "projects/my-project/zones/us-central1-a",
+		"instance/machine-type":                 "projects/my-project/zones/us-central1-a/machineTypes/e2-medium",
+		"instance/cpu-platform":                 "Intel Broadwell",
+		"instance/tags":                         `["http-server"]`,
+		"instance/attributes/startup-script":    "#!/bin/bash\necho hello",
+		"instance/network-interfaces/0/ip":      "10.128.0.2",
+		"instance/network-interfaces/0/network": "projects/my-project/global/networks/default",
+		"instance/network-interfaces/0/access-configs/0/external-ip":                 "34.0.0.1",
+		"instance/network-interfaces/0/access-configs/0/type":                        "ONE_TO_ONE_NAT",
+		"instance/disks/0/device-name":                                               "test-instance",
+		"instance/disks/0/mode":                                                      "READ_WRITE",
+		"instance/disks/0/type":                                                      "PERSISTENT",
+		"instance/service-accounts/default/email":                                    "123-compute@developer.gserviceaccount.com",
+		"instance/service-accounts/default/scopes":                                   "https://www.googleapis.com/auth/cloud-platform",
+		"instance/service-accounts/123-compute@developer.gserviceaccount.com/email":  "123-compute@developer.gserviceaccount.com",
+		"instance/service-accounts/123-compute@developer.gserviceaccount.com/scopes": "https://www.googleapis.com/auth/cloud-platform",
+		"instance/scheduling/automatic-restart":                                      "TRUE",
+		"instance/scheduling/on-host-maintenance":                                    "MIGRATE",
+		"instance/scheduling/preemptible":                                            "FALSE",
+	}
+	got := make(map[string]string)
+	for k, h := range c.Handlers {
+		got[k] = h()
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("metadata mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,164 @@
+package metadataserver
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// MetadataHostnames are the hostnames of the metadata server that the DNS stub resolves.
+var MetadataHostnames = []string{"metadata.google.internal", "metadata"}
+
+// DNS response codes and record types that are used by the DNS stub.
+const (
+	dnsTypeA        = 1
+	dnsTypeAAAA     = 28
+	dnsClassIN      = 1
+	dnsRcodeOK      = 0
+	dnsRcodeFormErr = 1
+	dnsRcodeRefused = 5
+	dnsHeaderSize   = 12
+	dnsTTL          = 60
+)
+
+// WithDNS sets a new server to run a DNS stub on UDP port that resolves [MetadataHostnames]
+// to the server's address. Queries for other names are refused.
+// The stub is served at the same IP address as metadata. If the address is not an IP address
+// or is unspecified, the hostnames are resolved to the loopback address.
+// The DNS stub is disabled when the port is 0.
+func WithDNS(port int) Option {
+	return func(s *Server) {
+		s.dnsPort = port
+	}
+}
+
+// HostsEntry returns the line for /etc/hosts file that maps [MetadataHostnames] to the server's address.
+func (s *Server) HostsEntry() string {
+	return s.dnsAddress().String() + " " + strings.Join(MetadataHostnames, " ")
+}
+
+// dnsAddress returns the address that the metadata hostnames are resolved to.
+func (s *Server) dnsAddress() net.IP {
+	ip := net.ParseIP(s.config.Address)
+	if ip == nil || ip.IsUnspecified() {
+		return net.IPv4(127, 0, 0, 1)
+	}
+	return ip
+}
+
+func (s *Server) startDNS(ctx context.Context) error {
+	addr := net.JoinHostPort(s.config.Address, strconv.Itoa(s.dnsPort))
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return bindError("udp", addr, err)
+	}
+	s.dns = conn
+	s.logger.DebugContext(ctx, "starting DNS stub", slog.String("address", addr))
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					s.logger.ErrorContext(ctx, "error reading DNS query", slog.String("error", err.Error()))
+				}
+				return
+			}
+			resp, ok := s.answerDNS(buf[:n])
+			if !ok {
+				continue
+			}
+			if _, err := conn.WriteTo(resp, from); err != nil {
+				s.logger.ErrorContext(ctx, "error writing DNS response", slog.String("error", err.Error()))
+			}
+		}
+	}()
+	return nil
+}
+
+// answerDNS returns the response to the DNS query.
+// It returns false if the query is malformed and should be ignored.
+func (s *Server) answerDNS(query []byte) ([]byte, bool) {
+	if len(query) < dnsHeaderSize || query[2]&0x80 != 0 {
+		return nil, false
+	}
+	if binary.BigEndian.Uint16(query[4:6]) != 1 {
+		return dnsResponse(query, dnsHeaderSize, dnsRcodeFormErr), true
+	}
+	name, end, ok := dnsName(query, dnsHeaderSize)
+	if !ok || end+4 > len(query) {
+		return nil, false
+	}
+	qtype := binary.BigEndian.Uint16(query[end : end+2])
+	qclass := binary.BigEndian.Uint16(query[end+2 : end+4])
+	end += 4
+	if !isMetadataHostname(name) {
+		return dnsResponse(query, end, dnsRcodeRefused), true
+	}
+	resp := dnsResponse(query, end, dnsRcodeOK)
+	ip := s.dnsAddress()
+	rdata := ip.To4()
+	rtype := uint16(dnsTypeA)
+	if rdata == nil {
+		rdata = ip.To16()
+		rtype = dnsTypeAAAA
+	}
+	if qtype != rtype || qclass != dnsClassIN {
+		// the name exists but has no records of the requested type
+		return resp, true
+	}
+	binary.BigEndian.PutUint16(resp[6:8], 1)
+	// the answer's name points to the name in the question
+	resp = append(resp, 0xc0, dnsHeaderSize)
+	resp = binary.BigEndian.AppendUint16(resp, rtype)
+	resp = binary.BigEndian.AppendUint16(resp, dnsClassIN)
+	resp = binary.BigEndian.AppendUint32(resp, dnsTTL)
+	resp = binary.BigEndian.AppendUint16(resp, uint16(len(rdata)))
+	return append(resp, rdata...), true
+}
+
+// dnsResponse returns the response header followed by the question of the query that ends at the offset.
+func dnsResponse(query []byte, end int, rcode byte) []byte {
+	resp := make([]byte, end, end+16)
+	copy(resp, query[:end])
+	// QR and AA flags with the opcode and RD flag of the query
+	resp[2] = 0x80 | query[2]&0x79 | 0x04
+	resp[3] = rcode
+	if end == dnsHeaderSize {
+		binary.BigEndian.PutUint16(resp[4:6], 0)
+	}
+	clear(resp[6:dnsHeaderSize])
+	return resp
+}
+
+// dnsName reads the uncompressed domain name at the offset.
+// It returns the name and the offset after the name.
+func dnsName(msg []byte, offset int) (string, int, bool) {
+	var labels []string
+	for offset < len(msg) {
+		n := int(msg[offset])
+		offset++
+		if n == 0 {
+			return strings.Join(labels, "."), offset, true
+		}
+		if n&0xc0 != 0 || offset+n > len(msg) {
+			return "", 0, false
+		}
+		labels = append(labels, string(msg[offset:offset+n]))
+		offset += n
+	}
+	return "", 0, false
+}
+
+func isMetadataHostname(name string) bool {
+	for _, h := range MetadataHostnames {
+		if strings.EqualFold(name, h) {
+			return true
+		}
+	}
+	return false
+}
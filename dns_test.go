@@ -0,0 +1,61 @@
+package metadataserver_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/minherz/metadataserver"
+)
+
+func TestDNS(t *testing.T) {
+	ctx := context.Background()
+	port := freePort()
+	s, err := metadataserver.New(
+		metadataserver.WithAddress("127.0.0.1"),
+		metadataserver.WithPort(freePort()),
+		metadataserver.WithDNS(port))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if err := s.Start(ctx); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	defer s.Stop(ctx)
+
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "udp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+		},
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	addrs, err := resolver.LookupHost(ctx, "metadata.google.internal")
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if diff := cmp.Diff([]string{"127.0.0.1"}, addrs); diff != "" {
+		t.Errorf("addresses mismatch (-want +got):\n%s", diff)
+	}
+	_, err = resolver.LookupHost(ctx, "example.com")
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) {
+		t.Errorf("expected DNS error for unknown host, got: %v", err)
+	}
+}
+
+func TestHostsEntry(t *testing.T) {
+	s, err := metadataserver.New()
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if got, want := s.HostsEntry(), "169.254.169.254 metadata.google.internal metadata"; got != want {
+		t.Errorf("expected hosts entry %q, got: %q", want, got)
+	}
+}
@@ -11,6 +11,7 @@ Customize metadata and set up [Server] using one of [Option]'s:
 * [WithPort] to set port to serve metadata
 * [WithHandlers] to set metadata handlers
 * [WithConfigFile] to set [Configuration] loaded from JSON file
+* [WithAdminPort] to serve admin API that controls the server at runtime
 
 # Unit testing
 
@@ -0,0 +1,106 @@
+package metadataserver
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+)
+
+var (
+	// ErrConfigInvalid indicates that the configuration cannot be served, e.g. it has an invalid address,
+	// conflicting metadata paths or a malformed configuration file. The error is [ConfigError].
+	ErrConfigInvalid error = errors.New("invalid configuration")
+	// ErrHandlerPanic indicates that a metadata handler or a middleware panicked. The error is [HandlerPanicError].
+	ErrHandlerPanic error = errors.New("handler panicked")
+	// ErrHandlerInitFailed indicates that Init of a stateful handler failed when the server started.
+	ErrHandlerInitFailed error = errors.New("failed to initialize handler")
+	// ErrHandlerCloseFailed indicates that Close of a stateful handler failed when the server stopped.
+	ErrHandlerCloseFailed error = errors.New("failed to close handler")
+)
+
+// ConfigError describes the problem of the configuration that prevents the server from serving it.
+// It matches [ErrConfigInvalid] with [errors.Is] and keeps the message of the underlying error:
+//
+//	if errors.Is(err, metadataserver.ErrConfigInvalid) {
+//		log.Fatalf("fix the configuration: %v", err)
+//	}
+type ConfigError struct {
+	// Err is the problem of the configuration.
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns [ErrConfigInvalid] and the problem of the configuration.
+func (e *ConfigError) Unwrap() []error {
+	return []error{ErrConfigInvalid, e.Err}
+}
+
+// configError returns [ConfigError] of the problem or nil if err is nil.
+// The errors that are already [ConfigError] are returned as is.
+func configError(err error) error {
+	var ce *ConfigError
+	if err == nil || errors.As(err, &ce) {
+		return err
+	}
+	return &ConfigError{Err: err}
+}
+
+// HandlerPanicError describes the panic of a handler. The server recovers the panics of the handlers
+// that serve metadata and responds with 500 (Internal Server Error); the error is reported by [Server.State] then.
+type HandlerPanicError struct {
+	// Path is the path of the request or the metadata path of the stateful handler.
+	Path string
+	// Value is the value passed to panic.
+	Value any
+	// Stack is the stack trace of the goroutine that panicked.
+	Stack []byte
+}
+
+func (e *HandlerPanicError) Error() string {
+	return fmt.Sprintf("handler of %q panicked: %v", e.Path, e.Value)
+}
+
+// Unwrap returns [ErrHandlerPanic] and the value passed to panic if it is an error.
+func (e *HandlerPanicError) Unwrap() []error {
+	if err, ok := e.Value.(error); ok {
+		return []error{ErrHandlerPanic, err}
+	}
+	return []error{ErrHandlerPanic}
+}
+
+// callHandler calls fn of the stateful handler at the path and returns [HandlerPanicError] if it panics.
+func callHandler(path string, fn func() error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &HandlerPanicError{Path: path, Value: v, Stack: debug.Stack()}
+		}
+	}()
+	return fn()
+}
+
+// recoverPanics responds with 500 (Internal Server Error) if the handler panics and records [HandlerPanicError]
+// as the last error of the server. [http.ErrAbortHandler] is re-panicked to abort the response.
+func (s *Server) recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			err := &HandlerPanicError{Path: r.URL.Path, Value: v, Stack: debug.Stack()}
+			s.handlerLogger.ErrorContext(r.Context(), "handler panicked", slog.String("handler", r.URL.Path),
+				slog.Any("panic", v), slog.String("stack", string(err.Stack)))
+			s.setLastError(err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
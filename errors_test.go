@@ -0,0 +1,113 @@
+package metadataserver_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestConfigErrors(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(name, []byte(`{"metadata": {"zone": {"value": 1}`), 0o644); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	_, fileErr := metadataserver.NewConfigFromFile(name)
+	_, newErr := metadataserver.New(metadataserver.WithAddress("fd00::zz"))
+	_, conflictErr := metadataserver.New(metadataserver.WithHandlers(map[string]metadataserver.Metadata{
+		"instance":      func() string { return "a" },
+		"instance/zone": func() string { return "b" },
+	}))
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"config file", fileErr},
+		{"address", newErr},
+		{"conflicting paths", conflictErr},
+		{"validate", metadataserver.ValidateConfigFile(name)[0]},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if !errors.Is(test.err, metadataserver.ErrConfigInvalid) {
+				t.Errorf("expected %v, got: %v", metadataserver.ErrConfigInvalid, test.err)
+			}
+			var ce *metadataserver.ConfigError
+			if !errors.As(test.err, &ce) {
+				t.Errorf("expected ConfigError, got: %T", test.err)
+			}
+		})
+	}
+	if _, err := metadataserver.NewConfigFromFile(filepath.Join(t.TempDir(), "missing.json")); errors.Is(err, metadataserver.ErrConfigInvalid) || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected %v, got: %v", os.ErrNotExist, err)
+	}
+}
+
+func TestHandlerPanic(t *testing.T) {
+	s, err := metadataserver.New(metadataserver.WithHandlers(map[string]metadataserver.Metadata{
+		"instance/zone": func() string { panic("no zone") },
+	}))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/instance/zone", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got: %d", http.StatusInternalServerError, rec.Code)
+	}
+	err = s.State().LastError
+	if !errors.Is(err, metadataserver.ErrHandlerPanic) {
+		t.Fatalf("expected %v, got: %v", metadataserver.ErrHandlerPanic, err)
+	}
+	var pe *metadataserver.HandlerPanicError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected HandlerPanicError, got: %T", err)
+	}
+	if want := metadataserver.DefaultEndpoint + "/instance/zone"; pe.Path != want || pe.Value != "no zone" || len(pe.Stack) == 0 {
+		t.Errorf("expected panic of %q with %q and stack, got: %q with %v", want, "no zone", pe.Path, pe.Value)
+	}
+}
+
+// panickingHandler panics when the server initializes it.
+type panickingHandler struct{}
+
+func (panickingHandler) Serve(ctx context.Context, r *http.Request) (metadataserver.Response, error) {
+	return metadataserver.Response{}, nil
+}
+
+func (panickingHandler) Init(ctx context.Context) error {
+	panic(io.ErrUnexpectedEOF)
+}
+
+func TestStartErrors(t *testing.T) {
+	s, err := metadataserver.New(
+		metadataserver.WithAddress("127.0.0.1"),
+		metadataserver.WithPort(freePort()),
+		metadataserver.WithHandler("a", panickingHandler{}))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	err = s.Start(context.Background())
+	for _, want := range []error{metadataserver.ErrHandlerInitFailed, metadataserver.ErrHandlerPanic, io.ErrUnexpectedEOF} {
+		if !errors.Is(err, want) {
+			t.Errorf("expected %v, got: %v", want, err)
+		}
+	}
+
+	s, err = metadataserver.New(
+		metadataserver.WithAddress("127.0.0.1"),
+		metadataserver.WithPort(freePort()),
+		metadataserver.WithPreflight(func(ctx context.Context) error { return io.EOF }))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if err := s.Start(context.Background()); !errors.Is(err, metadataserver.ErrPreflightFailed) || !errors.Is(err, io.EOF) {
+		t.Errorf("expected %v, got: %v", metadataserver.ErrPreflightFailed, err)
+	}
+}
@@ -0,0 +1,75 @@
+package metadataserver
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// etag returns a strong entity tag of the value: the FNV-1a hash of the value in quotes.
+// The hash is computed inline to avoid allocations on the request path.
+func etag[T string | []byte](value T) string {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	h := uint64(offset64)
+	for i := 0; i < len(value); i++ {
+		h ^= uint64(value[i])
+		h *= prime64
+	}
+	var buf [18]byte
+	b := append(buf[:0], '"')
+	b = strconv.AppendUint(b, h, 16)
+	b = append(b, '"')
+	return string(b)
+}
+
+// lastETag keeps the entity tag of the value that the handler of the route returned last time,
+// so the values that do not change are served without allocations.
+type lastETag struct {
+	value string
+	tag   []string
+}
+
+// etagOf returns the ETag header value of the value that the handler of the route returns.
+func (rt *route) etagOf(value string) []string {
+	if rt.lastETag == nil {
+		return []string{etag(value)}
+	}
+	if last := rt.lastETag.Load(); last != nil && last.value == value {
+		return last.tag
+	}
+	last := &lastETag{value: value, tag: []string{etag(value)}}
+	rt.lastETag.Store(last)
+	return last.tag
+}
+
+// writeETag sets the ETag header of the response and responds with 304 (Not Modified)
+// if the If-None-Match header of the request matches the tag.
+// It returns true if the response is written.
+func writeETag(w http.ResponseWriter, r *http.Request, tag []string) bool {
+	w.Header()["Etag"] = tag
+	inm, ok := r.Header["If-None-Match"]
+	if !ok || !etagMatches(inm, tag[0]) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches reports whether one of the entity tags in the If-None-Match header values matches the tag.
+// The comparison is weak: "W/" prefixes are ignored. "*" matches any tag.
+func etagMatches(values []string, tag string) bool {
+	for _, v := range values {
+		for v != "" {
+			var t string
+			t, v, _ = strings.Cut(v, ",")
+			t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+			if t == "*" || t == tag {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package metadataserver_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestETag(t *testing.T) {
+	c, err := metadataserver.NewConfigFromFile("test/fixtures/config_literal_handlers.json")
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	c.Handlers["instance/hostname"] = func() string { return "test-host" }
+	c.BytesHandlers = map[string]metadataserver.BytesMetadata{
+		"instance/attributes/config": func() ([]byte, string) { return []byte(`{"a":1}`), "application/json" },
+	}
+	c.ResponseHandlers = map[string]metadataserver.ResponseFunc{
+		"instance/attributes/tagged": func(ctx context.Context, r *http.Request) (metadataserver.Response, error) {
+			return metadataserver.Response{Headers: http.Header{"Etag": {`"v1"`}}, Body: "tagged"}, nil
+		},
+		"instance/attributes/missing": func(ctx context.Context, r *http.Request) (metadataserver.Response, error) {
+			return metadataserver.Response{Status: http.StatusNotFound}, nil
+		},
+	}
+	s, err := metadataserver.New(metadataserver.WithConfiguration(c))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	s.SetValue("instance/attributes/runtime", "set")
+	get := func(path, inm string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, c.Endpoint+"/"+path, nil)
+		if inm != "" {
+			req.Header.Set("If-None-Match", inm)
+		}
+		rec := httptest.NewRecorder()
+		s.HttpHandler().ServeHTTP(rec, req)
+		return rec
+	}
+	for _, path := range []string{"entry1", "instance/hostname", "instance/attributes/config", "instance/attributes/tagged", "instance/attributes/runtime"} {
+		t.Run(path, func(t *testing.T) {
+			rec := get(path, "")
+			tag := rec.Header().Get("Etag")
+			if rec.Code != http.StatusOK || tag == "" {
+				t.Fatalf("expected status %d with ETag, got: %d %q", http.StatusOK, rec.Code, tag)
+			}
+			for _, inm := range []string{tag, "W/" + tag, `"other", ` + tag, "*"} {
+				rec := get(path, inm)
+				if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+					t.Errorf("If-None-Match %s: expected status %d without body, got: %d %q", inm, http.StatusNotModified, rec.Code, rec.Body.String())
+				}
+				if got := rec.Header().Get("Etag"); got != tag {
+					t.Errorf("If-None-Match %s: expected ETag %s, got: %s", inm, tag, got)
+				}
+			}
+			if rec := get(path, `"other"`); rec.Code != http.StatusOK || rec.Body.Len() == 0 {
+				t.Errorf("expected status %d with body for other tag, got: %d", http.StatusOK, rec.Code)
+			}
+		})
+	}
+	if got := get("instance/attributes/tagged", "").Header().Get("Etag"); got != `"v1"` {
+		t.Errorf("expected handler's ETag %q, got: %q", `"v1"`, got)
+	}
+	if rec := get("instance/attributes/missing", "*"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got: %d", http.StatusNotFound, rec.Code)
+	}
+
+	before := get("instance/attributes/runtime", "").Header().Get("Etag")
+	s.SetValue("instance/attributes/runtime", "changed")
+	if rec := get("instance/attributes/runtime", before); rec.Code != http.StatusOK {
+		t.Errorf("expected status %d after the value is changed, got: %d", http.StatusOK, rec.Code)
+	}
+}
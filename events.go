@@ -0,0 +1,130 @@
+package metadataserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// eventBuffer is the number of events that are buffered for each listener of the event stream.
+const eventBuffer = 64
+
+// Types of events in the event stream.
+const (
+	EventRequest  = "request"
+	EventChange   = "change"
+	EventScenario = "scenario"
+)
+
+// Event describes something that happened in the server. Exactly one of the details is set according to the type.
+type Event struct {
+	Time     time.Time      `json:"time"`
+	Type     string         `json:"type"`
+	Request  *RequestRecord `json:"request,omitempty"`
+	Change   *ChangeEvent   `json:"change,omitempty"`
+	Scenario *ScenarioEvent `json:"scenario,omitempty"`
+}
+
+// ScenarioEvent describes progress of the scenario.
+// The state is one of "started", "step", "completed" or "interrupted".
+// Action and path are set for executed steps.
+type ScenarioEvent struct {
+	Name   string `json:"name"`
+	State  string `json:"state"`
+	Action string `json:"action,omitempty"`
+	Path   string `json:"path,omitempty"`
+}
+
+// eventListeners keeps channels of the event stream listeners.
+// It uses its own lock because events are emitted while s.mu is held.
+type eventListeners struct {
+	mu        sync.Mutex
+	listeners []chan Event
+	// count allows to skip building events when nobody listens
+	count atomic.Int32
+}
+
+// active reports whether there are listeners of the event stream.
+func (l *eventListeners) active() bool {
+	return l.count.Load() > 0
+}
+
+func (l *eventListeners) add() chan Event {
+	ch := make(chan Event, eventBuffer)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.listeners = append(l.listeners, ch)
+	l.count.Add(1)
+	return ch
+}
+
+func (l *eventListeners) remove(ch chan Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, c := range l.listeners {
+		if c == ch {
+			l.listeners = append(l.listeners[:i], l.listeners[i+1:]...)
+			l.count.Add(-1)
+			return
+		}
+	}
+}
+
+// emit sends the event to all listeners. Events are dropped for listeners that do not read them in time.
+func (l *eventListeners) emit(e Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, ch := range l.listeners {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// serveEvents streams events as Server-Sent Events with JSON data
+// or as newline delimited JSON if the client accepts "application/x-ndjson".
+// The stream ends when the client disconnects or the server stops.
+func (s *Server) serveEvents(w http.ResponseWriter, r *http.Request) {
+	ndjson := strings.Contains(r.Header.Get("Accept"), "application/x-ndjson")
+	if ndjson {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	} else {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	// the listener is added before the response starts so no event is missed after the client connects
+	ch := s.events.add()
+	defer s.events.remove(ch)
+	s.mu.RLock()
+	done := s.done
+	s.mu.RUnlock()
+	rc := http.NewResponseController(w)
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+	for {
+		select {
+		case e := <-ch:
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			if ndjson {
+				data = append(data, '\n')
+			} else {
+				data = append(append([]byte("event: "+e.Type+"\ndata: "), data...), '\n', '\n')
+			}
+			if _, err := w.Write(data); err != nil {
+				return
+			}
+			rc.Flush()
+		case <-r.Context().Done():
+			return
+		case <-done:
+			return
+		}
+	}
+}
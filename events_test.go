@@ -0,0 +1,83 @@
+package metadataserver_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestEventStream(t *testing.T) {
+	s, err := metadataserver.New()
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	admin := httptest.NewServer(s.AdminHttpHandler())
+	defer admin.Close()
+	ts := httptest.NewServer(s.HttpHandler())
+	defer ts.Close()
+
+	tests := []struct {
+		name   string
+		accept string
+		prefix string
+	}{
+		{"ndjson", "application/x-ndjson", ""},
+		{"sse", "text/event-stream", "data: "},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, admin.URL+"/events", nil)
+			req.Header.Set("Accept", test.accept)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			defer resp.Body.Close()
+
+			getStatus(t, ts.URL+metadataserver.DefaultEndpoint+"/project/project-id")
+			s.SetValue("instance/zone", "zone-a")
+
+			events := make(chan metadataserver.Event, 16)
+			go func() {
+				sc := bufio.NewScanner(resp.Body)
+				for sc.Scan() {
+					data, ok := strings.CutPrefix(sc.Text(), test.prefix)
+					if !ok || data == "" {
+						continue
+					}
+					var e metadataserver.Event
+					if err := json.Unmarshal([]byte(data), &e); err == nil {
+						events <- e
+					}
+				}
+			}()
+			var got []string
+			for len(got) < 2 {
+				select {
+				case e := <-events:
+					switch e.Type {
+					case metadataserver.EventRequest:
+						got = append(got, e.Type+" "+e.Request.Path)
+					case metadataserver.EventChange:
+						got = append(got, e.Type+" "+e.Change.Path+"="+e.Change.Value)
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("expected 2 events, got: %v", got)
+				}
+			}
+			want := []string{
+				"request " + metadataserver.DefaultEndpoint + "/project/project-id",
+				"change instance/zone=zone-a",
+			}
+			if strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("expected events %v, got: %v", want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package metadataserver
+
+import (
+	"path"
+	"sort"
+)
+
+// Expectation describes the requests that are expected at a metadata path.
+// See [Server.Expect].
+type Expectation struct {
+	s       *Server
+	pattern string
+	// times is the expected number of requests or -1 if at least one request is expected
+	times int
+	calls int
+}
+
+// TestingT is the subset of [testing.TB] that is used by [Server.VerifyExpectations].
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+// Expect declares that the metadata at the path relative to the server's endpoint is expected to be requested.
+// The path can be a pattern with the syntax of [path.Match], e.g. "instance/service-accounts/*/token".
+// By default at least one request is expected. Use [Expectation.Times] to expect the exact number of requests.
+//
+// Once an expectation is declared, the server runs in strict mode:
+// requests at the paths that do not match any expectation are reported by [Server.VerifyExpectations].
+func (s *Server) Expect(pattern string) *Expectation {
+	e := &Expectation{s: s, pattern: normalizeKey(pattern), times: -1}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expectations = append(s.expectations, e)
+	return e
+}
+
+// Times sets the exact number of the expected requests.
+func (e *Expectation) Times(n int) *Expectation {
+	e.s.mu.Lock()
+	defer e.s.mu.Unlock()
+	e.times = n
+	return e
+}
+
+// VerifyExpectations reports the unmet expectations and the requests at the unexpected paths with t.Errorf.
+// It returns true if all expectations are met and there were no unexpected requests.
+func (s *Server) VerifyExpectations(t TestingT) bool {
+	t.Helper()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ok := true
+	for _, e := range s.expectations {
+		switch {
+		case e.times < 0 && e.calls == 0:
+			t.Errorf("metadata %q: expected at least one request, got none", e.pattern)
+			ok = false
+		case e.times >= 0 && e.calls != e.times:
+			t.Errorf("metadata %q: expected %d requests, got %d", e.pattern, e.times, e.calls)
+			ok = false
+		}
+	}
+	unexpected := make([]string, 0, len(s.unexpected))
+	for k := range s.unexpected {
+		unexpected = append(unexpected, k)
+	}
+	sort.Strings(unexpected)
+	for _, k := range unexpected {
+		t.Errorf("metadata %q: unexpected %d requests", k, s.unexpected[k])
+		ok = false
+	}
+	return ok
+}
+
+// updateExpectationsLocked counts the request in the first expectation that matches the request's path.
+// The caller must hold s.mu.
+func (s *Server) updateExpectationsLocked(record RequestRecord) {
+	key, ok := s.keyOf(record.Path)
+	if !ok {
+		key = record.Path
+	}
+	key = normalizeKey(key)
+	for _, e := range s.expectations {
+		if matched, _ := path.Match(e.pattern, key); matched {
+			e.calls++
+			return
+		}
+	}
+	if s.unexpected == nil {
+		s.unexpected = make(map[string]int)
+	}
+	s.unexpected[key]++
+}
@@ -0,0 +1,62 @@
+package metadataserver_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/minherz/metadataserver"
+)
+
+type fakeT struct {
+	errors []string
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Errorf(format string, args ...any) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestExpectations(t *testing.T) {
+	s, err := metadataserver.New(metadataserver.WithHandlers(map[string]metadataserver.Metadata{
+		"instance/zone": func() string { return "projects/1/zones/us-central1-a" },
+		"instance/name": func() string { return "vm" },
+		"instance/service-accounts/default/token": func() string { return "token" },
+	}))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	s.Expect("instance/zone").Times(2)
+	s.Expect("instance/service-accounts/*/token")
+	s.Expect("project/project-id")
+	get := func(path string) {
+		s.HttpHandler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/"+path, nil))
+	}
+	for _, p := range []string{"instance/zone", "instance/service-accounts/default/token", "instance/name", "instance/name"} {
+		get(p)
+	}
+
+	ft := &fakeT{}
+	if s.VerifyExpectations(ft) {
+		t.Errorf("expected failed verification")
+	}
+	want := []string{
+		`metadata "instance/zone": expected 2 requests, got 1`,
+		`metadata "project/project-id": expected at least one request, got none`,
+		`metadata "instance/name": unexpected 2 requests`,
+	}
+	if diff := cmp.Diff(want, ft.errors); diff != "" {
+		t.Errorf("errors mismatch (-want +got):\n%s", diff)
+	}
+
+	s.Reset()
+	for _, p := range []string{"instance/zone", "instance/zone", "instance/service-accounts/default/token", "project/project-id"} {
+		get(p)
+	}
+	if !s.VerifyExpectations(t) {
+		t.Errorf("expected met expectations after reset")
+	}
+}
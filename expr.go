@@ -0,0 +1,769 @@
+package metadataserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// exprMetadata serves the value of the expression.
+// Expressions are a small built-in language of string, integer and boolean literals,
+// the operators ! && || == != < <= > >= + - * in and ?:,
+// the request attributes request.path, request.method, request.host, request.clientIP,
+// request.headers["NAME"] and request.query["NAME"], the functions value("KEY"), size(x), string(x) and int(x)
+// and the string methods startsWith, endsWith, contains and matches("PATTERN").
+// The types are checked when the expression is evaluated, not when it is parsed.
+type exprMetadata struct {
+	s    *Server
+	expr *expr
+}
+
+// expr is a parsed expression of the metadata at the key.
+type expr struct {
+	key  string
+	text string
+	root exprNode
+}
+
+// exprMap is a map attribute of the request, e.g. the request headers.
+// Indexing the absent keys is an error; use the in operator to check the keys.
+type exprMap func(key string) (string, bool)
+
+type exprNode interface {
+	eval(d *templateData) (any, error)
+}
+
+// parseExpr parses the expression of the metadata at the key.
+func parseExpr(key, text string) (*expr, error) {
+	p := &exprParser{text: text}
+	p.next()
+	root, err := p.parseCond()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %q", p.tok.text)
+	}
+	return &expr{key: key, text: text, root: root}, nil
+}
+
+func (m *exprMetadata) Serve(ctx context.Context, r *http.Request) (Response, error) {
+	v, err := m.render(&templateData{s: m.s, r: r, visiting: make(map[string]bool)})
+	return Response{Body: v}, err
+}
+
+func (m *exprMetadata) render(d *templateData) (string, error) {
+	key := normalizeKey(m.expr.key)
+	if d.visiting[key] {
+		return "", fmt.Errorf("reference cycle at %q", key)
+	}
+	d.visiting[key] = true
+	defer delete(d.visiting, key)
+	v, err := m.expr.root.eval(d)
+	if err != nil {
+		return "", fmt.Errorf("expression %q: %w", m.expr.text, err)
+	}
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", fmt.Errorf("expression %q: result is %s, not a string", m.expr.text, exprType(v))
+}
+
+// refs returns the keys that the expression references with value("KEY").
+func (e *expr) refs() []string {
+	var refs []string
+	var walk func(n exprNode)
+	walk = func(n exprNode) {
+		switch n := n.(type) {
+		case *exprCall:
+			if n.fn == "value" && n.recv == nil && len(n.args) == 1 {
+				if lit, ok := n.args[0].(*exprLiteral); ok {
+					if s, ok := lit.v.(string); ok {
+						refs = append(refs, normalizeKey(s))
+					}
+				}
+			}
+			if n.recv != nil {
+				walk(n.recv)
+			}
+			for _, a := range n.args {
+				walk(a)
+			}
+		case *exprUnary:
+			walk(n.x)
+		case *exprBinary:
+			walk(n.x)
+			walk(n.y)
+		case *exprCond:
+			walk(n.cond)
+			walk(n.x)
+			walk(n.y)
+		case *exprSelect:
+			walk(n.x)
+		case *exprIndex:
+			walk(n.x)
+			walk(n.index)
+		}
+	}
+	walk(e.root)
+	return refs
+}
+
+func exprType(v any) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case int64:
+		return "int"
+	case bool:
+		return "bool"
+	case exprMap:
+		return "map"
+	case *http.Request:
+		return "request"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+type exprLiteral struct {
+	v any
+}
+
+func (n *exprLiteral) eval(*templateData) (any, error) {
+	return n.v, nil
+}
+
+// exprRequest is the "request" identifier.
+type exprRequest struct{}
+
+func (exprRequest) eval(d *templateData) (any, error) {
+	return d.r, nil
+}
+
+type exprSelect struct {
+	x     exprNode
+	field string
+}
+
+func (n *exprSelect) eval(d *templateData) (any, error) {
+	x, err := n.x.eval(d)
+	if err != nil {
+		return nil, err
+	}
+	r, ok := x.(*http.Request)
+	if !ok {
+		return nil, fmt.Errorf("%s has no field %q", exprType(x), n.field)
+	}
+	switch n.field {
+	case "path":
+		return r.URL.Path, nil
+	case "method":
+		return r.Method, nil
+	case "host":
+		return r.Host, nil
+	case "clientIP":
+		if addr, ok := clientAddr(r.RemoteAddr); ok {
+			return addr.String(), nil
+		}
+		return "", nil
+	case "headers":
+		return exprMap(func(k string) (string, bool) {
+			v, ok := r.Header[http.CanonicalHeaderKey(k)]
+			if !ok || len(v) == 0 {
+				return "", false
+			}
+			return v[0], true
+		}), nil
+	case "query":
+		q := r.URL.Query()
+		return exprMap(func(k string) (string, bool) {
+			v, ok := q[k]
+			if !ok || len(v) == 0 {
+				return "", false
+			}
+			return v[0], true
+		}), nil
+	}
+	return nil, fmt.Errorf("request has no field %q", n.field)
+}
+
+type exprIndex struct {
+	x, index exprNode
+}
+
+func (n *exprIndex) eval(d *templateData) (any, error) {
+	x, err := n.x.eval(d)
+	if err != nil {
+		return nil, err
+	}
+	i, err := n.index.eval(d)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := x.(exprMap)
+	if !ok {
+		return nil, fmt.Errorf("cannot index %s", exprType(x))
+	}
+	k, ok := i.(string)
+	if !ok {
+		return nil, fmt.Errorf("map key is %s, not a string", exprType(i))
+	}
+	v, ok := m(k)
+	if !ok {
+		return nil, fmt.Errorf("no key %q", k)
+	}
+	return v, nil
+}
+
+type exprCall struct {
+	fn   string
+	recv exprNode
+	args []exprNode
+	// re is the compiled pattern of the matches method
+	re *regexp.Regexp
+}
+
+// exprFuncs are the numbers of arguments of the functions and the methods.
+var exprFuncs = map[string]int{
+	"value":      1,
+	"size":       1,
+	"string":     1,
+	"int":        1,
+	"startsWith": 1,
+	"endsWith":   1,
+	"contains":   1,
+	"matches":    1,
+}
+
+func (n *exprCall) eval(d *templateData) (any, error) {
+	args := make([]any, len(n.args))
+	for i, a := range n.args {
+		v, err := a.eval(d)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	if n.recv == nil {
+		switch n.fn {
+		case "value":
+			k, ok := args[0].(string)
+			if !ok {
+				return nil, fmt.Errorf("value() key is %s, not a string", exprType(args[0]))
+			}
+			return d.Value(k)
+		case "size":
+			if s, ok := args[0].(string); ok {
+				return int64(utf8.RuneCountInString(s)), nil
+			}
+		case "string":
+			switch v := args[0].(type) {
+			case string:
+				return v, nil
+			case int64:
+				return strconv.FormatInt(v, 10), nil
+			case bool:
+				return strconv.FormatBool(v), nil
+			}
+		case "int":
+			switch v := args[0].(type) {
+			case int64:
+				return v, nil
+			case string:
+				i, err := strconv.ParseInt(v, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("int(): %w", err)
+				}
+				return i, nil
+			}
+		}
+		return nil, fmt.Errorf("%s() does not support %s", n.fn, exprType(args[0]))
+	}
+	recv, err := n.recv.eval(d)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := recv.(string)
+	if !ok {
+		return nil, fmt.Errorf("%s has no method %s()", exprType(recv), n.fn)
+	}
+	arg, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("%s() argument is %s, not a string", n.fn, exprType(args[0]))
+	}
+	switch n.fn {
+	case "startsWith":
+		return strings.HasPrefix(s, arg), nil
+	case "endsWith":
+		return strings.HasSuffix(s, arg), nil
+	case "contains":
+		return strings.Contains(s, arg), nil
+	case "matches":
+		return n.re.MatchString(s), nil
+	}
+	return nil, fmt.Errorf("string has no method %s()", n.fn)
+}
+
+type exprUnary struct {
+	op string
+	x  exprNode
+}
+
+func (n *exprUnary) eval(d *templateData) (any, error) {
+	x, err := n.x.eval(d)
+	if err != nil {
+		return nil, err
+	}
+	switch v := x.(type) {
+	case bool:
+		if n.op == "!" {
+			return !v, nil
+		}
+	case int64:
+		if n.op == "-" {
+			return -v, nil
+		}
+	}
+	return nil, fmt.Errorf("operator %s does not support %s", n.op, exprType(x))
+}
+
+type exprBinary struct {
+	op   string
+	x, y exprNode
+}
+
+func (n *exprBinary) eval(d *templateData) (any, error) {
+	x, err := n.x.eval(d)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "&&" || n.op == "||" {
+		b, ok := x.(bool)
+		if !ok {
+			return nil, fmt.Errorf("operator %s does not support %s", n.op, exprType(x))
+		}
+		if b == (n.op == "||") {
+			return b, nil
+		}
+		y, err := n.y.eval(d)
+		if err != nil {
+			return nil, err
+		}
+		if b, ok := y.(bool); ok {
+			return b, nil
+		}
+		return nil, fmt.Errorf("operator %s does not support %s", n.op, exprType(y))
+	}
+	y, err := n.y.eval(d)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "in" {
+		m, ok := y.(exprMap)
+		k, isString := x.(string)
+		if !ok || !isString {
+			return nil, fmt.Errorf("operator in does not support %s and %s", exprType(x), exprType(y))
+		}
+		_, found := m(k)
+		return found, nil
+	}
+	switch x := x.(type) {
+	case string:
+		if y, ok := y.(string); ok {
+			switch n.op {
+			case "+":
+				return x + y, nil
+			case "==":
+				return x == y, nil
+			case "!=":
+				return x != y, nil
+			case "<":
+				return x < y, nil
+			case "<=":
+				return x <= y, nil
+			case ">":
+				return x > y, nil
+			case ">=":
+				return x >= y, nil
+			}
+		}
+	case int64:
+		if y, ok := y.(int64); ok {
+			switch n.op {
+			case "+":
+				return x + y, nil
+			case "-":
+				return x - y, nil
+			case "*":
+				return x * y, nil
+			case "==":
+				return x == y, nil
+			case "!=":
+				return x != y, nil
+			case "<":
+				return x < y, nil
+			case "<=":
+				return x <= y, nil
+			case ">":
+				return x > y, nil
+			case ">=":
+				return x >= y, nil
+			}
+		}
+	case bool:
+		if y, ok := y.(bool); ok {
+			switch n.op {
+			case "==":
+				return x == y, nil
+			case "!=":
+				return x != y, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("operator %s does not support %s and %s", n.op, exprType(x), exprType(y))
+}
+
+type exprCond struct {
+	cond, x, y exprNode
+}
+
+func (n *exprCond) eval(d *templateData) (any, error) {
+	c, err := n.cond.eval(d)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := c.(bool)
+	if !ok {
+		return nil, fmt.Errorf("condition is %s, not a bool", exprType(c))
+	}
+	if b {
+		return n.x.eval(d)
+	}
+	return n.y.eval(d)
+}
+
+const (
+	tokEOF = iota
+	tokIdent
+	tokString
+	tokInt
+	tokOp
+)
+
+type exprToken struct {
+	kind int
+	text string
+	pos  int
+}
+
+// exprParser is a recursive descent parser of the expressions.
+type exprParser struct {
+	text string
+	pos  int
+	tok  exprToken
+	err  error
+}
+
+// exprOps are the operators and the punctuation ordered so that longer operators are matched first.
+var exprOps = []string{"&&", "||", "==", "!=", "<=", ">=", "!", "<", ">", "+", "-", "*", "?", ":", "(", ")", "[", "]", ".", ","}
+
+func (p *exprParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("at %d: %s", p.tok.pos, fmt.Sprintf(format, args...))
+}
+
+// next reads the next token. Lexical errors are kept in p.err and reported by the parser.
+func (p *exprParser) next() {
+	for p.pos < len(p.text) && unicode.IsSpace(rune(p.text[p.pos])) {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.text) {
+		p.tok = exprToken{kind: tokEOF, pos: start}
+		return
+	}
+	c := p.text[p.pos]
+	switch {
+	case c == '"' || c == '\'':
+		i := p.pos + 1
+		for i < len(p.text) && p.text[i] != c {
+			if p.text[i] == '\\' {
+				i++
+			}
+			i++
+		}
+		if i >= len(p.text) {
+			p.err = fmt.Errorf("at %d: unterminated string", start)
+			p.tok = exprToken{kind: tokEOF, pos: start}
+			return
+		}
+		p.pos = i + 1
+		body := p.text[start+1 : i]
+		if c == '\'' {
+			body = strings.ReplaceAll(strings.ReplaceAll(body, `\'`, `'`), `"`, `\"`)
+		}
+		s, err := strconv.Unquote(`"` + body + `"`)
+		if err != nil {
+			p.err = fmt.Errorf("at %d: invalid string: %w", start, err)
+			p.tok = exprToken{kind: tokEOF, pos: start}
+			return
+		}
+		p.tok = exprToken{kind: tokString, text: s, pos: start}
+	case c >= '0' && c <= '9':
+		for p.pos < len(p.text) && p.text[p.pos] >= '0' && p.text[p.pos] <= '9' {
+			p.pos++
+		}
+		p.tok = exprToken{kind: tokInt, text: p.text[start:p.pos], pos: start}
+	case c == '_' || unicode.IsLetter(rune(c)):
+		for p.pos < len(p.text) && (p.text[p.pos] == '_' || unicode.IsLetter(rune(p.text[p.pos])) || unicode.IsDigit(rune(p.text[p.pos]))) {
+			p.pos++
+		}
+		p.tok = exprToken{kind: tokIdent, text: p.text[start:p.pos], pos: start}
+	default:
+		for _, op := range exprOps {
+			if strings.HasPrefix(p.text[p.pos:], op) {
+				p.pos += len(op)
+				p.tok = exprToken{kind: tokOp, text: op, pos: start}
+				return
+			}
+		}
+		p.err = fmt.Errorf("at %d: unexpected character %q", start, c)
+		p.tok = exprToken{kind: tokEOF, pos: start}
+	}
+}
+
+func (p *exprParser) isOp(ops ...string) bool {
+	if p.tok.kind != tokOp && !(p.tok.kind == tokIdent && p.tok.text == "in") {
+		return false
+	}
+	for _, op := range ops {
+		if p.tok.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *exprParser) expect(op string) error {
+	if p.err != nil {
+		return p.err
+	}
+	if p.tok.kind != tokOp || p.tok.text != op {
+		if p.tok.kind == tokEOF {
+			return p.errorf("expected %q, got end of expression", op)
+		}
+		return p.errorf("expected %q, got %q", op, p.tok.text)
+	}
+	p.next()
+	return nil
+}
+
+func (p *exprParser) parseCond() (exprNode, error) {
+	cond, err := p.parseBinary(0)
+	if err != nil || !p.isOp("?") {
+		return cond, err
+	}
+	p.next()
+	x, err := p.parseCond()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	y, err := p.parseCond()
+	if err != nil {
+		return nil, err
+	}
+	return &exprCond{cond: cond, x: x, y: y}, nil
+}
+
+// exprPrecedence are the binary operators from the lowest to the highest precedence.
+var exprPrecedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">=", "in"},
+	{"+", "-"},
+	{"*"},
+}
+
+func (p *exprParser) parseBinary(level int) (exprNode, error) {
+	if level == len(exprPrecedence) {
+		return p.parseUnary()
+	}
+	x, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp(exprPrecedence[level]...) {
+		op := p.tok.text
+		p.next()
+		y, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		x = &exprBinary{op: op, x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.isOp("!", "-") {
+		op := p.tok.text
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &exprUnary{op: op, x: x}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *exprParser) parsePostfix() (exprNode, error) {
+	x, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.isOp("."):
+			p.next()
+			if p.tok.kind != tokIdent {
+				return nil, p.errorf("expected field name")
+			}
+			name, pos := p.tok.text, p.tok.pos
+			p.next()
+			if p.isOp("(") {
+				args, err := p.parseArgs(name, pos)
+				if err != nil {
+					return nil, err
+				}
+				call := &exprCall{fn: name, recv: x, args: args}
+				if name == "matches" {
+					if call.re, err = compilePattern(args[0], pos); err != nil {
+						return nil, err
+					}
+				}
+				x = call
+			} else {
+				x = &exprSelect{x: x, field: name}
+			}
+		case p.isOp("["):
+			p.next()
+			index, err := p.parseCond()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			x = &exprIndex{x: x, index: index}
+		default:
+			return x, p.err
+		}
+	}
+}
+
+// parseArgs parses the arguments of the call of the function with the name at the position.
+func (p *exprParser) parseArgs(name string, pos int) ([]exprNode, error) {
+	n, ok := exprFuncs[name]
+	if !ok {
+		return nil, fmt.Errorf("at %d: unknown function %q", pos, name)
+	}
+	p.next()
+	var args []exprNode
+	for !p.isOp(")") {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		a, err := p.parseCond()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, a)
+	}
+	p.next()
+	if len(args) != n {
+		return nil, fmt.Errorf("at %d: %s() expects %d argument(s), got %d", pos, name, n, len(args))
+	}
+	return args, nil
+}
+
+// compilePattern compiles the pattern of the matches method at the position.
+// The pattern must be a string literal, so it is compiled once when the expression is parsed.
+func compilePattern(arg exprNode, pos int) (*regexp.Regexp, error) {
+	lit, ok := arg.(*exprLiteral)
+	if !ok {
+		return nil, fmt.Errorf("at %d: matches() expects a string literal", pos)
+	}
+	pattern, ok := lit.v.(string)
+	if !ok {
+		return nil, fmt.Errorf("at %d: matches() expects a string literal", pos)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("at %d: matches(): %w", pos, err)
+	}
+	return re, nil
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	tok := p.tok
+	switch tok.kind {
+	case tokEOF:
+		return nil, p.errorf("unexpected end of expression")
+	case tokString:
+		p.next()
+		return &exprLiteral{v: tok.text}, nil
+	case tokInt:
+		p.next()
+		i, err := strconv.ParseInt(tok.text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("at %d: %w", tok.pos, err)
+		}
+		return &exprLiteral{v: i}, nil
+	case tokIdent:
+		p.next()
+		switch tok.text {
+		case "true", "false":
+			return &exprLiteral{v: tok.text == "true"}, nil
+		case "request":
+			return exprRequest{}, nil
+		}
+		if p.isOp("(") {
+			args, err := p.parseArgs(tok.text, tok.pos)
+			if err != nil {
+				return nil, err
+			}
+			return &exprCall{fn: tok.text, args: args}, nil
+		}
+		return nil, fmt.Errorf("at %d: unknown identifier %q", tok.pos, tok.text)
+	}
+	if tok.text == "(" {
+		p.next()
+		x, err := p.parseCond()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return x, nil
+	}
+	return nil, p.errorf("unexpected %q", tok.text)
+}
@@ -0,0 +1,206 @@
+package metadataserver_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestExprValues(t *testing.T) {
+	s, err := metadataserver.New(metadataserver.WithConfigFile("test/fixtures/config_expr.json"))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	tests := []struct {
+		name   string
+		path   string
+		header http.Header
+		status int
+		want   string
+	}{
+		{
+			name:   "default branch",
+			path:   "instance/attributes/environment",
+			status: http.StatusOK,
+			want:   "staging",
+		},
+		{
+			name:   "header",
+			path:   "instance/attributes/environment",
+			header: http.Header{"X-Env": {"prod"}},
+			status: http.StatusOK,
+			want:   "production",
+		},
+		{
+			name:   "query",
+			path:   "instance/attributes/location?verbose",
+			status: http.StatusOK,
+			want:   "projects/123456789/zones/us-central1-a",
+		},
+		{
+			name:   "no query",
+			path:   "instance/attributes/location",
+			status: http.StatusOK,
+			want:   "us-central1-a",
+		},
+		{
+			name:   "references",
+			path:   "instance/attributes/summary",
+			header: http.Header{"X-Env": {"prod"}},
+			status: http.StatusOK,
+			want:   "test-project-id production 3",
+		},
+		{
+			name:   "integer",
+			path:   "instance/attributes/broken?n=21",
+			status: http.StatusOK,
+			want:   "42",
+		},
+		{
+			name:   "evaluation error",
+			path:   "instance/attributes/broken?n=x",
+			status: http.StatusInternalServerError,
+		},
+		{
+			name:   "missing key",
+			path:   "instance/attributes/region",
+			status: http.StatusInternalServerError,
+		},
+		{
+			name:   "pattern",
+			path:   "instance/attributes/region?zone=us-central1-a",
+			status: http.StatusOK,
+			want:   "true",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/"+test.path, nil)
+			for k, v := range test.header {
+				req.Header[k] = v
+			}
+			rec := httptest.NewRecorder()
+			s.HttpHandler().ServeHTTP(rec, req)
+			if rec.Code != test.status {
+				t.Fatalf("expected status %d, got: %d", test.status, rec.Code)
+			}
+			if test.status == http.StatusOK && rec.Body.String() != test.want {
+				t.Errorf("expected %q, got: %q", test.want, rec.Body.String())
+			}
+		})
+	}
+
+	s.SetValue("project/project-id", "other-project")
+	if got, _ := s.GetValue("instance/attributes/summary"); !strings.HasPrefix(got, "other-project ") {
+		t.Errorf("expected value to follow the change, got: %q", got)
+	}
+}
+
+func TestExprErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{
+			expr: `request.path ==`,
+			want: `invalid expression of metadata "a": at 15: unexpected end of expression`,
+		},
+		{
+			expr: `unknown`,
+			want: `invalid expression of metadata "a": at 0: unknown identifier "unknown"`,
+		},
+		{
+			expr: `upper("a")`,
+			want: `invalid expression of metadata "a": at 0: unknown function "upper"`,
+		},
+		{
+			expr: `value("a", "b")`,
+			want: `invalid expression of metadata "a": at 0: value() expects 1 argument(s), got 2`,
+		},
+		{
+			expr: `request.path.matches("[")`,
+			want: "invalid expression of metadata \"a\": at 13: matches(): error parsing regexp: missing closing ]: `[`",
+		},
+		{
+			expr: `request.path.matches(value("b"))`,
+			want: `invalid expression of metadata "a": at 13: matches() expects a string literal`,
+		},
+		{
+			expr: `"unterminated`,
+			want: `invalid expression of metadata "a": at 0: unterminated string`,
+		},
+		{
+			expr: `value("b") + "/" + value("a")`,
+			want: `metadata "a": reference cycle a -> a`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "config.json")
+			data := `{"metadata": {"a": {"expr": ` + strconv.Quote(test.expr) + `}, "b": {"value": "one"}}}`
+			if err := os.WriteFile(name, []byte(data), 0o600); err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			c, err := metadataserver.NewConfigFromFile(name)
+			if err == nil {
+				_, err = metadataserver.New(metadataserver.WithConfiguration(c))
+			}
+			if err == nil || err.Error() != test.want {
+				t.Errorf("expected error %q, got: %v", test.want, err)
+			}
+		})
+	}
+}
+
+func FuzzParseExpr(f *testing.F) {
+	for _, seed := range []string{
+		`request.headers["X-Env"] == "prod" ? "production" : "staging"`,
+		`value("b") + "/" + string(size(request.path))`,
+		`request.query["zone"].startsWith("us-") && !(int("42") > 7 || "a" in ["a"])`,
+		`request.clientIP.matches("^10\\.") ? -1 * 2 : 3 - 4`,
+		`request.path ==`,
+		`"unterminated`,
+	} {
+		f.Add(seed)
+	}
+	dir := f.TempDir()
+	f.Fuzz(func(t *testing.T, text string) {
+		data, err := json.Marshal(map[string]any{"metadata": map[string]any{
+			"a": map[string]string{"expr": text},
+			"b": map[string]string{"value": "one"},
+		}})
+		if err != nil {
+			t.Skip()
+		}
+		name := filepath.Join(dir, "config.json")
+		if err := os.WriteFile(name, data, 0o600); err != nil {
+			t.Fatalf("expected no errors, got: %v", err)
+		}
+		c, err := metadataserver.NewConfigFromFile(name)
+		if err != nil {
+			return
+		}
+		s, err := metadataserver.New(metadataserver.WithConfiguration(c))
+		if err != nil {
+			return
+		}
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/a?zone=us-central1", nil)
+		r.Header.Set("X-Env", "prod")
+		s.HttpHandler().ServeHTTP(rec, r)
+		if rec.Code != http.StatusOK && rec.Code != http.StatusInternalServerError {
+			t.Errorf("expected status %d or %d, got: %d", http.StatusOK, http.StatusInternalServerError, rec.Code)
+		}
+		if err := s.State().LastError; errors.Is(err, metadataserver.ErrHandlerPanic) {
+			t.Errorf("expected no panics, got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,214 @@
+// Package grpccontrol exposes the runtime control of [metadataserver.Server] as a gRPC service.
+//
+// The service is defined in control.proto that can be used to generate typed clients.
+// Register the service with an instance of [grpc.Server] that listens at a port of your choice:
+//
+//	gs := grpccontrol.NewServer(ms)
+//	l, _ := net.Listen("tcp", ":8082")
+//	go gs.Serve(l)
+//	defer gs.GracefulStop()
+package grpccontrol
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"sort"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/minherz/metadataserver"
+)
+
+// NewServer creates an instance of [grpc.Server] with the control service of the metadata server registered.
+// If the metadata server is configured with the admin token, the gRPC server requires the same token.
+// See [TokenInterceptor].
+func NewServer(ms *metadataserver.Server, opts ...grpc.ServerOption) *grpc.Server {
+	if token := ms.Configuration().AdminToken; token != "" {
+		opts = append(opts, grpc.ChainUnaryInterceptor(TokenInterceptor(token)))
+	}
+	gs := grpc.NewServer(opts...)
+	Register(gs, ms)
+	return gs
+}
+
+// Register registers the control service of the metadata server with the gRPC server.
+func Register(r grpc.ServiceRegistrar, ms *metadataserver.Server) {
+	c := &control{ms: ms}
+	r.RegisterService(c.serviceDesc(), c)
+}
+
+// TokenInterceptor returns an interceptor that rejects calls without the token in the
+// "authorization: Bearer <token>" metadata with [codes.Unauthenticated] error.
+func TokenInterceptor(token string) grpc.UnaryServerInterceptor {
+	want := []byte("Bearer " + token)
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		values := md.Get("authorization")
+		if len(values) != 1 || subtle.ConstantTimeCompare([]byte(values[0]), want) != 1 {
+			return nil, status.Error(codes.Unauthenticated, "invalid admin token")
+		}
+		return handler(ctx, req)
+	}
+}
+
+type control struct {
+	ms *metadataserver.Server
+}
+
+type unaryFunc func(ctx context.Context, in, out *dynamicpb.Message) error
+
+func (c *control) serviceDesc() *grpc.ServiceDesc {
+	methods := map[string]unaryFunc{
+		"ListRoutes":   c.listRoutes,
+		"GetValue":     c.getValue,
+		"SetValue":     c.setValue,
+		"DeleteValue":  c.deleteValue,
+		"RunScenario":  c.runScenario,
+		"GetHistory":   c.getHistory,
+		"Reset":        c.reset,
+		"TriggerEvent": c.triggerEvent,
+		"GetStats":     c.getStats,
+	}
+	sd := fileDescriptor.Services().ByName("Control")
+	desc := &grpc.ServiceDesc{
+		ServiceName: ServiceName,
+		HandlerType: (*any)(nil),
+		Metadata:    fileDescriptor.Path(),
+	}
+	for i := 0; i < sd.Methods().Len(); i++ {
+		md := sd.Methods().Get(i)
+		desc.Methods = append(desc.Methods, grpc.MethodDesc{
+			MethodName: string(md.Name()),
+			Handler:    unaryHandler(md, methods[string(md.Name())]),
+		})
+	}
+	return desc
+}
+
+func unaryHandler(md protoreflect.MethodDescriptor, f unaryFunc) grpc.MethodHandler {
+	fullMethod := "/" + ServiceName + "/" + string(md.Name())
+	return func(_ any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+		in := dynamicpb.NewMessage(md.Input())
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		handler := func(ctx context.Context, req any) (any, error) {
+			out := dynamicpb.NewMessage(md.Output())
+			if err := f(ctx, req.(*dynamicpb.Message), out); err != nil {
+				return nil, err
+			}
+			return out, nil
+		}
+		if interceptor == nil {
+			return handler(ctx, in)
+		}
+		return interceptor(ctx, in, &grpc.UnaryServerInfo{FullMethod: fullMethod}, handler)
+	}
+}
+
+func (c *control) listRoutes(_ context.Context, _, out *dynamicpb.Message) error {
+	fd := out.Descriptor().Fields().ByName("paths")
+	list := out.Mutable(fd).List()
+	for _, p := range c.ms.Paths() {
+		list.Append(protoreflect.ValueOfString(p))
+	}
+	return nil
+}
+
+func (c *control) getValue(_ context.Context, in, out *dynamicpb.Message) error {
+	v, ok := c.ms.GetValue(getString(in, "path"))
+	setField(out, "value", protoreflect.ValueOfString(v))
+	setField(out, "found", protoreflect.ValueOfBool(ok))
+	return nil
+}
+
+func (c *control) setValue(_ context.Context, in, _ *dynamicpb.Message) error {
+	path := getString(in, "path")
+	if path == "" {
+		return status.Error(codes.InvalidArgument, "path is required")
+	}
+	c.ms.SetValue(path, getString(in, "value"))
+	return nil
+}
+
+func (c *control) deleteValue(_ context.Context, in, _ *dynamicpb.Message) error {
+	c.ms.DeleteValue(getString(in, "path"))
+	return nil
+}
+
+func (c *control) runScenario(_ context.Context, in, _ *dynamicpb.Message) error {
+	var sc metadataserver.Scenario
+	if err := json.Unmarshal([]byte(getString(in, "scenario_json")), &sc); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := c.ms.RunScenario(context.Background(), &sc); err != nil {
+		if errors.Is(err, metadataserver.ErrServerIsNotRunning) {
+			return status.Error(codes.FailedPrecondition, err.Error())
+		}
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return nil
+}
+
+func (c *control) getHistory(_ context.Context, _, out *dynamicpb.Message) error {
+	fd := out.Descriptor().Fields().ByName("requests")
+	list := out.Mutable(fd).List()
+	for _, r := range c.ms.History() {
+		m := dynamicpb.NewMessage(fd.Message())
+		setField(m, "time_unix_nano", protoreflect.ValueOfInt64(r.Time.UnixNano()))
+		setField(m, "method", protoreflect.ValueOfString(r.Method))
+		setField(m, "path", protoreflect.ValueOfString(r.Path))
+		setField(m, "status", protoreflect.ValueOfInt32(int32(r.Status)))
+		setField(m, "remote_addr", protoreflect.ValueOfString(r.RemoteAddr))
+		list.Append(protoreflect.ValueOfMessage(m))
+	}
+	return nil
+}
+
+func (c *control) reset(_ context.Context, _, _ *dynamicpb.Message) error {
+	c.ms.Reset()
+	return nil
+}
+
+func (c *control) triggerEvent(_ context.Context, in, _ *dynamicpb.Message) error {
+	if err := c.ms.TriggerEvent(getString(in, "event"), getString(in, "value")); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return nil
+}
+
+func (c *control) getStats(_ context.Context, _, out *dynamicpb.Message) error {
+	stats := c.ms.Stats()
+	paths := make([]string, 0, len(stats))
+	for p := range stats {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	fd := out.Descriptor().Fields().ByName("stats")
+	list := out.Mutable(fd).List()
+	for _, p := range paths {
+		ps := stats[p]
+		m := dynamicpb.NewMessage(fd.Message())
+		setField(m, "path", protoreflect.ValueOfString(p))
+		setField(m, "requests", protoreflect.ValueOfInt64(int64(ps.Requests)))
+		setField(m, "errors", protoreflect.ValueOfInt64(int64(ps.Errors)))
+		setField(m, "last_access_unix_nano", protoreflect.ValueOfInt64(ps.LastAccess.UnixNano()))
+		list.Append(protoreflect.ValueOfMessage(m))
+	}
+	return nil
+}
+
+func getString(m *dynamicpb.Message, name protoreflect.Name) string {
+	return m.Get(m.Descriptor().Fields().ByName(name)).String()
+}
+
+func setField(m *dynamicpb.Message, name protoreflect.Name, v protoreflect.Value) {
+	m.Set(m.Descriptor().Fields().ByName(name), v)
+}
@@ -0,0 +1,143 @@
+package grpccontrol_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/minherz/metadataserver"
+	"github.com/minherz/metadataserver/grpccontrol"
+)
+
+func TestControl(t *testing.T) {
+	ms, err := metadataserver.New()
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	conn := newTestConn(t, ms)
+
+	invoke(t, conn, "SetValue", map[string]string{"path": "instance/attributes/my-flag", "value": "on"})
+	if got, _ := ms.GetValue("instance/attributes/my-flag"); got != "on" {
+		t.Errorf("expected value %q, got: %q", "on", got)
+	}
+	out := invoke(t, conn, "GetValue", map[string]string{"path": "project/project-id"})
+	if got := out.Get(out.Descriptor().Fields().ByName("value")).String(); got != "test-project-id" {
+		t.Errorf("expected value %q, got: %q", "test-project-id", got)
+	}
+	out = invoke(t, conn, "ListRoutes", nil)
+	if got := out.Get(out.Descriptor().Fields().ByName("paths")).List().Len(); got != 2 {
+		t.Errorf("expected 2 routes, got: %d", got)
+	}
+	invoke(t, conn, "Reset", nil)
+	if _, ok := ms.GetValue("instance/attributes/my-flag"); ok {
+		t.Errorf("expected value to be reset")
+	}
+}
+
+func TestControlEventsAndStats(t *testing.T) {
+	ms, err := metadataserver.New()
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	conn := newTestConn(t, ms)
+
+	invoke(t, conn, "TriggerEvent", map[string]string{"event": metadataserver.InstanceEventPreemption})
+	if got, _ := ms.GetValue(metadataserver.PreemptedPath); got != "TRUE" {
+		t.Errorf("expected value %q, got: %q", "TRUE", got)
+	}
+	in := emptyMessage(t, "TriggerEventRequest")
+	in.Set(in.Descriptor().Fields().ByName("event"), protoreflect.ValueOfString("reboot"))
+	err = conn.Invoke(context.Background(), "/"+grpccontrol.ServiceName+"/TriggerEvent", in, emptyMessage(t, "TriggerEventResponse"))
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected %v error, got: %v", codes.InvalidArgument, err)
+	}
+
+	h := ms.HttpHandler()
+	for _, p := range []string{"project/project-id", "project/project-id", "instance/missing"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/"+p, nil))
+	}
+	out := invoke(t, conn, "GetStats", nil)
+	list := out.Get(out.Descriptor().Fields().ByName("stats")).List()
+	got := make(map[string][2]int64)
+	for i := 0; i < list.Len(); i++ {
+		m := list.Get(i).Message()
+		fields := m.Descriptor().Fields()
+		got[m.Get(fields.ByName("path")).String()] = [2]int64{m.Get(fields.ByName("requests")).Int(), m.Get(fields.ByName("errors")).Int()}
+	}
+	want := map[string][2]int64{"project/project-id": {2, 0}, "instance/missing": {1, 1}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("stats mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestTokenInterceptor(t *testing.T) {
+	ms, err := metadataserver.New(metadataserver.WithAdminToken("secret"))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	conn := newTestConn(t, ms)
+	err = conn.Invoke(context.Background(), "/"+grpccontrol.ServiceName+"/Reset", emptyMessage(t, "ResetRequest"), emptyMessage(t, "ResetResponse"))
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected %v error, got: %v", codes.Unauthenticated, err)
+	}
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer secret")
+	if err := conn.Invoke(ctx, "/"+grpccontrol.ServiceName+"/Reset", emptyMessage(t, "ResetRequest"), emptyMessage(t, "ResetResponse")); err != nil {
+		t.Errorf("expected no errors, got: %v", err)
+	}
+}
+
+func newTestConn(t *testing.T, ms *metadataserver.Server) *grpc.ClientConn {
+	t.Helper()
+	l := bufconn.Listen(1 << 16)
+	gs := grpccontrol.NewServer(ms)
+	go gs.Serve(l)
+	t.Cleanup(gs.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return l.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func emptyMessage(t *testing.T, name string) *dynamicpb.Message {
+	t.Helper()
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName("metadataserver.control.v1." + name))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	return dynamicpb.NewMessage(d.(protoreflect.MessageDescriptor))
+}
+
+func invoke(t *testing.T, conn *grpc.ClientConn, method string, fields map[string]string) *dynamicpb.Message {
+	t.Helper()
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(grpccontrol.ServiceName))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	md := d.(protoreflect.ServiceDescriptor).Methods().ByName(protoreflect.Name(method))
+	in := dynamicpb.NewMessage(md.Input())
+	for k, v := range fields {
+		in.Set(md.Input().Fields().ByName(protoreflect.Name(k)), protoreflect.ValueOfString(v))
+	}
+	out := dynamicpb.NewMessage(md.Output())
+	if err := conn.Invoke(context.Background(), "/"+grpccontrol.ServiceName+"/"+method, in, out); err != nil {
+		t.Fatalf("%s: expected no errors, got: %v", method, err)
+	}
+	return out
+}
@@ -0,0 +1,112 @@
+package grpccontrol
+
+import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// ServiceName is the full name of the control service.
+const ServiceName = "metadataserver.control.v1.Control"
+
+// fileDescriptor describes control.proto.
+// It is built at runtime to avoid code generation and must be kept in sync with control.proto.
+// The descriptor is registered in [protoregistry.GlobalFiles] so it can be used by gRPC reflection.
+var fileDescriptor = mustBuildFile()
+
+func mustBuildFile() protoreflect.FileDescriptor {
+	str := descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum()
+	int64 := descriptorpb.FieldDescriptorProto_TYPE_INT64.Enum()
+	fdp := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("metadataserver/control/v1/control.proto"),
+		Package: proto.String("metadataserver.control.v1"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			message("ListRoutesRequest"),
+			message("ListRoutesResponse", repeated(field("paths", 1, str))),
+			message("GetValueRequest", field("path", 1, str)),
+			message("GetValueResponse", field("value", 1, str), field("found", 2, descriptorpb.FieldDescriptorProto_TYPE_BOOL.Enum())),
+			message("SetValueRequest", field("path", 1, str), field("value", 2, str)),
+			message("SetValueResponse"),
+			message("DeleteValueRequest", field("path", 1, str)),
+			message("DeleteValueResponse"),
+			message("RunScenarioRequest", field("scenario_json", 1, str)),
+			message("RunScenarioResponse"),
+			message("GetHistoryRequest"),
+			message("Request",
+				field("time_unix_nano", 1, int64),
+				field("method", 2, str),
+				field("path", 3, str),
+				field("status", 4, descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum()),
+				field("remote_addr", 5, str)),
+			message("GetHistoryResponse", repeated(messageField("requests", 1, ".metadataserver.control.v1.Request"))),
+			message("ResetRequest"),
+			message("ResetResponse"),
+			message("TriggerEventRequest", field("event", 1, str), field("value", 2, str)),
+			message("TriggerEventResponse"),
+			message("GetStatsRequest"),
+			message("PathStats",
+				field("path", 1, str),
+				field("requests", 2, int64),
+				field("errors", 3, int64),
+				field("last_access_unix_nano", 4, int64)),
+			message("GetStatsResponse", repeated(messageField("stats", 1, ".metadataserver.control.v1.PathStats"))),
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Control"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				method("ListRoutes"),
+				method("GetValue"),
+				method("SetValue"),
+				method("DeleteValue"),
+				method("RunScenario"),
+				method("GetHistory"),
+				method("Reset"),
+				method("TriggerEvent"),
+				method("GetStats"),
+			},
+		}},
+	}
+	fd, err := protodesc.NewFile(fdp, nil)
+	if err != nil {
+		panic(err)
+	}
+	if err := protoregistry.GlobalFiles.RegisterFile(fd); err != nil {
+		panic(err)
+	}
+	return fd
+}
+
+func message(name string, fields ...*descriptorpb.FieldDescriptorProto) *descriptorpb.DescriptorProto {
+	return &descriptorpb.DescriptorProto{Name: proto.String(name), Field: fields}
+}
+
+func field(name string, number int32, t *descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+	return &descriptorpb.FieldDescriptorProto{
+		Name:   proto.String(name),
+		Number: proto.Int32(number),
+		Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		Type:   t,
+	}
+}
+
+func messageField(name string, number int32, typeName string) *descriptorpb.FieldDescriptorProto {
+	f := field(name, number, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum())
+	f.TypeName = proto.String(typeName)
+	return f
+}
+
+func repeated(f *descriptorpb.FieldDescriptorProto) *descriptorpb.FieldDescriptorProto {
+	f.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	return f
+}
+
+func method(name string) *descriptorpb.MethodDescriptorProto {
+	return &descriptorpb.MethodDescriptorProto{
+		Name:       proto.String(name),
+		InputType:  proto.String(".metadataserver.control.v1." + name + "Request"),
+		OutputType: proto.String(".metadataserver.control.v1." + name + "Response"),
+	}
+}
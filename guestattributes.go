@@ -0,0 +1,38 @@
+package metadataserver
+
+import (
+	"io"
+	"net/http"
+	"strings"
+)
+
+// GuestAttributesPath is the path of the guest attributes that the instance writes to the metadata server.
+const GuestAttributesPath = "instance/guest-attributes"
+
+// guestAttributeKey reports whether the key is the path of a guest attribute, i.e. "instance/guest-attributes/NAMESPACE/KEY".
+func guestAttributeKey(key string) bool {
+	rest, ok := strings.CutPrefix(key, GuestAttributesPath+"/")
+	namespace, name, found := strings.Cut(rest, "/")
+	return ok && found && namespace != "" && name != "" && !strings.Contains(name, "/")
+}
+
+// writeGuestAttribute sets the guest attribute at the key to the request body with PUT and deletes it with DELETE.
+// The guest attributes are stored like the values set with [Server.SetValue], so they are served, listed and persisted
+// in the state file (see [WithStateFile]). Other paths respond with 405 (Method Not Allowed).
+func (s *Server) writeGuestAttribute(w http.ResponseWriter, r *http.Request, key string) {
+	if !guestAttributeKey(key) {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Method == http.MethodDelete {
+		s.deleteValue(key, AuditSourceGuest)
+		return
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		readBodyError(w, err)
+		return
+	}
+	s.setValue(key, string(data), AuditSourceGuest)
+}
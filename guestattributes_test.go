@@ -0,0 +1,51 @@
+package metadataserver_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestGuestAttributes(t *testing.T) {
+	s, err := metadataserver.New()
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	h := s.HttpHandler()
+	tests := []struct {
+		method   string
+		path     string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{http.MethodPut, "instance/guest-attributes/hostkeys/ssh-rsa", "AAAA", http.StatusOK, ""},
+		{http.MethodPut, "instance/guest-attributes/hostkeys/ssh-ed25519", "BBBB", http.StatusOK, ""},
+		{http.MethodGet, "instance/guest-attributes/hostkeys/ssh-rsa", "", http.StatusOK, "AAAA"},
+		{http.MethodGet, "instance/guest-attributes/hostkeys/", "", http.StatusOK, "ssh-ed25519\nssh-rsa\n"},
+		{http.MethodDelete, "instance/guest-attributes/hostkeys/ssh-rsa", "", http.StatusOK, ""},
+		{http.MethodGet, "instance/guest-attributes/hostkeys/ssh-rsa", "", http.StatusNotFound, ""},
+		{http.MethodPut, "instance/guest-attributes/hostkeys", "CCCC", http.StatusMethodNotAllowed, ""},
+		{http.MethodPut, "project/project-id", "other", http.StatusMethodNotAllowed, ""},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(test.method, metadataserver.DefaultEndpoint+"/"+test.path, strings.NewReader(test.body)))
+		if rec.Code != test.wantCode {
+			t.Errorf("%s %s: expected status %d, got: %d", test.method, test.path, test.wantCode, rec.Code)
+		}
+		if test.wantCode == http.StatusOK && rec.Body.String() != test.wantBody {
+			t.Errorf("%s %s: expected body %q, got: %q", test.method, test.path, test.wantBody, rec.Body.String())
+		}
+	}
+	if got, _ := s.GetValue("project/project-id"); got != "test-project-id" {
+		t.Errorf("expected the project ID not to be written, got: %q", got)
+	}
+	records := s.AuditLog()
+	if len(records) == 0 || records[0].Source != metadataserver.AuditSourceGuest {
+		t.Errorf("expected audit records of the guest, got: %+v", records)
+	}
+}
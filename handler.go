@@ -0,0 +1,96 @@
+package metadataserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// Handler serves the metadata at a path.
+// Use it to implement stateful handlers like counters, token issuers or stores.
+// If the handler implements [HandlerInitializer] or [HandlerCloser], the server calls the methods when it starts and stops.
+type Handler interface {
+	Serve(ctx context.Context, r *http.Request) (Response, error)
+}
+
+// HandlerInitializer is implemented by handlers that need to set up their state when the server starts.
+type HandlerInitializer interface {
+	Init(ctx context.Context) error
+}
+
+// HandlerCloser is implemented by handlers that need to release their resources when the server stops.
+type HandlerCloser interface {
+	Close(ctx context.Context) error
+}
+
+// Serve calls f(ctx, r) so [ResponseFunc] can be used as [Handler].
+func (f ResponseFunc) Serve(ctx context.Context, r *http.Request) (Response, error) {
+	return f(ctx, r)
+}
+
+// WithHandler sets a new server with the handler of the metadata at the path.
+//
+// Mind the order of options when use with [WithConfiguration] and [WithConfigFile].
+func WithHandler(path string, h Handler) Option {
+	return func(s *Server) {
+		if s.config == nil {
+			s.config = NewConfiguration(DefaultConfigurationHandlers)
+		}
+		if s.config.StatefulHandlers == nil {
+			s.config.StatefulHandlers = make(map[string]Handler)
+		}
+		s.config.StatefulHandlers[path] = h
+	}
+}
+
+// initHandlers calls Init of the stateful handlers in the order of their paths. Panics of Init are returned as [HandlerPanicError].
+// If one of them fails, the handlers that were initialized are closed.
+func (s *Server) initHandlers(ctx context.Context) error {
+	handlers := s.statefulHandlers()
+	paths := sortedHandlerPaths(handlers)
+	for i, p := range paths {
+		h, ok := handlers[p].(HandlerInitializer)
+		if !ok {
+			continue
+		}
+		if err := callHandler(p, func() error { return h.Init(ctx) }); err != nil {
+			s.closeHandlers(ctx, paths[:i])
+			return fmt.Errorf("%w of %q: %w", ErrHandlerInitFailed, p, err)
+		}
+	}
+	return nil
+}
+
+// closeHandlers calls Close of the stateful handlers at the paths in the reverse order.
+func (s *Server) closeHandlers(ctx context.Context, paths []string) error {
+	handlers := s.statefulHandlers()
+	var errs []error
+	for i := len(paths) - 1; i >= 0; i-- {
+		h, ok := handlers[paths[i]].(HandlerCloser)
+		if !ok {
+			continue
+		}
+		if err := callHandler(paths[i], func() error { return h.Close(ctx) }); err != nil {
+			errs = append(errs, fmt.Errorf("%w of %q: %w", ErrHandlerCloseFailed, paths[i], err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// statefulHandlers returns the stateful handlers of the server. The map is replaced when the configuration is reloaded.
+func (s *Server) statefulHandlers() map[string]Handler {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.config.StatefulHandlers
+}
+
+func sortedHandlerPaths(handlers map[string]Handler) []string {
+	paths := make([]string, 0, len(handlers))
+	for p := range handlers {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
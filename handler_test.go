@@ -0,0 +1,132 @@
+package metadataserver_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/minherz/metadataserver"
+)
+
+// counterHandler returns the number of served requests.
+type counterHandler struct {
+	mu      sync.Mutex
+	count   int
+	calls   []string
+	initErr error
+}
+
+func (h *counterHandler) Serve(ctx context.Context, r *http.Request) (metadataserver.Response, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.count++
+	return metadataserver.Response{Body: strconv.Itoa(h.count)}, nil
+}
+
+func (h *counterHandler) Init(ctx context.Context) error {
+	h.calls = append(h.calls, "init")
+	h.count = 0
+	return h.initErr
+}
+
+func (h *counterHandler) Close(ctx context.Context) error {
+	h.calls = append(h.calls, "close")
+	return nil
+}
+
+func TestStatefulHandler(t *testing.T) {
+	h := &counterHandler{}
+	s, err := metadataserver.New(
+		metadataserver.WithAddress("127.0.0.1"),
+		metadataserver.WithPort(freePort()),
+		metadataserver.WithHandler("instance/attributes/counter", h),
+		metadataserver.WithHandler("instance/attributes/static", metadataserver.ResponseFunc(
+			func(ctx context.Context, r *http.Request) (metadataserver.Response, error) {
+				return metadataserver.Response{Body: "static"}, nil
+			})))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	for i := 1; i <= 2; i++ {
+		rec := httptest.NewRecorder()
+		s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/instance/attributes/counter", nil))
+		if got, want := rec.Body.String(), strconv.Itoa(i); got != want {
+			t.Errorf("expected body %q, got: %q", want, got)
+		}
+	}
+	if v, ok := s.GetValue("instance/attributes/static"); !ok || v != "static" {
+		t.Errorf("expected value %q, got: %q", "static", v)
+	}
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if diff := cmp.Diff([]string{"init", "close"}, h.calls); diff != "" {
+		t.Errorf("lifecycle calls mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestStatefulHandlerInitError(t *testing.T) {
+	first := &counterHandler{}
+	failing := &counterHandler{initErr: errors.New("no resources")}
+	s, err := metadataserver.New(
+		metadataserver.WithAddress("127.0.0.1"),
+		metadataserver.WithPort(freePort()),
+		metadataserver.WithHandler("a", first),
+		metadataserver.WithHandler("b", failing))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if err := s.Start(context.Background()); !errors.Is(err, failing.initErr) {
+		t.Fatalf("expected error %v, got: %v", failing.initErr, err)
+	}
+	if diff := cmp.Diff([]string{"init", "close"}, first.calls); diff != "" {
+		t.Errorf("lifecycle calls of initialized handler mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"init"}, failing.calls); diff != "" {
+		t.Errorf("lifecycle calls of failed handler mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestStatefulHandlerRestart(t *testing.T) {
+	h := &counterHandler{}
+	port := freePort()
+	s, err := metadataserver.New(
+		metadataserver.WithAddress("127.0.0.1"),
+		metadataserver.WithPort(port),
+		metadataserver.WithAdminPort(freePort()),
+		metadataserver.WithHandler("instance/attributes/counter", h))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	url := fmt.Sprintf("http://127.0.0.1:%d%s/instance/attributes/counter", port, metadataserver.DefaultEndpoint)
+	for i := 0; i < 2; i++ {
+		if err := s.Start(context.Background()); err != nil {
+			t.Fatalf("start %d: expected no errors, got: %v", i, err)
+		}
+		res, err := http.Get(url)
+		if err != nil {
+			t.Fatalf("expected no errors, got: %v", err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if got := string(body); got != "1" {
+			t.Errorf("start %d: expected the counter to start from %q, got: %q", i, "1", got)
+		}
+		if err := s.Stop(context.Background()); err != nil {
+			t.Fatalf("stop %d: expected no errors, got: %v", i, err)
+		}
+	}
+	if diff := cmp.Diff([]string{"init", "close", "init", "close"}, h.calls); diff != "" {
+		t.Errorf("lifecycle calls mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,59 @@
+package metadataserver
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// headWriter discards the body of the response to the HEAD request and counts its length.
+// The status is written when the handler returns so Content-Length can be set.
+type headWriter struct {
+	w      http.ResponseWriter
+	status int
+	n      int
+}
+
+func (h *headWriter) Header() http.Header {
+	return h.w.Header()
+}
+
+func (h *headWriter) WriteHeader(status int) {
+	if h.status == 0 {
+		h.status = status
+	}
+}
+
+// Write detects the content type of the body like [http.ResponseWriter] does if the handler does not set it
+// and the body is not encoded.
+func (h *headWriter) Write(p []byte) (int, error) {
+	h.WriteHeader(http.StatusOK)
+	if h.n == 0 && len(p) > 0 && h.w.Header().Get("Content-Encoding") == "" {
+		if _, ok := h.w.Header()["Content-Type"]; !ok {
+			h.w.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+	}
+	h.n += len(p)
+	return len(p), nil
+}
+
+// serveHead serves HEAD requests like GET requests without the body.
+// Content-Length of the response is the length of the body that the GET request gets,
+// including streamed values and directory listings.
+func (s *Server) serveHead(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		hw := &headWriter{w: w}
+		next.ServeHTTP(hw, r)
+		if hw.status == 0 {
+			hw.status = http.StatusOK
+		}
+		h := w.Header()
+		if hw.status >= http.StatusOK && hw.status != http.StatusNoContent && hw.status != http.StatusNotModified && h.Get("Content-Length") == "" {
+			h.Set("Content-Length", strconv.Itoa(hw.n))
+		}
+		w.WriteHeader(hw.status)
+	})
+}
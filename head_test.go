@@ -0,0 +1,72 @@
+package metadataserver_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestHead(t *testing.T) {
+	c, err := metadataserver.NewConfigFromFile("test/fixtures/config_file_handlers.json")
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	c.Handlers["instance/hostname"] = func() string { return "test-host" }
+	c.Handlers["instance/attributes/large"] = func() string { return strings.Repeat("x", 10000) }
+	s, err := metadataserver.New(metadataserver.WithConfiguration(c))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	ts := httptest.NewServer(s.HttpHandler())
+	defer ts.Close()
+	// the client does not decompress the responses, so the compressed length is compared
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	var paths []string
+	for _, rt := range s.Routes() {
+		if !strings.Contains(rt.Path, "*") && !strings.Contains(rt.Path, "{") {
+			paths = append(paths, rt.Path)
+		}
+	}
+	paths = append(paths, "instance/", "instance/?recursive=true", "missing", "")
+	do := func(t *testing.T, method, url, encoding string) *http.Response {
+		req, err := http.NewRequest(method, url, nil)
+		if err != nil {
+			t.Fatalf("expected no errors, got: %v", err)
+		}
+		if encoding != "" {
+			req.Header.Set("Accept-Encoding", encoding)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("expected no errors, got: %v", err)
+		}
+		return res
+	}
+	for _, encoding := range []string{"", "gzip"} {
+		for _, path := range paths {
+			t.Run(encoding+"/"+path, func(t *testing.T) {
+				url := ts.URL + c.Endpoint + "/" + path
+				res := do(t, http.MethodGet, url, encoding)
+				body, _ := io.ReadAll(res.Body)
+				res.Body.Close()
+				head := do(t, http.MethodHead, url, encoding)
+				head.Body.Close()
+				if head.StatusCode != res.StatusCode {
+					t.Errorf("expected status %d, got: %d", res.StatusCode, head.StatusCode)
+				}
+				if head.ContentLength != int64(len(body)) {
+					t.Errorf("expected Content-Length %d, got: %d", len(body), head.ContentLength)
+				}
+				for _, k := range []string{"Content-Type", "Content-Encoding", "Etag"} {
+					if got, want := head.Header.Get(k), res.Header.Get(k); got != want {
+						t.Errorf("expected header %s %q, got: %q", k, want, got)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package metadataserver
+
+import (
+	"net/http"
+	"path"
+)
+
+// ResponseHeaders describes extra headers that the server adds to responses at the paths.
+// Paths are relative to the server's endpoint and can use patterns supported by [path.Match].
+// If no paths are defined the headers are added to all responses.
+// Headers that the server sets itself, like Content-Type of the metadata value, take precedence.
+type ResponseHeaders struct {
+	Paths   []string          `json:"paths,omitempty"`
+	Headers map[string]string `json:"headers"`
+}
+
+// WithResponseHeaders sets a new server to add the headers to responses at the paths.
+//
+// Mind the order of options when use with [WithConfiguration] and [WithConfigFile].
+func WithResponseHeaders(headers map[string]string, paths ...string) Option {
+	return func(s *Server) {
+		if s.config == nil {
+			s.config = NewConfiguration(DefaultConfigurationHandlers)
+		}
+		s.config.ResponseHeaders = append(s.config.ResponseHeaders, ResponseHeaders{Paths: paths, Headers: headers})
+	}
+}
+
+func (rh ResponseHeaders) matches(key string, inEndpoint bool) bool {
+	if len(rh.Paths) == 0 {
+		return true
+	}
+	if !inEndpoint {
+		return false
+	}
+	for _, p := range rh.Paths {
+		if ok, _ := path.Match(normalizeKey(p), key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) addResponseHeaders(next http.Handler) http.Handler {
+	if len(s.config.ResponseHeaders) == 0 {
+		return next
+	}
+	rules := s.config.ResponseHeaders
+	values := make([]http.Header, len(rules))
+	for i, rh := range rules {
+		values[i] = make(http.Header, len(rh.Headers))
+		for k, v := range rh.Headers {
+			values[i].Set(k, v)
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, ok := s.keyOf(r.URL.Path)
+		h := w.Header()
+		for i, rh := range rules {
+			if rh.matches(key, ok) {
+				for k, v := range values[i] {
+					h[k] = v
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
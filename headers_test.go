@@ -0,0 +1,40 @@
+package metadataserver_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestResponseHeaders(t *testing.T) {
+	c, err := metadataserver.NewConfigFromFile("test/fixtures/config_headers.json")
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	s, err := metadataserver.New(
+		metadataserver.WithConfiguration(c),
+		metadataserver.WithResponseHeaders(map[string]string{"X-Option": "set"}, "instance/id"))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	tests := []struct {
+		path string
+		want map[string]string
+	}{
+		{"/instance/id", map[string]string{"X-Custom": "all", "X-Option": "set", "Cache-Control": ""}},
+		{"/instance/service-accounts/default/token", map[string]string{"X-Custom": "all", "X-Option": "", "Cache-Control": "no-store"}},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+test.path, nil))
+			for k, v := range test.want {
+				if got := rec.Header().Get(k); got != v {
+					t.Errorf("expected header %s %q, got: %q", k, v, got)
+				}
+			}
+		})
+	}
+}
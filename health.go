@@ -0,0 +1,47 @@
+package metadataserver
+
+import (
+	"errors"
+	"io"
+	"net/http"
+)
+
+const (
+	// HealthPath is the path at which the server reports that it is alive.
+	HealthPath = "/healthz"
+	// ReadyPath is the path at which the server reports whether it is ready to serve metadata.
+	ReadyPath = "/readyz"
+)
+
+// Ready returns nil if the server is ready to serve metadata.
+// The server is not ready if it is paused or if environment variables or files
+// that metadata handlers of the configuration file read are missing.
+func (s *Server) Ready() error {
+	var errs []error
+	if s.Paused() {
+		errs = append(errs, errors.New("server is paused"))
+	}
+	s.mu.RLock()
+	errs = append(errs, dependencyErrors(s.config)...)
+	s.mu.RUnlock()
+	return errors.Join(errs...)
+}
+
+// healthChecks responds to health and readiness checks before the request reaches other middleware,
+// so the checks are not logged, recorded or paused.
+func (s *Server) healthChecks(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case HealthPath:
+			io.WriteString(w, "ok")
+		case ReadyPath:
+			if err := s.Ready(); err != nil {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+			io.WriteString(w, "ok")
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
@@ -0,0 +1,61 @@
+package metadataserver_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestHealthChecks(t *testing.T) {
+	t.Setenv("two", "")
+	c, err := metadataserver.NewConfigFromFile("test/fixtures/config_literal_handlers.json")
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	s, err := metadataserver.New(metadataserver.WithConfiguration(c))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	if rec := get(metadataserver.ReadyPath); rec.Code != http.StatusOK {
+		t.Errorf("expected status %d, got: %d %q", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	s.Pause()
+	if rec := get(metadataserver.HealthPath); rec.Code != http.StatusOK {
+		t.Errorf("expected paused server to be healthy, got: %d", rec.Code)
+	}
+	if rec := get(metadataserver.ReadyPath); rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "paused") {
+		t.Errorf("expected paused server to be not ready, got: %d %q", rec.Code, rec.Body.String())
+	}
+	s.Resume()
+	if err := s.Ready(); err != nil {
+		t.Errorf("expected resumed server to be ready, got: %v", err)
+	}
+}
+
+func TestReadyMissingEnv(t *testing.T) {
+	// t.Setenv restores the ambient value of the variable after the test
+	t.Setenv("two", "")
+	os.Unsetenv("two")
+	c, err := metadataserver.NewConfigFromFile("test/fixtures/config_literal_handlers.json")
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	s, err := metadataserver.New(metadataserver.WithConfiguration(c))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	want := `metadata "entry2": environment variable "two" is not set`
+	if err := s.Ready(); err == nil || err.Error() != want {
+		t.Errorf("expected error %q, got: %v", want, err)
+	}
+}
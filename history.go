@@ -0,0 +1,118 @@
+package metadataserver
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// historySize is the maximum number of requests kept in the request history.
+const historySize = 100
+
+// RequestRecord describes a request served by the metadata server.
+type RequestRecord struct {
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	RemoteAddr string    `json:"remoteAddr"`
+}
+
+// History returns the most recent requests served by the server starting from the oldest one.
+func (s *Server) History() []RequestRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	history := make([]RequestRecord, 0, len(s.history))
+	history = append(history, s.history[s.historyNext:]...)
+	return append(history, s.history[:s.historyNext]...)
+}
+
+func (s *Server) recordRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := newStatusRecorder(w)
+		defer rw.release()
+		next.ServeHTTP(rw, r)
+		record := RequestRecord{
+			Time:       s.now(),
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Status:     rw.status,
+			RemoteAddr: r.RemoteAddr,
+		}
+		s.mu.Lock()
+		if len(s.history) == historySize {
+			// overwrite the oldest record
+			s.history[s.historyNext] = record
+			s.historyNext = (s.historyNext + 1) % historySize
+		} else {
+			s.history = append(s.history, record)
+		}
+		s.updateStatsLocked(record)
+		if len(s.expectations) > 0 {
+			s.updateExpectationsLocked(record)
+		}
+		s.mu.Unlock()
+		if s.events.active() {
+			rec := record
+			s.events.emit(Event{Time: rec.Time, Type: EventRequest, Request: &rec})
+		}
+		s.notifyWebhooks(record)
+	})
+}
+
+// statusRecorder captures the status code and the size of the response.
+// If body is not nil, it also keeps a copy of the response body.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+	body   *bytes.Buffer
+}
+
+var statusRecorderPool = sync.Pool{
+	New: func() any { return new(statusRecorder) },
+}
+
+// newStatusRecorder returns a recorder from the pool that wraps w.
+// Call release when the request is served to return the recorder to the pool.
+func newStatusRecorder(w http.ResponseWriter) *statusRecorder {
+	rw := statusRecorderPool.Get().(*statusRecorder)
+	rw.ResponseWriter = w
+	rw.status = http.StatusOK
+	return rw
+}
+
+func (rw *statusRecorder) release() {
+	*rw = statusRecorder{}
+	statusRecorderPool.Put(rw)
+}
+
+func (rw *statusRecorder) WriteHeader(status int) {
+	rw.status = status
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *statusRecorder) Write(b []byte) (int, error) {
+	n, err := rw.ResponseWriter.Write(b)
+	rw.size += n
+	if rw.body != nil {
+		rw.body.Write(b[:n])
+	}
+	return n, err
+}
+
+// WriteString writes the string without copying it to bytes if the wrapped writer implements [io.StringWriter].
+func (rw *statusRecorder) WriteString(str string) (int, error) {
+	n, err := io.WriteString(rw.ResponseWriter, str)
+	rw.size += n
+	if rw.body != nil {
+		rw.body.WriteString(str[:n])
+	}
+	return n, err
+}
+
+func (rw *statusRecorder) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
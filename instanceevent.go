@@ -0,0 +1,52 @@
+package metadataserver
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Paths of the metadata that announce the events of the instance.
+const (
+	MaintenanceEventPath = "instance/maintenance-event"
+	PreemptedPath        = "instance/preempted"
+)
+
+// Events of the instance that can be triggered with [Server.TriggerEvent].
+const (
+	// InstanceEventMaintenance announces the host maintenance at [MaintenanceEventPath].
+	InstanceEventMaintenance = "maintenance"
+	// InstanceEventPreemption marks the instance as preempted at [PreemptedPath].
+	InstanceEventPreemption = "preemption"
+)
+
+// ErrUnknownEvent is returned when the event that is triggered is not supported.
+var ErrUnknownEvent error = errors.New("unknown event")
+
+// instanceEvents keeps the paths and the default values of the instance events.
+var instanceEvents = map[string]struct{ path, value string }{
+	InstanceEventMaintenance: {MaintenanceEventPath, "MIGRATE_ON_HOST_MAINTENANCE"},
+	InstanceEventPreemption:  {PreemptedPath, "TRUE"},
+}
+
+// TriggerEvent sets the metadata that announces the event of the instance, e.g. the host maintenance.
+// The value replaces the default value of the event, e.g. "TERMINATE_ON_HOST_MAINTENANCE" for the maintenance
+// or "NONE" to announce that the maintenance is over. The clients that wait for the change of the value
+// (see [Server.Subscribe]) are notified. [Server.Reset] clears the triggered events.
+// It returns [ErrUnknownEvent] if the event is not one of the InstanceEvent constants.
+//
+// It is safe to call TriggerEvent while the server is running.
+func (s *Server) TriggerEvent(event, value string) error {
+	return s.triggerEvent(event, value, AuditSourceAPI)
+}
+
+func (s *Server) triggerEvent(event, value, source string) error {
+	e, ok := instanceEvents[event]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownEvent, event)
+	}
+	if value == "" {
+		value = e.value
+	}
+	s.setValue(e.path, value, source)
+	return nil
+}
@@ -0,0 +1,74 @@
+package metadataserver_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestTriggerEvent(t *testing.T) {
+	tests := []struct {
+		event string
+		value string
+		path  string
+		want  string
+	}{
+		{metadataserver.InstanceEventMaintenance, "", metadataserver.MaintenanceEventPath, "MIGRATE_ON_HOST_MAINTENANCE"},
+		{metadataserver.InstanceEventMaintenance, "TERMINATE_ON_HOST_MAINTENANCE", metadataserver.MaintenanceEventPath, "TERMINATE_ON_HOST_MAINTENANCE"},
+		{metadataserver.InstanceEventPreemption, "", metadataserver.PreemptedPath, "TRUE"},
+	}
+	for _, test := range tests {
+		s, err := metadataserver.New()
+		if err != nil {
+			t.Fatalf("expected no errors, got: %v", err)
+		}
+		ch := s.Subscribe(test.path)
+		if err := s.TriggerEvent(test.event, test.value); err != nil {
+			t.Fatalf("%s: expected no errors, got: %v", test.event, err)
+		}
+		if got, _ := s.GetValue(test.path); got != test.want {
+			t.Errorf("%s: expected %q, got: %q", test.event, test.want, got)
+		}
+		if e := <-ch; e.Path != test.path || e.Value != test.want {
+			t.Errorf("%s: unexpected change event: %+v", test.event, e)
+		}
+		s.Unsubscribe(ch)
+	}
+
+	s, err := metadataserver.New()
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if err := s.TriggerEvent("reboot", ""); !errors.Is(err, metadataserver.ErrUnknownEvent) {
+		t.Errorf("expected %v, got: %v", metadataserver.ErrUnknownEvent, err)
+	}
+}
+
+func TestAdminTriggerEvent(t *testing.T) {
+	s, err := metadataserver.New()
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	admin := httptest.NewServer(s.AdminHttpHandler())
+	defer admin.Close()
+
+	adminRequest(t, http.MethodPost, admin.URL+"/trigger/maintenance?value=TERMINATE_ON_HOST_MAINTENANCE", "")
+	if got, _ := s.GetValue(metadataserver.MaintenanceEventPath); got != "TERMINATE_ON_HOST_MAINTENANCE" {
+		t.Errorf("expected %q, got: %q", "TERMINATE_ON_HOST_MAINTENANCE", got)
+	}
+	res, err := http.Post(admin.URL+"/trigger/reboot", "", nil)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+	adminRequest(t, http.MethodPost, admin.URL+"/reset", "")
+	if _, ok := s.GetValue(metadataserver.MaintenanceEventPath); ok {
+		t.Errorf("expected the event to be cleared by reset")
+	}
+}
@@ -0,0 +1,75 @@
+package metadataserver
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+const (
+	// DefaultMaxRequestBodySize is the maximal size of the request body in bytes that the server accepts by default.
+	DefaultMaxRequestBodySize = 1 << 20
+	// DefaultMaxURLLength is the maximal length of the request URL that the server accepts by default.
+	DefaultMaxURLLength = 8 << 10
+)
+
+// WithMaxRequestBodySize sets a new server with the maximal size of the request body in bytes.
+// Requests with larger bodies are rejected with 413 (Request Entity Too Large).
+// The limit applies to the metadata and the admin API requests. Use a negative size to disable the limit.
+func WithMaxRequestBodySize(size int64) Option {
+	return func(s *Server) {
+		s.maxRequestBodySize = &size
+	}
+}
+
+// WithMaxURLLength sets a new server with the maximal length of the request URL (path and query).
+// Requests with longer URLs are rejected with 414 (Request URI Too Long).
+// The limit applies to the metadata and the admin API requests. Use a negative length to disable the limit.
+func WithMaxURLLength(length int) Option {
+	return func(s *Server) {
+		s.maxURLLength = &length
+	}
+}
+
+func (s *Server) limitRequests(next http.Handler) http.Handler {
+	maxBody := int64(DefaultMaxRequestBodySize)
+	if s.maxRequestBodySize != nil {
+		maxBody = *s.maxRequestBodySize
+	}
+	maxURL := DefaultMaxURLLength
+	if s.maxURLLength != nil {
+		maxURL = *s.maxURLLength
+	}
+	if maxBody < 0 && maxURL < 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if maxURL >= 0 && len(r.RequestURI) > maxURL {
+			s.handlerLogger.DebugContext(r.Context(), "request URL is too long", slog.Int("length", len(r.RequestURI)))
+			http.Error(w, http.StatusText(http.StatusRequestURITooLong), http.StatusRequestURITooLong)
+			return
+		}
+		if maxBody >= 0 {
+			if r.ContentLength > maxBody {
+				s.handlerLogger.DebugContext(r.Context(), "request body is too large", slog.Int64("size", r.ContentLength))
+				http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				return
+			}
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = http.MaxBytesReader(w, r.Body, maxBody)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// readBodyError responds to the error of reading the request body.
+// It responds with 413 if the body exceeds the limit and with 400 otherwise.
+func readBodyError(w http.ResponseWriter, err error) {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
@@ -0,0 +1,48 @@
+package metadataserver_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestRequestLimits(t *testing.T) {
+	s, err := metadataserver.New(
+		metadataserver.WithMaxRequestBodySize(10),
+		metadataserver.WithMaxURLLength(100))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	tests := []struct {
+		name    string
+		handler http.Handler
+		method  string
+		url     string
+		body    string
+		chunked bool
+		want    int
+	}{
+		{"short url", s.HttpHandler(), http.MethodGet, metadataserver.DefaultEndpoint + "/project/project-id", "", false, http.StatusOK},
+		{"long url", s.HttpHandler(), http.MethodGet, metadataserver.DefaultEndpoint + "/" + strings.Repeat("a", 100), "", false, http.StatusRequestURITooLong},
+		{"large body", s.HttpHandler(), http.MethodPost, metadataserver.DefaultEndpoint + "/project/project-id", strings.Repeat("a", 11), false, http.StatusRequestEntityTooLarge},
+		{"admin small body", s.AdminHttpHandler(), http.MethodPut, "/values/instance/id", "123", false, http.StatusNoContent},
+		{"admin large body", s.AdminHttpHandler(), http.MethodPut, "/values/instance/id", strings.Repeat("a", 11), false, http.StatusRequestEntityTooLarge},
+		{"admin large chunked body", s.AdminHttpHandler(), http.MethodPut, "/values/instance/id", strings.Repeat("a", 11), true, http.StatusRequestEntityTooLarge},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(test.method, test.url, strings.NewReader(test.body))
+			if test.chunked {
+				r.ContentLength = -1
+			}
+			rec := httptest.NewRecorder()
+			test.handler.ServeHTTP(rec, r)
+			if rec.Code != test.want {
+				t.Errorf("expected status %d, got: %d", test.want, rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package metadataserver
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// LintWarning describes a suspicious part of the configuration that the server serves nevertheless,
+// e.g. a leftover of a real environment in a test fixture.
+type LintWarning struct {
+	// Field is the part of the configuration, e.g. "endpoint", `metadata "instance/zone"` or `alias "zone"`.
+	Field string
+	// Message describes the problem.
+	Message string
+}
+
+// String returns the warning as "FIELD: MESSAGE".
+func (w LintWarning) String() string {
+	return w.Field + ": " + w.Message
+}
+
+// credentialPatterns match values that look like real credentials.
+var credentialPatterns = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{"Google API key", regexp.MustCompile(`AIza[0-9A-Za-z_\-]{35}`)},
+	{"OAuth 2.0 access token", regexp.MustCompile(`ya29\.[0-9A-Za-z_\-]{20,}`)},
+	{"private key", regexp.MustCompile(`-----BEGIN (?:RSA |EC |OPENSSH |ENCRYPTED )?PRIVATE KEY-----`)},
+	{"service account key", regexp.MustCompile(`"private_key_id"\s*:`)},
+	{"AWS access key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"GitHub token", regexp.MustCompile(`\bgh[pousr]_[0-9A-Za-z]{36}\b`)},
+}
+
+// credentialName returns the name of the credential that the value looks like or an empty string.
+func credentialName(v string) string {
+	for _, cp := range credentialPatterns {
+		if cp.pattern.MatchString(v) {
+			return cp.name
+		}
+	}
+	return ""
+}
+
+// Lint returns the warnings about the configuration sorted by field. It warns about
+//   - metadata that reads unset environment variables or missing files,
+//   - aliases which targets are not served,
+//   - static values and service account tokens that look like real credentials,
+//   - the endpoint without the leading slash,
+//   - the zero shutdown timeout that drops active requests when the server stops.
+//
+// Metadata of the profiles is checked too. Unlike the problems reported by [ValidateConfigFile],
+// the warnings do not prevent the server from serving the configuration.
+func (c *Configuration) Lint() []LintWarning {
+	var warnings []LintWarning
+	warn := func(field, format string, args ...any) {
+		warnings = append(warnings, LintWarning{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+	if c.Endpoint != "" && c.Endpoint[0] != '/' {
+		warn("endpoint", "%q does not start with \"/\"", c.Endpoint)
+	}
+	if c.ShutdownTimeout == 0 {
+		warn("shutdownTimeout", "zero timeout drops active requests when the server stops")
+	}
+	lintMetadata(c, "", warn)
+	for _, p := range c.Profiles {
+		if p.config != nil {
+			lintMetadata(p.config, fmt.Sprintf("profile %q: ", p.Name), warn)
+		}
+	}
+	var served routeTrie
+	keys := c.keys()
+	for _, p := range c.Profiles {
+		keys = appendKeys(keys, p.Handlers)
+		if p.config != nil {
+			keys = append(keys, p.config.keys()...)
+		}
+	}
+	for _, k := range keys {
+		served.insert(normalizeKey(k), &route{key: normalizeKey(k)})
+	}
+	for alias, target := range c.Aliases {
+		if served.node(normalizeKey(target)) == nil {
+			warn(fmt.Sprintf("alias %q", alias), "target %q is not served", target)
+		}
+	}
+	for _, sa := range c.ServiceAccounts {
+		if name := credentialName(sa.Token); name != "" {
+			warn(fmt.Sprintf("service account %q", sa.Email), "token looks like a real %s", name)
+		}
+	}
+	sort.Slice(warnings, func(i, j int) bool {
+		if warnings[i].Field != warnings[j].Field {
+			return warnings[i].Field < warnings[j].Field
+		}
+		return warnings[i].Message < warnings[j].Message
+	})
+	return warnings
+}
+
+// lintMetadata warns about the metadata of the configuration file that reads unset environment variables
+// or missing files and about static values that look like real credentials.
+func lintMetadata(c *Configuration, prefix string, warn func(field, format string, args ...any)) {
+	for _, err := range dependencyErrors(c) {
+		de := err.(*dependencyError)
+		warn(fmt.Sprintf("%smetadata %q", prefix, de.key), "%v", de.err)
+	}
+	for k, v := range c.literals {
+		if name := credentialName(v); name != "" {
+			warn(fmt.Sprintf("%smetadata %q", prefix, k), "value looks like a real %s", name)
+		}
+	}
+}
+
+// keys returns the keys of all handlers of the configuration including the metadata
+// that the project, the zone and the service accounts add when the server is created.
+func (c *Configuration) keys() []string {
+	keys := appendKeys(nil, c.Handlers)
+	keys = appendKeys(keys, c.FuncHandlers)
+	keys = appendKeys(keys, c.BytesHandlers)
+	keys = appendKeys(keys, c.ResponseHandlers)
+	keys = appendKeys(keys, c.StatefulHandlers)
+	keys = appendKeys(keys, c.StreamHandlers)
+	keys = appendKeys(keys, c.parsed)
+	if c.ProjectID != "" {
+		keys = append(keys, ProjectIDPath)
+	}
+	if c.ProjectNumber > 0 {
+		keys = append(keys, ProjectNumberPath)
+	}
+	if c.Zone != "" {
+		keys = append(keys, ZonePath, RegionPath)
+	}
+	for _, sa := range c.ServiceAccounts {
+		keys = append(keys, "instance/service-accounts/"+sa.Email+"/email")
+	}
+	return keys
+}
+
+func appendKeys[V any](keys []string, m map[string]V) []string {
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
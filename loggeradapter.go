@@ -0,0 +1,132 @@
+package metadataserver
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Logger is a minimal interface of the logger that receives the server's diagnostics.
+// The keys and values are alternating pairs; keys of grouped attributes are joined with dots, e.g. "request.path".
+// Use [SlogLogger] or [ZapLogger] to adapt popular loggers.
+// The adapter of logr.Logger is in the github.com/minherz/metadataserver/logradapter module.
+type Logger interface {
+	Enabled(ctx context.Context, level slog.Level) bool
+	Log(ctx context.Context, level slog.Level, msg string, keysAndValues ...any)
+}
+
+// WithLoggerAdapter sets a new server with the logger that does not use [slog].
+// It replaces the logger set with [WithLogger].
+func WithLoggerAdapter(l Logger) Option {
+	return func(s *Server) {
+		s.logger = slog.New(&adapterHandler{l: l})
+	}
+}
+
+// SlogLogger adapts [slog.Logger] to [Logger].
+func SlogLogger(l *slog.Logger) Logger {
+	return slogLogger{l}
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+func (a slogLogger) Enabled(ctx context.Context, level slog.Level) bool {
+	return a.l.Enabled(ctx, level)
+}
+
+func (a slogLogger) Log(ctx context.Context, level slog.Level, msg string, keysAndValues ...any) {
+	a.l.Log(ctx, level, msg, keysAndValues...)
+}
+
+// SugaredLogger is the subset of the methods of zap's SugaredLogger that is used by [ZapLogger].
+type SugaredLogger interface {
+	Debugw(msg string, keysAndValues ...any)
+	Infow(msg string, keysAndValues ...any)
+	Warnw(msg string, keysAndValues ...any)
+	Errorw(msg string, keysAndValues ...any)
+}
+
+// ZapLogger adapts zap's SugaredLogger (e.g. zap.L().Sugar()) to [Logger].
+// All records are passed to the logger which filters them by its level.
+func ZapLogger(l SugaredLogger) Logger {
+	return zapLogger{l}
+}
+
+type zapLogger struct {
+	l SugaredLogger
+}
+
+func (a zapLogger) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (a zapLogger) Log(ctx context.Context, level slog.Level, msg string, keysAndValues ...any) {
+	switch {
+	case level >= slog.LevelError:
+		a.l.Errorw(msg, keysAndValues...)
+	case level >= slog.LevelWarn:
+		a.l.Warnw(msg, keysAndValues...)
+	case level >= slog.LevelInfo:
+		a.l.Infow(msg, keysAndValues...)
+	default:
+		a.l.Debugw(msg, keysAndValues...)
+	}
+}
+
+// adapterHandler is [slog.Handler] that passes the records to [Logger].
+type adapterHandler struct {
+	l Logger
+	// keysAndValues are the attributes added with WithAttrs
+	keysAndValues []any
+	// prefix is the key prefix of the groups added with WithGroup
+	prefix string
+}
+
+func (h *adapterHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.l.Enabled(ctx, level)
+}
+
+func (h *adapterHandler) Handle(ctx context.Context, rec slog.Record) error {
+	kv := make([]any, len(h.keysAndValues), len(h.keysAndValues)+2*rec.NumAttrs())
+	copy(kv, h.keysAndValues)
+	rec.Attrs(func(a slog.Attr) bool {
+		kv = appendAttr(kv, h.prefix, a)
+		return true
+	})
+	h.l.Log(ctx, rec.Level, rec.Message, kv...)
+	return nil
+}
+
+func (h *adapterHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	kv := append([]any(nil), h.keysAndValues...)
+	for _, a := range attrs {
+		kv = appendAttr(kv, h.prefix, a)
+	}
+	return &adapterHandler{l: h.l, keysAndValues: kv, prefix: h.prefix}
+}
+
+func (h *adapterHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &adapterHandler{l: h.l, keysAndValues: h.keysAndValues, prefix: h.prefix + name + "."}
+}
+
+// appendAttr appends the key and the value of the attribute to kv. Groups are flattened.
+func appendAttr(kv []any, prefix string, a slog.Attr) []any {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range v.Group() {
+			kv = appendAttr(kv, prefix, ga)
+		}
+		return kv
+	}
+	if a.Key == "" {
+		return kv
+	}
+	return append(kv, prefix+a.Key, v.Any())
+}
@@ -0,0 +1,74 @@
+package metadataserver_test
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+type fakeSugaredLogger struct {
+	lines []string
+}
+
+func (l *fakeSugaredLogger) log(level, msg string, keysAndValues ...any) {
+	l.lines = append(l.lines, fmt.Sprintf("%s %s %v", level, msg, keysAndValues))
+}
+
+func (l *fakeSugaredLogger) Debugw(msg string, kv ...any) { l.log("debug", msg, kv...) }
+func (l *fakeSugaredLogger) Infow(msg string, kv ...any)  { l.log("info", msg, kv...) }
+func (l *fakeSugaredLogger) Warnw(msg string, kv ...any)  { l.log("warn", msg, kv...) }
+func (l *fakeSugaredLogger) Errorw(msg string, kv ...any) { l.log("error", msg, kv...) }
+
+func TestLoggerAdapter(t *testing.T) {
+	zap := &fakeSugaredLogger{}
+	tests := []struct {
+		name   string
+		logger metadataserver.Logger
+		lines  func() []string
+	}{
+		{
+			name:   "zap",
+			logger: metadataserver.ZapLogger(zap),
+			lines:  func() []string { return zap.lines },
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := metadataserver.New(
+				metadataserver.WithLoggerAdapter(test.logger),
+				metadataserver.WithLogLevel(slog.LevelDebug))
+			if err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			rec := httptest.NewRecorder()
+			s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/project/project-id", nil))
+			var found bool
+			for _, line := range test.lines() {
+				if strings.Contains(line, "/computeMetadata/v1/project/project-id") {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("expected a record about the request, got: %q", test.lines())
+			}
+		})
+	}
+}
+
+func TestSlogLogger(t *testing.T) {
+	var b strings.Builder
+	l := metadataserver.SlogLogger(slog.New(slog.NewTextHandler(&b, &slog.HandlerOptions{Level: slog.LevelInfo})))
+	if l.Enabled(context.Background(), slog.LevelDebug) {
+		t.Errorf("expected debug level to be disabled")
+	}
+	l.Log(context.Background(), slog.LevelInfo, "hello", "request.path", "/")
+	if got := b.String(); !strings.Contains(got, "msg=hello request.path=/") {
+		t.Errorf("unexpected record: %q", got)
+	}
+}
@@ -0,0 +1,134 @@
+package metadataserver
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"path"
+	"time"
+)
+
+// LogComponent identifies a group of log records that the server emits.
+type LogComponent int
+
+const (
+	// LogLifecycle identifies records about starting and stopping the server, scenarios and other background activities.
+	LogLifecycle LogComponent = iota
+	// LogRequests identifies records about served requests. See [WithRequestLogLevel].
+	LogRequests
+	// LogHandlers identifies records about evaluation of metadata handlers.
+	LogHandlers
+)
+
+// WithLogLevel sets a new server with the minimal level of the log records that the server emits.
+// Records with lower level are not passed to the logger set with [WithLogger].
+func WithLogLevel(level slog.Leveler) Option {
+	return func(s *Server) {
+		s.logLevel = level
+	}
+}
+
+// WithSilencedLogs sets a new server to not emit log records of the components.
+func WithSilencedLogs(components ...LogComponent) Option {
+	return func(s *Server) {
+		if s.silencedLogs == nil {
+			s.silencedLogs = make(map[LogComponent]bool)
+		}
+		for _, c := range components {
+			s.silencedLogs[c] = true
+		}
+	}
+}
+
+// DefaultRedactedPaths are the patterns of the metadata paths which values are redacted in the log records
+// unless other patterns are set with [WithRedactedPaths].
+var DefaultRedactedPaths = []string{
+	"instance/service-accounts/*/token",
+	"instance/service-accounts/*/identity",
+	"*/attributes/ssh-keys",
+}
+
+// redactedValue replaces values of the redacted metadata in the log records.
+const redactedValue = "REDACTED"
+
+// WithRedactedPaths sets a new server with the patterns of the metadata paths which values are replaced
+// with "REDACTED" in the log records. The patterns use the syntax of [path.Match] and are matched against
+// the metadata path relative to the endpoint (e.g. "instance/service-accounts/*/token").
+// The patterns replace [DefaultRedactedPaths]. Call it without patterns to log all values verbatim.
+func WithRedactedPaths(patterns ...string) Option {
+	return func(s *Server) {
+		s.redactedPaths = append([]string{}, patterns...)
+	}
+}
+
+// loggedValue returns the value of the metadata at the key as it should appear in the log records.
+func (s *Server) loggedValue(key, value string) string {
+	for _, p := range s.redactedPaths {
+		if matched, _ := path.Match(p, key); matched {
+			return redactedValue
+		}
+	}
+	return value
+}
+
+// componentLogger returns a logger that emits records of the component according to the server's log settings.
+func (s *Server) componentLogger(h slog.Handler, c LogComponent) *slog.Logger {
+	return slog.New(filterLogHandler{Handler: h, level: s.logLevel, silenced: s.silencedLogs[c]})
+}
+
+// filterLogHandler drops records below the level or all records if silenced.
+type filterLogHandler struct {
+	slog.Handler
+	level    slog.Leveler
+	silenced bool
+}
+
+func (h filterLogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if h.silenced || (h.level != nil && level < h.level.Level()) {
+		return false
+	}
+	return h.Handler.Enabled(ctx, level)
+}
+
+func (h filterLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return filterLogHandler{Handler: h.Handler.WithAttrs(attrs), level: h.level, silenced: h.silenced}
+}
+
+func (h filterLogHandler) WithGroup(name string) slog.Handler {
+	return filterLogHandler{Handler: h.Handler.WithGroup(name), level: h.level, silenced: h.silenced}
+}
+
+// WithRequestLogLevel sets a new server with the level at which each served request is logged.
+// The default level is [slog.LevelDebug].
+func WithRequestLogLevel(level slog.Leveler) Option {
+	return func(s *Server) {
+		s.requestLogLevel = level
+	}
+}
+
+func (s *Server) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		level := slog.LevelDebug
+		if s.requestLogLevel != nil {
+			level = s.requestLogLevel.Level()
+		}
+		ctx := r.Context()
+		if !s.requestLogger.Enabled(ctx, level) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		rw := newStatusRecorder(w)
+		defer rw.release()
+		next.ServeHTTP(rw, r)
+		s.requestLogger.LogAttrs(ctx, level, "request is served",
+			slog.Group("request",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("remoteAddr", r.RemoteAddr)),
+			slog.Group("response",
+				slog.Int("status", rw.status),
+				slog.Int("size", rw.size)),
+			slog.Duration("duration", time.Since(start)))
+	})
+}
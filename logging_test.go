@@ -0,0 +1,209 @@
+package metadataserver_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/minherz/metadataserver"
+)
+
+func TestRequestLogging(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	s, err := metadataserver.New(
+		metadataserver.WithLogger(logger),
+		metadataserver.WithRequestLogLevel(slog.LevelInfo))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	ts := httptest.NewServer(s.HttpHandler())
+	defer ts.Close()
+	getStatus(t, ts.URL+metadataserver.DefaultEndpoint+"/instance/unknown")
+
+	var got struct {
+		Msg     string
+		Request struct {
+			Method string
+			Path   string
+		}
+		Response struct {
+			Status int
+		}
+		Duration int64
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("expected single JSON record, got: %q", buf.String())
+	}
+	if got.Msg != "request is served" || got.Request.Method != http.MethodGet ||
+		got.Request.Path != metadataserver.DefaultEndpoint+"/instance/unknown" || got.Response.Status != http.StatusNotFound {
+		t.Errorf("unexpected log record: %q", buf.String())
+	}
+}
+
+func TestTraceIDInLogs(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		want   string
+	}{
+		{
+			name:   "traceparent",
+			header: "traceparent",
+			value:  "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			want:   "4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+		{
+			name:   "cloud_trace_context",
+			header: "X-Cloud-Trace-Context",
+			value:  "105445aa7843bc8bf206b12000100000/1;o=1",
+			want:   "105445aa7843bc8bf206b12000100000",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+			s, err := metadataserver.New(metadataserver.WithLogger(logger))
+			if err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			ts := httptest.NewServer(s.HttpHandler())
+			defer ts.Close()
+			buf.Reset()
+
+			req, _ := http.NewRequest(http.MethodGet, ts.URL+metadataserver.DefaultEndpoint+"/project/project-id", nil)
+			req.Header.Set(test.header, test.value)
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			res.Body.Close()
+
+			dec := json.NewDecoder(&buf)
+			records := 0
+			for dec.More() {
+				var rec struct{ TraceID string }
+				if err := dec.Decode(&rec); err != nil {
+					t.Fatalf("expected no errors, got: %v", err)
+				}
+				if rec.TraceID != test.want {
+					t.Errorf("expected trace ID %q, got: %q", test.want, rec.TraceID)
+				}
+				records++
+			}
+			if records == 0 {
+				t.Errorf("expected log records for the request")
+			}
+		})
+	}
+}
+
+func TestLogFiltering(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []metadataserver.Option
+		want []string
+	}{
+		{
+			name: "all",
+			want: []string{"metadata handler is called", "request is served"},
+		},
+		{
+			name: "log_level",
+			opts: []metadataserver.Option{metadataserver.WithLogLevel(slog.LevelInfo)},
+		},
+		{
+			name: "silenced_handlers",
+			opts: []metadataserver.Option{metadataserver.WithSilencedLogs(metadataserver.LogHandlers)},
+			want: []string{"request is served"},
+		},
+		{
+			name: "silenced_requests",
+			opts: []metadataserver.Option{metadataserver.WithSilencedLogs(metadataserver.LogRequests, metadataserver.LogLifecycle)},
+			want: []string{"metadata handler is called"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+			s, err := metadataserver.New(append(test.opts, metadataserver.WithLogger(logger))...)
+			if err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			ts := httptest.NewServer(s.HttpHandler())
+			defer ts.Close()
+			buf.Reset()
+			getStatus(t, ts.URL+metadataserver.DefaultEndpoint+"/project/project-id")
+
+			var got []string
+			dec := json.NewDecoder(&buf)
+			for dec.More() {
+				var rec struct{ Msg string }
+				if err := dec.Decode(&rec); err != nil {
+					t.Fatalf("expected no errors, got: %v", err)
+				}
+				got = append(got, rec.Msg)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("log records mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRedactedValues(t *testing.T) {
+	handlers := map[string]metadataserver.Metadata{
+		"instance/service-accounts/default/token": func() string { return "secret-token" },
+		"project/attributes/ssh-keys":             func() string { return "user:ssh-rsa AAAA" },
+		"instance/zone":                           func() string { return "us-central1-a" },
+	}
+	tests := []struct {
+		name string
+		opts []metadataserver.Option
+		path string
+		want string
+	}{
+		{"default token", nil, "instance/service-accounts/default/token", "REDACTED"},
+		{"default ssh keys", nil, "project/attributes/ssh-keys", "REDACTED"},
+		{"default other", nil, "instance/zone", "us-central1-a"},
+		{"custom", []metadataserver.Option{metadataserver.WithRedactedPaths("instance/zone")}, "instance/zone", "REDACTED"},
+		{"custom replaces default", []metadataserver.Option{metadataserver.WithRedactedPaths("instance/zone")}, "instance/service-accounts/default/token", "secret-token"},
+		{"disabled", []metadataserver.Option{metadataserver.WithRedactedPaths()}, "project/attributes/ssh-keys", "user:ssh-rsa AAAA"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+			opts := append(test.opts, metadataserver.WithHandlers(handlers), metadataserver.WithLogger(logger))
+			s, err := metadataserver.New(opts...)
+			if err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			ts := httptest.NewServer(s.HttpHandler())
+			defer ts.Close()
+			getStatus(t, ts.URL+metadataserver.DefaultEndpoint+"/"+test.path)
+
+			got := ""
+			dec := json.NewDecoder(&buf)
+			for dec.More() {
+				var rec map[string]any
+				if err := dec.Decode(&rec); err != nil {
+					t.Fatalf("expected no errors, got: %v", err)
+				}
+				if rec["msg"] == "metadata handler is called" {
+					got, _ = rec["response"].(string)
+				}
+			}
+			if got != test.want {
+				t.Errorf("expected logged response %q, got: %q", test.want, got)
+			}
+		})
+	}
+}
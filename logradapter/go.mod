@@ -0,0 +1,16 @@
+module github.com/minherz/metadataserver/logradapter
+
+go 1.22.0
+
+require (
+	github.com/go-logr/logr v1.4.2
+	github.com/minherz/metadataserver v0.0.0
+)
+
+require (
+	go.opentelemetry.io/otel v1.33.0 // indirect
+	go.opentelemetry.io/otel/metric v1.33.0 // indirect
+	go.opentelemetry.io/otel/trace v1.33.0 // indirect
+)
+
+replace github.com/minherz/metadataserver => ../
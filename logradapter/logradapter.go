@@ -0,0 +1,43 @@
+// Package logradapter adapts [logr.Logger] to the [metadataserver.Logger] interface:
+//
+//	s, err := metadataserver.New(metadataserver.WithLoggerAdapter(logradapter.Logger(log)))
+//
+// The adapter is kept in the separate module, so the metadataserver module does not depend on logr.
+package logradapter
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/go-logr/logr"
+	"github.com/minherz/metadataserver"
+)
+
+// Logger adapts [logr.Logger] to [metadataserver.Logger].
+// Errors are logged with Error, warnings and info with V(0) and debug records with V(1).
+func Logger(l logr.Logger) metadataserver.Logger {
+	return logger{l}
+}
+
+type logger struct {
+	l logr.Logger
+}
+
+func (a logger) verbosity(level slog.Level) int {
+	if level < slog.LevelInfo {
+		return 1
+	}
+	return 0
+}
+
+func (a logger) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelError || a.l.V(a.verbosity(level)).Enabled()
+}
+
+func (a logger) Log(ctx context.Context, level slog.Level, msg string, keysAndValues ...any) {
+	if level >= slog.LevelError {
+		a.l.Error(nil, msg, keysAndValues...)
+		return
+	}
+	a.l.V(a.verbosity(level)).Info(msg, keysAndValues...)
+}
@@ -0,0 +1,56 @@
+package logradapter_test
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+	"github.com/minherz/metadataserver"
+	"github.com/minherz/metadataserver/logradapter"
+)
+
+func TestLogger(t *testing.T) {
+	var lines []string
+	l := logradapter.Logger(funcr.New(func(prefix, args string) {
+		lines = append(lines, args)
+	}, funcr.Options{Verbosity: 1}))
+	s, err := metadataserver.New(
+		metadataserver.WithLoggerAdapter(l),
+		metadataserver.WithLogLevel(slog.LevelDebug))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/project/project-id", nil))
+	var found bool
+	for _, line := range lines {
+		if strings.Contains(line, "/computeMetadata/v1/project/project-id") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected a record about the request, got: %q", lines)
+	}
+}
+
+func TestLoggerLevels(t *testing.T) {
+	var lines []string
+	l := logradapter.Logger(funcr.New(func(prefix, args string) {
+		lines = append(lines, args)
+	}, funcr.Options{}))
+	ctx := context.Background()
+	if l.Enabled(ctx, slog.LevelDebug) {
+		t.Errorf("expected debug level to be disabled")
+	}
+	if !l.Enabled(ctx, slog.LevelError) {
+		t.Errorf("expected error level to be enabled")
+	}
+	l.Log(ctx, slog.LevelError, "failed", "request.path", "/")
+	if len(lines) != 1 || !strings.Contains(lines[0], `"msg"="failed"`) {
+		t.Errorf("unexpected records: %q", lines)
+	}
+}
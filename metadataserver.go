@@ -6,11 +6,21 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
 	"net"
 	"net/http"
-	"path"
+	"net/http/httputil"
+	"net/netip"
+	"net/url"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -28,6 +38,117 @@ type Server struct {
 	config *Configuration
 	server *http.Server
 	status chan error
+
+	admin     *http.Server
+	dns       net.PacketConn
+	dnsPort   int
+	adminMux  http.Handler
+	adminCSRF string
+	routes    routeTrie
+	scenarios []*Scenario
+	stateFile string
+	// configPath is the watched configuration file; configVersion is its version when it was loaded
+	configPath          string
+	configWatchInterval time.Duration
+	configVersion       configFileVersion
+	// watchStopped is closed when the watcher of the configuration file stops
+	watchStopped chan struct{}
+	pauseMode    PauseMode
+	// dualStack is set to accept requests over IPv4 and IPv6; dualStackHost is the additional host the server listens on
+	dualStack     bool
+	dualStackHost string
+	outageMode    OutageMode
+	chaos         *chaosInjector
+	// listener is the listener of the running server
+	listener  *outageListener
+	accessLog *accessLog
+	capture   *captureBuffer
+	// trafficDump is the file that the traffic is written to when the server stops
+	trafficDump string
+
+	upstreamURL string
+	upstream    *httputil.ReverseProxy
+	replayer    *replayer
+
+	allowedClientRanges []string
+	allowedClients      []netip.Prefix
+
+	metadataToken    string
+	metadataUser     string
+	metadataPassword string
+	rateLimiter      *rateLimiter
+	tokenQuota       *quota
+	strictPaths      bool
+	profiles         []*serverProfile
+	profileServers   []*http.Server
+	handlerTimeouts  []handlerTimeout
+	sizeLimits       []sizeLimit
+	bootDelays       []bootDelay
+	// concurrencyLimits are pointers because their slots are shared by all requests
+	concurrencyLimits []*concurrencyLimit
+	middleware        []func(http.Handler) http.Handler
+	bandwidthLimit    int
+	firstByteDelay    time.Duration
+	clock             func() time.Time
+	preflightChecks   []PreflightCheck
+	// onShutdownTimeout is called with the paths of the active requests if the graceful shutdown times out
+	onShutdownTimeout func(pending []string)
+	active            *activeRequests
+
+	// firstConnectionDelay delays the first request from each client address that is not in seenClients
+	firstConnectionDelay time.Duration
+	compressionThreshold *int
+	maxRequestBodySize   *int64
+	maxURLLength         *int
+
+	requestLogLevel slog.Leveler
+	logLevel        slog.Leveler
+	silencedLogs    map[LogComponent]bool
+	redactedPaths   []string
+	requestLogger   *slog.Logger
+	handlerLogger   *slog.Logger
+
+	tracerProvider trace.TracerProvider
+	meterProvider  metric.MeterProvider
+	// issuedTokens counts the issued tokens if the meter provider is set
+	issuedTokens metric.Int64Counter
+
+	// aliases map normalized alias keys to the keys of the metadata; the map is replaced when the configuration is reloaded
+	aliases atomic.Pointer[map[string]string]
+	// redirects map normalized keys to their redirects
+	redirects map[string]Redirect
+
+	mu     sync.RWMutex
+	values map[string]string
+	// startTime and boundAddress are set while the server is running; lastError is the last error of the server;
+	// bootTime is the time of the server's clock that the boot delays are counted from
+	startTime    time.Time
+	boundAddress string
+	bootTime     time.Time
+	lastError    error
+	statuses     map[string]int
+	disabled     map[string]bool
+	history      []RequestRecord
+	// historyNext is the index of the oldest record when the history is full
+	historyNext int
+	stats       map[string]*PathStats
+	tokenStats  TokenStats
+	unmatched   map[string]int
+	seenClients map[string]bool
+	// expectations are declared with Expect; unexpected counts requests that do not match any of them
+	expectations []*Expectation
+	unexpected   map[string]int
+	audit        []AuditRecord
+	// auditNext is the index of the oldest audit record when the audit log is full
+	auditNext int
+	// tokenFailureStatus is the status of the failed token requests; tokenFailures is the number of failures left
+	tokenFailureStatus int
+	tokenFailures      atomic.Int64
+	done               chan struct{}
+	resumed            chan struct{}
+
+	subscriptions []*subscription
+	events        eventListeners
 }
 
 // Option allows to set up an instance of Server at creation time.
@@ -45,6 +166,20 @@ func WithAddress(address string) Option {
 	}
 }
 
+// WithAdminPort sets a new server with a port number at which the admin API accepts requests.
+// The admin API is served at the same IP address as metadata.
+// The admin API is disabled when the port is 0.
+//
+// Mind the order of options when use with [WithConfiguration] and [WithConfigFile].
+func WithAdminPort(port int) Option {
+	return func(s *Server) {
+		if s.config == nil {
+			s.config = NewConfiguration(DefaultConfigurationHandlers)
+		}
+		s.config.AdminPort = port
+	}
+}
+
 // WithConfigFile sets a new server with [Configuration] that is read from JSON file.
 //
 // Mind the order of options when use with [WithConfiguration], [WithAddress], [WithPort] and [WithHandlers].
@@ -61,12 +196,14 @@ func WithConfigFile(path string) Option {
 	}
 }
 
-// WithConfiguration sets a new server with [Configuration].
+// WithConfiguration sets a new server with a copy of [Configuration].
+// The server and the following options do not change c, so it can be used to create several servers.
 //
 // Mind the order of options when use with [WithConfigFile], [WithAddress], [WithPort] and [WithHandlers].
 func WithConfiguration(c *Configuration) Option {
 	return func(s *Server) {
-		s.config = c
+		cc := c.clone()
+		s.config = &cc
 	}
 }
 
@@ -106,6 +243,57 @@ func WithPort(port int) Option {
 	}
 }
 
+// WithFuncHandlers sets a new server with a set of metadata handlers that receive the served request.
+// A handler at the same path as one of [Configuration.Handlers] takes precedence.
+//
+// Mind the order of options when use with [WithConfiguration] and [WithConfigFile].
+func WithFuncHandlers(handlers map[string]MetadataFunc) Option {
+	return func(s *Server) {
+		if s.config == nil {
+			s.config = NewConfiguration(DefaultConfigurationHandlers)
+		}
+		s.config.FuncHandlers = handlers
+	}
+}
+
+// WithResponseHandlers sets a new server with a set of metadata handlers that control the response status and headers.
+//
+// Mind the order of options when use with [WithConfiguration] and [WithConfigFile].
+func WithResponseHandlers(handlers map[string]ResponseFunc) Option {
+	return func(s *Server) {
+		if s.config == nil {
+			s.config = NewConfiguration(DefaultConfigurationHandlers)
+		}
+		s.config.ResponseHandlers = handlers
+	}
+}
+
+// WithBytesHandlers sets a new server with a set of metadata handlers that return binary values with their content type.
+// Use them for payloads like pre-marshaled JSON documents or PKCS#7 blobs that should be served as is.
+//
+// Mind the order of options when use with [WithConfiguration] and [WithConfigFile].
+func WithBytesHandlers(handlers map[string]BytesMetadata) Option {
+	return func(s *Server) {
+		if s.config == nil {
+			s.config = NewConfiguration(DefaultConfigurationHandlers)
+		}
+		s.config.BytesHandlers = handlers
+	}
+}
+
+// WithStreamHandlers sets a new server with a set of streamed metadata handlers.
+// Use them for large values, like user-data or startup scripts, that should not be kept in memory.
+//
+// Mind the order of options when use with [WithConfiguration] and [WithConfigFile].
+func WithStreamHandlers(handlers map[string]StreamMetadata) Option {
+	return func(s *Server) {
+		if s.config == nil {
+			s.config = NewConfiguration(DefaultConfigurationHandlers)
+		}
+		s.config.StreamHandlers = handlers
+	}
+}
+
 // WithLogger sets a new server with an instance of [slog.Logger].
 func WithLogger(l *slog.Logger) Option {
 	return func(s *Server) {
@@ -114,6 +302,7 @@ func WithLogger(l *slog.Logger) Option {
 }
 
 // New creates a new instance of the server.
+// The problems of the configuration are returned as [ConfigError] that matches [ErrConfigInvalid] with [errors.Is].
 func New(opts ...Option) (*Server, error) {
 	s := &Server{}
 	for _, opt := range opts {
@@ -125,35 +314,410 @@ func New(opts ...Option) (*Server, error) {
 	if s.logger == nil {
 		s.logger = slog.New(slog.NewTextHandler(io.Discard, nil))
 	}
+	if s.redactedPaths == nil {
+		s.redactedPaths = DefaultRedactedPaths
+	}
+	s.bootTime = s.now()
+	h := traceLogHandler{s.logger.Handler()}
+	s.logger = s.componentLogger(h, LogLifecycle)
+	s.requestLogger = s.componentLogger(h, LogRequests)
+	s.handlerLogger = s.componentLogger(h, LogHandlers)
 	if s.config.Endpoint[0] != '/' {
 		s.config.Endpoint = "/" + s.config.Endpoint
 	}
-	mux := http.NewServeMux()
-	mux.HandleFunc(s.config.Endpoint, func(w http.ResponseWriter, _ *http.Request) {
-		fmt.Fprint(w, "ok")
-	})
-	for k, v := range s.config.Handlers {
-		urlPath := path.Join(s.config.Endpoint, k)
-		mux.HandleFunc(urlPath, func(w http.ResponseWriter, r *http.Request) {
-			ctx := r.Context()
-			data := v()
-			s.logger.DebugContext(ctx, "metadata handler is called",
-				slog.String("handler", r.URL.Path), slog.String("response", data))
-			fmt.Fprint(w, data)
-		})
+	s.config.Address = normalizeAddress(s.config.Address)
+	if err := checkAddress(s.config.Address); err != nil {
+		return nil, configError(err)
+	}
+	host, dualStackHost, err := s.listenHosts()
+	if err != nil {
+		return nil, configError(err)
+	}
+	s.dualStackHost = dualStackHost
+	if err := s.config.applyProject(); err != nil {
+		return nil, configError(err)
+	}
+	if err := s.config.applyZone(); err != nil {
+		return nil, configError(err)
+	}
+	if err := s.config.applyServiceAccounts(s.now); err != nil {
+		return nil, configError(err)
+	}
+	if err := s.insertRoutes(&s.routes, s.config); err != nil {
+		return nil, configError(err)
+	}
+	profiles, err := s.newProfiles()
+	if err != nil {
+		return nil, configError(err)
+	}
+	s.profiles = profiles
+	aliases, err := newAliases(s.config.Aliases, &s.routes)
+	if err != nil {
+		return nil, configError(err)
+	}
+	s.aliases.Store(&aliases)
+	redirects, err := s.newRedirects()
+	if err != nil {
+		return nil, configError(err)
+	}
+	s.redirects = redirects
+	if len(s.allowedClientRanges) > 0 {
+		prefixes, err := parseAllowedClients(s.allowedClientRanges)
+		if err != nil {
+			return nil, configError(err)
+		}
+		s.allowedClients = prefixes
+	}
+	upstream, err := s.newUpstream()
+	if err != nil {
+		return nil, configError(err)
+	}
+	s.upstream = upstream
+	if err := s.initConcurrencyLimits(); err != nil {
+		return nil, configError(err)
+	}
+	if s.rateLimiter != nil {
+		if err := s.rateLimiter.validate(); err != nil {
+			return nil, configError(err)
+		}
+	}
+	if s.tokenQuota != nil && s.tokenQuota.limit <= 0 {
+		return nil, configError(fmt.Errorf("token quota %d is not positive", s.tokenQuota.limit))
+	}
+	if err := s.checkSizeLimits(); err != nil {
+		return nil, configError(err)
+	}
+	if s.chaos != nil {
+		if err := s.chaos.validate(); err != nil {
+			return nil, configError(err)
+		}
+	}
+	// the middleware of the metadata requests starting from the outermost one
+	middleware := []func(http.Handler) http.Handler{
+		s.trackRequests,
+		s.logAccess,
+		s.logRequests,
+		s.captureTraffic,
+		s.recordRequests,
+		s.limitRequests,
+		s.normalizePaths,
+		s.selectProfile,
+		s.allowClients,
+		s.requireMetadataAuth,
+		s.rateLimit,
+		s.limitTokenRequests,
+		s.failTokenRequests,
+		s.pauseGate,
+		s.delayNewClients,
+		s.throttle,
+		s.addResponseHeaders,
+		s.cacheHeaders,
+		s.serveHead,
+		s.compress,
+		s.replayTraffic,
+		s.recoverPanics,
+		s.applyMiddleware,
+		s.limitHandlerTime,
+		s.limitConcurrency,
+		s.limitResponseSize,
+	}
+	handler, err := s.instrument(chain(http.HandlerFunc(s.routeRequest), middleware...))
+	if err != nil {
+		return nil, err
 	}
 	httpServer := &http.Server{
-		Addr:    net.JoinHostPort(s.config.Address, strconv.Itoa(s.config.Port)),
-		Handler: mux,
+		Addr:    net.JoinHostPort(host, strconv.Itoa(s.config.Port)),
+		Handler: chain(handler, s.healthChecks, propagateTraceID, s.injectChaos),
 	}
 	s.server = httpServer
+	if err := s.loadState(); err != nil {
+		return nil, err
+	}
+	s.adminCSRF = newCSRFToken()
+	s.adminMux = s.requireAdminToken(s.limitRequests(s.adminHandler()))
+	if s.config.AdminPort > 0 {
+		s.admin = &http.Server{
+			Addr:    net.JoinHostPort(s.config.Address, strconv.Itoa(s.config.AdminPort)),
+			Handler: s.adminMux,
+		}
+	}
 	s.logger.DebugContext(context.Background(), "server is created", slog.Any("configuration", s.config))
 	return s, nil
 }
 
-// Configuration returns a copy of the server's configuration
+// insertRoutes adds the routes of the configuration's handlers to the trie.
+// It returns an error if two keys are served at the same path, e.g. "instance/zone" and "/instance/zone/",
+// or if the value of a key hides the metadata under it, e.g. "instance" and "instance/zone".
+// Only the keys of the same map conflict. A handler of a later map replaces the handler at the same path,
+// so the handlers registered with options take precedence over [Configuration.Handlers].
+func (s *Server) insertRoutes(t *routeTrie, c *Configuration) error {
+	conflicts := newRouteConflicts()
+	insert := func(k string, rt *route) {
+		rt.source = c.Source(k)
+		conflicts.insert(t, k, rt)
+	}
+	conflicts.next()
+	for k, v := range c.Handlers {
+		insert(k, newRoute(c, k, v))
+	}
+	conflicts.next()
+	for k, v := range c.FuncHandlers {
+		insert(k, newFuncRoute(k, v))
+	}
+	if err := checkReferenceCycles(c.parsed); err != nil {
+		return err
+	}
+	conflicts.next()
+	for k, pv := range c.parsed {
+		insert(k, newResponseRoute(k, pv.kind.handler(s, pv.value)))
+	}
+	conflicts.next()
+	for k, v := range c.ResponseHandlers {
+		insert(k, newResponseRoute(k, v))
+	}
+	conflicts.next()
+	for k, v := range c.StatefulHandlers {
+		rt := newResponseRoute(k, v)
+		rt.stateful = true
+		insert(k, rt)
+	}
+	conflicts.next()
+	for k, v := range c.BytesHandlers {
+		insert(k, newBytesRoute(k, v))
+	}
+	conflicts.next()
+	for k, v := range c.StreamHandlers {
+		insert(k, newStreamRoute(k, v))
+	}
+	return errors.Join(conflicts.errors(t)...)
+}
+
+// serveMetadata writes the metadata value of the route.
+// The value set with [Server.SetValue] takes precedence over the value returned by the handler.
+// The route's handler can be nil if there is no handler registered for the key.
+func (s *Server) serveMetadata(w http.ResponseWriter, r *http.Request, rt *route) {
+	ctx := r.Context()
+	debug := s.handlerLogger.Enabled(ctx, slog.LevelDebug)
+	if !s.PathEnabled(rt.key) {
+		if debug {
+			s.handlerLogger.DebugContext(ctx, "metadata handler is disabled", slog.String("handler", r.URL.Path))
+		}
+		http.NotFound(w, r)
+		return
+	}
+	if s.booting(rt.key) {
+		if debug {
+			s.handlerLogger.DebugContext(ctx, "metadata is not available yet", slog.String("handler", r.URL.Path))
+		}
+		http.NotFound(w, r)
+		return
+	}
+	if status, ok := s.forcedStatus(rt.key); ok {
+		if debug {
+			s.handlerLogger.DebugContext(ctx, "metadata handler is forced to fail",
+				slog.String("handler", r.URL.Path), slog.Int("status", status))
+		}
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	if r.URL.RawQuery != "" && r.URL.Query().Get("wait_for_change") == "true" {
+		s.waitForChange(r, rt.key, false, func() string { return s.currentETag(r, rt) })
+	}
+	data, ok := s.storedValue(rt.key)
+	if !ok {
+		if rt.stream != nil {
+			s.streamMetadata(w, r, rt)
+			return
+		}
+		if rt.fn != nil {
+			s.callMetadataFunc(w, r, rt)
+			return
+		}
+		if rt.bytes != nil {
+			s.writeBytesMetadata(w, r, rt)
+			return
+		}
+		if rt.response != nil {
+			s.writeResponse(w, r, rt)
+			return
+		}
+		if rt.handler == nil {
+			s.notFound(w, r)
+			return
+		}
+		if rt.static != nil {
+			if debug {
+				s.handlerLogger.DebugContext(ctx, "static metadata is served", slog.String("handler", r.URL.Path))
+			}
+			if writeETag(w, r, rt.static.etag) {
+				return
+			}
+			h := w.Header()
+			h["Content-Type"] = textPlainHeader
+			h["Content-Length"] = rt.static.contentLength
+			w.Write(rt.static.body)
+			return
+		}
+		data = rt.handler()
+	}
+	if debug {
+		s.handlerLogger.DebugContext(ctx, "metadata handler is called",
+			slog.String("handler", r.URL.Path), slog.String("response", s.loggedValue(rt.key, data)))
+	}
+	if writeETag(w, r, rt.etagOf(data)) {
+		return
+	}
+	io.WriteString(w, data)
+}
+
+// callMetadataFunc writes the value that the request-aware handler of the route returns.
+// It responds with 500 if the handler fails.
+func (s *Server) callMetadataFunc(w http.ResponseWriter, r *http.Request, rt *route) {
+	ctx := r.Context()
+	data, err := rt.fn(ctx, r)
+	if err != nil {
+		s.handlerLogger.ErrorContext(ctx, "metadata handler failed",
+			slog.String("handler", r.URL.Path), slog.String("error", err.Error()))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if s.handlerLogger.Enabled(ctx, slog.LevelDebug) {
+		s.handlerLogger.DebugContext(ctx, "metadata handler is called",
+			slog.String("handler", r.URL.Path), slog.String("response", s.loggedValue(rt.key, data)))
+	}
+	if writeETag(w, r, rt.etagOf(data)) {
+		return
+	}
+	io.WriteString(w, data)
+}
+
+// validStatus reports whether the status can be written to the response.
+// [http.ResponseWriter.WriteHeader] panics with the codes outside of 100-999.
+func validStatus(status int) bool {
+	return status >= 100 && status <= 999
+}
+
+// writeResponse writes the response that the handler of the route returns.
+// It responds with 500 if the handler fails or returns a status outside of 100-999.
+func (s *Server) writeResponse(w http.ResponseWriter, r *http.Request, rt *route) {
+	ctx := r.Context()
+	res, err := rt.response.Serve(ctx, r)
+	if err != nil {
+		s.handlerLogger.ErrorContext(ctx, "metadata handler failed",
+			slog.String("handler", r.URL.Path), slog.String("error", err.Error()))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	status := res.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if !validStatus(status) {
+		s.handlerLogger.ErrorContext(ctx, "metadata handler returned invalid status",
+			slog.String("handler", r.URL.Path), slog.Int("status", status))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if s.handlerLogger.Enabled(ctx, slog.LevelDebug) {
+		s.handlerLogger.DebugContext(ctx, "metadata handler is called", slog.String("handler", r.URL.Path),
+			slog.Int("status", status), slog.String("response", s.loggedValue(rt.key, res.Body)))
+	}
+	h := w.Header()
+	for k, v := range res.Headers {
+		h[k] = v
+	}
+	if status == http.StatusOK {
+		tag := res.Headers["Etag"]
+		if len(tag) == 0 {
+			tag = []string{etag(res.Body)}
+		}
+		if writeETag(w, r, tag) {
+			return
+		}
+	}
+	w.WriteHeader(status)
+	io.WriteString(w, res.Body)
+}
+
+// writeBytesMetadata writes the binary value of the route with its content type.
+func (s *Server) writeBytesMetadata(w http.ResponseWriter, r *http.Request, rt *route) {
+	data, contentType := rt.bytes()
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	if writeETag(w, r, []string{etag(data)}) {
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Type", contentType)
+	h.Set("Content-Length", strconv.Itoa(len(data)))
+	s.handlerLogger.DebugContext(r.Context(), "metadata handler is called",
+		slog.String("handler", r.URL.Path), slog.String("contentType", contentType), slog.Int("size", len(data)))
+	w.Write(data)
+}
+
+// streamMetadata copies the streamed metadata value of the route to the response.
+// It responds with 500 if the stream fails before any data is read.
+func (s *Server) streamMetadata(w http.ResponseWriter, r *http.Request, rt *route) {
+	ctx := r.Context()
+	body := rt.stream()
+	if c, ok := body.(io.Closer); ok {
+		defer c.Close()
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	n, err := io.Copy(w, body)
+	if err != nil {
+		s.handlerLogger.ErrorContext(ctx, "error streaming metadata",
+			slog.String("handler", r.URL.Path), slog.String("error", err.Error()))
+		if n == 0 {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+		return
+	}
+	s.handlerLogger.DebugContext(ctx, "metadata is streamed", slog.String("handler", r.URL.Path), slog.Int64("size", n))
+}
+
+// Configuration returns a copy of the server's configuration.
+// The copy is taken under the same lock that guards the routes, so it is consistent
+// when the configuration is reloaded concurrently (see [Server.ReloadConfig]).
+// Changes of the returned maps and slices do not affect the server.
+// Use [Server.Snapshot] to get the configuration together with the runtime changes of the metadata.
 func (s *Server) Configuration() Configuration {
-	return *s.config
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.config.clone()
+}
+
+// ServerSnapshot is the consistent copy of the server's configuration and its runtime changes returned by [Server.Snapshot].
+type ServerSnapshot struct {
+	// Configuration is the copy of the server's configuration like [Server.Configuration] returns.
+	Configuration Configuration
+	// Values are the values set with [Server.SetValue] by their paths.
+	Values map[string]string
+	// Statuses are the statuses set with [Server.SetStatus] by their paths.
+	Statuses map[string]int
+	// Disabled are the sorted paths disabled with [Server.DisablePath].
+	Disabled []string
+}
+
+// Snapshot returns the copy of the server's configuration together with the values, the statuses and the disabled paths
+// that were changed at runtime. The copy is taken under one lock, so it is consistent when the metadata is changed
+// or the configuration is reloaded concurrently. Changes of the returned maps and slices do not affect the server.
+func (s *Server) Snapshot() ServerSnapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snapshot := ServerSnapshot{
+		Configuration: s.config.clone(),
+		Values:        maps.Clone(s.values),
+		Statuses:      maps.Clone(s.statuses),
+	}
+	for k, disabled := range s.disabled {
+		if disabled {
+			snapshot.Disabled = append(snapshot.Disabled, k)
+		}
+	}
+	sort.Strings(snapshot.Disabled)
+	return snapshot
 }
 
 // HttpHandler returns collection of HTTP handlers
@@ -164,44 +728,239 @@ func (s *Server) HttpHandler() http.Handler {
 	return s.server.Handler
 }
 
+// Mount returns a handler that serves metadata under the prefix, e.g. "/metadata".
+// Use it to embed the server into an existing mux:
+//
+//	mux.Handle("/metadata/", s.Mount("/metadata"))
+//
+// The prefix is stripped from the request path before the request is served,
+// so the metadata is available at the prefix followed by the server's endpoint.
+func (s *Server) Mount(prefix string) http.Handler {
+	prefix = strings.TrimSuffix(prefix, "/")
+	h := s.HttpHandler()
+	if prefix == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := strings.TrimPrefix(r.URL.Path, prefix)
+		rp := strings.TrimPrefix(r.URL.RawPath, prefix)
+		if len(p) == len(r.URL.Path) || p != "" && p[0] != '/' {
+			http.NotFound(w, r)
+			return
+		}
+		if p == "" {
+			p = "/"
+		}
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = p
+		if r.URL.RawPath != "" {
+			r2.URL.RawPath = rp
+		}
+		h.ServeHTTP(w, r2)
+	})
+}
+
 // Start launches the server to server configured metadata handlers.
 //
 // It returns ErrServerHasBeenStarted if the server has already been started.
 // Otherwise it return an error if failed to start serving on the configured address.
-func (s *Server) Start(ctx context.Context) error {
+// If the server cannot listen on the address, the error is [BindError]
+// that matches [ErrBindFailed] and [ErrPortInUse] or [ErrPermissionDenied] with [errors.Is].
+// Failed preflight checks match [ErrPreflightFailed] and failed stateful handlers match [ErrHandlerInitFailed].
+func (s *Server) Start(ctx context.Context) (err error) {
 	if s.status != nil {
 		return ErrServerAlreadyStarted
 	}
+	defer func() {
+		if err != nil {
+			s.setLastError(err)
+			s.renewServers()
+		}
+	}()
 	s.logger.DebugContext(ctx, "starting metadata server", slog.Any("configuration", s.config))
-	s.status = make(chan error)
+	if err := s.preflight(ctx); err != nil {
+		return err
+	}
+	if err := s.initHandlers(ctx); err != nil {
+		return err
+	}
+	// undo the started parts of the server if any of the later steps fails
+	defer func() {
+		if err == nil {
+			return
+		}
+		if s.dns != nil {
+			s.dns.Close()
+			s.dns = nil
+		}
+		if s.admin != nil {
+			s.admin.Close()
+		}
+		s.server.Close()
+		if s.status != nil {
+			s.setStopped()
+		}
+		s.closeHandlers(ctx, sortedHandlerPaths(s.statefulHandlers()))
+	}()
+	l, err := listenOutage(s.server.Addr)
+	if err != nil {
+		return err
+	}
+	s.listener = l
+	// the status is buffered so the serving goroutine does not block after Stop
+	status := make(chan error, 1)
+	s.mu.Lock()
+	s.status = status
+	s.done = make(chan struct{})
+	s.mu.Unlock()
+	// the servers are captured because Stop replaces them with new ones
+	srv := s.server
 	go func() {
-		err := s.server.ListenAndServe()
-		s.status <- err
+		err := srv.Serve(l)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.setLastError(err)
+		}
+		status <- err
 		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			s.logger.ErrorContext(ctx, "error listening and serving", slog.String("error", err.Error()))
 		}
 	}()
 	select {
-	case err := <-s.status:
-		s.status = nil
+	case err := <-status:
 		return err
 	case <-time.After(100 * time.Millisecond):
 	}
+	if s.dualStackHost != "" {
+		l2, err := s.listenDualStack(l)
+		if err != nil {
+			return err
+		}
+		go func() {
+			if err := srv.Serve(l2); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				s.logger.ErrorContext(ctx, "error listening and serving", slog.String("address", l2.Addr().String()), slog.String("error", err.Error()))
+			}
+		}()
+	}
+	if s.admin != nil {
+		if err := s.startAdmin(ctx); err != nil {
+			return err
+		}
+	}
+	if s.dnsPort > 0 {
+		if err := s.startDNS(ctx); err != nil {
+			return err
+		}
+	}
+	if err := s.startProfiles(ctx); err != nil {
+		return err
+	}
+	for _, sc := range s.scenarios {
+		go s.runScenario(ctx, sc, s.done)
+	}
+	if s.configPath != "" {
+		s.watchStopped = make(chan struct{})
+		go s.watchConfig(s.done, s.watchStopped)
+	}
+	s.setRunning(l.Addr().String())
+	s.logger.InfoContext(ctx, "metadata server is started", slog.String("address", s.server.Addr),
+		slog.String("endpoint", s.config.Endpoint), slog.Int("routes", len(s.Routes())))
 	return nil
 }
 
+// running returns the channel that is closed when the running server stops or nil if the server is not running.
+func (s *Server) running() <-chan struct{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.status == nil {
+		return nil
+	}
+	return s.done
+}
+
+// setStopped marks the server as not running and closes the channel that stops its background tasks.
+func (s *Server) setStopped() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = nil
+	close(s.done)
+}
+
+func (s *Server) startAdmin(ctx context.Context) error {
+	l, err := net.Listen("tcp", s.admin.Addr)
+	if err != nil {
+		return bindError("tcp", s.admin.Addr, err)
+	}
+	s.logger.DebugContext(ctx, "starting admin API", slog.String("address", s.admin.Addr))
+	admin := s.admin
+	go func() {
+		if err := admin.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.ErrorContext(ctx, "error serving admin API", slog.String("error", err.Error()))
+		}
+	}()
+	return nil
+}
+
+// renewServers replaces the HTTP servers of the metadata and the admin API with new ones at the same addresses,
+// so the stopped server can be started again. A closed [http.Server] cannot be reused.
+func (s *Server) renewServers() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.server = &http.Server{Addr: s.server.Addr, Handler: s.server.Handler}
+	if s.admin != nil {
+		s.admin = &http.Server{Addr: s.admin.Addr, Handler: s.admin.Handler}
+	}
+}
+
 // Stop shuts down the running server.
 //
 // It returns ErrServerIsNotRunning if the server was not started.
 // Otherwise it return an error if failed to stop the running service.
+// The stopped server can be started again with [Server.Start].
 func (s *Server) Stop(ctx context.Context) error {
 	if s.status == nil {
 		return ErrServerIsNotRunning
 	}
 	s.logger.DebugContext(ctx, "stopping metadata server", slog.Any("configuration", s.config))
-	s.status = nil
+	s.setStopped()
+	s.setRunning("")
+	if s.watchStopped != nil {
+		<-s.watchStopped
+		s.watchStopped = nil
+	}
+	s.Resume()
 	shutdownCtx := context.Background()
 	shutdownCtx, cancel := context.WithTimeout(shutdownCtx, time.Duration(s.config.ShutdownTimeout)*time.Second)
 	defer cancel()
-	return s.server.Shutdown(shutdownCtx)
+	if s.admin != nil {
+		if err := s.admin.Shutdown(shutdownCtx); err != nil {
+			s.logger.ErrorContext(ctx, "error stopping admin API", slog.String("error", err.Error()))
+		}
+	}
+	if s.dns != nil {
+		s.dns.Close()
+		s.dns = nil
+	}
+	s.shutdownProfiles(shutdownCtx)
+	err := s.server.Shutdown(shutdownCtx)
+	if err != nil {
+		s.setLastError(err)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		s.shutdownTimedOut(ctx)
+	}
+	s.renewServers()
+	s.logUnmatched(ctx)
+	if err := s.closeHandlers(ctx, sortedHandlerPaths(s.statefulHandlers())); err != nil {
+		s.logger.ErrorContext(ctx, "error closing handlers", slog.String("error", err.Error()))
+	}
+	if err := s.SaveState(); err != nil {
+		s.logger.ErrorContext(ctx, "error saving state", slog.String("file", s.stateFile), slog.String("error", err.Error()))
+	}
+	if err := s.dumpTraffic(); err != nil {
+		s.logger.ErrorContext(ctx, "error writing traffic", slog.String("file", s.trafficDump), slog.String("error", err.Error()))
+	}
+	return err
 }
@@ -2,6 +2,7 @@ package metadataserver_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -176,6 +177,151 @@ func TestHandlers(t *testing.T) {
 	}
 }
 
+func TestFuncHandlers(t *testing.T) {
+	s, err := metadataserver.New(metadataserver.WithFuncHandlers(map[string]metadataserver.MetadataFunc{
+		"instance/service-accounts/default/identity": func(ctx context.Context, r *http.Request) (string, error) {
+			audience := r.URL.Query().Get("audience")
+			if audience == "" {
+				return "", errors.New("missing audience")
+			}
+			return "token-for-" + audience, nil
+		},
+		"instance/hostname": func(ctx context.Context, r *http.Request) (string, error) {
+			return "host-" + r.Header.Get("X-Test"), nil
+		},
+	}))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	tests := []struct {
+		name       string
+		path       string
+		header     string
+		wantStatus int
+		wantBody   string
+	}{
+		{"query", "instance/service-accounts/default/identity?audience=test", "", http.StatusOK, "token-for-test"},
+		{"header", "instance/hostname", "a", http.StatusOK, "host-a"},
+		{"error", "instance/service-accounts/default/identity", "", http.StatusInternalServerError, "Internal Server Error\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/"+test.path, nil)
+			r.Header.Set("X-Test", test.header)
+			rec := httptest.NewRecorder()
+			s.HttpHandler().ServeHTTP(rec, r)
+			if rec.Code != test.wantStatus {
+				t.Errorf("expected status %d, got: %d", test.wantStatus, rec.Code)
+			}
+			if got := rec.Body.String(); got != test.wantBody {
+				t.Errorf("expected body %q, got: %q", test.wantBody, got)
+			}
+		})
+	}
+	if v, ok := s.GetValue("instance/hostname"); !ok || v != "host-" {
+		t.Errorf("expected value %q, got: %q, %t", "host-", v, ok)
+	}
+	if _, ok := s.GetValue("instance/service-accounts/default/identity"); ok {
+		t.Errorf("expected no value for failed handler")
+	}
+	if diff := cmp.Diff([]string{"instance/hostname", "instance/service-accounts/default/identity", "project/project-id"}, s.Paths()); diff != "" {
+		t.Errorf("paths mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestBytesHandlers(t *testing.T) {
+	blob := []byte{0x30, 0x82, 0x00, 0xff}
+	s, err := metadataserver.New(metadataserver.WithBytesHandlers(map[string]metadataserver.BytesMetadata{
+		"instance/identity-document": func() ([]byte, string) { return []byte(`{"id":1}`), "application/json" },
+		"instance/pkcs7":             func() ([]byte, string) { return blob, "" },
+	}))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	tests := []struct {
+		path            string
+		wantContentType string
+		wantBody        []byte
+	}{
+		{"instance/identity-document", "application/json", []byte(`{"id":1}`)},
+		{"instance/pkcs7", "application/octet-stream", blob},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/"+test.path, nil))
+			if rec.Code != http.StatusOK {
+				t.Errorf("expected status %d, got: %d", http.StatusOK, rec.Code)
+			}
+			if got := rec.Header().Get("Content-Type"); got != test.wantContentType {
+				t.Errorf("expected content type %q, got: %q", test.wantContentType, got)
+			}
+			if diff := cmp.Diff(test.wantBody, rec.Body.Bytes()); diff != "" {
+				t.Errorf("body mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+	if v, ok := s.GetValue("instance/pkcs7"); !ok || v != string(blob) {
+		t.Errorf("expected value %q, got: %q", blob, v)
+	}
+}
+
+func TestResponseHandlers(t *testing.T) {
+	calls := 0
+	s, err := metadataserver.New(metadataserver.WithResponseHandlers(map[string]metadataserver.ResponseFunc{
+		"instance/attributes/flapping": func(ctx context.Context, r *http.Request) (metadataserver.Response, error) {
+			calls++
+			if calls%2 == 0 {
+				return metadataserver.Response{Status: http.StatusServiceUnavailable, Body: "unavailable"}, nil
+			}
+			return metadataserver.Response{Headers: http.Header{"X-Call": {fmt.Sprint(calls)}}, Body: "ok"}, nil
+		},
+		"instance/attributes/absent": func(ctx context.Context, r *http.Request) (metadataserver.Response, error) {
+			return metadataserver.Response{Status: http.StatusNotFound}, nil
+		},
+		"instance/attributes/broken": func(ctx context.Context, r *http.Request) (metadataserver.Response, error) {
+			return metadataserver.Response{}, errors.New("broken")
+		},
+		"instance/attributes/invalid": func(ctx context.Context, r *http.Request) (metadataserver.Response, error) {
+			return metadataserver.Response{Status: 42, Body: "invalid"}, nil
+		},
+	}))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantBody   string
+		wantHeader string
+	}{
+		{"instance/attributes/flapping", http.StatusOK, "ok", "1"},
+		{"instance/attributes/flapping", http.StatusServiceUnavailable, "unavailable", ""},
+		{"instance/attributes/absent", http.StatusNotFound, "", ""},
+		{"instance/attributes/broken", http.StatusInternalServerError, "Internal Server Error\n", ""},
+		{"instance/attributes/invalid", http.StatusInternalServerError, "Internal Server Error\n", ""},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/"+test.path, nil))
+		if rec.Code != test.wantStatus {
+			t.Errorf("%s: expected status %d, got: %d", test.path, test.wantStatus, rec.Code)
+		}
+		if got := rec.Body.String(); got != test.wantBody {
+			t.Errorf("%s: expected body %q, got: %q", test.path, test.wantBody, got)
+		}
+		if got := rec.Header().Get("X-Call"); got != test.wantHeader {
+			t.Errorf("%s: expected header %q, got: %q", test.path, test.wantHeader, got)
+		}
+	}
+	if _, ok := s.GetValue("instance/attributes/absent"); ok {
+		t.Errorf("expected no value for path that responds with 404")
+	}
+	if err := s.State().LastError; err != nil {
+		t.Errorf("expected the invalid status not to panic, got: %v", err)
+	}
+}
+
 func TestEndToEnd(t *testing.T) {
 	if testing.Short() {
 		t.Skip()
@@ -230,19 +376,55 @@ func TestStopNotRunningServer(t *testing.T) {
 	}
 }
 
-func startLiveServer(ctx context.Context, ip string) (*metadataserver.Server, error) {
+func freePort() int {
 	var port int
 	dummy := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
 	server := httptest.NewServer(dummy)
 	fmt.Sscanf(server.URL, "http://127.0.0.1:%d", &port)
 	server.Close()
+	return port
+}
 
+func startLiveServer(ctx context.Context, ip string) (*metadataserver.Server, error) {
 	s, err := metadataserver.New(
 		metadataserver.WithAddress(ip),
-		metadataserver.WithPort(port))
+		metadataserver.WithPort(freePort()))
 	if err != nil {
 		return s, err
 	}
 	err = s.Start(ctx)
 	return s, err
 }
+
+func TestMount(t *testing.T) {
+	s, err := metadataserver.New(metadataserver.WithHandlers(map[string]metadataserver.Metadata{
+		"instance/id":   func() string { return "123" },
+		"instance/zone": func() string { return "zone" },
+	}))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metadata/", s.Mount("/metadata/"))
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "app") })
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"/metadata" + metadataserver.DefaultEndpoint + "/instance/id", http.StatusOK, "123"},
+		{"/metadata" + metadataserver.DefaultEndpoint + "/instance/", http.StatusOK, "id\nzone\n"},
+		{"/metadata/other", http.StatusNotFound, "404 page not found\n"},
+		{"/index.html", http.StatusOK, "app"},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, test.path, nil))
+			if rec.Code != test.wantStatus || rec.Body.String() != test.wantBody {
+				t.Errorf("expected %d %q, got: %d %q", test.wantStatus, test.wantBody, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
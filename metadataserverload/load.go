@@ -0,0 +1,275 @@
+// Package metadataserverload drives a configurable mix of requests against a running metadata server
+// and reports latency percentiles and error rates, so performance regressions of the simulator
+// and of the middleware that is added to it are caught, e.g. in a soak test:
+//
+//	ms, _ := metadataserver.New(metadataserver.WithMiddleware(myMiddleware))
+//	ts := httptest.NewServer(ms.HttpHandler())
+//	defer ts.Close()
+//	runner := &metadataserverload.Runner{
+//		Mix: []metadataserverload.Request{
+//			{Path: "project/project-id", Weight: 9},
+//			{Path: "instance/service-accounts/default/token"},
+//		},
+//		Concurrency: 8,
+//		Duration:    time.Minute,
+//	}
+//	report, err := runner.Run(ctx, ts.URL)
+//	if report.P99 > 10*time.Millisecond || report.ErrorRate() > 0 {
+//		t.Errorf("performance regression: %v", report)
+//	}
+package metadataserverload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/minherz/metadataserver"
+)
+
+// DefaultRequests is the number of requests that [Runner] sends if neither the number of requests nor the duration is set.
+const DefaultRequests = 1000
+
+// Request describes one kind of requests in the mix.
+type Request struct {
+	// Method is the method of the request. GET is used if empty.
+	Method string
+	// Path is the metadata path relative to the server's endpoint with an optional query, e.g. "instance/?recursive=true".
+	Path string
+	// Header is added to the request after the runner's header.
+	Header http.Header
+	// Weight is the relative frequency of the request in the mix. Zero means 1.
+	Weight int
+}
+
+// Runner sends the requests of the mix to the metadata server.
+// The requests are sent in a fixed order that follows the weights, so two runs send the same sequence of requests.
+type Runner struct {
+	// Client is used to send requests to the metadata server. [http.DefaultClient] is used if nil.
+	Client *http.Client
+	// Header is added to each request. It defaults to "Metadata-Flavor: Google" if nil.
+	Header http.Header
+	// Endpoint is the path of the metadata endpoint. [metadataserver.DefaultEndpoint] is used if empty.
+	Endpoint string
+	// Mix is the requests to send.
+	Mix []Request
+	// Concurrency is the number of requests that are sent in parallel. Zero means 1.
+	Concurrency int
+	// Requests is the number of requests to send.
+	Requests int
+	// Duration is the time to send requests for. If both the duration and the number of requests are set,
+	// the run stops at whichever limit is reached first. If neither is set, [DefaultRequests] are sent.
+	Duration time.Duration
+}
+
+// Stats describes the latency and errors of the requests.
+// A request is an error if it fails or is responded with status 400 or higher.
+type Stats struct {
+	Requests int
+	Errors   int
+	P50      time.Duration
+	P90      time.Duration
+	P99      time.Duration
+	Max      time.Duration
+}
+
+// ErrorRate returns the share of the failed requests in the range [0, 1].
+func (s Stats) ErrorRate() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(s.Requests)
+}
+
+// Report describes the result of the run.
+type Report struct {
+	Stats
+	// Duration is the time that the run took.
+	Duration time.Duration
+	// Paths keeps the stats of each path of the mix.
+	Paths map[string]Stats
+}
+
+// Throughput returns the number of requests per second.
+func (r Report) Throughput() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Requests) / r.Duration.Seconds()
+}
+
+// String describes the report in one line per path after the total, e.g.
+// "1000 requests in 1.2s (833.3/s), 0.00% errors, p50 1ms, p90 2ms, p99 5ms, max 9ms".
+func (r Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d requests in %s (%.1f/s), %s", r.Requests, r.Duration.Round(time.Millisecond), r.Throughput(), r.Stats.summary())
+	paths := make([]string, 0, len(r.Paths))
+	for p := range r.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		s := r.Paths[p]
+		fmt.Fprintf(&b, "\n  %s: %d requests, %s", p, s.Requests, s.summary())
+	}
+	return b.String()
+}
+
+func (s Stats) summary() string {
+	return fmt.Sprintf("%.2f%% errors, p50 %s, p90 %s, p99 %s, max %s", 100*s.ErrorRate(), s.P50, s.P90, s.P99, s.Max)
+}
+
+// sample is the result of one request.
+type sample struct {
+	request int
+	latency time.Duration
+	failed  bool
+}
+
+// Run sends the requests of the mix to the server at the base URL, e.g. "http://127.0.0.1:8080",
+// until the number of requests is sent, the duration expires or the context is canceled.
+// It returns an error if the mix is empty or if the context is canceled before any request is sent.
+func (lr *Runner) Run(ctx context.Context, baseURL string) (Report, error) {
+	if len(lr.Mix) == 0 {
+		return Report{}, errors.New("mix of requests is empty")
+	}
+	client := lr.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	endpoint := lr.Endpoint
+	if endpoint == "" {
+		endpoint = metadataserver.DefaultEndpoint
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/") + "/" + strings.Trim(endpoint, "/") + "/"
+	// schedule lists the indexes of the mix's requests according to their weights
+	var schedule []int
+	for i, r := range lr.Mix {
+		for range max(r.Weight, 1) {
+			schedule = append(schedule, i)
+		}
+	}
+	total := lr.Requests
+	if total <= 0 && lr.Duration <= 0 {
+		total = DefaultRequests
+	}
+	if lr.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, lr.Duration)
+		defer cancel()
+	}
+
+	var next atomic.Int64
+	var mu sync.Mutex
+	var samples []sample
+	var wg sync.WaitGroup
+	start := time.Now()
+	for range max(lr.Concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var local []sample
+			for ctx.Err() == nil {
+				n := int(next.Add(1)) - 1
+				if total > 0 && n >= total {
+					break
+				}
+				i := schedule[n%len(schedule)]
+				latency, err := lr.send(ctx, client, baseURL, lr.Mix[i])
+				if err != nil && ctx.Err() != nil {
+					// the request is interrupted by the end of the run
+					break
+				}
+				local = append(local, sample{request: i, latency: latency, failed: err != nil})
+			}
+			mu.Lock()
+			samples = append(samples, local...)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	report := Report{Duration: time.Since(start), Paths: make(map[string]Stats)}
+	if len(samples) == 0 {
+		if err := ctx.Err(); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+			return report, err
+		}
+	}
+	report.Stats = newStats(samples)
+	byPath := make(map[string][]sample)
+	for _, s := range samples {
+		p := lr.Mix[s.request].Path
+		byPath[p] = append(byPath[p], s)
+	}
+	for p, list := range byPath {
+		report.Paths[p] = newStats(list)
+	}
+	return report, nil
+}
+
+// send sends the request and returns its latency. The request fails if it is responded with status 400 or higher.
+func (lr *Runner) send(ctx context.Context, client *http.Client, baseURL string, r Request) (time.Duration, error) {
+	method := r.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequestWithContext(ctx, method, baseURL+strings.TrimPrefix(r.Path, "/"), nil)
+	if err != nil {
+		return 0, err
+	}
+	if lr.Header == nil {
+		req.Header.Set("Metadata-Flavor", "Google")
+	} else {
+		req.Header = lr.Header.Clone()
+	}
+	for k, v := range r.Header {
+		req.Header[k] = v
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return time.Since(start), err
+	}
+	_, err = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	latency := time.Since(start)
+	if err != nil {
+		return latency, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return latency, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return latency, nil
+}
+
+// newStats returns the stats of the samples with the nearest-rank percentiles of their latencies.
+func newStats(samples []sample) Stats {
+	s := Stats{Requests: len(samples)}
+	if len(samples) == 0 {
+		return s
+	}
+	latencies := make([]time.Duration, len(samples))
+	for i, sm := range samples {
+		latencies[i] = sm.latency
+		if sm.failed {
+			s.Errors++
+		}
+	}
+	slices.Sort(latencies)
+	percentile := func(p int) time.Duration {
+		rank := (p*len(latencies) + 99) / 100
+		return latencies[max(rank, 1)-1]
+	}
+	s.P50 = percentile(50)
+	s.P90 = percentile(90)
+	s.P99 = percentile(99)
+	s.Max = latencies[len(latencies)-1]
+	return s
+}
@@ -0,0 +1,117 @@
+package metadataserverload_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minherz/metadataserver"
+	"github.com/minherz/metadataserver/metadataserverload"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	s, err := metadataserver.New(metadataserver.WithHandlers(map[string]metadataserver.Metadata{
+		"project/project-id": func() string { return "test-project-id" },
+		"instance/zone":      func() string { return "projects/123/zones/europe-west1-b" },
+	}))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	ts := httptest.NewServer(s.HttpHandler())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestRun(t *testing.T) {
+	ts := newTestServer(t)
+	runner := &metadataserverload.Runner{
+		Mix: []metadataserverload.Request{
+			{Path: "project/project-id", Weight: 3},
+			{Path: "instance/zone"},
+			{Path: "instance/missing"},
+		},
+		Concurrency: 4,
+		Requests:    100,
+	}
+	report, err := runner.Run(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if report.Requests != 100 || report.Errors != 20 {
+		t.Errorf("expected 100 requests with 20 errors, got: %d requests with %d errors", report.Requests, report.Errors)
+	}
+	want := map[string][2]int{
+		"project/project-id": {60, 0},
+		"instance/zone":      {20, 0},
+		"instance/missing":   {20, 20},
+	}
+	for p, w := range want {
+		if got := report.Paths[p]; got.Requests != w[0] || got.Errors != w[1] {
+			t.Errorf("%s: expected %d requests with %d errors, got: %+v", p, w[0], w[1], got)
+		}
+	}
+	if got := report.ErrorRate(); got != 0.2 {
+		t.Errorf("expected error rate 0.2, got: %v", got)
+	}
+	if report.P50 <= 0 || report.P50 > report.P90 || report.P90 > report.P99 || report.P99 > report.Max {
+		t.Errorf("expected ordered percentiles, got: %+v", report.Stats)
+	}
+	if !strings.HasPrefix(report.String(), "100 requests in ") {
+		t.Errorf("unexpected report: %s", report)
+	}
+}
+
+func TestRunDuration(t *testing.T) {
+	ts := newTestServer(t)
+	runner := &metadataserverload.Runner{
+		Mix:      []metadataserverload.Request{{Path: "project/project-id"}},
+		Duration: 100 * time.Millisecond,
+	}
+	report, err := runner.Run(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if report.Requests == 0 || report.Errors != 0 {
+		t.Errorf("expected requests without errors, got: %+v", report.Stats)
+	}
+	if report.Duration < 100*time.Millisecond {
+		t.Errorf("expected the run to take the duration, got: %v", report.Duration)
+	}
+}
+
+func TestRunHeaders(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" || r.Header.Get("X-Request") != "token" || r.Method != http.MethodPost {
+			http.Error(w, "bad request", http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+	runner := &metadataserverload.Runner{
+		Mix:      []metadataserverload.Request{{Method: http.MethodPost, Path: "token", Header: http.Header{"X-Request": {"token"}}}},
+		Requests: 10,
+	}
+	report, err := runner.Run(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if report.Requests != 10 || report.Errors != 0 {
+		t.Errorf("expected requests with the headers, got: %+v", report.Stats)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	runner := &metadataserverload.Runner{}
+	if _, err := runner.Run(context.Background(), "http://127.0.0.1"); err == nil {
+		t.Errorf("expected error for empty mix, got nil")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	runner.Mix = []metadataserverload.Request{{Path: "project/project-id"}}
+	if _, err := runner.Run(ctx, "http://127.0.0.1"); err == nil {
+		t.Errorf("expected error for canceled context, got nil")
+	}
+}
@@ -0,0 +1,69 @@
+package metadataserver
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// WithMiddleware sets a new server with the middleware that wraps serving of the metadata requests.
+// The middleware is applied inside the server's own middleware, e.g. after access control, rate limiting and pausing,
+// so it observes only the requests that reach the metadata handlers.
+// The first middleware is the outermost one. Calling the option more than once appends the middleware.
+func WithMiddleware(mw ...func(http.Handler) http.Handler) Option {
+	return func(s *Server) {
+		s.middleware = append(s.middleware, mw...)
+	}
+}
+
+// applyMiddleware wraps the handler with the middleware set with [WithMiddleware].
+func (s *Server) applyMiddleware(next http.Handler) http.Handler {
+	return chain(next, s.middleware...)
+}
+
+// chain wraps the handler with the middleware, so the first middleware is the outermost one.
+func chain(h http.Handler, middleware ...func(http.Handler) http.Handler) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// responseBuffer buffers the response until the request is served, so the middleware can replace or alter it.
+type responseBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseBuffer() *responseBuffer {
+	return &responseBuffer{header: make(http.Header)}
+}
+
+func (rb *responseBuffer) Header() http.Header {
+	return rb.header
+}
+
+func (rb *responseBuffer) Write(b []byte) (int, error) {
+	if rb.status == 0 {
+		rb.status = http.StatusOK
+	}
+	return rb.body.Write(b)
+}
+
+func (rb *responseBuffer) WriteHeader(status int) {
+	if rb.status == 0 {
+		rb.status = status
+	}
+}
+
+func (rb *responseBuffer) copyTo(w http.ResponseWriter) {
+	h := w.Header()
+	for k, v := range rb.header {
+		h[k] = v
+	}
+	if rb.status == 0 {
+		rb.status = http.StatusOK
+	}
+	w.WriteHeader(rb.status)
+	w.Write(rb.body.Bytes())
+}
@@ -0,0 +1,67 @@
+package metadataserver_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/minherz/metadataserver"
+)
+
+func TestMiddleware(t *testing.T) {
+	var calls []string
+	trace := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				w.Header().Set("X-"+name, "true")
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	reject := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Reject") != "" {
+				http.Error(w, "rejected", http.StatusTeapot)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	s, err := metadataserver.New(
+		metadataserver.WithMiddleware(trace("First"), trace("Second")),
+		metadataserver.WithMiddleware(reject),
+		metadataserver.WithMetadataToken("secret"))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		header     http.Header
+		wantStatus int
+		wantCalls  []string
+	}{
+		{"served", http.Header{"Authorization": {"Bearer secret"}}, http.StatusOK, []string{"First", "Second"}},
+		{"rejected by middleware", http.Header{"Authorization": {"Bearer secret"}, "X-Reject": {"1"}}, http.StatusTeapot, []string{"First", "Second"}},
+		{"rejected by server", nil, http.StatusUnauthorized, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			calls = nil
+			r := httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/project/project-id", nil)
+			for k, v := range test.header {
+				r.Header[k] = v
+			}
+			rec := httptest.NewRecorder()
+			s.HttpHandler().ServeHTTP(rec, r)
+			if rec.Code != test.wantStatus {
+				t.Errorf("expected status %d, got: %d", test.wantStatus, rec.Code)
+			}
+			if diff := cmp.Diff(test.wantCalls, calls); diff != "" {
+				t.Errorf("middleware calls mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
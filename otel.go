@@ -0,0 +1,77 @@
+package metadataserver
+
+import (
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies the package in the emitted telemetry.
+const instrumentationName = "github.com/minherz/metadataserver"
+
+// WithOTel sets a new server with OpenTelemetry providers that are used to trace and measure served requests.
+// The server continues the trace that is propagated in the request using W3C Trace Context headers.
+// Either provider can be nil.
+func WithOTel(tp trace.TracerProvider, mp metric.MeterProvider) Option {
+	return func(s *Server) {
+		s.tracerProvider = tp
+		s.meterProvider = mp
+	}
+}
+
+func (s *Server) instrument(next http.Handler) (http.Handler, error) {
+	if s.tracerProvider == nil && s.meterProvider == nil {
+		return next, nil
+	}
+	var tracer trace.Tracer
+	if s.tracerProvider != nil {
+		tracer = s.tracerProvider.Tracer(instrumentationName)
+	}
+	var duration metric.Float64Histogram
+	if s.meterProvider != nil {
+		var err error
+		duration, err = s.meterProvider.Meter(instrumentationName).Float64Histogram("http.server.request.duration",
+			metric.WithUnit("s"), metric.WithDescription("Duration of HTTP server requests."))
+		if err != nil {
+			return nil, err
+		}
+		s.issuedTokens, err = s.meterProvider.Meter(instrumentationName).Int64Counter("metadataserver.tokens.issued",
+			metric.WithUnit("{token}"), metric.WithDescription("Number of issued access and identity tokens."))
+		if err != nil {
+			return nil, err
+		}
+	}
+	propagator := propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		attrs := []attribute.KeyValue{
+			attribute.String("http.request.method", r.Method),
+			attribute.String("url.path", r.URL.Path),
+		}
+		var span trace.Span
+		if tracer != nil {
+			ctx, span = tracer.Start(ctx, r.Method+" "+r.URL.Path,
+				trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+			defer span.End()
+		}
+		rw := newStatusRecorder(w)
+		defer rw.release()
+		next.ServeHTTP(rw, r.WithContext(ctx))
+		attrs = append(attrs, attribute.Int("http.response.status_code", rw.status))
+		if span != nil {
+			span.SetAttributes(attrs[len(attrs)-1])
+			if rw.status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(rw.status))
+			}
+		}
+		if duration != nil {
+			duration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attrs...))
+		}
+	}), nil
+}
@@ -0,0 +1,3 @@
+// Package oteltest tests the OpenTelemetry instrumentation of the metadata server with the OpenTelemetry SDK.
+// The tests are kept in the separate module, so the metadataserver module depends only on the OpenTelemetry API.
+package oteltest
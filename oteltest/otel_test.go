@@ -0,0 +1,70 @@
+package oteltest_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestOTel(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	s, err := metadataserver.New(metadataserver.WithOTel(tp, mp))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	ts := httptest.NewServer(s.HttpHandler())
+	defer ts.Close()
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+metadataserver.DefaultEndpoint+"/project/project-id", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	res.Body.Close()
+
+	ended := spans.Ended()
+	if len(ended) != 1 {
+		t.Fatalf("expected 1 span, got: %d", len(ended))
+	}
+	if got := ended[0].SpanContext().TraceID().String(); got != traceID {
+		t.Errorf("expected trace ID %q, got: %q", traceID, got)
+	}
+	if !hasAttribute(ended[0].Attributes(), attribute.Int("http.response.status_code", http.StatusOK)) {
+		t.Errorf("expected status code attribute, got: %v", ended[0].Attributes())
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if len(rm.ScopeMetrics) != 1 || len(rm.ScopeMetrics[0].Metrics) != 1 {
+		t.Fatalf("expected 1 metric, got: %+v", rm.ScopeMetrics)
+	}
+	if got := rm.ScopeMetrics[0].Metrics[0].Name; got != "http.server.request.duration" {
+		t.Errorf("expected metric %q, got: %q", "http.server.request.duration", got)
+	}
+}
+
+func hasAttribute(attrs []attribute.KeyValue, want attribute.KeyValue) bool {
+	for _, a := range attrs {
+		if a == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package oteltest_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestTokenMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	s, err := metadataserver.New(
+		metadataserver.WithConfigFile("../test/fixtures/config_template.json"),
+		metadataserver.WithServiceAccounts(metadataserver.ServiceAccount{
+			Email:  "app@test-project-id.iam.gserviceaccount.com",
+			Scopes: []string{"https://www.googleapis.com/auth/cloud-platform"},
+		}),
+		metadataserver.WithOTel(nil, mp),
+	)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	ts := httptest.NewServer(s.HttpHandler())
+	defer ts.Close()
+
+	paths := []string{
+		"instance/service-accounts/default/token",
+		"instance/service-accounts/default/token",
+		"instance/service-accounts/default/identity?audience=https://api.example.com",
+		// rejected requests do not issue tokens
+		"instance/service-accounts/default/token?scopes=https://www.googleapis.com/auth/devstorage.read_only",
+	}
+	for _, p := range paths {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+metadataserver.DefaultEndpoint+"/"+p, nil)
+		req.Header.Set("Metadata-Flavor", "Google")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("expected no errors, got: %v", err)
+		}
+		res.Body.Close()
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	var issued int64
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		if m.Name != "metadataserver.tokens.issued" {
+			continue
+		}
+		for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+			issued += dp.Value
+			if _, ok := dp.Attributes.Value("audience"); ok {
+				t.Errorf("expected no audience attribute, got: %v", dp.Attributes)
+			}
+		}
+	}
+	if issued != 3 {
+		t.Errorf("expected 3 issued tokens in metrics, got: %d", issued)
+	}
+}
@@ -0,0 +1,180 @@
+package metadataserver
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+// OutageMode defines how the server is unreachable during the scheduled outages.
+type OutageMode int
+
+const (
+	// OutagePause pauses the server during the outage. See [Server.Pause] and [WithPauseMode].
+	OutagePause OutageMode = iota
+	// OutageRefuse closes the server's listener during the outage so new connections are refused.
+	OutageRefuse
+)
+
+// auditSourceOutage is the source of the pause and resume audit records of the scheduled outages.
+const auditSourceOutage = "outage"
+
+// WithOutageMode sets a new server with the mode defining how the server is unreachable during the scheduled outages.
+// The default mode is [OutagePause].
+func WithOutageMode(mode OutageMode) Option {
+	return func(s *Server) {
+		s.outageMode = mode
+	}
+}
+
+// ScheduleOutage makes the running server unreachable for the duration starting at the start time
+// of the server's clock (see [WithClock]).
+// See [WithOutageMode] for the server behavior during the outage.
+// The outage is canceled if the server is stopped.
+//
+// It returns ErrServerIsNotRunning if the server was not started.
+func (s *Server) ScheduleOutage(start time.Time, d time.Duration) error {
+	done := s.running()
+	if done == nil {
+		return ErrServerIsNotRunning
+	}
+	if d <= 0 {
+		return fmt.Errorf("outage duration %s is not positive", d)
+	}
+	go s.runOutage(start, d, done)
+	return nil
+}
+
+func (s *Server) runOutage(start time.Time, d time.Duration, done <-chan struct{}) {
+	ctx := context.Background()
+	timer := time.NewTimer(start.Sub(s.now()))
+	defer timer.Stop()
+	select {
+	case <-done:
+		return
+	case <-timer.C:
+	}
+	if s.outageMode == OutageRefuse {
+		s.listener.down()
+	} else {
+		s.pause(auditSourceOutage)
+	}
+	s.logger.InfoContext(ctx, "outage is started", slog.Duration("duration", d))
+	timer.Reset(d)
+	select {
+	case <-done:
+		return
+	case <-timer.C:
+	}
+	if s.outageMode == OutageRefuse {
+		if err := s.listener.up(); err != nil {
+			s.logger.ErrorContext(ctx, "failed to end outage", slog.String("error", err.Error()))
+			return
+		}
+	} else {
+		s.resume(auditSourceOutage)
+	}
+	s.logger.InfoContext(ctx, "outage is ended")
+}
+
+// listenOutage listens at the address with the listener that can be closed during the outages.
+func listenOutage(addr string) (*outageListener, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, bindError("tcp", addr, err)
+	}
+	return &outageListener{l: l, closed: make(chan struct{})}, nil
+}
+
+// outageListener is a listener that can be closed for an outage and reopened at the same address.
+type outageListener struct {
+	mu sync.Mutex
+	l  net.Listener
+	// resumed is not nil during the outage and is closed when the outage ends
+	resumed   chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (ol *outageListener) Accept() (net.Conn, error) {
+	for {
+		ol.mu.Lock()
+		l, resumed := ol.l, ol.resumed
+		ol.mu.Unlock()
+		if resumed != nil {
+			select {
+			case <-resumed:
+				continue
+			case <-ol.closed:
+				return nil, net.ErrClosed
+			}
+		}
+		c, err := l.Accept()
+		if err == nil {
+			return c, nil
+		}
+		select {
+		case <-ol.closed:
+			return nil, err
+		default:
+		}
+		ol.mu.Lock()
+		reopened := ol.l != l || ol.resumed != nil
+		ol.mu.Unlock()
+		if !reopened {
+			return nil, err
+		}
+	}
+}
+
+// down closes the listener until up is called.
+func (ol *outageListener) down() {
+	ol.mu.Lock()
+	defer ol.mu.Unlock()
+	if ol.resumed != nil {
+		return
+	}
+	ol.resumed = make(chan struct{})
+	ol.l.Close()
+}
+
+// up reopens the listener at the same address.
+func (ol *outageListener) up() error {
+	ol.mu.Lock()
+	defer ol.mu.Unlock()
+	if ol.resumed == nil {
+		return nil
+	}
+	select {
+	case <-ol.closed:
+		return net.ErrClosed
+	default:
+	}
+	l, err := net.Listen("tcp", ol.l.Addr().String())
+	if err != nil {
+		return bindError("tcp", ol.l.Addr().String(), err)
+	}
+	ol.l = l
+	close(ol.resumed)
+	ol.resumed = nil
+	return nil
+}
+
+func (ol *outageListener) Close() error {
+	ol.closeOnce.Do(func() { close(ol.closed) })
+	ol.mu.Lock()
+	defer ol.mu.Unlock()
+	if ol.resumed != nil {
+		return nil
+	}
+	return ol.l.Close()
+}
+
+func (ol *outageListener) Addr() net.Addr {
+	ol.mu.Lock()
+	defer ol.mu.Unlock()
+	return ol.l.Addr()
+}
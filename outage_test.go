@@ -0,0 +1,115 @@
+package metadataserver_test
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/minherz/metadataserver"
+)
+
+// outageLog signals the start and the end of the outages that the server logs.
+type outageLog struct {
+	started, ended chan struct{}
+}
+
+func newOutageLog() *outageLog {
+	return &outageLog{started: make(chan struct{}, 1), ended: make(chan struct{}, 1)}
+}
+
+func (l *outageLog) Enabled(context.Context, slog.Level) bool { return true }
+
+func (l *outageLog) WithAttrs([]slog.Attr) slog.Handler { return l }
+
+func (l *outageLog) WithGroup(string) slog.Handler { return l }
+
+func (l *outageLog) Handle(_ context.Context, r slog.Record) error {
+	switch r.Message {
+	case "outage is started":
+		l.started <- struct{}{}
+	case "outage is ended":
+		l.ended <- struct{}{}
+	}
+	return nil
+}
+
+func TestScheduleOutage(t *testing.T) {
+	tests := []struct {
+		name string
+		mode metadataserver.OutageMode
+		// status is the response status during the outage or 0 if the connection is expected to fail
+		status int
+	}{
+		{"pause", metadataserver.OutagePause, http.StatusServiceUnavailable},
+		{"refuse", metadataserver.OutageRefuse, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			port := freePort()
+			now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+			log := newOutageLog()
+			s, err := metadataserver.New(
+				metadataserver.WithAddress("127.0.0.1"),
+				metadataserver.WithPort(port),
+				metadataserver.WithClock(func() time.Time { return now }),
+				metadataserver.WithLogger(slog.New(log)),
+				metadataserver.WithOutageMode(test.mode))
+			if err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			if err := s.ScheduleOutage(now, time.Second); err != metadataserver.ErrServerIsNotRunning {
+				t.Errorf("expected error: %v, got: %v", metadataserver.ErrServerIsNotRunning, err)
+			}
+			if err := s.Start(ctx); err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			defer s.Stop(ctx)
+			client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+			get := func() int {
+				req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d%s/project/project-id", port, metadataserver.DefaultEndpoint), nil)
+				req.Header.Set("Metadata-Flavor", "Google")
+				resp, err := client.Do(req)
+				if err != nil {
+					return 0
+				}
+				resp.Body.Close()
+				return resp.StatusCode
+			}
+			// the outage is far in the future of the server's clock
+			if err := s.ScheduleOutage(now.Add(time.Hour), time.Second); err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			if got := get(); got != http.StatusOK {
+				t.Errorf("before outage: expected status %d, got: %d", http.StatusOK, got)
+			}
+
+			// the outage started at the server's current time is ended by the test
+			if err := s.ScheduleOutage(now, time.Hour); err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			<-log.started
+			if got := get(); got != test.status {
+				t.Errorf("during outage: expected status %d, got: %d", test.status, got)
+			}
+			if err := s.Stop(ctx); err != nil {
+				t.Errorf("expected no errors stopping during outage, got: %v", err)
+			}
+
+			if err := s.Start(ctx); err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			if err := s.ScheduleOutage(now, time.Millisecond); err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			<-log.started
+			<-log.ended
+			if got := get(); got != http.StatusOK {
+				t.Errorf("after outage: expected status %d, got: %d", http.StatusOK, got)
+			}
+		})
+	}
+}
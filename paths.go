@@ -0,0 +1,69 @@
+package metadataserver
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// WithStrictPaths sets a new server to reject requests with abnormal paths with 400 (Bad Request).
+// A path is abnormal if it has duplicate slashes, "." or ".." segments or URL-encoded slashes or backslashes.
+// By default such paths are normalized before matching the metadata.
+func WithStrictPaths() Option {
+	return func(s *Server) {
+		s.strictPaths = true
+	}
+}
+
+// cleanPath returns the path without duplicate slashes and "." and ".." segments.
+// Unlike [path.Clean] it keeps the trailing slash that marks directory requests.
+// It does not allocate if the path is already clean.
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	cleaned := path.Clean(p)
+	if p[len(p)-1] == '/' && cleaned != "/" {
+		if len(p) == len(cleaned)+1 && p[:len(cleaned)] == cleaned {
+			return p
+		}
+		return cleaned + "/"
+	}
+	return cleaned
+}
+
+// hasEncodedSeparator reports whether the escaped path contains encoded slashes or backslashes.
+func hasEncodedSeparator(u *url.URL) bool {
+	if u.RawPath == "" {
+		return false
+	}
+	raw := strings.ToLower(u.RawPath)
+	return strings.Contains(raw, "%2f") || strings.Contains(raw, "%5c")
+}
+
+// normalizePaths serves requests with the normalized path so that sloppy paths match the same metadata
+// in all middleware and handlers. With [WithStrictPaths] it rejects requests with abnormal paths instead.
+func (s *Server) normalizePaths(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// backslashes are treated as separators
+		cleaned := cleanPath(strings.ReplaceAll(r.URL.Path, `\`, "/"))
+		if cleaned == r.URL.Path && !hasEncodedSeparator(r.URL) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if s.strictPaths {
+			s.handlerLogger.DebugContext(r.Context(), "request with abnormal path is rejected", slog.String("path", r.URL.Path))
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = cleaned
+		r2.URL.RawPath = ""
+		next.ServeHTTP(w, r2)
+	})
+}
@@ -0,0 +1,69 @@
+package metadataserver_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestPathNormalization(t *testing.T) {
+	handlers := map[string]metadataserver.Metadata{
+		"instance/zone": func() string { return "us-central1-a" },
+	}
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantStrict int
+	}{
+		{"clean", "/computeMetadata/v1/instance/zone", http.StatusOK, http.StatusOK},
+		{"directory", "/computeMetadata/v1/instance/", http.StatusOK, http.StatusOK},
+		{"duplicate slashes", "/computeMetadata/v1//instance///zone", http.StatusOK, http.StatusBadRequest},
+		{"dot segment", "/computeMetadata/v1/instance/./zone", http.StatusOK, http.StatusBadRequest},
+		{"dot dot segment", "/computeMetadata/v1/project/../instance/zone", http.StatusOK, http.StatusBadRequest},
+		{"encoded slash", "/computeMetadata/v1/instance%2Fzone", http.StatusOK, http.StatusBadRequest},
+		{"encoded backslash", "/computeMetadata/v1/instance%5Czone", http.StatusOK, http.StatusBadRequest},
+		{"traversal outside endpoint", "/computeMetadata/v1/../../instance/zone", http.StatusNotFound, http.StatusBadRequest},
+	}
+	for _, strict := range []bool{false, true} {
+		opts := []metadataserver.Option{metadataserver.WithHandlers(handlers)}
+		if strict {
+			opts = append(opts, metadataserver.WithStrictPaths())
+		}
+		s, err := metadataserver.New(opts...)
+		if err != nil {
+			t.Fatalf("expected no errors, got: %v", err)
+		}
+		for _, test := range tests {
+			want := test.wantStatus
+			if strict {
+				want = test.wantStrict
+			}
+			rec := httptest.NewRecorder()
+			s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, test.path, nil))
+			if rec.Code != want {
+				t.Errorf("%s (strict %t): expected status %d, got: %d", test.name, strict, want, rec.Code)
+			}
+		}
+	}
+}
+
+func TestPathNormalizationAppliesToQuota(t *testing.T) {
+	s, err := metadataserver.New(
+		metadataserver.WithHandlers(map[string]metadataserver.Metadata{
+			"instance/service-accounts/default/token": func() string { return "token" },
+		}),
+		metadataserver.WithTokenQuota(1))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	for i, p := range []string{"instance/service-accounts/default/token", "instance/service-accounts//default/./token"} {
+		rec := httptest.NewRecorder()
+		s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/"+p, nil))
+		if i == 1 && rec.Code != http.StatusTooManyRequests {
+			t.Errorf("expected status %d for sloppy path, got: %d", http.StatusTooManyRequests, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package metadataserver
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+// PauseMode defines how the paused server responds to requests.
+type PauseMode int
+
+const (
+	// PauseUnavailable makes the paused server to respond with 503 (Service Unavailable).
+	PauseUnavailable PauseMode = iota
+	// PauseHang makes the paused server to hold requests until the server is resumed or the request is canceled.
+	PauseHang
+)
+
+// WithPauseMode sets a new server with the mode defining how the server responds when it is paused.
+// The default mode is [PauseUnavailable].
+func WithPauseMode(mode PauseMode) Option {
+	return func(s *Server) {
+		s.pauseMode = mode
+	}
+}
+
+// Pause makes the server to stop serving metadata while keeping the listener open.
+// See [WithPauseMode] for the server behavior while it is paused.
+func (s *Server) Pause() {
+	s.pause(AuditSourceAPI)
+}
+
+func (s *Server) pause(source string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.resumed == nil {
+		s.resumed = make(chan struct{})
+		s.auditLocked(source, ActionPause, "", "", "")
+	}
+}
+
+// Resume restores serving metadata after the server was paused.
+func (s *Server) Resume() {
+	s.resume(AuditSourceAPI)
+}
+
+func (s *Server) resume(source string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.resumed != nil {
+		close(s.resumed)
+		s.resumed = nil
+		s.auditLocked(source, ActionResume, "", "", "")
+	}
+}
+
+// Paused reports whether the server is paused.
+func (s *Server) Paused() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.resumed != nil
+}
+
+func (s *Server) pauseGate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.RLock()
+		resumed := s.resumed
+		s.mu.RUnlock()
+		if resumed == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if s.pauseMode == PauseUnavailable {
+			s.handlerLogger.DebugContext(r.Context(), "request is rejected by paused server", slog.String("path", r.URL.Path))
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+		s.handlerLogger.DebugContext(r.Context(), "request is held by paused server", slog.String("path", r.URL.Path))
+		select {
+		case <-resumed:
+			next.ServeHTTP(w, r)
+		case <-r.Context().Done():
+		}
+	})
+}
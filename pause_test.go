@@ -0,0 +1,69 @@
+package metadataserver_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestPauseUnavailable(t *testing.T) {
+	s, err := metadataserver.New()
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	ts := httptest.NewServer(s.HttpHandler())
+	defer ts.Close()
+	url := ts.URL + metadataserver.DefaultEndpoint + "/project/project-id"
+
+	s.Pause()
+	if !s.Paused() {
+		t.Errorf("expected server to be paused")
+	}
+	if got := getStatus(t, url); got != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got: %d", http.StatusServiceUnavailable, got)
+	}
+	s.Resume()
+	if got := getStatus(t, url); got != http.StatusOK {
+		t.Errorf("expected status %d, got: %d", http.StatusOK, got)
+	}
+}
+
+func TestPauseHang(t *testing.T) {
+	s, err := metadataserver.New(metadataserver.WithPauseMode(metadataserver.PauseHang))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	ts := httptest.NewServer(s.HttpHandler())
+	defer ts.Close()
+
+	s.Pause()
+	result := make(chan int)
+	go func() {
+		result <- getStatus(t, ts.URL+metadataserver.DefaultEndpoint+"/project/project-id")
+	}()
+	select {
+	case status := <-result:
+		t.Fatalf("expected request to hang, got status: %d", status)
+	case <-time.After(100 * time.Millisecond):
+	}
+	s.Resume()
+	if got := <-result; got != http.StatusOK {
+		t.Errorf("expected status %d, got: %d", http.StatusOK, got)
+	}
+}
+
+func getStatus(t *testing.T, url string) int {
+	t.Helper()
+	res, err := http.Get(url)
+	if err != nil {
+		t.Errorf("expected no errors, got: %v", err)
+		return 0
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+	return res.StatusCode
+}
@@ -0,0 +1,45 @@
+package metadataserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"plugin"
+)
+
+// DefaultPluginSymbol is the name of the plugin's symbol that implements the metadata handler.
+const DefaultPluginSymbol = "Value"
+
+// LoadPluginHandler loads the metadata handler from the Go plugin (see [plugin.Open]) at the path.
+// The symbol must be a function (or a variable of a function type) with one of the signatures:
+//
+//	func() string
+//	func(ctx context.Context, r *http.Request) (string, error)
+//
+// The plugin must be built with the same Go version as the program that loads it.
+// Only Go plugins are supported, so the plugins work on the platforms supported by the [plugin] package;
+// WebAssembly modules cannot be loaded.
+func LoadPluginHandler(path, symbol string) (MetadataFunc, error) {
+	if symbol == "" {
+		symbol = DefaultPluginSymbol
+	}
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := p.Lookup(symbol)
+	if err != nil {
+		return nil, err
+	}
+	switch fn := sym.(type) {
+	case func() string:
+		return func(context.Context, *http.Request) (string, error) { return fn(), nil }, nil
+	case *func() string:
+		return func(context.Context, *http.Request) (string, error) { return (*fn)(), nil }, nil
+	case func(context.Context, *http.Request) (string, error):
+		return fn, nil
+	case *func(context.Context, *http.Request) (string, error):
+		return func(ctx context.Context, r *http.Request) (string, error) { return (*fn)(ctx, r) }, nil
+	}
+	return nil, fmt.Errorf("plugin %q: symbol %q has unsupported type %T", path, symbol, sym)
+}
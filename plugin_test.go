@@ -0,0 +1,104 @@
+package metadataserver_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+const pluginSource = `package main
+
+import (
+	"context"
+	"net/http"
+)
+
+func Value(ctx context.Context, r *http.Request) (string, error) {
+	return "hello " + r.URL.Query().Get("name"), nil
+}
+
+func Static() string {
+	return "static"
+}
+
+var Count int
+
+func main() {}
+`
+
+// buildPlugin builds the test plugin in the test's temporary directory and returns the path of the plugin file.
+// Call it once per test binary because the same plugin cannot be loaded from two files.
+func buildPlugin(t *testing.T) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("building plugins is skipped in short mode")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(pluginSource), 0o644); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module testplugin\n"), 0o644); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	cmd := exec.Command("go", "build", "-buildmode=plugin", "-o", "handler.so", ".")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("plugins are not supported: %v\n%s", err, out)
+	}
+	name := filepath.Join(dir, "handler.so")
+	// the plugin cannot be loaded if it is built with different flags, e.g. -race
+	if _, err := metadataserver.LoadPluginHandler(name, "Static"); err != nil {
+		t.Skipf("plugin cannot be loaded: %v", err)
+	}
+	return name
+}
+
+func TestPlugins(t *testing.T) {
+	name := buildPlugin(t)
+	t.Run("handlers", func(t *testing.T) {
+		config := `{"metadata": {
+			"instance/attributes/greeting": {"plugin": "` + name + `"},
+			"instance/attributes/static": {"plugin": "` + name + `", "symbol": "Static"}
+		}}`
+		file := filepath.Join(t.TempDir(), "config.json")
+		if err := os.WriteFile(file, []byte(config), 0o644); err != nil {
+			t.Fatalf("expected no errors, got: %v", err)
+		}
+		s, err := metadataserver.New(metadataserver.WithConfigFile(file))
+		if err != nil {
+			t.Fatalf("expected no errors, got: %v", err)
+		}
+		for path, want := range map[string]string{
+			"instance/attributes/greeting?name=vm": "hello vm",
+			"instance/attributes/static":           "static",
+		} {
+			rec := httptest.NewRecorder()
+			s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/"+path, nil))
+			if got := rec.Body.String(); got != want {
+				t.Errorf("%s: expected %q, got: %q", path, want, got)
+			}
+		}
+		c := s.Configuration()
+		if got := c.Source("instance/attributes/static"); got != "plugin "+name {
+			t.Errorf("expected plugin source, got: %q", got)
+		}
+	})
+	t.Run("unsupported symbol", func(t *testing.T) {
+		_, err := metadataserver.LoadPluginHandler(name, "Count")
+		if err == nil || !strings.Contains(err.Error(), `symbol "Count" has unsupported type *int`) {
+			t.Errorf("expected unsupported type error, got: %v", err)
+		}
+	})
+}
+
+func TestPluginMissing(t *testing.T) {
+	if _, err := metadataserver.LoadPluginHandler("test/fixtures/missing.so", ""); err == nil {
+		t.Errorf("expected error for missing plugin")
+	}
+}
@@ -0,0 +1,118 @@
+package metadataserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ErrPreflightFailed indicates that the preflight checks found problems when the server started. The error is [PreflightError].
+var ErrPreflightFailed error = errors.New("preflight checks failed")
+
+// PreflightCheck is a custom check that [Server.Start] runs before the server listens.
+// The check returns an error that describes the problem, e.g. a missing credential file.
+type PreflightCheck func(ctx context.Context) error
+
+// PreflightError lists the problems found by the preflight checks of [Server.Start].
+type PreflightError struct {
+	Problems []error
+}
+
+func (e *PreflightError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "preflight checks failed with %d problem(s):", len(e.Problems))
+	for _, err := range e.Problems {
+		b.WriteString("\n\t")
+		b.WriteString(err.Error())
+	}
+	return b.String()
+}
+
+// Unwrap returns [ErrPreflightFailed] and the problems.
+func (e *PreflightError) Unwrap() []error {
+	return append([]error{ErrPreflightFailed}, e.Problems...)
+}
+
+// WithPreflight sets a new server to check its dependencies when it starts instead of serving empty values silently.
+// [Server.Start] fails with [PreflightError] if environment variables or files that metadata handlers
+// of the configuration file and its profiles read are missing, or if any of the custom checks fails.
+//
+// Mind the order of options when use with [WithConfiguration] and [WithConfigFile].
+func WithPreflight(checks ...PreflightCheck) Option {
+	return func(s *Server) {
+		if s.config == nil {
+			s.config = NewConfiguration(DefaultConfigurationHandlers)
+		}
+		s.config.Preflight = true
+		s.preflightChecks = append(s.preflightChecks, checks...)
+	}
+}
+
+// preflight runs the preflight checks if they are enabled and returns [PreflightError] with all found problems.
+func (s *Server) preflight(ctx context.Context) error {
+	if !s.config.Preflight {
+		return nil
+	}
+	problems := dependencyErrors(s.config)
+	for _, p := range s.config.Profiles {
+		if p.config == nil {
+			continue
+		}
+		for _, err := range dependencyErrors(p.config) {
+			problems = append(problems, fmt.Errorf("profile %q: %w", p.Name, err))
+		}
+	}
+	for _, check := range s.preflightChecks {
+		if err := check(ctx); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	if len(problems) > 0 {
+		return &PreflightError{Problems: problems}
+	}
+	return nil
+}
+
+// dependencyError is the error of the environment variable or the file that the metadata at the key reads.
+type dependencyError struct {
+	key string
+	err error
+}
+
+func (e *dependencyError) Error() string {
+	return fmt.Sprintf("metadata %q: %v", e.key, e.err)
+}
+
+func (e *dependencyError) Unwrap() error {
+	return e.err
+}
+
+// dependencyErrors returns [dependencyError] of the environment variables and files that metadata handlers
+// of the configuration read and that are missing, sorted by the metadata keys.
+func dependencyErrors(c *Configuration) []error {
+	keys := make([]string, 0, len(c.envVars)+len(c.files))
+	for k := range c.envVars {
+		keys = append(keys, k)
+	}
+	for k := range c.files {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var errs []error
+	for _, k := range keys {
+		if name, ok := c.envVars[k]; ok {
+			if _, ok := os.LookupEnv(name); !ok {
+				errs = append(errs, &dependencyError{key: k, err: fmt.Errorf("environment variable %q is not set", name)})
+			}
+		}
+		if name, ok := c.files[k]; ok {
+			if _, err := os.Stat(name); err != nil {
+				errs = append(errs, &dependencyError{key: k, err: err})
+			}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,142 @@
+package metadataserver_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestPreflight(t *testing.T) {
+	errCheck := errors.New("credentials are missing")
+	tests := []struct {
+		name     string
+		config   string
+		env      map[string]string
+		checks   []metadataserver.PreflightCheck
+		problems int
+	}{
+		{
+			name:   "env is set",
+			config: "test/fixtures/config_literal_handlers.json",
+			env:    map[string]string{"two": "2"},
+		},
+		{
+			name:     "env is missing",
+			config:   "test/fixtures/config_literal_handlers.json",
+			problems: 1,
+		},
+		{
+			name:     "file is missing",
+			config:   "test/fixtures/config_file_handlers.json",
+			problems: 1,
+		},
+		{
+			name:   "custom check passes",
+			config: "test/fixtures/config_file_handlers.json",
+			checks: []metadataserver.PreflightCheck{
+				func(context.Context) error { return nil },
+			},
+			problems: 1,
+		},
+		{
+			name:   "custom check fails",
+			config: "test/fixtures/config_literal_handlers.json",
+			checks: []metadataserver.PreflightCheck{
+				func(context.Context) error { return errCheck },
+			},
+			problems: 2,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for k, v := range test.env {
+				t.Setenv(k, v)
+			}
+			c, err := metadataserver.NewConfigFromFile(test.config)
+			if err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			s, err := metadataserver.New(metadataserver.WithConfiguration(c), metadataserver.WithAddress("127.0.0.1"), metadataserver.WithPort(0), metadataserver.WithPreflight(test.checks...))
+			if err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			err = s.Start(context.Background())
+			if test.problems == 0 {
+				if err != nil {
+					t.Fatalf("expected no errors, got: %v", err)
+				}
+				s.Stop(context.Background())
+				return
+			}
+			var preflightErr *metadataserver.PreflightError
+			if !errors.As(err, &preflightErr) {
+				if err == nil {
+					s.Stop(context.Background())
+				}
+				t.Fatalf("expected PreflightError, got: %v", err)
+			}
+			if len(preflightErr.Problems) != test.problems {
+				t.Errorf("expected %d problems, got: %v", test.problems, preflightErr.Problems)
+			}
+		})
+	}
+}
+
+func TestPreflightMissingFile(t *testing.T) {
+	c, err := metadataserver.NewConfigFromFile("test/fixtures/config_file_handlers.json")
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	s, err := metadataserver.New(metadataserver.WithConfiguration(c), metadataserver.WithPreflight())
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	err = s.Start(context.Background())
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected error that wraps %v, got: %v", fs.ErrNotExist, err)
+	}
+}
+
+func TestPreflightDisabled(t *testing.T) {
+	c, err := metadataserver.NewConfigFromFile("test/fixtures/config_literal_handlers.json")
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	s, err := metadataserver.New(metadataserver.WithConfiguration(c), metadataserver.WithAddress("127.0.0.1"), metadataserver.WithPort(0))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	s.Stop(context.Background())
+}
+
+func TestPreflightConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{"preflight": true, "metadata": {"entry": {"env": "METADATASERVER_PREFLIGHT_MISSING"}}, "profiles": [{"name": "vm-1", "pathPrefix": "vm-1", "metadata": {"entry": {"file": "missing.txt"}}}]}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	c, err := metadataserver.NewConfigFromFile(path)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if !c.Preflight {
+		t.Errorf("expected preflight to be enabled")
+	}
+	s, err := metadataserver.New(metadataserver.WithConfiguration(c))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	err = s.Start(context.Background())
+	var preflightErr *metadataserver.PreflightError
+	if !errors.As(err, &preflightErr) || len(preflightErr.Problems) != 2 {
+		t.Errorf("expected PreflightError with 2 problems, got: %v", err)
+	}
+}
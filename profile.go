@@ -0,0 +1,205 @@
+package metadataserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Profile describes the metadata of one of the instances that the server simulates.
+// The profile serves the request if the request matches any of the profile's selectors:
+// the path prefix (e.g. "/vm-1" for requests at "/vm-1/computeMetadata/v1/..."), the Host header, the port
+// or the client's IP address that belongs to one of the Clients ranges (e.g. "172.18.0.5" or "172.18.0.0/24").
+// The handlers of the profile take precedence over the server's handlers. The values changed at runtime are shared by all profiles.
+type Profile struct {
+	Name       string
+	PathPrefix string
+	Hosts      []string
+	Port       int
+	Clients    []string
+	Handlers   map[string]Metadata
+
+	// config keeps the handlers of the profile loaded from the configuration file
+	config *Configuration
+}
+
+type jsonProfile struct {
+	Name       string         `json:"name"`
+	PathPrefix string         `json:"pathPrefix"`
+	Hosts      []string       `json:"hosts"`
+	Port       int            `json:"port"`
+	Clients    []string       `json:"clients"`
+	Handlers   map[string]any `json:"metadata"`
+}
+
+// WithProfiles sets a new server with the instance profiles so a single server can simulate several instances.
+// If the profile has a port, the server also listens at this port and serves requests at it with the profile.
+//
+// Mind the order of options when use with [WithConfiguration] and [WithConfigFile].
+func WithProfiles(profiles ...Profile) Option {
+	return func(s *Server) {
+		if s.config == nil {
+			s.config = NewConfiguration(DefaultConfigurationHandlers)
+		}
+		s.config.Profiles = append(s.config.Profiles, profiles...)
+	}
+}
+
+// serverProfile is the profile with the routes of its handlers.
+type serverProfile struct {
+	Profile
+	routes  routeTrie
+	clients []netip.Prefix
+}
+
+type profileContextKey struct{}
+
+// requestProfile returns the profile that serves the request or nil if the request is served by the server's handlers.
+func requestProfile(r *http.Request) *serverProfile {
+	p, _ := r.Context().Value(profileContextKey{}).(*serverProfile)
+	return p
+}
+
+// newProfiles builds the routes of the configured profiles.
+func (s *Server) newProfiles() ([]*serverProfile, error) {
+	profiles := make([]*serverProfile, 0, len(s.config.Profiles))
+	for i, p := range s.config.Profiles {
+		if p.Name == "" {
+			return nil, fmt.Errorf("profile %d: name is required", i)
+		}
+		if p.PathPrefix != "" {
+			p.PathPrefix = "/" + strings.Trim(p.PathPrefix, "/")
+		}
+		c := p.config
+		if c == nil {
+			c = &Configuration{Handlers: p.Handlers}
+		}
+		sp := &serverProfile{Profile: p}
+		for _, cidr := range p.Clients {
+			prefix, err := parseClientRange(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("profile %q: invalid client range %q: %w", p.Name, cidr, err)
+			}
+			sp.clients = append(sp.clients, prefix)
+		}
+		if err := s.insertRoutes(&sp.routes, c); err != nil {
+			return nil, fmt.Errorf("profile %q: %w", p.Name, err)
+		}
+		profiles = append(profiles, sp)
+	}
+	return profiles, nil
+}
+
+// matches reports whether the profile serves the request.
+func (p *serverProfile) matches(r *http.Request) bool {
+	if p.PathPrefix != "" && hasPathPrefix(r.URL.Path, p.PathPrefix) {
+		return true
+	}
+	if len(p.Hosts) > 0 {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		for _, h := range p.Hosts {
+			if strings.EqualFold(h, host) {
+				return true
+			}
+		}
+	}
+	if p.Port > 0 {
+		if addr, ok := r.Context().Value(http.LocalAddrContextKey).(*net.TCPAddr); ok && addr.Port == p.Port {
+			return true
+		}
+	}
+	if len(p.clients) > 0 {
+		if addr, ok := clientAddr(r.RemoteAddr); ok {
+			for _, prefix := range p.clients {
+				if prefix.Contains(addr) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func hasPathPrefix(urlPath, prefix string) bool {
+	return urlPath == prefix || strings.HasPrefix(urlPath, prefix+"/")
+}
+
+// selectProfile serves the request with the first profile that matches the request.
+// The profile's path prefix is removed from the request path.
+func (s *Server) selectProfile(next http.Handler) http.Handler {
+	if len(s.profiles) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, p := range s.profiles {
+			if !p.matches(r) {
+				continue
+			}
+			r = r.WithContext(context.WithValue(r.Context(), profileContextKey{}, p))
+			if p.PathPrefix != "" && hasPathPrefix(r.URL.Path, p.PathPrefix) {
+				u := *r.URL
+				u.Path = strings.TrimPrefix(u.Path, p.PathPrefix)
+				u.RawPath = ""
+				if u.Path == "" {
+					u.Path = "/"
+				}
+				r.URL = &u
+			}
+			s.handlerLogger.DebugContext(r.Context(), "request is served with profile", slog.String("profile", p.Name))
+			break
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// startProfiles starts listening at the ports of the profiles.
+func (s *Server) startProfiles(ctx context.Context) error {
+	for _, p := range s.profiles {
+		if p.Port <= 0 || p.Port == s.config.Port {
+			continue
+		}
+		srv := &http.Server{
+			Addr:    net.JoinHostPort(s.config.Address, strconv.Itoa(p.Port)),
+			Handler: s.server.Handler,
+		}
+		l, err := net.Listen("tcp", srv.Addr)
+		if err != nil {
+			s.closeProfiles()
+			return fmt.Errorf("profile %q: %w", p.Name, bindError("tcp", srv.Addr, err))
+		}
+		s.logger.DebugContext(ctx, "starting profile", slog.String("profile", p.Name), slog.String("address", srv.Addr))
+		go func() {
+			if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				s.logger.ErrorContext(ctx, "error serving profile", slog.String("profile", p.Name), slog.String("error", err.Error()))
+			}
+		}()
+		s.profileServers = append(s.profileServers, srv)
+	}
+	return nil
+}
+
+// shutdownProfiles gracefully stops serving at the ports of the profiles.
+func (s *Server) shutdownProfiles(ctx context.Context) {
+	for _, srv := range s.profileServers {
+		if err := srv.Shutdown(ctx); err != nil {
+			s.logger.ErrorContext(ctx, "error stopping profile server", slog.String("address", srv.Addr), slog.String("error", err.Error()))
+		}
+	}
+	s.profileServers = nil
+}
+
+func (s *Server) closeProfiles() {
+	for _, srv := range s.profileServers {
+		srv.Close()
+	}
+	s.profileServers = nil
+}
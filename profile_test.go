@@ -0,0 +1,149 @@
+package metadataserver_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestProfiles(t *testing.T) {
+	s, err := metadataserver.New(metadataserver.WithConfigFile("test/fixtures/config_profiles.json"))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	tests := []struct {
+		name   string
+		host   string
+		path   string
+		status int
+		want   string
+	}{
+		{"path prefix", "", "/vm-1" + metadataserver.DefaultEndpoint + "/instance/id", http.StatusOK, "1001"},
+		{"other path prefix", "", "/vm-2" + metadataserver.DefaultEndpoint + "/instance/name", http.StatusOK, "vm-2"},
+		{"host", "vm-1.internal", metadataserver.DefaultEndpoint + "/instance/name", http.StatusOK, "vm-1"},
+		{"host with port", "vm-1.internal:80", metadataserver.DefaultEndpoint + "/instance/id", http.StatusOK, "1001"},
+		{"fallback to server handlers", "", "/vm-2" + metadataserver.DefaultEndpoint + "/instance/zone", http.StatusOK, "projects/123456789/zones/us-central1-a"},
+		{"profile listing", "", "/vm-1" + metadataserver.DefaultEndpoint + "/instance/", http.StatusOK, "id\nname\nregion\nzone\n"},
+		{"no profile", "", metadataserver.DefaultEndpoint + "/instance/id", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, test.path, nil)
+			if test.host != "" {
+				r.Host = test.host
+			}
+			rec := httptest.NewRecorder()
+			s.HttpHandler().ServeHTTP(rec, r)
+			if rec.Code != test.status {
+				t.Fatalf("expected status %d, got: %d", test.status, rec.Code)
+			}
+			if test.status != http.StatusOK {
+				return
+			}
+			body, _ := io.ReadAll(rec.Body)
+			if got := string(body); got != test.want {
+				t.Errorf("expected %q, got: %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestProfilePort(t *testing.T) {
+	ctx := context.Background()
+	port := freePort()
+	s, err := metadataserver.New(
+		metadataserver.WithAddress("127.0.0.1"),
+		metadataserver.WithPort(freePort()),
+		metadataserver.WithProfiles(metadataserver.Profile{
+			Name: "vm-1",
+			Port: port,
+			Handlers: map[string]metadataserver.Metadata{
+				"project/project-id": func() string { return "vm-1-project" },
+			},
+		}))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if err := s.Start(ctx); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	defer s.Stop(ctx)
+
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d%s/project/project-id", port, metadataserver.DefaultEndpoint), nil)
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if got := string(body); got != "vm-1-project" {
+		t.Errorf("expected %q, got: %q", "vm-1-project", got)
+	}
+}
+
+func TestProfileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile metadataserver.Profile
+		want    string
+	}{
+		{"no name", metadataserver.Profile{PathPrefix: "/vm-1"}, "profile 0: name is required"},
+		{"invalid client range", metadataserver.Profile{Name: "vm-1", Clients: []string{"10.0.0.0/33"}}, `profile "vm-1": invalid client range "10.0.0.0/33"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := metadataserver.New(metadataserver.WithProfiles(test.profile))
+			if err == nil || !strings.HasPrefix(err.Error(), test.want) {
+				t.Errorf("expected error %q, got: %v", test.want, err)
+			}
+		})
+	}
+}
+
+func TestProfileClients(t *testing.T) {
+	s, err := metadataserver.New(metadataserver.WithProfiles(
+		metadataserver.Profile{
+			Name:     "app",
+			Clients:  []string{"172.18.0.0/24"},
+			Handlers: map[string]metadataserver.Metadata{"instance/name": func() string { return "app" }},
+		},
+		metadataserver.Profile{
+			Name:     "db",
+			Clients:  []string{"172.18.1.7"},
+			Handlers: map[string]metadataserver.Metadata{"instance/name": func() string { return "db" }},
+		}))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	tests := []struct {
+		remoteAddr string
+		status     int
+		want       string
+	}{
+		{"172.18.0.5:4321", http.StatusOK, "app"},
+		{"172.18.1.7:4321", http.StatusOK, "db"},
+		{"[::ffff:172.18.1.7]:4321", http.StatusOK, "db"},
+		{"172.18.1.8:4321", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.remoteAddr, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/instance/name", nil)
+			r.RemoteAddr = test.remoteAddr
+			rec := httptest.NewRecorder()
+			s.HttpHandler().ServeHTTP(rec, r)
+			if rec.Code != test.status {
+				t.Fatalf("expected status %d, got: %d", test.status, rec.Code)
+			}
+			if got := rec.Body.String(); test.status == http.StatusOK && got != test.want {
+				t.Errorf("expected %q, got: %q", test.want, got)
+			}
+		})
+	}
+}
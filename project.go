@@ -0,0 +1,113 @@
+package metadataserver
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Paths of the project metadata.
+const (
+	ProjectIDPath     = "project/project-id"
+	ProjectNumberPath = "project/numeric-project-id"
+)
+
+// WithProject sets a new server with the project that the simulated instance belongs to.
+// The server serves the project ID and the project number at [ProjectIDPath] and [ProjectNumberPath].
+// The server fails to start if other handlers define contradicting values, e.g. a different project ID
+// or a zone of another project number.
+//
+// Mind the order of options when use with [WithConfiguration] and [WithConfigFile].
+func WithProject(id string, number int64) Option {
+	return func(s *Server) {
+		if s.config == nil {
+			s.config = NewConfiguration(DefaultConfigurationHandlers)
+		}
+		s.config.ProjectID = id
+		s.config.ProjectNumber = number
+	}
+}
+
+// applyProject adds the handlers of the project ID and number to the configuration.
+// It returns an error if the handlers of the configuration contradict the project.
+// The default handler of the project ID is replaced.
+func (c *Configuration) applyProject() error {
+	if c.ProjectID == "" && c.ProjectNumber == 0 {
+		return nil
+	}
+	if c.ProjectNumber < 0 {
+		return fmt.Errorf("project number %d is negative", c.ProjectNumber)
+	}
+	values := make(map[string]string, 2)
+	if c.ProjectID != "" {
+		values[ProjectIDPath] = c.ProjectID
+	}
+	if c.ProjectNumber > 0 {
+		values[ProjectNumberPath] = strconv.FormatInt(c.ProjectNumber, 10)
+	}
+	handlers := make(map[string]Metadata, len(c.Handlers)+len(values))
+	for k, h := range c.Handlers {
+		handlers[k] = h
+	}
+	for k, v := range values {
+		h, ok := handlers[k]
+		switch {
+		case ok && !isDefaultHandler(k, h):
+			if err := checkProjectValue(k, h(), c.ProjectID, c.ProjectNumber); err != nil {
+				return err
+			}
+		case !ok && c.Source(k) != "":
+			return fmt.Errorf("metadata %q: the handler conflicts with the project", k)
+		}
+		handlers[k] = func() string {
+			return v
+		}
+		if c.literals == nil {
+			c.literals = make(map[string]string)
+		}
+		c.literals[k] = v
+		if c.sources == nil {
+			c.sources = make(map[string]string)
+		}
+		if _, ok := c.sources[k]; !ok {
+			c.sources[k] = "project"
+		}
+	}
+	if h, ok := handlers["instance/zone"]; ok {
+		if err := checkProjectValue("instance/zone", h(), c.ProjectID, c.ProjectNumber); err != nil {
+			return err
+		}
+	}
+	c.Handlers = handlers
+	return nil
+}
+
+// checkProjectValue returns an error if the metadata value at the key contradicts the project ID or number.
+func checkProjectValue(key, value, id string, number int64) error {
+	var got, want string
+	switch key {
+	case ProjectIDPath:
+		got, want = value, id
+	case ProjectNumberPath:
+		if number > 0 {
+			got, want = value, strconv.FormatInt(number, 10)
+		}
+	case "instance/zone":
+		// the zone is "projects/NUMBER/zones/ZONE"
+		parts := strings.Split(value, "/")
+		if number > 0 && len(parts) == 4 && parts[0] == "projects" {
+			got, want = parts[1], strconv.FormatInt(number, 10)
+		}
+	}
+	if want != "" && got != want {
+		return fmt.Errorf("metadata %q: value %q contradicts the project %q", key, value, want)
+	}
+	return nil
+}
+
+// isDefaultHandler reports whether the handler at the key is the one from [DefaultConfigurationHandlers].
+func isDefaultHandler(key string, h Metadata) bool {
+	d, ok := DefaultConfigurationHandlers[key]
+	return ok && reflect.ValueOf(d).Pointer() == reflect.ValueOf(h).Pointer()
+}
@@ -0,0 +1,115 @@
+package metadataserver_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/minherz/metadataserver"
+)
+
+func TestProject(t *testing.T) {
+	s, err := metadataserver.New(metadataserver.WithProject("my-project", 123456789012))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	for path, want := range map[string]string{
+		metadataserver.ProjectIDPath:     "my-project",
+		metadataserver.ProjectNumberPath: "123456789012",
+	} {
+		if got, ok := s.GetValue(path); !ok || got != want {
+			t.Errorf("%s: expected %q, got: %q", path, want, got)
+		}
+	}
+}
+
+func TestProjectConsistency(t *testing.T) {
+	tests := []struct {
+		name     string
+		handlers map[string]metadataserver.Metadata
+		want     string
+	}{
+		{
+			name:     "same values",
+			handlers: map[string]metadataserver.Metadata{metadataserver.ProjectIDPath: func() string { return "my-project" }},
+		},
+		{
+			name:     "zone of the project",
+			handlers: map[string]metadataserver.Metadata{"instance/zone": func() string { return "projects/42/zones/us-central1-a" }},
+		},
+		{
+			name:     "different project ID",
+			handlers: map[string]metadataserver.Metadata{metadataserver.ProjectIDPath: func() string { return "other-project" }},
+			want:     `metadata "project/project-id": value "other-project" contradicts the project "my-project"`,
+		},
+		{
+			name:     "different project number",
+			handlers: map[string]metadataserver.Metadata{metadataserver.ProjectNumberPath: func() string { return "7" }},
+			want:     `metadata "project/numeric-project-id": value "7" contradicts the project "42"`,
+		},
+		{
+			name:     "zone of another project",
+			handlers: map[string]metadataserver.Metadata{"instance/zone": func() string { return "projects/7/zones/us-central1-a" }},
+			want:     `metadata "instance/zone": value "projects/7/zones/us-central1-a" contradicts the project "42"`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := metadataserver.New(
+				metadataserver.WithConfiguration(metadataserver.NewConfiguration(test.handlers)),
+				metadataserver.WithProject("my-project", 42))
+			if test.want == "" {
+				if err != nil {
+					t.Errorf("expected no errors, got: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != test.want {
+				t.Errorf("expected error %q, got: %v", test.want, err)
+			}
+		})
+	}
+}
+
+func TestProjectIdentityClaims(t *testing.T) {
+	key, err := metadataserver.NewTestSigningKey("RS256", "identity")
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	s, err := metadataserver.New(
+		metadataserver.WithProject("my-project", 42),
+		metadataserver.WithServiceAccounts(metadataserver.ServiceAccount{Email: "app@my-project.iam.gserviceaccount.com"}),
+		metadataserver.WithSigningKey(key))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	status, token := getIdentity(t, s, "default", "?audience=aud&format=full")
+	if status != http.StatusOK {
+		t.Fatalf("expected status 200, got: %d %q", status, token)
+	}
+	claims := verifyJWT(t, token, "RS256", key.Public())
+	want := map[string]any{"compute_engine": map[string]any{"project_id": "my-project", "project_number": float64(42)}}
+	if diff := cmp.Diff(want, claims["google"]); diff != "" {
+		t.Errorf("claims mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestProjectConfigurationReuse(t *testing.T) {
+	c := metadataserver.NewConfiguration(metadataserver.DefaultConfigurationHandlers)
+	if _, err := metadataserver.New(metadataserver.WithConfiguration(c), metadataserver.WithProject("my-project", 42),
+		metadataserver.WithZone("europe-west1-b"), metadataserver.WithServiceAccounts(metadataserver.ServiceAccount{Email: "sa@example.com"})); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	s, err := metadataserver.New(metadataserver.WithConfiguration(c))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if got, _ := s.GetValue(metadataserver.ProjectIDPath); got != "test-project-id" {
+		t.Errorf("expected %q, got: %q", "test-project-id", got)
+	}
+	for _, p := range []string{metadataserver.ProjectNumberPath, metadataserver.ZonePath, "instance/service-accounts/default/email"} {
+		if got, ok := s.GetValue(p); ok {
+			t.Errorf("%s: expected no value, got: %q", p, got)
+		}
+	}
+}
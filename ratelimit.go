@@ -0,0 +1,205 @@
+package metadataserver
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimitScope defines how requests are grouped when the rate limit is applied.
+type RateLimitScope int
+
+const (
+	// RateLimitPerIP applies the rate limit to requests of each client IP.
+	RateLimitPerIP RateLimitScope = iota
+	// RateLimitPerPath applies the rate limit to requests at each path regardless of the client.
+	RateLimitPerPath
+	// RateLimitPerIPAndPath applies the rate limit to requests of each client IP at each path.
+	RateLimitPerIPAndPath
+)
+
+// WithRateLimit sets a new server with a token-bucket rate limiter.
+// Each bucket holds up to burst tokens and is refilled at rate tokens per second.
+// Requests that exceed the limit are rejected with 429 (Too Many Requests) and the Retry-After header.
+// The buckets are refilled by the server's clock (see [WithClock]).
+// The rate must be positive and the burst must be at least 1, otherwise [New] returns [ConfigError].
+func WithRateLimit(rate float64, burst int, scope RateLimitScope) Option {
+	return func(s *Server) {
+		s.rateLimiter = &rateLimiter{
+			rate:    rate,
+			burst:   float64(burst),
+			scope:   scope,
+			buckets: make(map[string]*tokenBucket),
+		}
+	}
+}
+
+// rateLimiter keeps token buckets of the request groups.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+	scope RateLimitScope
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	// swept is the time when the full buckets were removed last time
+	swept time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// validate returns an error if the limiter never allows requests.
+func (l *rateLimiter) validate() error {
+	if l.rate <= 0 || math.IsNaN(l.rate) {
+		return fmt.Errorf("rate limit %v is not positive", l.rate)
+	}
+	if l.burst < 1 {
+		return fmt.Errorf("rate limit burst %v is less than 1", l.burst)
+	}
+	return nil
+}
+
+// allow takes a token from the bucket of the key.
+// It returns the duration to wait for the next token if the bucket is empty.
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// sweep removes the buckets that are refilled to the burst, so the buckets of idle clients and paths do not accumulate.
+// A removed bucket is the same as the new one. The buckets are checked once in the time that refills an empty bucket.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept).Seconds() < l.burst/l.rate {
+		return
+	}
+	l.swept = now
+	for k, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+func (l *rateLimiter) key(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	switch l.scope {
+	case RateLimitPerPath:
+		return r.URL.Path
+	case RateLimitPerIPAndPath:
+		return ip + " " + r.URL.Path
+	}
+	return ip
+}
+
+func (s *Server) rateLimit(next http.Handler) http.Handler {
+	if s.rateLimiter == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, wait := s.rateLimiter.allow(s.rateLimiter.key(r), s.now())
+		if ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		s.handlerLogger.DebugContext(r.Context(), "request is rate limited",
+			slog.String("path", r.URL.Path), slog.String("remoteAddr", r.RemoteAddr))
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+	})
+}
+
+// TokenPath is the pattern of the metadata paths that serve service account access tokens.
+const TokenPath = "instance/service-accounts/*/token"
+
+// WithTokenQuota sets a new server that serves at most the given number of requests per minute
+// at the access token paths (see [TokenPath]) similar to the quota of the real metadata server.
+// The requests above the quota are rejected with 429 (Too Many Requests) and the Retry-After header
+// until the next minute starts. The quota does not apply to other metadata paths.
+// The minutes are counted by the server's clock (see [WithClock]) and [Server.Reset] starts a new minute.
+// The number of requests must be positive, otherwise [New] returns [ConfigError].
+func WithTokenQuota(requestsPerMinute int) Option {
+	return func(s *Server) {
+		s.tokenQuota = &quota{limit: requestsPerMinute, window: time.Minute}
+	}
+}
+
+// quota counts requests in fixed time windows.
+type quota struct {
+	limit  int
+	window time.Duration
+
+	mu    sync.Mutex
+	start time.Time
+	count int
+}
+
+// allow counts the request in the current window.
+// It returns the duration until the next window if the limit of the current window is reached.
+func (q *quota) allow(now time.Time) (bool, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if now.Sub(q.start) >= q.window {
+		q.start = now
+		q.count = 0
+	}
+	if q.count < q.limit {
+		q.count++
+		return true, 0
+	}
+	return false, q.start.Add(q.window).Sub(now)
+}
+
+// reset starts a new window with the next request.
+func (q *quota) reset() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.start = time.Time{}
+	q.count = 0
+}
+
+func (s *Server) limitTokenRequests(next http.Handler) http.Handler {
+	if s.tokenQuota == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, ok := s.keyOf(r.URL.Path)
+		if matched, _ := path.Match(TokenPath, key); !ok || !matched {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ok, wait := s.tokenQuota.allow(s.now())
+		if ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		s.handlerLogger.DebugContext(r.Context(), "token request exceeds quota",
+			slog.String("path", r.URL.Path), slog.String("remoteAddr", r.RemoteAddr))
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+	})
+}
@@ -0,0 +1,151 @@
+package metadataserver_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestRateLimit(t *testing.T) {
+	tests := []struct {
+		name        string
+		scope       metadataserver.RateLimitScope
+		ip          string
+		path        string
+		wantLimited bool
+	}{
+		{"per ip same path", metadataserver.RateLimitPerIP, "10.0.0.1", "project/project-id", true},
+		{"per ip other path", metadataserver.RateLimitPerIP, "10.0.0.1", "instance/id", true},
+		{"per ip other ip", metadataserver.RateLimitPerIP, "10.0.0.2", "project/project-id", false},
+		{"per path other ip", metadataserver.RateLimitPerPath, "10.0.0.2", "project/project-id", true},
+		{"per path other path", metadataserver.RateLimitPerPath, "10.0.0.1", "instance/id", false},
+		{"per ip and path same", metadataserver.RateLimitPerIPAndPath, "10.0.0.1", "project/project-id", true},
+		{"per ip and path other path", metadataserver.RateLimitPerIPAndPath, "10.0.0.1", "instance/id", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := metadataserver.New(metadataserver.WithRateLimit(0.001, 1, test.scope))
+			if err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			if rec := serveFrom(s, "10.0.0.1", "project/project-id"); rec.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got: %d", http.StatusOK, rec.Code)
+			}
+			rec := serveFrom(s, test.ip, test.path)
+			if got := rec.Code == http.StatusTooManyRequests; got != test.wantLimited {
+				t.Errorf("expected limited %t, got status: %d", test.wantLimited, rec.Code)
+			}
+			if test.wantLimited && rec.Header().Get("Retry-After") == "" {
+				t.Errorf("expected Retry-After header, got: %v", rec.Header())
+			}
+		})
+	}
+}
+
+func TestRateLimitClock(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s, err := metadataserver.New(
+		metadataserver.WithRateLimit(1, 2, metadataserver.RateLimitPerIP),
+		metadataserver.WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	serve := func(ip string, want int) {
+		t.Helper()
+		if rec := serveFrom(s, ip, "project/project-id"); rec.Code != want {
+			t.Errorf("%s: expected status %d, got: %d", ip, want, rec.Code)
+		}
+	}
+	serve("10.0.0.1", http.StatusOK)
+	serve("10.0.0.1", http.StatusOK)
+	serve("10.0.0.1", http.StatusTooManyRequests)
+	serve("10.0.0.2", http.StatusOK)
+
+	// the idle buckets are refilled and removed; the new buckets hold the burst again
+	now = now.Add(time.Minute)
+	serve("10.0.0.3", http.StatusOK)
+	serve("10.0.0.1", http.StatusOK)
+	serve("10.0.0.1", http.StatusOK)
+	serve("10.0.0.1", http.StatusTooManyRequests)
+
+	now = now.Add(time.Second)
+	serve("10.0.0.1", http.StatusOK)
+	serve("10.0.0.1", http.StatusTooManyRequests)
+}
+
+func TestRateLimitInvalid(t *testing.T) {
+	tests := []struct {
+		rate  float64
+		burst int
+	}{
+		{0, 1},
+		{-1, 1},
+		{1, 0},
+		{1, -1},
+	}
+	for _, test := range tests {
+		_, err := metadataserver.New(metadataserver.WithRateLimit(test.rate, test.burst, metadataserver.RateLimitPerIP))
+		if !errors.Is(err, metadataserver.ErrConfigInvalid) {
+			t.Errorf("rate %v burst %d: expected %v, got: %v", test.rate, test.burst, metadataserver.ErrConfigInvalid, err)
+		}
+	}
+}
+
+func serveFrom(s *metadataserver.Server, ip, path string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/"+path, nil)
+	r.RemoteAddr = ip + ":12345"
+	rec := httptest.NewRecorder()
+	s.HttpHandler().ServeHTTP(rec, r)
+	return rec
+}
+
+func TestTokenQuota(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s, err := metadataserver.New(
+		metadataserver.WithHandlers(map[string]metadataserver.Metadata{
+			"instance/service-accounts/default/token": func() string { return `{"access_token":"x"}` },
+			"project/project-id":                      func() string { return "test-project-id" },
+		}),
+		metadataserver.WithTokenQuota(2),
+		metadataserver.WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	exhaust := func() {
+		t.Helper()
+		for i := 0; i < 2; i++ {
+			if rec := serveFrom(s, "10.0.0.1", "instance/service-accounts/default/token"); rec.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got: %d", http.StatusOK, rec.Code)
+			}
+		}
+	}
+	exhaust()
+	now = now.Add(15 * time.Second)
+	rec := serveFrom(s, "10.0.0.2", "instance/service-accounts/default/token")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d, got: %d", http.StatusTooManyRequests, rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "45" {
+		t.Errorf("expected Retry-After %q, got: %q", "45", got)
+	}
+	if rec := serveFrom(s, "10.0.0.1", "project/project-id"); rec.Code != http.StatusOK {
+		t.Errorf("expected status %d for path without quota, got: %d", http.StatusOK, rec.Code)
+	}
+
+	now = now.Add(45 * time.Second)
+	exhaust()
+	s.Reset()
+	exhaust()
+}
+
+func TestTokenQuotaInvalid(t *testing.T) {
+	for _, n := range []int{0, -1} {
+		if _, err := metadataserver.New(metadataserver.WithTokenQuota(n)); !errors.Is(err, metadataserver.ErrConfigInvalid) {
+			t.Errorf("quota %d: expected %v, got: %v", n, metadataserver.ErrConfigInvalid, err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package metadataserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// DefaultRecordSkip lists the metadata keys that are not recorded by default.
+// The keys are matched with [path.Match] against the path relative to the endpoint.
+// Access and identity tokens are skipped to avoid storing credentials in config files.
+var DefaultRecordSkip = []string{
+	"instance/service-accounts/*/token",
+	"instance/service-accounts/*/identity",
+}
+
+// Recorder crawls a live metadata server and writes its metadata as a configuration file.
+type Recorder struct {
+	// Client is used to send requests to the metadata server. [http.DefaultClient] is used if nil.
+	Client *http.Client
+	// Header is added to each request. It defaults to "Metadata-Flavor: Google" if nil.
+	Header http.Header
+	// Skip lists the patterns of the keys that are not recorded. [DefaultRecordSkip] is used if nil.
+	Skip []string
+}
+
+// Record recursively walks the metadata endpoint at the URL, e.g. "http://169.254.169.254/computeMetadata/v1",
+// and writes all metadata values as a JSON configuration that can be loaded with [NewConfigFromFile].
+func (rec *Recorder) Record(ctx context.Context, endpointURL string, w io.Writer) error {
+	u, err := url.Parse(endpointURL)
+	if err != nil {
+		return fmt.Errorf("invalid endpoint URL %q: %w", endpointURL, err)
+	}
+	values := make(map[string]any)
+	if err := rec.crawl(ctx, u, "", values); err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "    ")
+	return enc.Encode(struct {
+		Endpoint string         `json:"endpoint"`
+		Handlers map[string]any `json:"metadata"`
+	}{
+		Endpoint: strings.TrimSuffix(u.Path, "/"),
+		Handlers: values,
+	})
+}
+
+// crawl reads the directory at the key and records values of all its entries.
+func (rec *Recorder) crawl(ctx context.Context, endpoint *url.URL, key string, values map[string]any) error {
+	listing, err := rec.get(ctx, endpoint, key+"/")
+	if err != nil {
+		return err
+	}
+	for _, name := range strings.Split(listing, "\n") {
+		if name == "" {
+			continue
+		}
+		child := strings.TrimPrefix(key+"/"+strings.TrimSuffix(name, "/"), "/")
+		if rec.skipped(child) {
+			continue
+		}
+		if strings.HasSuffix(name, "/") {
+			if err := rec.crawl(ctx, endpoint, child, values); err != nil {
+				return err
+			}
+			continue
+		}
+		v, err := rec.get(ctx, endpoint, child)
+		if err != nil {
+			return err
+		}
+		values[child] = map[string]string{"value": v}
+	}
+	return nil
+}
+
+func (rec *Recorder) skipped(key string) bool {
+	skip := rec.Skip
+	if skip == nil {
+		skip = DefaultRecordSkip
+	}
+	for _, pattern := range skip {
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (rec *Recorder) get(ctx context.Context, endpoint *url.URL, key string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.JoinPath(key).String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if rec.Header == nil {
+		req.Header.Set("Metadata-Flavor", "Google")
+	} else {
+		req.Header = rec.Header.Clone()
+	}
+	client := rec.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to read metadata %q: %s", key, resp.Status)
+	}
+	return string(body), nil
+}
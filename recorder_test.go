@@ -0,0 +1,59 @@
+package metadataserver_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/minherz/metadataserver"
+)
+
+func TestRecorder(t *testing.T) {
+	want := map[string]string{
+		"project/project-id":                      "recorded-project",
+		"instance/zone":                           "projects/123/zones/us-central1-a",
+		"instance/attributes/enable-oslogin":      "TRUE",
+		"instance/service-accounts/default/email": "sa@recorded-project.iam.gserviceaccount.com",
+	}
+	handlers := map[string]metadataserver.Metadata{
+		"instance/service-accounts/default/token": func() string { return "secret" },
+	}
+	for k, v := range want {
+		handlers[k] = func() string { return v }
+	}
+	s, err := metadataserver.New(metadataserver.WithHandlers(handlers))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	ts := httptest.NewServer(s.HttpHandler())
+	defer ts.Close()
+
+	file := filepath.Join(t.TempDir(), "recorded.json")
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	rec := &metadataserver.Recorder{}
+	if err := rec.Record(context.Background(), ts.URL+metadataserver.DefaultEndpoint, f); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	f.Close()
+
+	c, err := metadataserver.NewConfigFromFile(file)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	got := make(map[string]string)
+	for k, h := range c.Handlers {
+		got[k] = h()
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("recorded metadata mismatch (-want +got):\n%s", diff)
+	}
+	if c.Endpoint != metadataserver.DefaultEndpoint {
+		t.Errorf("expected endpoint %q, got: %q", metadataserver.DefaultEndpoint, c.Endpoint)
+	}
+}
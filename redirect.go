@@ -0,0 +1,108 @@
+package metadataserver
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Redirect describes the redirect of the requests at the path.
+// The path is relative to the server's endpoint. The target is a path relative to the endpoint,
+// an absolute path that starts with "/" or a URL. The query of the request is kept.
+// Zero status means 301 (Moved Permanently).
+type Redirect struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Status int    `json:"status,omitempty"`
+}
+
+// WithRedirect sets a new server to redirect the requests at the path to the target with the status,
+// e.g. to simulate legacy paths. Supported statuses are 301, 302, 303, 307 and 308.
+//
+// Mind the order of options when use with [WithConfiguration] and [WithConfigFile].
+func WithRedirect(from, to string, status int) Option {
+	return func(s *Server) {
+		if s.config == nil {
+			s.config = NewConfiguration(DefaultConfigurationHandlers)
+		}
+		s.config.Redirects = append(s.config.Redirects, Redirect{From: from, To: to, Status: status})
+	}
+}
+
+// WithDirectoryRedirect sets a new server to redirect the requests of metadata directories
+// without the trailing slash to the path with the slash like the real metadata server does,
+// e.g. ".../instance" to ".../instance/". Zero status disables the redirect.
+//
+// Mind the order of options when use with [WithConfiguration] and [WithConfigFile].
+func WithDirectoryRedirect(status int) Option {
+	return func(s *Server) {
+		if s.config == nil {
+			s.config = NewConfiguration(DefaultConfigurationHandlers)
+		}
+		s.config.DirectoryRedirect = status
+	}
+}
+
+// checkRedirectStatus returns an error if the status is not a redirect status.
+func checkRedirectStatus(status int) error {
+	switch status {
+	case 0, http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return nil
+	}
+	return fmt.Errorf("status %d is not a redirect", status)
+}
+
+// newRedirects returns the redirects of the configuration by the keys of their paths.
+func (s *Server) newRedirects() (map[string]Redirect, error) {
+	if err := checkRedirectStatus(s.config.DirectoryRedirect); err != nil {
+		return nil, fmt.Errorf("invalid directory redirect: %w", err)
+	}
+	if len(s.config.Redirects) == 0 {
+		return nil, nil
+	}
+	redirects := make(map[string]Redirect, len(s.config.Redirects))
+	for _, rd := range s.config.Redirects {
+		if rd.To == "" {
+			return nil, fmt.Errorf("invalid redirect of %q: target is required", rd.From)
+		}
+		if err := checkRedirectStatus(rd.Status); err != nil {
+			return nil, fmt.Errorf("invalid redirect of %q: %w", rd.From, err)
+		}
+		redirects[normalizeKey(rd.From)] = rd
+	}
+	return redirects, nil
+}
+
+// redirect writes the redirect response if the request at the key is redirected.
+// It returns true if the response is written.
+func (s *Server) redirect(w http.ResponseWriter, r *http.Request, key string) bool {
+	var target string
+	var status int
+	if rd, ok := s.redirects[key]; ok {
+		target, status = rd.To, rd.Status
+		if !strings.HasPrefix(target, "/") && !strings.Contains(target, "://") {
+			target = s.config.Endpoint + "/" + target
+		}
+	} else if s.config.DirectoryRedirect != 0 && key != "" && !strings.HasSuffix(r.URL.Path, "/") && s.isDirectory(r, key) {
+		target, status = r.URL.Path+"/", s.config.DirectoryRedirect
+	} else {
+		return false
+	}
+	if status == 0 {
+		status = http.StatusMovedPermanently
+	}
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	w.Header().Set("Location", target)
+	w.WriteHeader(status)
+	return true
+}
+
+// isDirectory reports whether the key is a metadata directory and not a value.
+func (s *Server) isDirectory(r *http.Request, key string) bool {
+	if _, ok := s.storedValue(key); ok || s.matchRoute(r, key) != nil {
+		return false
+	}
+	return len(s.subtreeValues(r, key, false)) > 0
+}
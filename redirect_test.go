@@ -0,0 +1,90 @@
+package metadataserver_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestRedirects(t *testing.T) {
+	s, err := metadataserver.New(metadataserver.WithConfigFile("test/fixtures/config_redirects.json"))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	tests := []struct {
+		path     string
+		status   int
+		location string
+	}{
+		{"legacy/zone", http.StatusTemporaryRedirect, "/computeMetadata/v1/instance/zone"},
+		{"legacy/zone?alt=text", http.StatusTemporaryRedirect, "/computeMetadata/v1/instance/zone?alt=text"},
+		{"v0/zone", http.StatusMovedPermanently, "/computeMetadata/v1/instance/zone"},
+		{"instance", http.StatusMovedPermanently, "/computeMetadata/v1/instance/"},
+		{"instance/attributes?recursive=true", http.StatusMovedPermanently, "/computeMetadata/v1/instance/attributes/?recursive=true"},
+		{"instance/", http.StatusOK, ""},
+		{"instance/zone", http.StatusOK, ""},
+		{"missing", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/"+test.path, nil))
+			if rec.Code != test.status {
+				t.Errorf("expected status %d, got: %d", test.status, rec.Code)
+			}
+			if got := rec.Header().Get("Location"); got != test.location {
+				t.Errorf("expected Location %q, got: %q", test.location, got)
+			}
+		})
+	}
+}
+
+func TestRedirectPreservesHeaders(t *testing.T) {
+	s, err := metadataserver.New(
+		metadataserver.WithHandlers(map[string]metadataserver.Metadata{"instance/zone": func() string { return "us-central1-a" }}),
+		metadataserver.WithRedirect("legacy/zone", "instance/zone", http.StatusTemporaryRedirect),
+		metadataserver.WithMetadataToken("secret"),
+	)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	ts := httptest.NewServer(s.HttpHandler())
+	defer ts.Close()
+	req, err := http.NewRequest(http.MethodGet, ts.URL+metadataserver.DefaultEndpoint+"/legacy/zone", nil)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer secret")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK || string(body) != "us-central1-a" {
+		t.Errorf("expected status %d with %q, got: %d %q", http.StatusOK, "us-central1-a", res.StatusCode, body)
+	}
+}
+
+func TestRedirectErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		option metadataserver.Option
+		want   string
+	}{
+		{"status", metadataserver.WithRedirect("a", "b", http.StatusOK), `invalid redirect of "a": status 200 is not a redirect`},
+		{"target", metadataserver.WithRedirect("a", "", 0), `invalid redirect of "a": target is required`},
+		{"directory", metadataserver.WithDirectoryRedirect(http.StatusNotFound), "invalid directory redirect: status 404 is not a redirect"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := metadataserver.New(test.option)
+			if err == nil || err.Error() != test.want {
+				t.Errorf("expected error %q, got: %v", test.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package metadataserver
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultConfigWatchInterval is the interval of checking the watched configuration file for changes.
+const DefaultConfigWatchInterval = time.Second
+
+// ErrConfigNotWatched indicates that the server was not created with [WithConfigWatch].
+var ErrConfigNotWatched error = errors.New("configuration file is not watched")
+
+// WithConfigWatch sets a new server with the configuration file like [WithConfigFile]
+// and reloads the metadata when the file changes while the server is running.
+// The file is checked at the interval; zero interval means [DefaultConfigWatchInterval].
+//
+// The watcher polls the path instead of watching the directory with file system notifications.
+// It resolves the symlinks of the path on each check, so it detects files that are replaced by rename
+// and the symlink swap that Kubernetes uses to update mounted ConfigMaps, when "config.json" links to
+// "..data/config.json" and "..data" is relinked to a new directory. An update is picked up within the interval.
+//
+// The reload replaces the metadata of the server, including the project, the zone, the service accounts and the aliases,
+// with the metadata of the file. Handlers that are set in code are discarded except the stateful handlers
+// set with [WithHandler], which keep their state and are closed when the server stops.
+// Other settings, e.g. the port or the profiles, take effect after the server is created again.
+// If the new file is invalid, the server logs the error and keeps serving the previous metadata.
+//
+// Mind the order of options when use with [WithConfiguration], [WithAddress], [WithPort] and [WithHandlers].
+func WithConfigWatch(path string, interval time.Duration) Option {
+	return func(s *Server) {
+		WithConfigFile(path)(s)
+		if interval <= 0 {
+			interval = DefaultConfigWatchInterval
+		}
+		s.configPath = path
+		s.configWatchInterval = interval
+		s.configVersion, _ = statConfigFile(path)
+	}
+}
+
+// configFileVersion identifies the content of the configuration file without reading it.
+type configFileVersion struct {
+	// target is the path of the file with all symlinks resolved
+	target  string
+	modTime time.Time
+	size    int64
+}
+
+// statConfigFile returns the version of the configuration file at the path.
+func statConfigFile(path string) (configFileVersion, error) {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return configFileVersion{}, err
+	}
+	fi, err := os.Stat(target)
+	if err != nil {
+		return configFileVersion{}, err
+	}
+	return configFileVersion{target: target, modTime: fi.ModTime(), size: fi.Size()}, nil
+}
+
+// ReloadConfig reloads the metadata from the configuration file set with [WithConfigWatch].
+// The server calls it when the file changes, so it is needed only to reload the metadata immediately.
+// It returns [ErrConfigNotWatched] if the server does not watch a configuration file
+// and [ConfigError] if the changed file cannot be served; the server keeps serving the previous metadata then.
+// It is safe to call ReloadConfig while the server is running.
+func (s *Server) ReloadConfig() error {
+	if s.configPath == "" {
+		return ErrConfigNotWatched
+	}
+	c, err := NewConfigFromFile(s.configPath)
+	if err != nil {
+		return configError(err)
+	}
+	if err := c.applyProject(); err != nil {
+		return configError(err)
+	}
+	if err := c.applyZone(); err != nil {
+		return configError(err)
+	}
+	c.SigningKey = s.config.SigningKey
+	if err := c.applyServiceAccounts(s.now); err != nil {
+		return configError(err)
+	}
+	// the stateful handlers set in code are initialized by Start and closed by Stop, so they survive the reload;
+	// the counters of the file are replaced like the rest of its metadata
+	s.mu.RLock()
+	for k, h := range s.config.StatefulHandlers {
+		if s.config.sources[k] == "counter" {
+			continue
+		}
+		if c.StatefulHandlers == nil {
+			c.StatefulHandlers = make(map[string]Handler)
+		}
+		c.StatefulHandlers[k] = h
+	}
+	s.mu.RUnlock()
+	var routes routeTrie
+	if err := s.insertRoutes(&routes, c); err != nil {
+		return configError(err)
+	}
+	aliases, err := newAliases(c.Aliases, &routes)
+	if err != nil {
+		return configError(err)
+	}
+	s.mu.Lock()
+	s.config.ProjectID = c.ProjectID
+	s.config.ProjectNumber = c.ProjectNumber
+	s.config.Zone = c.Zone
+	s.config.ServiceAccounts = c.ServiceAccounts
+	s.config.Aliases = c.Aliases
+	s.config.Handlers = c.Handlers
+	s.config.FuncHandlers = c.FuncHandlers
+	s.config.BytesHandlers = c.BytesHandlers
+	s.config.ResponseHandlers = c.ResponseHandlers
+	s.config.StatefulHandlers = c.StatefulHandlers
+	s.config.StreamHandlers = c.StreamHandlers
+	s.config.literals = c.literals
+	s.config.sources = c.sources
+	s.config.envVars = c.envVars
+	s.config.files = c.files
+	s.config.parsed = c.parsed
+	s.routes.replace(&routes)
+	s.aliases.Store(&aliases)
+	s.mu.Unlock()
+	s.logger.InfoContext(context.Background(), "configuration is reloaded", slog.String("file", s.configPath), slog.Int("routes", len(s.Routes())))
+	return nil
+}
+
+// watchConfig reloads the configuration when the version of the watched file changes until done is closed.
+// Missing files are ignored because the file can be briefly absent while it is replaced.
+func (s *Server) watchConfig(done <-chan struct{}, stopped chan<- struct{}) {
+	defer close(stopped)
+	ctx := context.Background()
+	last := s.configVersion
+	ticker := time.NewTicker(s.configWatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		v, err := statConfigFile(s.configPath)
+		if err != nil || v == last {
+			continue
+		}
+		last = v
+		if err := s.ReloadConfig(); err != nil {
+			s.logger.ErrorContext(ctx, "failed to reload configuration", slog.String("file", s.configPath), slog.String("error", err.Error()))
+		}
+	}
+}
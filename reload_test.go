@@ -0,0 +1,289 @@
+package metadataserver_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/minherz/metadataserver"
+)
+
+func TestReloadConfig(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(name, []byte(`{"metadata": {"a": {"value": "one"}, "b": {"value": "two"}}}`), 0o600); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	s, err := metadataserver.New(metadataserver.WithConfigWatch(name, 0))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if got, _ := s.GetValue("a"); got != "one" {
+		t.Errorf("expected %q, got: %q", "one", got)
+	}
+
+	data := `{"projectId": "reloaded-project", "metadata": {"a": {"value": "three"}, "c": {"template": "{{ .Value \"a\" }}!"}}}`
+	if err := os.WriteFile(name, []byte(data), 0o600); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if err := s.ReloadConfig(); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	tests := []struct {
+		path string
+		want string
+		ok   bool
+	}{
+		{"a", "three", true},
+		{"b", "", false},
+		{"c", "three!", true},
+		{"project/project-id", "reloaded-project", true},
+	}
+	for _, test := range tests {
+		if got, ok := s.GetValue(test.path); got != test.want || ok != test.ok {
+			t.Errorf("%s: expected %q, %v, got: %q, %v", test.path, test.want, test.ok, got, ok)
+		}
+	}
+
+	if err := os.WriteFile(name, []byte(`{"metadata": `), 0o600); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if err := s.ReloadConfig(); err == nil {
+		t.Errorf("expected error, got nil")
+	}
+	if got, _ := s.GetValue("a"); got != "three" {
+		t.Errorf("expected previous value %q after failed reload, got: %q", "three", got)
+	}
+}
+
+func TestReloadConfigNotWatched(t *testing.T) {
+	s, err := metadataserver.New(metadataserver.WithConfigFile("test/fixtures/config_handlers.json"))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if err := s.ReloadConfig(); !errors.Is(err, metadataserver.ErrConfigNotWatched) {
+		t.Errorf("expected %v, got: %v", metadataserver.ErrConfigNotWatched, err)
+	}
+}
+
+// TestConfigWatchConfigMap simulates the update of the ConfigMap mounted as a volume in Kubernetes:
+// the file is a symlink to "..data/config.json" and "..data" is atomically relinked to a new directory.
+// writeConfigMap writes the configuration file to the version directory and swaps the "..data" symlink to it
+// like Kubernetes updates mounted ConfigMaps. It returns the path of the "config.json" symlink.
+func writeConfigMap(t *testing.T, dir, version, data string) string {
+	t.Helper()
+	if err := os.Mkdir(filepath.Join(dir, version), 0o755); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, version, "config.json"), []byte(data), 0o600); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if err := os.Symlink(version, filepath.Join(dir, "..data_tmp")); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if err := os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	name := filepath.Join(dir, "config.json")
+	if _, err := os.Lstat(name); errors.Is(err, os.ErrNotExist) {
+		if err := os.Symlink(filepath.Join("..data", "config.json"), name); err != nil {
+			t.Fatalf("expected no errors, got: %v", err)
+		}
+	}
+	return name
+}
+
+func TestConfigWatchConfigMap(t *testing.T) {
+	dir := t.TempDir()
+	writeVersion := func(version, value string) string {
+		t.Helper()
+		return writeConfigMap(t, dir, version, `{"metadata": {"instance/attributes/version": {"value": "`+value+`"}}}`)
+	}
+	name := writeVersion("..2026_10_15_10_00_00.1", "v1")
+
+	s, err := metadataserver.New(
+		metadataserver.WithConfigWatch(name, 10*time.Millisecond),
+		metadataserver.WithAddress("127.0.0.1"),
+		metadataserver.WithPort(0),
+	)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	defer s.Stop(context.Background())
+	if got, _ := s.GetValue("instance/attributes/version"); got != "v1" {
+		t.Errorf("expected %q, got: %q", "v1", got)
+	}
+
+	writeVersion("..2026_10_15_10_05_00.2", "v2")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, _ := s.GetValue("instance/attributes/version")
+		if got == "v2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %q after the ConfigMap update, got: %q", "v2", got)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConfigWatchConfigMapProject(t *testing.T) {
+	dir := t.TempDir()
+	writeVersion := func(version, project, zone, email, alias string) string {
+		t.Helper()
+		data := `{"projectId": "` + project + `", "zone": "` + zone + `", "serviceAccounts": [{"email": "` + email + `"}],
+			"aliases": {"` + alias + `": "project/project-id"}}`
+		return writeConfigMap(t, dir, version, data)
+	}
+	name := writeVersion("..2026_10_15_10_00_00.1", "first-project", "us-central1-a", "first@first-project.iam.gserviceaccount.com", "first-alias")
+	s, err := metadataserver.New(
+		metadataserver.WithConfigWatch(name, 10*time.Millisecond),
+		metadataserver.WithAddress("127.0.0.1"),
+		metadataserver.WithPort(0),
+	)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	defer s.Stop(context.Background())
+	if got, _ := s.GetValue("first-alias"); got != "first-project" {
+		t.Errorf("expected %q, got: %q", "first-project", got)
+	}
+
+	writeVersion("..2026_10_15_10_05_00.2", "second-project", "europe-west1-b", "second@second-project.iam.gserviceaccount.com", "second-alias")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, _ := s.GetValue("project/project-id")
+		if got == "second-project" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %q after the ConfigMap update, got: %q", "second-project", got)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"second-alias", "second-project"},
+		{"instance/zone", "projects/" + strconv.FormatInt(metadataserver.DefaultProjectNumber, 10) + "/zones/europe-west1-b"},
+		{"instance/region", "projects/" + strconv.FormatInt(metadataserver.DefaultProjectNumber, 10) + "/regions/europe-west1"},
+		{"instance/service-accounts/default/email", "second@second-project.iam.gserviceaccount.com"},
+	}
+	for _, test := range tests {
+		if got, _ := s.GetValue(test.path); got != test.want {
+			t.Errorf("%s: expected %q, got: %q", test.path, test.want, got)
+		}
+	}
+	for _, path := range []string{"first-alias", "instance/service-accounts/first@first-project.iam.gserviceaccount.com/email"} {
+		if got, ok := s.GetValue(path); ok {
+			t.Errorf("%s: expected the metadata of the previous file to be removed, got: %q", path, got)
+		}
+	}
+	if c := s.Configuration(); c.ProjectID != "second-project" || c.Zone != "europe-west1-b" {
+		t.Errorf("expected the configuration of the reloaded file, got project %q and zone %q", c.ProjectID, c.Zone)
+	}
+}
+
+func TestConfigurationSnapshotDuringReload(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(name, []byte(`{"metadata": {"a": {"value": "one"}, "b": {"value": "one"}}}`), 0o600); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	s, err := metadataserver.New(metadataserver.WithConfigWatch(name, 0))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if err := os.WriteFile(name, []byte(`{"metadata": {"a": {"value": "two"}, "b": {"value": "two"}}}`), 0o600); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			if err := s.ReloadConfig(); err != nil {
+				t.Errorf("expected no errors, got: %v", err)
+				return
+			}
+		}
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		c := s.Configuration()
+		if a, b := c.Handlers["a"](), c.Handlers["b"](); a != b {
+			t.Fatalf("expected consistent snapshot, got a=%q and b=%q", a, b)
+		}
+	}
+
+	c := s.Configuration()
+	delete(c.Handlers, "a")
+	if got, ok := s.GetValue("a"); got != "two" || !ok {
+		t.Errorf("expected changes of the snapshot not to affect the server, got: %q, %v", got, ok)
+	}
+}
+
+func TestReloadConfigKeepsStatefulHandlers(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(name, []byte(`{"metadata": {"a": {"value": "one"}, "visits": {"counter": {}}}}`), 0o600); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	h := &counterHandler{}
+	s, err := metadataserver.New(
+		metadataserver.WithConfigWatch(name, time.Millisecond),
+		metadataserver.WithAddress("127.0.0.1"),
+		metadataserver.WithPort(freePort()),
+		metadataserver.WithHandler("instance/attributes/counter", h))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if got, _ := s.GetValue("instance/attributes/counter"); got != "1" {
+		t.Errorf("expected %q, got: %q", "1", got)
+	}
+	// reloads run concurrently with Stop to detect races with closing the handlers
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			s.ReloadConfig()
+		}
+	}()
+	if err := os.WriteFile(name, []byte(`{"metadata": {"a": {"value": "two"}}}`), 0o600); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if err := s.ReloadConfig(); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if got, _ := s.GetValue("instance/attributes/counter"); got != "2" {
+		t.Errorf("expected the handler to keep its state, got: %q", got)
+	}
+	if _, ok := s.GetValue("visits"); ok {
+		t.Errorf("expected the counter of the previous file to be removed")
+	}
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	<-done
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if diff := cmp.Diff([]string{"init", "close"}, h.calls); diff != "" {
+		t.Errorf("lifecycle calls mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,219 @@
+package metadataserver
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Exchange describes a recorded request and the response that was returned for it.
+type Exchange struct {
+	Method string
+	// URI is the request path with the query, e.g. "/computeMetadata/v1/instance/?recursive=true"
+	URI    string
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// WithReplay sets a new server to respond to requests with the recorded responses.
+// A request matches an exchange with the same method and URI. If the same request was recorded
+// several times, the responses are replayed in the recorded order and the last one is repeated.
+// Requests that do not match any exchange are served as usual.
+func WithReplay(exchanges []Exchange) Option {
+	return func(s *Server) {
+		r := &replayer{exchanges: make(map[string][]Exchange)}
+		for _, e := range exchanges {
+			k := e.Method + " " + e.URI
+			r.exchanges[k] = append(r.exchanges[k], e)
+		}
+		s.replayer = r
+	}
+}
+
+// replayer keeps the recorded exchanges and the number of times each of them was replayed.
+type replayer struct {
+	mu        sync.Mutex
+	exchanges map[string][]Exchange
+	replayed  map[string]int
+}
+
+func (r *replayer) next(method, uri string) (Exchange, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	k := method + " " + uri
+	list := r.exchanges[k]
+	if len(list) == 0 {
+		return Exchange{}, false
+	}
+	if r.replayed == nil {
+		r.replayed = make(map[string]int)
+	}
+	i := min(r.replayed[k], len(list)-1)
+	r.replayed[k]++
+	return list[i], true
+}
+
+func (s *Server) replayTraffic(next http.Handler) http.Handler {
+	if s.replayer == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e, ok := s.replayer.next(r.Method, r.URL.RequestURI())
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !validStatus(e.Status) {
+			s.handlerLogger.ErrorContext(r.Context(), "recorded response has invalid status",
+				slog.String("path", r.URL.Path), slog.Int("status", e.Status))
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		s.handlerLogger.DebugContext(r.Context(), "recorded response is replayed",
+			slog.String("path", r.URL.Path), slog.Int("status", e.Status))
+		h := w.Header()
+		for k, v := range e.Header {
+			// the body is kept decoded and its length is set when it is written
+			if k == "Content-Encoding" || k == "Content-Length" || k == "Transfer-Encoding" {
+				continue
+			}
+			h[k] = v
+		}
+		w.WriteHeader(e.Status)
+		w.Write(e.Body)
+	})
+}
+
+// ParseHAR reads exchanges from the HTTP Archive (HAR) file.
+// It returns an error if the response status of an entry is outside of 100-999,
+// e.g. 0 that browsers record for aborted requests.
+func ParseHAR(r io.Reader) ([]Exchange, error) {
+	var har struct {
+		Log struct {
+			Entries []struct {
+				Request struct {
+					Method string `json:"method"`
+					URL    string `json:"url"`
+				} `json:"request"`
+				Response struct {
+					Status  int `json:"status"`
+					Headers []struct {
+						Name  string `json:"name"`
+						Value string `json:"value"`
+					} `json:"headers"`
+					Content struct {
+						Text     string `json:"text"`
+						Encoding string `json:"encoding"`
+					} `json:"content"`
+				} `json:"response"`
+			} `json:"entries"`
+		} `json:"log"`
+	}
+	if err := json.NewDecoder(r).Decode(&har); err != nil {
+		return nil, err
+	}
+	exchanges := make([]Exchange, 0, len(har.Log.Entries))
+	for i, entry := range har.Log.Entries {
+		u, err := url.Parse(entry.Request.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid URL of HAR entry %d: %w", i, err)
+		}
+		if !validStatus(entry.Response.Status) {
+			return nil, fmt.Errorf("invalid status %d of HAR entry %d", entry.Response.Status, i)
+		}
+		e := Exchange{
+			Method: entry.Request.Method,
+			URI:    u.RequestURI(),
+			Status: entry.Response.Status,
+			Header: make(http.Header),
+			Body:   []byte(entry.Response.Content.Text),
+		}
+		for _, h := range entry.Response.Headers {
+			e.Header.Add(h.Name, h.Value)
+		}
+		if entry.Response.Content.Encoding == "base64" {
+			if e.Body, err = base64.StdEncoding.DecodeString(entry.Response.Content.Text); err != nil {
+				return nil, fmt.Errorf("invalid content of HAR entry %d: %w", i, err)
+			}
+		}
+		exchanges = append(exchanges, e)
+	}
+	return exchanges, nil
+}
+
+// ParseCaptures reads exchanges from the captures that the server writes when it is set up with [WithCapture].
+func ParseCaptures(r io.Reader) ([]Exchange, error) {
+	br := bufio.NewReader(r)
+	var exchanges []Exchange
+	for {
+		line, err := readNonEmptyLine(br)
+		if errors.Is(err, io.EOF) {
+			return exchanges, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, err := time.Parse(time.RFC3339Nano, line); err != nil {
+			return nil, fmt.Errorf("invalid capture time %q: %w", line, err)
+		}
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			return nil, fmt.Errorf("invalid captured request: %w", err)
+		}
+		if _, err := io.Copy(io.Discard, req.Body); err != nil {
+			return nil, err
+		}
+		if err := skipEmptyLines(br); err != nil {
+			return nil, fmt.Errorf("missing captured response: %w", err)
+		}
+		resp, err := http.ReadResponse(br, req)
+		if err != nil {
+			return nil, fmt.Errorf("invalid captured response: %w", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		exchanges = append(exchanges, Exchange{
+			Method: req.Method,
+			URI:    req.URL.RequestURI(),
+			Status: resp.StatusCode,
+			Header: resp.Header,
+			Body:   body,
+		})
+	}
+}
+
+func readNonEmptyLine(br *bufio.Reader) (string, error) {
+	if err := skipEmptyLines(br); err != nil {
+		return "", err
+	}
+	line, err := br.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func skipEmptyLines(br *bufio.Reader) error {
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			return err
+		}
+		if b[0] != '\n' && b[0] != '\r' {
+			return nil
+		}
+		br.ReadByte()
+	}
+}
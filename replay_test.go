@@ -0,0 +1,109 @@
+package metadataserver_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestReplayHAR(t *testing.T) {
+	f, err := os.Open("test/fixtures/replay.har")
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	defer f.Close()
+	exchanges, err := metadataserver.ParseHAR(f)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	s, err := metadataserver.New(metadataserver.WithReplay(exchanges))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"/instance/zone", http.StatusOK, "projects/123/zones/europe-west1-b"},
+		{"/instance/service-accounts/default/token", http.StatusServiceUnavailable, ""},
+		{"/instance/service-accounts/default/token", http.StatusOK, `{"access_token":"token"}`},
+		{"/instance/service-accounts/default/token", http.StatusOK, `{"access_token":"token"}`},
+		{"/project/project-id", http.StatusOK, "test-project-id"},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+test.path, nil))
+		if rec.Code != test.wantStatus || rec.Body.String() != test.wantBody {
+			t.Errorf("expected %d %q at %s, got: %d %q", test.wantStatus, test.wantBody, test.path, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestReplayCaptures(t *testing.T) {
+	var captured bytes.Buffer
+	s, err := metadataserver.New(
+		metadataserver.WithCapture(0, &captured),
+		metadataserver.WithHandlers(map[string]metadataserver.Metadata{
+			"instance/hostname": func() string { return "captured-host" },
+		}))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	for _, p := range []string{"/instance/hostname", "/instance/missing"} {
+		s.HttpHandler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+p, nil))
+	}
+
+	exchanges, err := metadataserver.ParseCaptures(&captured)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if len(exchanges) != 2 {
+		t.Fatalf("expected 2 exchanges, got: %d", len(exchanges))
+	}
+	replay, err := metadataserver.New(metadataserver.WithReplay(exchanges))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	ts := httptest.NewServer(replay.HttpHandler())
+	defer ts.Close()
+	resp, err := http.Get(ts.URL + metadataserver.DefaultEndpoint + "/instance/hostname")
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "captured-host" {
+		t.Errorf("expected response %q, got: %q", "captured-host", string(body))
+	}
+	if got := getStatus(t, ts.URL+metadataserver.DefaultEndpoint+"/instance/missing"); got != http.StatusNotFound {
+		t.Errorf("expected status %d, got: %d", http.StatusNotFound, got)
+	}
+}
+
+func TestReplayInvalidStatus(t *testing.T) {
+	for _, status := range []int{0, 99, 1000} {
+		har := fmt.Sprintf(`{"log": {"entries": [{"request": {"method": "GET", "url": "http://metadata.google.internal/computeMetadata/v1/instance/zone"}, "response": {"status": %d}}]}}`, status)
+		if _, err := metadataserver.ParseHAR(strings.NewReader(har)); err == nil {
+			t.Errorf("status %d: expected error, got nil", status)
+		}
+	}
+	s, err := metadataserver.New(metadataserver.WithReplay([]metadataserver.Exchange{
+		{Method: http.MethodGet, URI: metadataserver.DefaultEndpoint + "/instance/zone"},
+	}))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/instance/zone", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got: %d", http.StatusInternalServerError, rec.Code)
+	}
+}
@@ -0,0 +1,82 @@
+package metadataserver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Resender re-sends recorded requests to a metadata server and compares the responses with the recorded ones.
+// Use it to validate that a configuration faithfully reproduces the metadata of a real server.
+type Resender struct {
+	// Client is used to send requests to the metadata server. [http.DefaultClient] is used if nil.
+	Client *http.Client
+	// Header is added to each request. It defaults to "Metadata-Flavor: Google" if nil.
+	Header http.Header
+}
+
+// ExchangeDiff describes the difference between the recorded response and the response of the server.
+type ExchangeDiff struct {
+	Method string
+	URI    string
+	// WantStatus and WantBody describe the recorded response
+	WantStatus int
+	WantBody   []byte
+	// GotStatus and GotBody describe the response of the server
+	GotStatus int
+	GotBody   []byte
+}
+
+// String describes the difference in one line.
+func (d ExchangeDiff) String() string {
+	if d.GotStatus != d.WantStatus {
+		return fmt.Sprintf("%s %s: got status %d, want %d", d.Method, d.URI, d.GotStatus, d.WantStatus)
+	}
+	return fmt.Sprintf("%s %s: got body %q, want %q", d.Method, d.URI, d.GotBody, d.WantBody)
+}
+
+// Resend sends the requests of the exchanges to the server at the base URL, e.g. "http://127.0.0.1:8080",
+// and returns the differences between the recorded responses and the responses of the server.
+// The responses are compared by the status and the body.
+func (rs *Resender) Resend(ctx context.Context, baseURL string, exchanges []Exchange) ([]ExchangeDiff, error) {
+	client := rs.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	var diffs []ExchangeDiff
+	for _, e := range exchanges {
+		req, err := http.NewRequestWithContext(ctx, e.Method, baseURL+e.URI, nil)
+		if err != nil {
+			return nil, err
+		}
+		if rs.Header == nil {
+			req.Header.Set("Metadata-Flavor", "Google")
+		} else {
+			req.Header = rs.Header.Clone()
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != e.Status || !bytes.Equal(body, e.Body) {
+			diffs = append(diffs, ExchangeDiff{
+				Method:     e.Method,
+				URI:        e.URI,
+				WantStatus: e.Status,
+				WantBody:   e.Body,
+				GotStatus:  resp.StatusCode,
+				GotBody:    body,
+			})
+		}
+	}
+	return diffs, nil
+}
@@ -0,0 +1,49 @@
+package metadataserver_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestResend(t *testing.T) {
+	f, err := os.Open("test/fixtures/replay.har")
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	defer f.Close()
+	exchanges, err := metadataserver.ParseHAR(f)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	s, err := metadataserver.New(metadataserver.WithHandlers(map[string]metadataserver.Metadata{
+		"instance/zone": func() string { return "projects/123/zones/europe-west1-b" },
+		"instance/service-accounts/default/token": func() string { return `{"access_token":"other"}` },
+	}))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	server := httptest.NewServer(s.HttpHandler())
+	defer server.Close()
+
+	rs := &metadataserver.Resender{}
+	diffs, err := rs.Resend(context.Background(), server.URL, exchanges)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	want := []string{
+		"GET /computeMetadata/v1/instance/service-accounts/default/token: got status 200, want 503",
+		`GET /computeMetadata/v1/instance/service-accounts/default/token: got body "{\"access_token\":\"other\"}", want "{\"access_token\":\"token\"}"`,
+	}
+	if len(diffs) != len(want) {
+		t.Fatalf("expected %d differences, got: %v", len(want), diffs)
+	}
+	for i, d := range diffs {
+		if got := d.String(); got != want[i] {
+			t.Errorf("difference %d: expected %q, got: %q", i, want[i], got)
+		}
+	}
+}
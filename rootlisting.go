@@ -0,0 +1,72 @@
+package metadataserver
+
+import (
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// WithRootListing sets a new server to respond to the requests of "/" and of the directories above the endpoint
+// with the listing of the directories under them like the real metadata server lists the available API versions,
+// e.g. "computeMetadata/" at "/" and "v1/" at "/computeMetadata/" for the default endpoint.
+// The path prefixes of the profiles are listed at "/" too, so discovery clients that start at "/" find all served roots.
+//
+// Mind the order of options when use with [WithConfiguration] and [WithConfigFile].
+func WithRootListing() Option {
+	return func(s *Server) {
+		if s.config == nil {
+			s.config = NewConfiguration(DefaultConfigurationHandlers)
+		}
+		s.config.RootListing = true
+	}
+}
+
+// rootListing returns the names of the directories under the path that lead to the endpoint
+// or, if the request is not served by a profile, to the path prefixes of the profiles.
+// It returns nil if the path is not a directory above them.
+func (s *Server) rootListing(r *http.Request) []string {
+	dir := normalizeKey(r.URL.Path)
+	roots := []string{normalizeKey(s.config.Endpoint)}
+	if requestProfile(r) == nil {
+		for _, p := range s.profiles {
+			if p.PathPrefix != "" {
+				roots = append(roots, normalizeKey(p.PathPrefix))
+			}
+		}
+	}
+	names := make(map[string]bool)
+	for _, root := range roots {
+		rest := root
+		if dir != "" {
+			var ok bool
+			if rest, ok = strings.CutPrefix(root, dir+"/"); !ok {
+				continue
+			}
+		}
+		name, _, _ := strings.Cut(rest, "/")
+		if name != "" {
+			names[name+"/"] = true
+		}
+	}
+	listing := make([]string, 0, len(names))
+	for name := range names {
+		listing = append(listing, name)
+	}
+	sort.Strings(listing)
+	return listing
+}
+
+// serveRootListing writes the listing of the directories above the endpoint if the root listing is enabled.
+// It returns false if the path is not a directory above the endpoint.
+func (s *Server) serveRootListing(w http.ResponseWriter, r *http.Request) bool {
+	if !s.config.RootListing || !strings.HasSuffix(r.URL.Path, "/") {
+		return false
+	}
+	listing := s.rootListing(r)
+	if len(listing) == 0 {
+		return false
+	}
+	io.WriteString(w, strings.Join(listing, "\n")+"\n")
+	return true
+}
@@ -0,0 +1,67 @@
+package metadataserver_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestRootListing(t *testing.T) {
+	s, err := metadataserver.New(
+		metadataserver.WithRootListing(),
+		metadataserver.WithProfiles(
+			metadataserver.Profile{Name: "vm-1", PathPrefix: "/vm-1"},
+			metadataserver.Profile{Name: "vm-2", PathPrefix: "/instances/vm-2"},
+			metadataserver.Profile{Name: "host", Hosts: []string{"vm-3.internal"}},
+		),
+	)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		want   string
+	}{
+		{"root", "/", http.StatusOK, "computeMetadata/\ninstances/\nvm-1/\n"},
+		{"endpoint parent", "/computeMetadata/", http.StatusOK, "v1/\n"},
+		{"profile parent", "/instances/", http.StatusOK, "vm-2/\n"},
+		{"profile root", "/vm-1/", http.StatusOK, "computeMetadata/\n"},
+		{"profile endpoint parent", "/instances/vm-2/computeMetadata/", http.StatusOK, "v1/\n"},
+		{"endpoint", metadataserver.DefaultEndpoint, http.StatusOK, "ok"},
+		{"without slash", "/computeMetadata", http.StatusNotFound, ""},
+		{"unknown", "/unknown/", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, test.path, nil))
+			if rec.Code != test.status {
+				t.Fatalf("expected status %d, got: %d", test.status, rec.Code)
+			}
+			if test.status != http.StatusOK {
+				return
+			}
+			body, _ := io.ReadAll(rec.Body)
+			if got := string(body); got != test.want {
+				t.Errorf("expected %q, got: %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestRootListingDisabled(t *testing.T) {
+	s, err := metadataserver.New()
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got: %d", http.StatusNotFound, rec.Code)
+	}
+}
@@ -0,0 +1,461 @@
+package metadataserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// wildcardSegment matches any single segment of the metadata path.
+// Named segments like "{email}" are stored in the trie as wildcards.
+const wildcardSegment = "*"
+
+// routeParam is a named segment of the route's key, e.g. "{email}" in "instance/service-accounts/{email}/token".
+type routeParam struct {
+	index int
+	name  string
+}
+
+// paramName returns the name of the named segment.
+func paramName(seg string) (string, bool) {
+	if len(seg) > 2 && seg[0] == '{' && seg[len(seg)-1] == '}' {
+		return seg[1 : len(seg)-1], true
+	}
+	return "", false
+}
+
+// bufferPool keeps buffers that are used to render directory responses.
+var bufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// maxPooledBufferSize is the capacity above which buffers are not returned to the pool
+// so occasional large responses do not keep memory.
+const maxPooledBufferSize = 64 << 10
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+// routeTrie maps metadata paths to routes.
+// Each node represents a path segment. Nodes with children are directories.
+// The root is replaced atomically when the configuration is reloaded.
+type routeTrie struct {
+	root atomic.Pointer[trieNode]
+}
+
+type trieNode struct {
+	children map[string]*trieNode
+	route    *route
+}
+
+// insert adds the route at the key. Named segments of the key are registered as parameters of the route.
+// It returns the route that was registered at the same path before and is replaced, or nil.
+func (t *routeTrie) insert(key string, rt *route) *route {
+	n := t.root.Load()
+	if n == nil {
+		n = &trieNode{}
+		t.root.Store(n)
+	}
+	if key != "" {
+		for i, seg := range strings.Split(key, "/") {
+			if name, ok := paramName(seg); ok {
+				rt.params = append(rt.params, routeParam{index: i, name: name})
+				seg = wildcardSegment
+			}
+			if n.children == nil {
+				n.children = make(map[string]*trieNode)
+			}
+			child, ok := n.children[seg]
+			if !ok {
+				child = &trieNode{}
+				n.children[seg] = child
+			}
+			n = child
+		}
+	}
+	prev := n.route
+	n.route = rt
+	return prev
+}
+
+// node returns the node at the key. Exact segments take precedence over wildcards.
+func (t *routeTrie) node(key string) *trieNode {
+	n := t.rootNode()
+	if key == "" {
+		return n
+	}
+	return n.match(key, true)
+}
+
+// rootNode returns the root node of the trie. The root of the empty trie has no children.
+func (t *routeTrie) rootNode() *trieNode {
+	if n := t.root.Load(); n != nil {
+		return n
+	}
+	return &trieNode{}
+}
+
+// replace replaces the routes of the trie with the routes of the other trie.
+func (t *routeTrie) replace(other *routeTrie) {
+	t.root.Store(other.rootNode())
+}
+
+// match returns the node at the key relative to n.
+// The key is matched segment by segment without splitting it to avoid allocations.
+func (n *trieNode) match(key string, more bool) *trieNode {
+	if !more {
+		return n
+	}
+	seg, rest, more := strings.Cut(key, "/")
+	if child, ok := n.children[seg]; ok {
+		if found := child.match(rest, more); found != nil {
+			return found
+		}
+	}
+	if child, ok := n.children[wildcardSegment]; ok {
+		return child.match(rest, more)
+	}
+	return nil
+}
+
+// lookup returns the route at the key or nil if no route is registered.
+func (t *routeTrie) lookup(key string) *route {
+	if n := t.node(key); n != nil {
+		return n.route
+	}
+	return nil
+}
+
+// matchRoute returns the route that serves the metadata at the key or nil if no route is registered.
+// Routes of the instance profile that serves the request take precedence.
+// If the key matches a route with wildcards, the returned route is a copy with the key
+// and the values of the route's named segments are set as path values of the request (see [http.Request.PathValue]).
+func (s *Server) matchRoute(r *http.Request, key string) *route {
+	if p := requestProfile(r); p != nil {
+		if rt := p.routes.match(r, key); rt != nil {
+			return rt
+		}
+	}
+	return s.routes.match(r, key)
+}
+
+func (t *routeTrie) match(r *http.Request, key string) *route {
+	rt := t.lookup(key)
+	if rt == nil || rt.key == key {
+		return rt
+	}
+	if len(rt.params) > 0 {
+		segs := strings.Split(key, "/")
+		for _, p := range rt.params {
+			r.SetPathValue(p.name, segs[p.index])
+		}
+	}
+	m := *rt
+	m.key = key
+	return &m
+}
+
+// walk calls fn for each route in the subtree of the node with the key relative to the node.
+func (n *trieNode) walk(prefix string, fn func(key string, rt *route)) {
+	if n.route != nil {
+		fn(prefix, n.route)
+	}
+	for seg, child := range n.children {
+		child.walk(path.Join(prefix, seg), fn)
+	}
+}
+
+// shadowing calls fn for each route that has other routes under it with the route under it that has the smallest key.
+// The value of such route hides the directory listing of the metadata under it.
+func (n *trieNode) shadowing(fn func(rt, under *route)) {
+	if n.route != nil {
+		var under *route
+		for _, child := range n.children {
+			child.walk("", func(_ string, rt *route) {
+				if under == nil || rt.key < under.key {
+					under = rt
+				}
+			})
+		}
+		if under != nil {
+			fn(n.route, under)
+		}
+	}
+	for _, child := range n.children {
+		child.shadowing(fn)
+	}
+}
+
+// routeConflicts collects the keys that are served at the same path, e.g. "instance/zone" and "/instance/zone/"
+// or "instance/{a}" and "instance/{b}", and the keys which values hide the metadata under them, e.g. "instance" and "instance/zone".
+// The real metadata server cannot serve a value and a directory at the same path.
+// Only the keys of the same map of handlers conflict: a route of a later map replaces the route at the same path.
+type routeConflicts struct {
+	// keys keep the configured keys of the routes
+	keys map[*route]string
+	// groups keep the maps of handlers which the routes come from
+	groups    map[*route]int
+	group     int
+	conflicts []string
+}
+
+func newRouteConflicts() *routeConflicts {
+	return &routeConflicts{keys: make(map[*route]string), groups: make(map[*route]int)}
+}
+
+// next starts inserting the routes of the next map of handlers.
+func (rc *routeConflicts) next() {
+	rc.group++
+}
+
+// insert adds the route at the key to the trie and records the conflict if another route of the same map
+// is registered at the same path.
+func (rc *routeConflicts) insert(t *routeTrie, key string, rt *route) {
+	rc.keys[rt] = key
+	rc.groups[rt] = rc.group
+	if prev := t.insert(normalizeKey(key), rt); prev != nil && rc.groups[prev] == rc.group {
+		pair := []string{rc.keys[prev], key}
+		sort.Strings(pair)
+		rc.conflicts = append(rc.conflicts, fmt.Sprintf("metadata %q and %q are served at the same path", pair[0], pair[1]))
+	}
+}
+
+// errors returns the sorted errors of the conflicts of the routes in the trie.
+func (rc *routeConflicts) errors(t *routeTrie) []error {
+	conflicts := rc.conflicts
+	t.rootNode().shadowing(func(rt, under *route) {
+		conflicts = append(conflicts, fmt.Sprintf("metadata %q hides the metadata under it, e.g. %q", rc.keys[rt], rc.keys[under]))
+	})
+	sort.Strings(conflicts)
+	errs := make([]error, len(conflicts))
+	for i, c := range conflicts {
+		errs[i] = errors.New(c)
+	}
+	return errs
+}
+
+// routeRequest dispatches requests under the server's endpoint.
+func (s *Server) routeRequest(w http.ResponseWriter, r *http.Request) {
+	key, ok := s.keyOf(r.URL.Path)
+	if !ok {
+		if s.serveRootListing(w, r) {
+			return
+		}
+		s.notFound(w, r)
+		return
+	}
+	if key != "" {
+		key = s.resolveKey(path.Clean(key))
+	}
+	if (s.redirects != nil || s.config.DirectoryRedirect != 0) && s.redirect(w, r, key) {
+		return
+	}
+	if r.Method == http.MethodPut || r.Method == http.MethodDelete {
+		s.writeGuestAttribute(w, r, key)
+		return
+	}
+	if key == "" && !strings.HasSuffix(r.URL.Path, "/") {
+		fmt.Fprint(w, "ok")
+		return
+	}
+	rt := s.matchRoute(r, key)
+	if strings.HasSuffix(r.URL.Path, "/") || (r.URL.RawQuery != "" && r.URL.Query().Get("recursive") == "true") {
+		if s.serveDirectory(w, r, key) {
+			return
+		}
+	}
+	if rt == nil {
+		rt = &route{key: key}
+	}
+	if tt := tokenType(key); tt != "" && r.Method == http.MethodGet {
+		rw := newStatusRecorder(w)
+		s.serveMetadata(rw, r, rt)
+		s.countToken(r, key, tt, rw.status)
+		rw.release()
+		return
+	}
+	s.serveMetadata(w, r, rt)
+}
+
+// serveDirectory writes the listing of the metadata directory at the key.
+// It returns false if there is no metadata under the key.
+// With recursive=true query parameter it writes all metadata under the key as JSON object.
+// With wait_for_change=true query parameter it writes the listing after any metadata under the key is changed.
+func (s *Server) serveDirectory(w http.ResponseWriter, r *http.Request, key string) bool {
+	recursive := r.URL.Query().Get("recursive") == "true"
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer putBuffer(buf)
+	ok, err := s.writeDirectory(buf, r, key, recursive)
+	if !ok {
+		return false
+	}
+	if r.URL.RawQuery != "" && r.URL.Query().Get("wait_for_change") == "true" {
+		s.waitForChange(r, key, true, func() string {
+			buf.Reset()
+			if ok, err := s.writeDirectory(buf, r, key, recursive); !ok || err != nil {
+				return ""
+			}
+			return etag(buf.Bytes())
+		})
+		buf.Reset()
+		if ok, err = s.writeDirectory(buf, r, key, recursive); !ok {
+			http.NotFound(w, r)
+			return true
+		}
+	}
+	if err != nil {
+		s.handlerLogger.ErrorContext(r.Context(), "failed to write recursive metadata", slog.String("error", err.Error()))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return true
+	}
+	if recursive {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	if writeETag(w, r, []string{etag(buf.Bytes())}) {
+		return true
+	}
+	w.Write(buf.Bytes())
+	return true
+}
+
+// writeDirectory writes the listing of the metadata directory at the key to the buffer.
+// It returns false if there is no metadata under the key.
+func (s *Server) writeDirectory(buf *bytes.Buffer, r *http.Request, key string, recursive bool) (bool, error) {
+	values := s.subtreeValues(r, key, recursive)
+	if len(values) == 0 {
+		return false, nil
+	}
+	if recursive {
+		tree := make(map[string]any)
+		for k, v := range values {
+			insertTree(tree, strings.Split(k, "/"), v)
+		}
+		return true, json.NewEncoder(buf).Encode(tree)
+	}
+	entries := make(map[string]bool)
+	for k := range values {
+		name, rest, _ := strings.Cut(k, "/")
+		entries[name] = entries[name] || rest != ""
+	}
+	names := make([]string, 0, len(entries))
+	for name, dir := range entries {
+		if dir {
+			name += "/"
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		buf.WriteString(name)
+		buf.WriteByte('\n')
+	}
+	return true, nil
+}
+
+// subtreeValues returns the metadata under the key with paths relative to the key.
+// Without withValues only the paths are returned with empty values and no handlers are called.
+// With withValues the handlers are called and the metadata which handlers fail is not included,
+// neither are streamed metadata nor stateful handlers (see [route.valueListed]).
+// The metadata at the key itself is not included.
+func (s *Server) subtreeValues(r *http.Request, key string, withValues bool) map[string]string {
+	values := make(map[string]string)
+	tries := []*routeTrie{&s.routes}
+	if p := requestProfile(r); p != nil {
+		tries = append(tries, &p.routes)
+	}
+	for _, t := range tries {
+		n := t.node(key)
+		if n == nil {
+			continue
+		}
+		for seg, child := range n.children {
+			if seg == wildcardSegment {
+				continue
+			}
+			child.walk(seg, func(k string, rt *route) {
+				if strings.Contains(k, wildcardSegment) {
+					return
+				}
+				if !withValues {
+					values[k] = ""
+				} else if v, ok := listedValue(r, rt); ok {
+					values[k] = v
+				}
+			})
+		}
+	}
+	prefix := key + "/"
+	if key == "" {
+		prefix = ""
+	}
+	// aliased maps the aliases under the key to the keys of the metadata
+	aliased := make(map[string]string)
+	for alias, target := range s.aliasMap() {
+		if rest, ok := strings.CutPrefix(alias, prefix); ok && rest != "" {
+			aliased[rest] = target
+			if rt := s.routes.lookup(target); rt != nil && rt.key == target {
+				if !withValues {
+					values[rest] = ""
+				} else if v, ok := listedValue(r, rt); ok {
+					values[rest] = v
+				}
+			}
+		}
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for k, v := range s.values {
+		if rest, ok := strings.CutPrefix(k, prefix); ok && rest != "" {
+			values[rest] = v
+		}
+	}
+	for rest, target := range aliased {
+		if v, ok := s.values[target]; ok {
+			values[rest] = v
+		}
+	}
+	for k := range values {
+		if full := s.resolveKey(path.Join(key, k)); s.disabled[full] || s.bootingLocked(full) {
+			delete(values, k)
+		}
+	}
+	return values
+}
+
+// listedValue returns the value of the route for the recursive listing.
+// It returns false if the route is not listed with its value or its handler fails.
+func listedValue(r *http.Request, rt *route) (string, bool) {
+	if !rt.valueListed() {
+		return "", false
+	}
+	v, err := rt.value(r)
+	return v, err == nil
+}
+
+func insertTree(tree map[string]any, segs []string, value string) {
+	if len(segs) == 1 {
+		if _, isDir := tree[segs[0]].(map[string]any); !isDir {
+			tree[segs[0]] = value
+		}
+		return
+	}
+	sub, ok := tree[segs[0]].(map[string]any)
+	if !ok {
+		sub = make(map[string]any)
+		tree[segs[0]] = sub
+	}
+	insertTree(sub, segs[1:], value)
+}
@@ -0,0 +1,280 @@
+package metadataserver_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/minherz/metadataserver"
+)
+
+func TestRouting(t *testing.T) {
+	s, err := metadataserver.New(metadataserver.WithHandlers(map[string]metadataserver.Metadata{
+		"instance/zone":                  func() string { return "us-central1-a" },
+		"instance/attributes/a":          func() string { return "1" },
+		"instance/attributes/b":          func() string { return "2" },
+		"instance/disks/*/device-name":   func() string { return "persistent-disk" },
+		"instance/disks/0/device-name":   func() string { return "boot-disk" },
+		"project/project-id":             func() string { return "test-project-id" },
+		"instance/network-interfaces/ip": func() string { return "10.0.0.2" },
+	}))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	s.SetValue("instance/attributes/c", "3")
+	ts := httptest.NewServer(s.HttpHandler())
+	defer ts.Close()
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		want       string
+	}{
+		{name: "root", path: "", wantStatus: http.StatusOK, want: "ok"},
+		{name: "leaf", path: "/instance/zone", wantStatus: http.StatusOK, want: "us-central1-a"},
+		{name: "duplicate_slashes", path: "//instance///zone", wantStatus: http.StatusOK, want: "us-central1-a"},
+		{name: "root_directory", path: "/", wantStatus: http.StatusOK, want: "instance/\nproject/\n"},
+		{name: "directory", path: "/instance/", wantStatus: http.StatusOK, want: "attributes/\ndisks/\nnetwork-interfaces/\nzone\n"},
+		{name: "directory_with_stored_value", path: "/instance/attributes/", wantStatus: http.StatusOK, want: "a\nb\nc\n"},
+		{name: "exact_over_wildcard", path: "/instance/disks/0/device-name", wantStatus: http.StatusOK, want: "boot-disk"},
+		{name: "wildcard", path: "/instance/disks/1/device-name", wantStatus: http.StatusOK, want: "persistent-disk"},
+		{name: "leaf_with_slash", path: "/instance/zone/", wantStatus: http.StatusOK, want: "us-central1-a"},
+		{name: "unknown", path: "/instance/unknown", wantStatus: http.StatusNotFound},
+		{name: "unknown_directory", path: "/unknown/", wantStatus: http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := http.Get(ts.URL + metadataserver.DefaultEndpoint + test.path)
+			if err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			data, _ := io.ReadAll(res.Body)
+			res.Body.Close()
+			if res.StatusCode != test.wantStatus {
+				t.Errorf("expected status %d, got: %d", test.wantStatus, res.StatusCode)
+			}
+			if test.wantStatus == http.StatusOK && string(data) != test.want {
+				t.Errorf("expected response %q, got: %q", test.want, string(data))
+			}
+		})
+	}
+
+	t.Run("recursive", func(t *testing.T) {
+		res, err := http.Get(ts.URL + metadataserver.DefaultEndpoint + "/instance/attributes/?recursive=true")
+		if err != nil {
+			t.Fatalf("expected no errors, got: %v", err)
+		}
+		defer res.Body.Close()
+		var got map[string]any
+		if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+			t.Fatalf("expected no errors, got: %v", err)
+		}
+		want := map[string]any{"a": "1", "b": "2", "c": "3"}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("recursive response mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestRouteParams(t *testing.T) {
+	s, err := metadataserver.New(
+		metadataserver.WithFuncHandlers(map[string]metadataserver.MetadataFunc{
+			"instance/service-accounts/{email}/token": func(ctx context.Context, r *http.Request) (string, error) {
+				return "token-of-" + r.PathValue("email"), nil
+			},
+			"instance/disks/{index}/device-name": func(ctx context.Context, r *http.Request) (string, error) {
+				return "disk-" + r.PathValue("index"), nil
+			},
+		}),
+		metadataserver.WithHandlers(map[string]metadataserver.Metadata{
+			"instance/disks/0/device-name": func() string { return "boot-disk" },
+		}))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	s.SetValue("instance/disks/2/device-name", "stored-disk")
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"instance/service-accounts/default/token", "token-of-default"},
+		{"instance/service-accounts/sa@test-project-id.iam.gserviceaccount.com/token", "token-of-sa@test-project-id.iam.gserviceaccount.com"},
+		{"instance/disks/1/device-name", "disk-1"},
+		{"instance/disks/0/device-name", "boot-disk"},
+		{"instance/disks/2/device-name", "stored-disk"},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/"+test.path, nil))
+			if rec.Code != http.StatusOK {
+				t.Errorf("expected status %d, got: %d", http.StatusOK, rec.Code)
+			}
+			if got := rec.Body.String(); got != test.want {
+				t.Errorf("expected response %q, got: %q", test.want, got)
+			}
+			if got, _ := s.GetValue(test.path); got != test.want {
+				t.Errorf("expected value %q, got: %q", test.want, got)
+			}
+		})
+	}
+	rec := httptest.NewRecorder()
+	s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/instance/service-accounts/default/identity", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got: %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func generateHandlers(n int) map[string]metadataserver.Metadata {
+	handlers := make(map[string]metadataserver.Metadata, n)
+	for i := 0; i < n; i++ {
+		handlers[fmt.Sprintf("instance/attributes/group%d/key%d", i%100, i)] = func() string { return "value" }
+	}
+	return handlers
+}
+
+func BenchmarkRegistration10k(b *testing.B) {
+	handlers := generateHandlers(10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := metadataserver.New(metadataserver.WithHandlers(handlers)); err != nil {
+			b.Fatalf("expected no errors, got: %v", err)
+		}
+	}
+}
+
+func BenchmarkLookup10k(b *testing.B) {
+	s, err := metadataserver.New(metadataserver.WithHandlers(generateHandlers(10000)))
+	if err != nil {
+		b.Fatalf("expected no errors, got: %v", err)
+	}
+	benchmarkHandler(b, s, "/instance/attributes/group42/key9942")
+}
+
+func TestRouteConflicts(t *testing.T) {
+	tests := []struct {
+		name     string
+		handlers map[string]metadataserver.Metadata
+		want     string
+	}{
+		{
+			name: "same_path",
+			handlers: map[string]metadataserver.Metadata{
+				"instance/zone":   func() string { return "a" },
+				"/instance/zone/": func() string { return "b" },
+			},
+			want: `metadata "/instance/zone/" and "instance/zone" are served at the same path`,
+		},
+		{
+			name: "same_named_segment",
+			handlers: map[string]metadataserver.Metadata{
+				"instance/{a}/name": func() string { return "a" },
+				"instance/{b}/name": func() string { return "b" },
+			},
+			want: `metadata "instance/{a}/name" and "instance/{b}/name" are served at the same path`,
+		},
+		{
+			name: "shadowing",
+			handlers: map[string]metadataserver.Metadata{
+				"instance":      func() string { return "a" },
+				"instance/zone": func() string { return "b" },
+				"instance/name": func() string { return "c" },
+			},
+			want: `metadata "instance" hides the metadata under it, e.g. "instance/name"`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := metadataserver.New(metadataserver.WithHandlers(test.handlers))
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if got := err.Error(); !strings.Contains(got, test.want) {
+				t.Errorf("expected error containing %q, got: %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestRouteOverridesDefaultHandlers(t *testing.T) {
+	s, err := metadataserver.New(
+		metadataserver.WithHandler("project/project-id", metadataserver.ResponseFunc(func(ctx context.Context, r *http.Request) (metadataserver.Response, error) {
+			return metadataserver.Response{Body: "stateful-project-id"}, nil
+		})),
+		metadataserver.WithFuncHandlers(map[string]metadataserver.MetadataFunc{
+			"/instance/zone/": func(ctx context.Context, r *http.Request) (string, error) {
+				return "projects/123/zones/europe-west1-b", nil
+			},
+		}))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	for p, want := range map[string]string{
+		"project/project-id": "stateful-project-id",
+		"instance/zone":      "projects/123/zones/europe-west1-b",
+	} {
+		rec := httptest.NewRecorder()
+		s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/"+p, nil))
+		if got := rec.Body.String(); got != want {
+			t.Errorf("%s: expected %q, got: %q", p, want, got)
+		}
+	}
+}
+
+func TestDirectoryListingDoesNotServeHandlers(t *testing.T) {
+	counter := &counterHandler{}
+	var streams, failures int
+	s, err := metadataserver.New(
+		metadataserver.WithHandlers(map[string]metadataserver.Metadata{
+			"instance/attributes/a": func() string { return "1" },
+		}),
+		metadataserver.WithHandler("instance/attributes/counter", counter),
+		metadataserver.WithStreamHandlers(map[string]metadataserver.StreamMetadata{
+			"instance/attributes/stream": func() io.Reader {
+				streams++
+				return strings.NewReader("stream")
+			},
+		}),
+		metadataserver.WithFuncHandlers(map[string]metadataserver.MetadataFunc{
+			"instance/attributes/failing": func(context.Context, *http.Request) (string, error) {
+				failures++
+				return "", fmt.Errorf("failed")
+			},
+		}))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	get := func(path string) string {
+		rec := httptest.NewRecorder()
+		s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+path, nil))
+		return rec.Body.String()
+	}
+
+	want := "a\ncounter\nfailing\nstream\n"
+	if got := get("/instance/attributes/"); got != want {
+		t.Errorf("expected listing %q, got: %q", want, got)
+	}
+	if streams != 0 || failures != 0 || counter.count != 0 {
+		t.Errorf("expected no handler calls for the listing, got: %d streams, %d failures, %d counter calls", streams, failures, counter.count)
+	}
+
+	var tree map[string]any
+	if err := json.Unmarshal([]byte(get("/instance/attributes/?recursive=true")), &tree); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if diff := cmp.Diff(map[string]any{"a": "1"}, tree); diff != "" {
+		t.Errorf("recursive response mismatch (-want +got):\n%s", diff)
+	}
+	if streams != 0 || counter.count != 0 {
+		t.Errorf("expected no stream reads and counter calls for the recursive listing, got: %d streams, %d counter calls", streams, counter.count)
+	}
+}
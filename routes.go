@@ -0,0 +1,39 @@
+package metadataserver
+
+import (
+	"sort"
+)
+
+// RouteInfo describes a metadata path that the server serves.
+// Static routes serve precomputed literal values; other routes call their handlers for each request.
+type RouteInfo struct {
+	Path    string `json:"path"`
+	Source  string `json:"source"`
+	Static  bool   `json:"static"`
+	Profile string `json:"profile,omitempty"`
+}
+
+// Routes returns the resolved route table of the server sorted by path.
+// The paths are relative to the server's endpoint and include aliases and the routes of the instance profiles.
+// Unlike [Server.Paths], it does not include the paths of the values set with [Server.SetValue].
+func (s *Server) Routes() []RouteInfo {
+	var routes []RouteInfo
+	s.routes.rootNode().walk("", func(_ string, rt *route) {
+		routes = append(routes, RouteInfo{Path: rt.key, Source: rt.source, Static: rt.static != nil})
+	})
+	for alias, key := range s.aliasMap() {
+		routes = append(routes, RouteInfo{Path: alias, Source: "alias " + key})
+	}
+	for _, p := range s.profiles {
+		p.routes.rootNode().walk("", func(_ string, rt *route) {
+			routes = append(routes, RouteInfo{Path: rt.key, Source: rt.source, Static: rt.static != nil, Profile: p.Name})
+		})
+	}
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Profile < routes[j].Profile
+	})
+	return routes
+}
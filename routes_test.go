@@ -0,0 +1,57 @@
+package metadataserver_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/minherz/metadataserver"
+)
+
+func TestRoutes(t *testing.T) {
+	s, err := metadataserver.New(
+		metadataserver.WithConfigFile("test/fixtures/config_literal_handlers.json"),
+		metadataserver.WithAliases(map[string]string{"legacy/entry1": "entry1"}),
+		metadataserver.WithProfiles(metadataserver.Profile{
+			Name:     "vm-1",
+			Handlers: map[string]metadataserver.Metadata{"entry1": func() string { return "vm-1" }},
+		}))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	want := []metadataserver.RouteInfo{
+		{Path: "entry1", Source: "value", Static: true},
+		{Path: "entry1", Source: "func", Profile: "vm-1"},
+		{Path: "entry2", Source: "env two"},
+		{Path: "legacy/entry1", Source: "alias entry1"},
+	}
+	if diff := cmp.Diff(want, s.Routes()); diff != "" {
+		t.Errorf("routes mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestStartBanner(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := context.Background()
+	s, err := metadataserver.New(
+		metadataserver.WithLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))),
+		metadataserver.WithAddress("127.0.0.1"),
+		metadataserver.WithPort(freePort()))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if err := s.Start(ctx); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	s.Stop(ctx)
+	var record map[string]any
+	if err := json.Unmarshal(bytes.SplitN(buf.Bytes(), []byte("\n"), 2)[0], &record); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if record["msg"] != "metadata server is started" || record["endpoint"] != metadataserver.DefaultEndpoint || record["routes"] != float64(1) {
+		t.Errorf("unexpected banner: %v", record)
+	}
+}
@@ -0,0 +1,173 @@
+package metadataserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+)
+
+// Actions that can be executed by a scenario step.
+const (
+	// ActionSet sets the value at the step's path. See [Server.SetValue].
+	ActionSet = "set"
+	// ActionDelete deletes the value at the step's path. See [Server.DeleteValue].
+	ActionDelete = "delete"
+	// ActionStatus makes the step's path to respond with the step's status. See [Server.SetStatus].
+	ActionStatus = "status"
+	// ActionReset resets the server's state. See [Server.Reset].
+	ActionReset = "reset"
+)
+
+// Scenario describes a sequence of timed changes to the served metadata.
+type Scenario struct {
+	Name  string         `json:"name"`
+	Steps []ScenarioStep `json:"steps"`
+}
+
+// ScenarioStep describes a single change that is executed at the time relative to the start of the scenario.
+type ScenarioStep struct {
+	At     time.Duration `json:"-"`
+	Action string        `json:"action"`
+	Path   string        `json:"path,omitempty"`
+	Value  string        `json:"value,omitempty"`
+	Status int           `json:"status,omitempty"`
+}
+
+type jsonScenarioStep struct {
+	At     string `json:"at"`
+	Action string `json:"action"`
+	Path   string `json:"path"`
+	Value  string `json:"value"`
+	Status int    `json:"status"`
+}
+
+// UnmarshalJSON reads the step with the time defined as a duration string (e.g. "+30s").
+func (st *ScenarioStep) UnmarshalJSON(data []byte) error {
+	var js jsonScenarioStep
+	if err := json.Unmarshal(data, &js); err != nil {
+		return err
+	}
+	var at time.Duration
+	if js.At != "" {
+		d, err := time.ParseDuration(js.At)
+		if err != nil {
+			return fmt.Errorf("invalid step time %q: %w", js.At, err)
+		}
+		at = d
+	}
+	*st = ScenarioStep{At: at, Action: js.Action, Path: js.Path, Value: js.Value, Status: js.Status}
+	return nil
+}
+
+// MarshalJSON writes the step with the time defined as a duration string.
+func (st ScenarioStep) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonScenarioStep{At: st.At.String(), Action: st.Action, Path: st.Path, Value: st.Value, Status: st.Status})
+}
+
+// NewScenarioFromFile reads a [Scenario] from JSON file.
+func NewScenarioFromFile(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var sc Scenario
+	if err := json.Unmarshal(data, &sc); err != nil {
+		return nil, err
+	}
+	if err := sc.Validate(); err != nil {
+		return nil, err
+	}
+	return &sc, nil
+}
+
+// Validate returns an error if any of the scenario's steps is invalid.
+func (sc *Scenario) Validate() error {
+	for i, st := range sc.Steps {
+		if st.At < 0 {
+			return fmt.Errorf("step %d: negative time %s", i, st.At)
+		}
+		switch st.Action {
+		case ActionSet, ActionDelete:
+			if st.Path == "" {
+				return fmt.Errorf("step %d: action %q requires path", i, st.Action)
+			}
+		case ActionStatus:
+			if st.Path == "" || st.Status < 0 {
+				return fmt.Errorf("step %d: action %q requires path and status", i, st.Action)
+			}
+		case ActionReset:
+		default:
+			return fmt.Errorf("step %d: unknown action %q", i, st.Action)
+		}
+	}
+	return nil
+}
+
+// WithScenario sets a new server with the scenario that is executed when the server starts.
+func WithScenario(sc *Scenario) Option {
+	return func(s *Server) {
+		s.scenarios = append(s.scenarios, sc)
+	}
+}
+
+// RunScenario starts executing the scenario on the running server.
+// The scenario steps are executed in background until all steps are executed or the server is stopped.
+//
+// It returns ErrServerIsNotRunning if the server was not started.
+func (s *Server) RunScenario(ctx context.Context, sc *Scenario) error {
+	done := s.running()
+	if done == nil {
+		return ErrServerIsNotRunning
+	}
+	if err := sc.Validate(); err != nil {
+		return err
+	}
+	go s.runScenario(ctx, sc, done)
+	return nil
+}
+
+func (s *Server) runScenario(ctx context.Context, sc *Scenario, done <-chan struct{}) {
+	steps := append([]ScenarioStep(nil), sc.Steps...)
+	sort.SliceStable(steps, func(i, j int) bool { return steps[i].At < steps[j].At })
+	start := time.Now()
+	s.logger.DebugContext(ctx, "scenario is started", slog.String("scenario", sc.Name))
+	s.emitScenarioEvent(ScenarioEvent{Name: sc.Name, State: "started"})
+	for _, st := range steps {
+		timer := time.NewTimer(time.Until(start.Add(st.At)))
+		select {
+		case <-done:
+			timer.Stop()
+			s.logger.DebugContext(ctx, "scenario is interrupted", slog.String("scenario", sc.Name))
+			s.emitScenarioEvent(ScenarioEvent{Name: sc.Name, State: "interrupted"})
+			return
+		case <-timer.C:
+		}
+		s.applyStep(st, "scenario:"+sc.Name)
+		s.logger.DebugContext(ctx, "scenario step is executed", slog.String("scenario", sc.Name),
+			slog.String("action", st.Action), slog.String("path", st.Path))
+		s.emitScenarioEvent(ScenarioEvent{Name: sc.Name, State: "step", Action: st.Action, Path: st.Path})
+	}
+	s.logger.DebugContext(ctx, "scenario is completed", slog.String("scenario", sc.Name))
+	s.emitScenarioEvent(ScenarioEvent{Name: sc.Name, State: "completed"})
+}
+
+func (s *Server) emitScenarioEvent(e ScenarioEvent) {
+	s.events.emit(Event{Time: s.now(), Type: EventScenario, Scenario: &e})
+}
+
+func (s *Server) applyStep(st ScenarioStep, source string) {
+	switch st.Action {
+	case ActionSet:
+		s.setValue(st.Path, st.Value, source)
+	case ActionDelete:
+		s.deleteValue(st.Path, source)
+	case ActionStatus:
+		s.setStatus(st.Path, st.Status, source)
+	case ActionReset:
+		s.reset(source)
+	}
+}
@@ -0,0 +1,92 @@
+package metadataserver_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/minherz/metadataserver"
+)
+
+func TestNewScenarioFromFile(t *testing.T) {
+	got, err := metadataserver.NewScenarioFromFile("test/fixtures/scenario.json")
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	want := &metadataserver.Scenario{
+		Name: "maintenance",
+		Steps: []metadataserver.ScenarioStep{
+			{At: 50 * time.Millisecond, Action: metadataserver.ActionSet, Path: "instance/maintenance-event", Value: "MIGRATE_ON_HOST_MAINTENANCE"},
+			{At: 50 * time.Millisecond, Action: metadataserver.ActionStatus, Path: "project/project-id", Status: http.StatusInternalServerError},
+			{Action: metadataserver.ActionSet, Path: "instance/maintenance-event", Value: "NONE"},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("scenario mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestScenarioValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		input metadataserver.ScenarioStep
+	}{
+		{
+			name:  "unknown_action",
+			input: metadataserver.ScenarioStep{Action: "explode"},
+		},
+		{
+			name:  "set_without_path",
+			input: metadataserver.ScenarioStep{Action: metadataserver.ActionSet},
+		},
+		{
+			name:  "negative_time",
+			input: metadataserver.ScenarioStep{At: -time.Second, Action: metadataserver.ActionReset},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sc := &metadataserver.Scenario{Steps: []metadataserver.ScenarioStep{test.input}}
+			if err := sc.Validate(); err == nil {
+				t.Errorf("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestRunScenario(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+	sc, err := metadataserver.NewScenarioFromFile("test/fixtures/scenario.json")
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	s, err := metadataserver.New(
+		metadataserver.WithAddress("127.0.0.1"),
+		metadataserver.WithPort(freePort()),
+		metadataserver.WithScenario(sc))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	defer s.Stop(context.Background())
+
+	time.Sleep(200 * time.Millisecond)
+	if got, _ := s.GetValue("instance/maintenance-event"); got != "MIGRATE_ON_HOST_MAINTENANCE" {
+		t.Errorf("expected value %q, got: %q", "MIGRATE_ON_HOST_MAINTENANCE", got)
+	}
+	res, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d%s/project/project-id", s.Configuration().Port, s.Configuration().Endpoint))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got: %d", http.StatusInternalServerError, res.StatusCode)
+	}
+}
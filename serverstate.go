@@ -0,0 +1,107 @@
+package metadataserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ServerState is the snapshot of the server's state returned by [Server.State].
+type ServerState struct {
+	// Running is true if the server is started.
+	Running bool
+	// Address is the address the server listens on, including the port chosen by the system for port 0.
+	// It is the configured address if the server is not running.
+	Address string
+	// Endpoint is the path the metadata is served under.
+	Endpoint string
+	// Routes is the number of the served metadata paths.
+	Routes int
+	// StartTime is the time of the server's clock (see [WithClock]) when the server was started.
+	// It is zero if the server is not running.
+	StartTime time.Time
+	// Uptime is the time since the server was started.
+	Uptime time.Duration
+	// LastError is the last error of starting, serving or stopping the server.
+	LastError error
+}
+
+// String returns a short description of the state, e.g. "running at 127.0.0.1:8080/computeMetadata/v1 for 1m0s, 3 routes".
+func (st ServerState) String() string {
+	var s string
+	if st.Running {
+		s = fmt.Sprintf("running at %s%s for %s, %d routes", st.Address, st.Endpoint, st.Uptime.Round(time.Millisecond), st.Routes)
+	} else {
+		s = fmt.Sprintf("stopped, %d routes", st.Routes)
+	}
+	if st.LastError != nil {
+		s += ", last error: " + st.LastError.Error()
+	}
+	return s
+}
+
+type jsonServerState struct {
+	Running   bool       `json:"running"`
+	Address   string     `json:"address"`
+	Endpoint  string     `json:"endpoint"`
+	Routes    int        `json:"routes"`
+	StartTime *time.Time `json:"startTime,omitempty"`
+	Uptime    string     `json:"uptime,omitempty"`
+	LastError string     `json:"lastError,omitempty"`
+}
+
+// MarshalJSON encodes the state with the uptime as a duration string, e.g. "1m0s", and the last error as its message.
+func (st ServerState) MarshalJSON() ([]byte, error) {
+	js := jsonServerState{
+		Running:  st.Running,
+		Address:  st.Address,
+		Endpoint: st.Endpoint,
+		Routes:   st.Routes,
+	}
+	if st.Running {
+		js.StartTime = &st.StartTime
+		js.Uptime = st.Uptime.String()
+	}
+	if st.LastError != nil {
+		js.LastError = st.LastError.Error()
+	}
+	return json.Marshal(js)
+}
+
+// State returns the snapshot of the server's state.
+// It is safe to call it concurrently with [Server.Start] and [Server.Stop].
+func (s *Server) State() ServerState {
+	st := ServerState{Endpoint: s.config.Endpoint, Routes: len(s.Routes())}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	st.Running = !s.startTime.IsZero()
+	st.Address = s.server.Addr
+	if st.Running {
+		st.Address = s.boundAddress
+		st.StartTime = s.startTime
+		st.Uptime = s.now().Sub(s.startTime)
+	}
+	st.LastError = s.lastError
+	return st
+}
+
+// setRunning records the start of the server at the bound address or its stop if the address is empty.
+// The start resets the time that the boot delays are counted from.
+func (s *Server) setRunning(addr string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.boundAddress = addr
+	if addr == "" {
+		s.startTime = time.Time{}
+	} else {
+		s.startTime = s.now()
+		s.bootTime = s.startTime
+	}
+}
+
+// setLastError records the error of starting, serving or stopping the server.
+func (s *Server) setLastError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastError = err
+}
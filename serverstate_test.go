@@ -0,0 +1,111 @@
+package metadataserver_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/minherz/metadataserver"
+)
+
+func TestState(t *testing.T) {
+	s, err := metadataserver.New(metadataserver.WithAddress("127.0.0.1"), metadataserver.WithPort(0))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	st := s.State()
+	if st.Running || st.Address != "127.0.0.1:0" || st.Routes != 1 || st.LastError != nil {
+		t.Errorf("expected stopped state at 127.0.0.1:0 with 1 route, got: %+v", st)
+	}
+	if got, want := st.String(), "stopped, 1 routes"; got != want {
+		t.Errorf("expected %q, got: %q", want, got)
+	}
+
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	st = s.State()
+	if _, port, _ := net.SplitHostPort(st.Address); !st.Running || port == "0" || st.StartTime.IsZero() || st.Uptime <= 0 {
+		t.Errorf("expected running state at the bound port, got: %+v", st)
+	}
+	if want := "running at " + st.Address + metadataserver.DefaultEndpoint + " for "; !strings.HasPrefix(st.String(), want) {
+		t.Errorf("expected %q prefix, got: %q", want, st.String())
+	}
+	data, err := json.Marshal(st)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	delete(got, "startTime")
+	delete(got, "uptime")
+	want := map[string]any{"running": true, "address": st.Address, "endpoint": metadataserver.DefaultEndpoint, "routes": float64(1)}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("JSON mismatch (-want +got):\n%s", diff)
+	}
+
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if st := s.State(); st.Running || !st.StartTime.IsZero() {
+		t.Errorf("expected stopped state, got: %+v", st)
+	}
+}
+
+func TestStateClock(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s, err := metadataserver.New(
+		metadataserver.WithAddress("127.0.0.1"),
+		metadataserver.WithPort(0),
+		metadataserver.WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	defer s.Stop(context.Background())
+	start := now
+	now = now.Add(time.Minute)
+	st := s.State()
+	if !st.StartTime.Equal(start) {
+		t.Errorf("expected start time %v, got: %v", start, st.StartTime)
+	}
+	if st.Uptime != time.Minute {
+		t.Errorf("expected uptime %v, got: %v", time.Minute, st.Uptime)
+	}
+}
+
+func TestStateLastError(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	defer l.Close()
+	s, err := metadataserver.New(metadataserver.WithAddress("127.0.0.1"), metadataserver.WithPort(l.Addr().(*net.TCPAddr).Port))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	startErr := s.Start(context.Background())
+	if startErr == nil {
+		t.Fatal("expected error, got nil")
+	}
+	st := s.State()
+	if st.Running || !errors.Is(st.LastError, metadataserver.ErrPortInUse) {
+		t.Errorf("expected stopped state with ErrPortInUse, got: %+v", st)
+	}
+	if want := "stopped, 1 routes, last error: " + startErr.Error(); st.String() != want {
+		t.Errorf("expected %q, got: %q", want, st.String())
+	}
+	data, _ := json.Marshal(st)
+	if !strings.Contains(string(data), `"lastError":`) {
+		t.Errorf("expected lastError in JSON, got: %s", data)
+	}
+}
@@ -0,0 +1,251 @@
+package metadataserver
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultScopes are the scopes of the service account that does not define scopes.
+var DefaultScopes = []string{"https://www.googleapis.com/auth/cloud-platform"}
+
+// DefaultTokenLifetime is the lifetime of the access tokens of the service account that does not define it.
+const DefaultTokenLifetime = time.Hour
+
+// ServiceAccount describes the service account of the simulated instance.
+// The server serves the account's email, scopes and access token at "instance/service-accounts/EMAIL/...".
+// If the signing key is set with [WithSigningKey], the server also serves the account's identity tokens.
+// The first account is also served as "default".
+type ServiceAccount struct {
+	Email         string
+	Scopes        []string
+	Token         string
+	TokenLifetime time.Duration
+}
+
+type jsonServiceAccount struct {
+	Email         string   `json:"email"`
+	Scopes        []string `json:"scopes"`
+	Token         string   `json:"token"`
+	TokenLifetime string   `json:"tokenLifetime"`
+}
+
+// tokenResponse is the JSON of the access token.
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+	TokenType   string `json:"token_type"`
+	Scope       string `json:"scope,omitempty"`
+}
+
+// WithServiceAccounts sets a new server with the service accounts of the instance.
+// The access token endpoint supports the "scopes" query parameter: the token is granted to
+// the requested scopes that the account has and the request is rejected with 400 (Bad Request) if it has none of them.
+//
+// Mind the order of options when use with [WithConfiguration] and [WithConfigFile].
+func WithServiceAccounts(accounts ...ServiceAccount) Option {
+	return func(s *Server) {
+		if s.config == nil {
+			s.config = NewConfiguration(DefaultConfigurationHandlers)
+		}
+		s.config.ServiceAccounts = append(s.config.ServiceAccounts, accounts...)
+	}
+}
+
+// applyServiceAccounts adds the handlers of the service accounts to the configuration.
+// The identity tokens are issued at the time of the clock.
+func (c *Configuration) applyServiceAccounts(now func() time.Time) error {
+	if len(c.ServiceAccounts) == 0 {
+		return nil
+	}
+	handlers := make(map[string]Metadata, len(c.Handlers)+2*len(c.ServiceAccounts))
+	for k, h := range c.Handlers {
+		handlers[k] = h
+	}
+	responses := make(map[string]ResponseFunc, len(c.ResponseHandlers)+len(c.ServiceAccounts))
+	for k, h := range c.ResponseHandlers {
+		responses[k] = h
+	}
+	if c.literals == nil {
+		c.literals = make(map[string]string)
+	}
+	if c.sources == nil {
+		c.sources = make(map[string]string)
+	}
+	names := []string{"email", "scopes", "token"}
+	instance := c.instanceClaims()
+	if c.SigningKey != nil {
+		if _, _, err := signingAlgorithm(c.SigningKey); err != nil {
+			return fmt.Errorf("invalid signing key: %w", err)
+		}
+		names = append(names, "identity")
+	}
+	for i, sa := range c.ServiceAccounts {
+		if sa.Email == "" {
+			return fmt.Errorf("service account %d: email is required", i)
+		}
+		if len(sa.Scopes) == 0 {
+			sa.Scopes = DefaultScopes
+		}
+		if sa.Token == "" {
+			sa.Token = "test-access-token"
+		}
+		if sa.TokenLifetime <= 0 {
+			sa.TokenLifetime = DefaultTokenLifetime
+		}
+		accounts := []string{sa.Email}
+		if i == 0 {
+			accounts = append(accounts, "default")
+		}
+		values := map[string]string{
+			"email":  sa.Email,
+			"scopes": strings.Join(sa.Scopes, "\n") + "\n",
+		}
+		source := "service account " + sa.Email
+		for _, account := range accounts {
+			prefix := "instance/service-accounts/" + account + "/"
+			for _, name := range names {
+				// the source is already set if the configuration is used by another server
+				if src := c.Source(prefix + name); src != "" && src != source {
+					return fmt.Errorf("metadata %q: the handler conflicts with the service account %q", prefix+name, sa.Email)
+				}
+				c.sources[prefix+name] = source
+			}
+			for name, v := range values {
+				handlers[prefix+name] = func() string {
+					return v
+				}
+				c.literals[prefix+name] = v
+			}
+			responses[prefix+"token"] = sa.serveToken
+			if c.SigningKey != nil {
+				responses[prefix+"identity"] = sa.serveIdentity(c.SigningKey, instance, now)
+			}
+		}
+	}
+	c.Handlers = handlers
+	c.ResponseHandlers = responses
+	return nil
+}
+
+// serveToken responds with the access token of the service account.
+// The token is granted to the scopes of the "scopes" query parameter that the account has.
+func (sa ServiceAccount) serveToken(ctx context.Context, r *http.Request) (Response, error) {
+	scopes := sa.Scopes
+	if q := r.URL.Query().Get("scopes"); q != "" {
+		scopes = intersectScopes(strings.Split(q, ","), sa.Scopes)
+		if len(scopes) == 0 {
+			return Response{Status: http.StatusBadRequest, Body: "none of the requested scopes is granted to the service account\n"}, nil
+		}
+	}
+	body, err := json.Marshal(tokenResponse{
+		AccessToken: sa.Token,
+		ExpiresIn:   int(sa.TokenLifetime.Seconds()),
+		TokenType:   "Bearer",
+		Scope:       strings.Join(scopes, " "),
+	})
+	if err != nil {
+		return Response{}, err
+	}
+	return Response{Headers: http.Header{"Content-Type": {"application/json"}}, Body: string(body)}, nil
+}
+
+// identityClaims are the claims of the identity token of the service account.
+type identityClaims struct {
+	Issuer          string        `json:"iss"`
+	Audience        string        `json:"aud"`
+	AuthorizedParty string        `json:"azp"`
+	Subject         string        `json:"sub"`
+	IssuedAt        int64         `json:"iat"`
+	Expiry          int64         `json:"exp"`
+	Email           string        `json:"email,omitempty"`
+	EmailVerified   bool          `json:"email_verified,omitempty"`
+	Google          *googleClaims `json:"google,omitempty"`
+}
+
+type googleClaims struct {
+	ComputeEngine computeEngineClaims `json:"compute_engine"`
+}
+
+// computeEngineClaims are the claims of the instance that issues the identity token with format=full.
+type computeEngineClaims struct {
+	InstanceID    string `json:"instance_id,omitempty"`
+	InstanceName  string `json:"instance_name,omitempty"`
+	ProjectID     string `json:"project_id,omitempty"`
+	ProjectNumber int64  `json:"project_number,omitempty"`
+	Zone          string `json:"zone,omitempty"`
+}
+
+// instanceClaims returns the claims of the instance that the identity tokens of the configuration include.
+// Only the literal values and the default handler of the project ID are used, other handlers are not called.
+func (c *Configuration) instanceClaims() computeEngineClaims {
+	ce := computeEngineClaims{
+		InstanceID:   c.literals["instance/id"],
+		InstanceName: c.literals["instance/name"],
+		ProjectID:    c.literals[ProjectIDPath],
+	}
+	if h, ok := c.Handlers[ProjectIDPath]; ok && ce.ProjectID == "" && isDefaultHandler(ProjectIDPath, h) {
+		ce.ProjectID = h()
+	}
+	ce.ProjectNumber, _ = strconv.ParseInt(c.literals[ProjectNumberPath], 10, 64)
+	if zone, ok := c.literals[ZonePath]; ok {
+		ce.Zone = path.Base(zone)
+	}
+	return ce
+}
+
+// identityIssuer is the issuer of the identity tokens.
+const identityIssuer = "https://accounts.google.com"
+
+// serveIdentity returns the handler that responds with the identity token of the service account signed with the key.
+// The token is issued for the "audience" query parameter and includes the email and the google.compute_engine claims
+// of the instance if "format" is "full".
+func (sa ServiceAccount) serveIdentity(key crypto.Signer, instance computeEngineClaims, now func() time.Time) ResponseFunc {
+	return func(ctx context.Context, r *http.Request) (Response, error) {
+		q := r.URL.Query()
+		audience := q.Get("audience")
+		if audience == "" {
+			return Response{Status: http.StatusBadRequest, Body: "non-empty audience parameter required\n"}, nil
+		}
+		t := now()
+		claims := identityClaims{
+			Issuer:          identityIssuer,
+			Audience:        audience,
+			AuthorizedParty: sa.Email,
+			Subject:         sa.Email,
+			IssuedAt:        t.Unix(),
+			Expiry:          t.Add(DefaultTokenLifetime).Unix(),
+		}
+		if q.Get("format") == "full" {
+			claims.Email = sa.Email
+			claims.EmailVerified = true
+			claims.Google = &googleClaims{ComputeEngine: instance}
+		}
+		token, err := signJWT(key, claims)
+		if err != nil {
+			return Response{}, err
+		}
+		return Response{Body: token}, nil
+	}
+}
+
+// intersectScopes returns the requested scopes that are granted.
+func intersectScopes(requested, granted []string) []string {
+	var scopes []string
+	for _, r := range requested {
+		r = strings.TrimSpace(r)
+		for _, g := range granted {
+			if r == g {
+				scopes = append(scopes, r)
+				break
+			}
+		}
+	}
+	return scopes
+}
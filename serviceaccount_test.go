@@ -0,0 +1,69 @@
+package metadataserver_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/minherz/metadataserver"
+)
+
+func TestServiceAccountToken(t *testing.T) {
+	s, err := metadataserver.New(metadataserver.WithServiceAccounts(metadataserver.ServiceAccount{
+		Email:         "sa@test-project-id.iam.gserviceaccount.com",
+		Scopes:        []string{"https://www.googleapis.com/auth/cloud-platform", "https://www.googleapis.com/auth/userinfo.email"},
+		Token:         "test-token",
+		TokenLifetime: 30 * time.Minute,
+	}))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		scope  string
+	}{
+		{"all scopes", "instance/service-accounts/default/token", http.StatusOK, "https://www.googleapis.com/auth/cloud-platform https://www.googleapis.com/auth/userinfo.email"},
+		{"narrowed scopes", "instance/service-accounts/sa@test-project-id.iam.gserviceaccount.com/token?scopes=https://www.googleapis.com/auth/userinfo.email,https://www.googleapis.com/auth/compute", http.StatusOK, "https://www.googleapis.com/auth/userinfo.email"},
+		{"no granted scopes", "instance/service-accounts/default/token?scopes=https://www.googleapis.com/auth/compute", http.StatusBadRequest, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/"+test.path, nil))
+			if rec.Code != test.status {
+				t.Fatalf("expected status %d, got: %d", test.status, rec.Code)
+			}
+			if test.status != http.StatusOK {
+				return
+			}
+			var got map[string]any
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			want := map[string]any{"access_token": "test-token", "expires_in": float64(1800), "token_type": "Bearer", "scope": test.scope}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("token mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+	if got, _ := s.GetValue("instance/service-accounts/default/email"); got != "sa@test-project-id.iam.gserviceaccount.com" {
+		t.Errorf("expected the default account email, got: %q", got)
+	}
+}
+
+func TestServiceAccountConflict(t *testing.T) {
+	_, err := metadataserver.New(
+		metadataserver.WithHandlers(map[string]metadataserver.Metadata{
+			"instance/service-accounts/default/email": func() string { return "other@example.com" },
+		}),
+		metadataserver.WithServiceAccounts(metadataserver.ServiceAccount{Email: "sa@example.com"}))
+	want := `metadata "instance/service-accounts/default/email": the handler conflicts with the service account "sa@example.com"`
+	if err == nil || err.Error() != want {
+		t.Errorf("expected error %q, got: %v", want, err)
+	}
+}
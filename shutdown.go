@@ -0,0 +1,78 @@
+package metadataserver
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// WithOnShutdownTimeout sets a new server to call fn when [Server.Stop] does not finish serving
+// the active requests within the shutdown timeout. The pending argument lists the paths of the requests
+// that are still served, sorted and with a path per request, e.g. to find the handler that hangs in CI.
+func WithOnShutdownTimeout(fn func(pending []string)) Option {
+	return func(s *Server) {
+		s.onShutdownTimeout = fn
+		s.active = &activeRequests{paths: make(map[uint64]string)}
+	}
+}
+
+// activeRequests keeps the paths of the requests that are being served.
+type activeRequests struct {
+	mu    sync.Mutex
+	next  uint64
+	paths map[uint64]string
+}
+
+// add records the request at the path and returns the id to remove it with.
+func (a *activeRequests) add(path string) uint64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.next++
+	a.paths[a.next] = path
+	return a.next
+}
+
+func (a *activeRequests) remove(id uint64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.paths, id)
+}
+
+// list returns the sorted paths of the active requests.
+func (a *activeRequests) list() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	paths := make([]string, 0, len(a.paths))
+	for _, p := range a.paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// trackRequests records the paths of the requests while they are served if the shutdown timeout callback is set.
+func (s *Server) trackRequests(next http.Handler) http.Handler {
+	if s.active == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := s.active.add(r.URL.Path)
+		defer s.active.remove(id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// shutdownTimedOut reports the requests that are still served when the graceful shutdown exceeds its deadline.
+func (s *Server) shutdownTimedOut(ctx context.Context) {
+	if s.active == nil {
+		s.logger.ErrorContext(ctx, "shutdown timed out with active requests")
+		return
+	}
+	pending := s.active.list()
+	s.logger.ErrorContext(ctx, "shutdown timed out with active requests", slog.Any("pending", pending))
+	if s.onShutdownTimeout != nil {
+		s.onShutdownTimeout(pending)
+	}
+}
@@ -0,0 +1,81 @@
+package metadataserver_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/minherz/metadataserver"
+)
+
+func TestOnShutdownTimeout(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	c := metadataserver.NewConfiguration(map[string]metadataserver.Metadata{
+		"instance/slow": func() string {
+			close(entered)
+			<-release
+			return "done"
+		},
+		"instance/fast": func() string { return "done" },
+	})
+	c.Address = "127.0.0.1"
+	c.Port = freePort()
+	c.ShutdownTimeout = 1
+	var got []string
+	s, err := metadataserver.New(
+		metadataserver.WithConfiguration(c),
+		metadataserver.WithOnShutdownTimeout(func(pending []string) { got = pending }),
+	)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	base := fmt.Sprintf("http://127.0.0.1:%d%s", c.Port, metadataserver.DefaultEndpoint)
+	res, err := http.Get(base + "/instance/fast")
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	res.Body.Close()
+	go func() {
+		if res, err := http.Get(base + "/instance/slow"); err == nil {
+			res.Body.Close()
+		}
+	}()
+	<-entered
+	if err := s.Stop(context.Background()); err == nil {
+		t.Error("expected shutdown timeout error, got nil")
+	}
+	close(release)
+	want := []string{metadataserver.DefaultEndpoint + "/instance/slow"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("pending paths mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestOnShutdownTimeoutNotCalled(t *testing.T) {
+	c := metadataserver.NewConfiguration(nil)
+	c.Address = "127.0.0.1"
+	c.Port = freePort()
+	called := false
+	s, err := metadataserver.New(
+		metadataserver.WithConfiguration(c),
+		metadataserver.WithOnShutdownTimeout(func([]string) { called = true }),
+	)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if called {
+		t.Error("expected the callback not to be called")
+	}
+}
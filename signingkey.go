@@ -0,0 +1,163 @@
+package metadataserver
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// WithSigningKey sets a new server with the key that signs the identity tokens of the service accounts.
+// The server serves the identity tokens at "instance/service-accounts/EMAIL/identity" only if the key is set.
+// The key's public key must be RSA (the tokens are signed with RS256) or ECDSA (ES256, ES384 or ES512 according to the curve).
+// Use [NewTestSigningKey] to get the same key in each test run.
+// The server does not simulate AWS, so the key does not sign AWS instance identity documents.
+//
+// Mind the order of options when use with [WithConfiguration] and [WithConfigFile].
+func WithSigningKey(key crypto.Signer) Option {
+	return func(s *Server) {
+		if s.config == nil {
+			s.config = NewConfiguration(DefaultConfigurationHandlers)
+		}
+		s.config.SigningKey = key
+	}
+}
+
+// NewTestSigningKey returns the key for the algorithm that is generated from the seed,
+// so the same seed always returns the same key. Supported algorithms are "RS256", "ES256", "ES384" and "ES512".
+// The keys are predictable by design: use them only in tests.
+// Since Go 1.26 the key generation ignores custom random sources unless GODEBUG=cryptocustomrand=1 is set
+// (the default for the modules that declare an earlier Go version); NewTestSigningKey returns an error in that case.
+func NewTestSigningKey(alg, seed string) (crypto.Signer, error) {
+	random := &seededReader{seed: alg + "/" + seed}
+	var key crypto.Signer
+	var err error
+	switch alg {
+	case "RS256":
+		key, err = rsa.GenerateKey(random, 2048)
+	case "ES256":
+		key, err = ecdsa.GenerateKey(elliptic.P256(), random)
+	case "ES384":
+		key, err = ecdsa.GenerateKey(elliptic.P384(), random)
+	case "ES512":
+		key, err = ecdsa.GenerateKey(elliptic.P521(), random)
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if random.counter == 0 {
+		return nil, errors.New("the key generation ignores the seed: set GODEBUG=cryptocustomrand=1")
+	}
+	return key, nil
+}
+
+// seededReader is the deterministic stream of SHA-256 blocks of the seed and the block counter.
+type seededReader struct {
+	seed    string
+	counter uint32
+	block   []byte
+}
+
+func (r *seededReader) Read(p []byte) (int, error) {
+	// the key generation reads a single byte at random to keep callers from relying on the output of the custom sources,
+	// so single byte reads do not advance the stream
+	if len(p) == 1 {
+		p[0] = 0
+		return 1, nil
+	}
+	for n := 0; n < len(p); {
+		if len(r.block) == 0 {
+			var counter [4]byte
+			binary.BigEndian.PutUint32(counter[:], r.counter)
+			r.counter++
+			h := sha256.New()
+			h.Write(counter[:])
+			h.Write([]byte(r.seed))
+			r.block = h.Sum(nil)
+		}
+		c := copy(p[n:], r.block)
+		r.block = r.block[c:]
+		n += c
+	}
+	return len(p), nil
+}
+
+// signingAlgorithm returns the JWT algorithm and the hash of the key.
+func signingAlgorithm(key crypto.Signer) (string, crypto.Hash, error) {
+	switch pub := key.Public().(type) {
+	case *rsa.PublicKey:
+		return "RS256", crypto.SHA256, nil
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			return "ES256", crypto.SHA256, nil
+		case elliptic.P384():
+			return "ES384", crypto.SHA384, nil
+		case elliptic.P521():
+			return "ES512", crypto.SHA512, nil
+		}
+	}
+	return "", 0, fmt.Errorf("unsupported signing key %T", key.Public())
+}
+
+// keyID returns the ID of the key that is used as "kid" of the signed tokens.
+func keyID(key crypto.Signer) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return "", err
+	}
+	sum := sha1.Sum(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// signJWT returns the JWT with the claims that is signed with the key.
+func signJWT(key crypto.Signer, claims any) (string, error) {
+	alg, hash, err := signingAlgorithm(key)
+	if err != nil {
+		return "", err
+	}
+	kid, err := keyID(key)
+	if err != nil {
+		return "", err
+	}
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(payload)
+	h := hash.New()
+	h.Write([]byte(unsigned))
+	sig, err := key.Sign(rand.Reader, h.Sum(nil), hash)
+	if err != nil {
+		return "", err
+	}
+	if pub, ok := key.Public().(*ecdsa.PublicKey); ok {
+		// JWS uses the fixed size concatenation of r and s instead of ASN.1
+		var rs struct{ R, S *big.Int }
+		if _, err := asn1.Unmarshal(sig, &rs); err != nil {
+			return "", err
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		sig = append(rs.R.FillBytes(make([]byte, size)), rs.S.FillBytes(make([]byte, size))...)
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
@@ -0,0 +1,246 @@
+package metadataserver_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestNewTestSigningKey(t *testing.T) {
+	for _, alg := range []string{"RS256", "ES256", "ES384", "ES512"} {
+		t.Run(alg, func(t *testing.T) {
+			key1, err := metadataserver.NewTestSigningKey(alg, "seed")
+			if err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			key2, _ := metadataserver.NewTestSigningKey(alg, "seed")
+			key3, _ := metadataserver.NewTestSigningKey(alg, "another seed")
+			pub1, _ := x509.MarshalPKIXPublicKey(key1.Public())
+			pub2, _ := x509.MarshalPKIXPublicKey(key2.Public())
+			pub3, _ := x509.MarshalPKIXPublicKey(key3.Public())
+			if string(pub1) != string(pub2) {
+				t.Errorf("expected the same key for the same seed")
+			}
+			if string(pub1) == string(pub3) {
+				t.Errorf("expected different keys for different seeds")
+			}
+		})
+	}
+	if _, err := metadataserver.NewTestSigningKey("HS256", "seed"); err == nil {
+		t.Errorf("expected error, got nil")
+	}
+}
+
+func TestIdentityTokens(t *testing.T) {
+	const email = "app@test-project-id.iam.gserviceaccount.com"
+	tests := []struct {
+		alg   string
+		query string
+		want  map[string]any
+	}{
+		{
+			alg:   "RS256",
+			query: "?audience=https://api.example.com",
+			want:  map[string]any{"iss": "https://accounts.google.com", "aud": "https://api.example.com", "azp": email, "sub": email},
+		},
+		{
+			alg:   "ES256",
+			query: "?audience=https://api.example.com&format=full",
+			want: map[string]any{"iss": "https://accounts.google.com", "aud": "https://api.example.com", "azp": email, "sub": email, "email": email, "email_verified": true,
+				"google": map[string]any{"compute_engine": map[string]any{"project_id": "test-project-id"}}},
+		},
+		{
+			alg:   "ES384",
+			query: "?audience=aud",
+			want:  map[string]any{"iss": "https://accounts.google.com", "aud": "aud", "azp": email, "sub": email},
+		},
+		{
+			alg:   "ES512",
+			query: "?audience=aud",
+			want:  map[string]any{"iss": "https://accounts.google.com", "aud": "aud", "azp": email, "sub": email},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.alg, func(t *testing.T) {
+			key, err := metadataserver.NewTestSigningKey(test.alg, "identity")
+			if err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			s, err := metadataserver.New(
+				metadataserver.WithServiceAccounts(metadataserver.ServiceAccount{Email: email}),
+				metadataserver.WithSigningKey(key),
+			)
+			if err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			status, token := getIdentity(t, s, "default", test.query)
+			if status != http.StatusOK {
+				t.Fatalf("expected status 200, got: %d %q", status, token)
+			}
+			claims := verifyJWT(t, token, test.alg, key.Public())
+			if claims["exp"].(float64)-claims["iat"].(float64) != 3600 {
+				t.Errorf("expected token to expire in an hour, got: %v", claims)
+			}
+			delete(claims, "exp")
+			delete(claims, "iat")
+			if diff := cmp.Diff(test.want, claims); diff != "" {
+				t.Errorf("claims mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestIdentityTokenInstanceClaims(t *testing.T) {
+	key, err := metadataserver.NewTestSigningKey("RS256", "identity")
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	name := filepath.Join(t.TempDir(), "config.json")
+	data := `{"metadata": {"instance/id": {"value": "4520031799277581759"}, "instance/name": {"value": "test-vm"}}}`
+	if err := os.WriteFile(name, []byte(data), 0o600); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s, err := metadataserver.New(
+		metadataserver.WithConfigFile(name),
+		metadataserver.WithProject("my-project", 42),
+		metadataserver.WithZone("europe-west1-b"),
+		metadataserver.WithServiceAccounts(metadataserver.ServiceAccount{Email: "sa@example.com"}),
+		metadataserver.WithSigningKey(key),
+		metadataserver.WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	status, token := getIdentity(t, s, "default", "?audience=aud&format=full")
+	if status != http.StatusOK {
+		t.Fatalf("expected status 200, got: %d %q", status, token)
+	}
+	claims := verifyJWT(t, token, "RS256", key.Public())
+	want := map[string]any{
+		"iss": "https://accounts.google.com", "aud": "aud", "azp": "sa@example.com", "sub": "sa@example.com",
+		"email": "sa@example.com", "email_verified": true,
+		"iat": float64(now.Unix()), "exp": float64(now.Add(time.Hour).Unix()),
+		"google": map[string]any{"compute_engine": map[string]any{
+			"instance_id":    "4520031799277581759",
+			"instance_name":  "test-vm",
+			"project_id":     "my-project",
+			"project_number": float64(42),
+			"zone":           "europe-west1-b",
+		}},
+	}
+	if diff := cmp.Diff(want, claims); diff != "" {
+		t.Errorf("claims mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestIdentityTokenErrors(t *testing.T) {
+	key, err := metadataserver.NewTestSigningKey("ES256", "identity")
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	s, err := metadataserver.New(
+		metadataserver.WithServiceAccounts(metadataserver.ServiceAccount{Email: "sa@example.com"}),
+		metadataserver.WithSigningKey(key),
+	)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if status, _ := getIdentity(t, s, "sa@example.com", ""); status != http.StatusBadRequest {
+		t.Errorf("expected status 400 without audience, got: %d", status)
+	}
+
+	s, err = metadataserver.New(metadataserver.WithServiceAccounts(metadataserver.ServiceAccount{Email: "sa@example.com"}))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if status, _ := getIdentity(t, s, "default", "?audience=aud"); status != http.StatusNotFound {
+		t.Errorf("expected status 404 without signing key, got: %d", status)
+	}
+
+	_, edKey, _ := ed25519.GenerateKey(nil)
+	_, err = metadataserver.New(
+		metadataserver.WithServiceAccounts(metadataserver.ServiceAccount{Email: "sa@example.com"}),
+		metadataserver.WithSigningKey(edKey),
+	)
+	if want := "invalid signing key: unsupported signing key ed25519.PublicKey"; err == nil || err.Error() != want {
+		t.Errorf("expected error %q, got: %v", want, err)
+	}
+}
+
+func getIdentity(t *testing.T, s *metadataserver.Server, account, query string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/instance/service-accounts/"+account+"/identity"+query, nil)
+	req.Header.Set("Metadata-Flavor", "Google")
+	rec := httptest.NewRecorder()
+	s.HttpHandler().ServeHTTP(rec, req)
+	body, _ := io.ReadAll(rec.Body)
+	return rec.Code, string(body)
+}
+
+// verifyJWT verifies the signature of the token with the public key and returns its claims.
+func verifyJWT(t *testing.T, token, alg string, pub crypto.PublicKey) map[string]any {
+	t.Helper()
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("expected JWT, got: %q", token)
+	}
+	var header map[string]string
+	data, _ := base64.RawURLEncoding.DecodeString(parts[0])
+	if err := json.Unmarshal(data, &header); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if header["alg"] != alg || header["typ"] != "JWT" || header["kid"] == "" {
+		t.Errorf("unexpected header: %v", header)
+	}
+	sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	signed := []byte(parts[0] + "." + parts[1])
+	var digest []byte
+	switch alg {
+	case "RS256", "ES256":
+		sum := sha256.Sum256(signed)
+		digest = sum[:]
+	case "ES384":
+		sum := sha512.Sum384(signed)
+		digest = sum[:]
+	case "ES512":
+		sum := sha512.Sum512(signed)
+		digest = sum[:]
+	}
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest, sig); err != nil {
+			t.Errorf("invalid signature: %v", err)
+		}
+	case *ecdsa.PublicKey:
+		r := new(big.Int).SetBytes(sig[:len(sig)/2])
+		s := new(big.Int).SetBytes(sig[len(sig)/2:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			t.Errorf("invalid signature")
+		}
+	}
+	var claims map[string]any
+	data, _ = base64.RawURLEncoding.DecodeString(parts[1])
+	if err := json.Unmarshal(data, &claims); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	return claims
+}
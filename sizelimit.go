@@ -0,0 +1,167 @@
+package metadataserver
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"strconv"
+)
+
+// ErrResponseTooLarge is returned to the handlers that write the metadata value over the limit set with [WithMaxResponseSize].
+var ErrResponseTooLarge error = errors.New("response exceeds the size limit")
+
+// SizeLimitMode defines how the server responds when the metadata value exceeds the size limit.
+type SizeLimitMode int
+
+const (
+	// SizeLimitTruncate makes the server to serve the first bytes of the value up to the limit.
+	SizeLimitTruncate SizeLimitMode = iota
+	// SizeLimitReject makes the server to respond with 500 (Internal Server Error) instead of the value.
+	SizeLimitReject
+)
+
+// WithMaxResponseSize sets a new server to limit the size of the metadata values at the paths to limit bytes.
+// Paths are relative to the server's endpoint and can use patterns supported by [path.Match].
+// If no paths are defined the limit applies to all metadata. If more than one limit applies to the path, the first one is used.
+// The mode defines whether the oversized values are truncated or rejected. Writes over the limit fail with [ErrResponseTooLarge],
+// so handlers that stream values stop early. Use it to protect long-running servers from runaway handlers
+// or to test how clients handle truncated values. The limits of the paths apply to their aliases too.
+// The limit must not be negative, otherwise [New] returns [ConfigError].
+func WithMaxResponseSize(limit int64, mode SizeLimitMode, paths ...string) Option {
+	return func(s *Server) {
+		s.sizeLimits = append(s.sizeLimits, sizeLimit{limit: limit, mode: mode, paths: paths})
+	}
+}
+
+type sizeLimit struct {
+	limit int64
+	mode  SizeLimitMode
+	paths []string
+}
+
+// checkSizeLimits validates the size limits.
+func (s *Server) checkSizeLimits() error {
+	for _, sl := range s.sizeLimits {
+		if sl.limit < 0 {
+			return fmt.Errorf("response size limit %d is negative", sl.limit)
+		}
+	}
+	return nil
+}
+
+// sizeLimitOf returns the size limit of the metadata at the key or nil if no limit applies.
+// The alias key is resolved to the key it refers to.
+func (s *Server) sizeLimitOf(key string) *sizeLimit {
+	key = s.resolveKey(key)
+	for i, sl := range s.sizeLimits {
+		if len(sl.paths) == 0 {
+			return &s.sizeLimits[i]
+		}
+		for _, p := range sl.paths {
+			if ok, _ := path.Match(normalizeKey(p), key); ok {
+				return &s.sizeLimits[i]
+			}
+		}
+	}
+	return nil
+}
+
+// limitResponseSize truncates or rejects the metadata values that exceed the size limit of their paths.
+// Rejected responses are buffered up to the limit, so the error status can be sent instead of the value.
+func (s *Server) limitResponseSize(next http.Handler) http.Handler {
+	if len(s.sizeLimits) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, ok := s.keyOf(r.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		sl := s.sizeLimitOf(key)
+		if sl == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if sl.mode == SizeLimitReject {
+			rw := &rejectWriter{responseBuffer: newResponseBuffer(), limit: sl.limit}
+			next.ServeHTTP(rw, r)
+			if rw.exceeded {
+				s.handlerLogger.WarnContext(r.Context(), "metadata value exceeds size limit",
+					slog.String("handler", r.URL.Path), slog.Int64("limit", sl.limit))
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			rw.copyTo(w)
+			return
+		}
+		tw := &truncateWriter{w: w, left: sl.limit}
+		next.ServeHTTP(tw, r)
+		if tw.truncated {
+			s.handlerLogger.WarnContext(r.Context(), "metadata value is truncated",
+				slog.String("handler", r.URL.Path), slog.Int64("limit", sl.limit))
+		}
+	})
+}
+
+// rejectWriter buffers the response until the request is served and fails the writes over the limit.
+type rejectWriter struct {
+	*responseBuffer
+	limit    int64
+	exceeded bool
+}
+
+func (rw *rejectWriter) Write(b []byte) (int, error) {
+	if rw.exceeded || int64(rw.body.Len()+len(b)) > rw.limit {
+		rw.exceeded = true
+		return 0, ErrResponseTooLarge
+	}
+	return rw.responseBuffer.Write(b)
+}
+
+// truncateWriter writes the response up to the limit and drops the rest.
+// Content-Length that the handler sets is lowered to the limit.
+type truncateWriter struct {
+	w           http.ResponseWriter
+	left        int64
+	wroteHeader bool
+	truncated   bool
+}
+
+func (tw *truncateWriter) Header() http.Header {
+	return tw.w.Header()
+}
+
+func (tw *truncateWriter) WriteHeader(status int) {
+	if tw.wroteHeader {
+		return
+	}
+	tw.wroteHeader = true
+	h := tw.w.Header()
+	if n, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64); err == nil && n > tw.left {
+		h.Set("Content-Length", strconv.FormatInt(tw.left, 10))
+	}
+	tw.w.WriteHeader(status)
+}
+
+func (tw *truncateWriter) Write(b []byte) (int, error) {
+	tw.WriteHeader(http.StatusOK)
+	if int64(len(b)) <= tw.left {
+		n, err := tw.w.Write(b)
+		tw.left -= int64(n)
+		return n, err
+	}
+	tw.truncated = true
+	n, err := tw.w.Write(b[:tw.left])
+	tw.left -= int64(n)
+	if err != nil {
+		return n, err
+	}
+	return n, ErrResponseTooLarge
+}
+
+func (tw *truncateWriter) Unwrap() http.ResponseWriter {
+	return tw.w
+}
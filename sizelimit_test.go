@@ -0,0 +1,80 @@
+package metadataserver_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestMaxResponseSize(t *testing.T) {
+	s, err := metadataserver.New(
+		metadataserver.WithHandlers(map[string]metadataserver.Metadata{
+			"instance/attributes/small": func() string { return "small" },
+			"instance/attributes/large": func() string { return strings.Repeat("x", 100) },
+			"instance/hostname":         func() string { return strings.Repeat("h", 100) },
+		}),
+		metadataserver.WithStreamHandlers(map[string]metadataserver.StreamMetadata{
+			"instance/attributes/user-data": func() io.Reader { return strings.NewReader(strings.Repeat("u", 100)) },
+			"instance/attributes/endless":   func() io.Reader { return endlessReader{} },
+		}),
+		metadataserver.WithMaxResponseSize(10, metadataserver.SizeLimitReject, "instance/hostname"),
+		metadataserver.WithMaxResponseSize(10, metadataserver.SizeLimitTruncate, "instance/attributes/*"),
+		metadataserver.WithAliases(map[string]string{"hostname": "instance/hostname"}),
+	)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		want       string
+		wantLength string
+	}{
+		{name: "under limit", method: http.MethodGet, path: "/instance/attributes/small", wantStatus: http.StatusOK, want: "small"},
+		{name: "truncated", method: http.MethodGet, path: "/instance/attributes/large", wantStatus: http.StatusOK, want: "xxxxxxxxxx"},
+		{name: "truncated stream", method: http.MethodGet, path: "/instance/attributes/user-data", wantStatus: http.StatusOK, want: "uuuuuuuuuu"},
+		{name: "endless stream", method: http.MethodGet, path: "/instance/attributes/endless", wantStatus: http.StatusOK, want: "0000000000"},
+		{name: "truncated head", method: http.MethodHead, path: "/instance/attributes/large", wantStatus: http.StatusOK, wantLength: "10"},
+		{name: "rejected", method: http.MethodGet, path: "/instance/hostname", wantStatus: http.StatusInternalServerError, want: "Internal Server Error\n"},
+		{name: "rejected alias", method: http.MethodGet, path: "/hostname", wantStatus: http.StatusInternalServerError, want: "Internal Server Error\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(test.method, metadataserver.DefaultEndpoint+test.path, nil))
+			if rec.Code != test.wantStatus {
+				t.Errorf("expected status %d, got: %d", test.wantStatus, rec.Code)
+			}
+			if got := rec.Body.String(); got != test.want {
+				t.Errorf("expected %q, got: %q", test.want, got)
+			}
+			if got := rec.Header().Get("Content-Length"); test.wantLength != "" && got != test.wantLength {
+				t.Errorf("expected Content-Length %q, got: %q", test.wantLength, got)
+			}
+		})
+	}
+}
+
+func TestMaxResponseSizeInvalid(t *testing.T) {
+	_, err := metadataserver.New(metadataserver.WithMaxResponseSize(-1, metadataserver.SizeLimitTruncate))
+	if !errors.Is(err, metadataserver.ErrConfigInvalid) {
+		t.Errorf("expected %v, got: %v", metadataserver.ErrConfigInvalid, err)
+	}
+}
+
+// endlessReader is a runaway value that never ends.
+type endlessReader struct{}
+
+func (endlessReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = '0'
+	}
+	return len(p), nil
+}
@@ -0,0 +1,84 @@
+package metadataserver
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// state describes the server's mutable state that is persisted in the state file.
+type state struct {
+	Values   map[string]string `json:"values,omitempty"`
+	Statuses map[string]int    `json:"statuses,omitempty"`
+	Disabled map[string]bool   `json:"disabled,omitempty"`
+	Counters map[string]int64  `json:"counters,omitempty"`
+}
+
+// WithStateFile sets a new server with a file to persist the server's mutable state.
+// The state includes values set with [Server.SetValue], guest attributes written by the clients,
+// statuses set with [Server.SetStatus], paths disabled with [Server.DisablePath]
+// and the number of times each [Counter] of the server's configuration was served.
+// The state is loaded from the file when the server is created and saved to the file when the server stops.
+// The file is created if it does not exist.
+func WithStateFile(path string) Option {
+	return func(s *Server) {
+		s.stateFile = path
+	}
+}
+
+// SaveState writes the server's mutable state to the file set with [WithStateFile].
+// It does nothing if no state file is set.
+func (s *Server) SaveState() error {
+	if s.stateFile == "" {
+		return nil
+	}
+	s.mu.RLock()
+	st := state{Values: s.values, Statuses: s.statuses, Disabled: s.disabled}
+	for k, h := range s.config.StatefulHandlers {
+		if c, ok := h.(*Counter); ok && c.Count() > 0 {
+			if st.Counters == nil {
+				st.Counters = make(map[string]int64)
+			}
+			st.Counters[normalizeKey(k)] = c.Count()
+		}
+	}
+	data, err := json.MarshalIndent(st, "", "    ")
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	tmp := s.stateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.stateFile)
+}
+
+func (s *Server) loadState() error {
+	if s.stateFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.stateFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values = st.Values
+	s.statuses = st.Statuses
+	s.disabled = st.Disabled
+	for k, h := range s.config.StatefulHandlers {
+		if c, ok := h.(*Counter); ok {
+			c.n.Store(st.Counters[normalizeKey(k)])
+		}
+	}
+	return nil
+}
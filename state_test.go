@@ -0,0 +1,68 @@
+package metadataserver_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestStateFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "state.json")
+	newServer := func() (*metadataserver.Server, http.Handler) {
+		s, err := metadataserver.New(
+			metadataserver.WithStateFile(file),
+			metadataserver.WithHandler("instance/attributes/polls", metadataserver.NewCounter(1, 1)))
+		if err != nil {
+			t.Fatalf("expected no errors, got: %v", err)
+		}
+		return s, s.HttpHandler()
+	}
+	get := func(h http.Handler, key string) (int, string) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/"+key, nil))
+		return rec.Code, rec.Body.String()
+	}
+	s, h := newServer()
+	s.SetValue("instance/attributes/my-flag", "on")
+	s.SetStatus("project/project-id", http.StatusServiceUnavailable)
+	s.DisablePath("instance/zone")
+	req := httptest.NewRequest(http.MethodPut, metadataserver.DefaultEndpoint+"/instance/guest-attributes/hostkeys/ssh-rsa", strings.NewReader("AAAA"))
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	get(h, "instance/attributes/polls")
+	get(h, "instance/attributes/polls")
+	if err := s.SaveState(); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+
+	restored, h := newServer()
+	if got, _ := restored.GetValue("instance/attributes/my-flag"); got != "on" {
+		t.Errorf("expected restored value %q, got: %q", "on", got)
+	}
+	if code, _ := get(h, "project/project-id"); code != http.StatusServiceUnavailable {
+		t.Errorf("expected restored status %d, got: %d", http.StatusServiceUnavailable, code)
+	}
+	if restored.PathEnabled("instance/zone") {
+		t.Errorf("expected %q to stay disabled", "instance/zone")
+	}
+	if _, body := get(h, "instance/guest-attributes/hostkeys/ssh-rsa"); body != "AAAA" {
+		t.Errorf("expected restored guest attribute %q, got: %q", "AAAA", body)
+	}
+	if _, body := get(h, "instance/attributes/polls"); body != "3" {
+		t.Errorf("expected the counter to continue from %q, got: %q", "3", body)
+	}
+}
+
+func TestInvalidStateFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(file, []byte("not json"), 0o644); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if _, err := metadataserver.New(metadataserver.WithStateFile(file)); err == nil {
+		t.Errorf("expected error, got nil")
+	}
+}
@@ -0,0 +1,115 @@
+package metadataserver
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+)
+
+var (
+	textPlainHeader = []string{"text/plain; charset=utf-8"}
+)
+
+// route describes a metadata path registered in the server's router.
+type route struct {
+	key string
+	// params are the named segments of the key
+	params  []routeParam
+	handler Metadata
+	// fn is not nil if the metadata depends on the request
+	fn MetadataFunc
+	// bytes is not nil if the metadata is a binary value
+	bytes BytesMetadata
+	// response is not nil if the handler controls the response status and headers
+	response Handler
+	// stream is not nil if the metadata is streamed
+	stream StreamMetadata
+	// stateful is true if the response handler keeps state, e.g. a counter, so it is served only at its own path
+	stateful bool
+	// static is not nil if the handler returns a literal value
+	static *staticResponse
+	// source describes where the value comes from (see [Configuration.Source])
+	source string
+	// lastETag is the entity tag of the last value of the handler; it is shared by the routes matched by wildcards
+	lastETag *atomic.Pointer[lastETag]
+}
+
+// staticResponse keeps the precomputed response of a handler that returns a literal value.
+type staticResponse struct {
+	body          []byte
+	contentLength []string
+	etag          []string
+}
+
+func newStaticResponse(value string) *staticResponse {
+	return &staticResponse{
+		body:          []byte(value),
+		contentLength: []string{strconv.Itoa(len(value))},
+		etag:          []string{etag(value)},
+	}
+}
+
+// newRoute creates a route for the handler at the key.
+// The response is precomputed if the configuration defines a literal value for the key
+// and the handler still returns this value.
+func newRoute(c *Configuration, key string, handler Metadata) *route {
+	rt := &route{key: normalizeKey(key), handler: handler, lastETag: new(atomic.Pointer[lastETag])}
+	if v, ok := c.literals[key]; ok && handler() == v {
+		rt.static = newStaticResponse(v)
+	}
+	return rt
+}
+
+// newStreamRoute creates a route for the streamed metadata at the key.
+func newStreamRoute(key string, stream StreamMetadata) *route {
+	return &route{key: normalizeKey(key), stream: stream}
+}
+
+// newFuncRoute creates a route for the request-aware handler at the key.
+func newFuncRoute(key string, fn MetadataFunc) *route {
+	return &route{key: normalizeKey(key), fn: fn, lastETag: new(atomic.Pointer[lastETag])}
+}
+
+// newBytesRoute creates a route for the binary metadata at the key.
+func newBytesRoute(key string, bytes BytesMetadata) *route {
+	return &route{key: normalizeKey(key), bytes: bytes}
+}
+
+// newResponseRoute creates a route for the handler that controls the response at the key.
+func newResponseRoute(key string, response Handler) *route {
+	return &route{key: normalizeKey(key), response: response}
+}
+
+// valueListed reports whether the value of the route is included in the recursive listing of a directory.
+// Streamed metadata is not read into memory and stateful handlers are not affected by the listings.
+func (rt *route) valueListed() bool {
+	return rt.stream == nil && !rt.stateful
+}
+
+// value returns the metadata value of the route for the request.
+// Streamed metadata is read completely.
+func (rt *route) value(r *http.Request) (string, error) {
+	switch {
+	case rt.fn != nil:
+		return rt.fn(r.Context(), r)
+	case rt.response != nil:
+		res, err := rt.response.Serve(r.Context(), r)
+		if err == nil && res.Status != 0 && res.Status != http.StatusOK {
+			err = fmt.Errorf("metadata handler responds with status %d", res.Status)
+		}
+		return res.Body, err
+	case rt.bytes != nil:
+		b, _ := rt.bytes()
+		return string(b), nil
+	case rt.stream != nil:
+		body := rt.stream()
+		if c, ok := body.(io.Closer); ok {
+			defer c.Close()
+		}
+		b, err := io.ReadAll(body)
+		return string(b), err
+	}
+	return rt.handler(), nil
+}
@@ -0,0 +1,97 @@
+package metadataserver_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestStaticResponse(t *testing.T) {
+	c, err := metadataserver.NewConfigFromFile("test/fixtures/config_literal_handlers.json")
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	s, err := metadataserver.New(metadataserver.WithConfiguration(c))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/entry1", nil))
+	if got := rec.Body.String(); got != "one" {
+		t.Errorf("expected response %q, got: %q", "one", got)
+	}
+	if rec.Header().Get("ETag") == "" || rec.Header().Get("Content-Length") != "3" {
+		t.Errorf("expected precomputed headers, got: %v", rec.Header())
+	}
+
+	s.SetValue("entry1", "override")
+	rec = httptest.NewRecorder()
+	s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/entry1", nil))
+	if got := rec.Body.String(); got != "override" {
+		t.Errorf("expected response %q, got: %q", "override", got)
+	}
+}
+
+func TestStaticResponseReplacedHandler(t *testing.T) {
+	c, err := metadataserver.NewConfigFromFile("test/fixtures/config_literal_handlers.json")
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	c.Handlers["entry1"] = func() string { return "replaced" }
+	s, err := metadataserver.New(metadataserver.WithConfiguration(c))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/entry1", nil))
+	if got := rec.Body.String(); got != "replaced" {
+		t.Errorf("expected response %q, got: %q", "replaced", got)
+	}
+}
+
+// discardResponseWriter is a response writer that can be reused across requests without allocations.
+// Like the response writer of [http.Server] it implements [io.StringWriter].
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w *discardResponseWriter) Header() http.Header               { return w.header }
+func (w *discardResponseWriter) Write(b []byte) (int, error)       { return len(b), nil }
+func (w *discardResponseWriter) WriteString(s string) (int, error) { return len(s), nil }
+func (w *discardResponseWriter) WriteHeader(int)                   {}
+
+func benchmarkHandler(b *testing.B, s *metadataserver.Server, path string) {
+	h := s.HttpHandler()
+	r := httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+path, nil)
+	w := &discardResponseWriter{header: make(http.Header)}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		clear(w.header)
+		h.ServeHTTP(w, r)
+	}
+}
+
+func BenchmarkLiteralHandler(b *testing.B) {
+	c, err := metadataserver.NewConfigFromFile("test/fixtures/config_literal_handlers.json")
+	if err != nil {
+		b.Fatalf("expected no errors, got: %v", err)
+	}
+	s, err := metadataserver.New(metadataserver.WithConfiguration(c))
+	if err != nil {
+		b.Fatalf("expected no errors, got: %v", err)
+	}
+	benchmarkHandler(b, s, "/entry1")
+}
+
+func BenchmarkFuncHandler(b *testing.B) {
+	s, err := metadataserver.New(metadataserver.WithHandlers(map[string]metadataserver.Metadata{
+		"entry1": func() string { return "one" },
+	}))
+	if err != nil {
+		b.Fatalf("expected no errors, got: %v", err)
+	}
+	benchmarkHandler(b, s, "/entry1")
+}
@@ -0,0 +1,47 @@
+package metadataserver
+
+import (
+	"net/http"
+	"time"
+)
+
+// PathStats describes requests served at a metadata path.
+type PathStats struct {
+	Requests   int       `json:"requests"`
+	Errors     int       `json:"errors"`
+	LastAccess time.Time `json:"lastAccess"`
+}
+
+// Stats returns request statistics per metadata path relative to the server's endpoint.
+// Requests that were responded with status 400 or higher are counted as errors.
+func (s *Server) Stats() map[string]PathStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stats := make(map[string]PathStats, len(s.stats))
+	for k, v := range s.stats {
+		stats[k] = *v
+	}
+	return stats
+}
+
+// updateStatsLocked counts the request in the statistics.
+// The caller must hold s.mu.
+func (s *Server) updateStatsLocked(record RequestRecord) {
+	key, ok := s.keyOf(record.Path)
+	if !ok {
+		return
+	}
+	if s.stats == nil {
+		s.stats = make(map[string]*PathStats)
+	}
+	ps, found := s.stats[key]
+	if !found {
+		ps = &PathStats{}
+		s.stats[key] = ps
+	}
+	ps.Requests++
+	if record.Status >= http.StatusBadRequest {
+		ps.Errors++
+	}
+	ps.LastAccess = record.Time
+}
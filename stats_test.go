@@ -0,0 +1,62 @@
+package metadataserver_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/minherz/metadataserver"
+)
+
+func TestStats(t *testing.T) {
+	s, err := metadataserver.New()
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	s.SetStatus("instance/zone", http.StatusServiceUnavailable)
+	h := s.HttpHandler()
+	start := time.Now()
+	for _, p := range []string{"project/project-id", "project/project-id/", "instance/zone", "instance/missing", "instance/zone"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/"+p, nil))
+	}
+	// requests outside of the endpoint are not counted
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/other", nil))
+
+	want := map[string]metadataserver.PathStats{
+		"project/project-id": {Requests: 2},
+		"instance/zone":      {Requests: 2, Errors: 2},
+		"instance/missing":   {Requests: 1, Errors: 1},
+	}
+	stats := s.Stats()
+	if diff := cmp.Diff(want, stats, cmpopts.IgnoreFields(metadataserver.PathStats{}, "LastAccess")); diff != "" {
+		t.Errorf("stats mismatch (-want +got):\n%s", diff)
+	}
+	for p, ps := range stats {
+		if ps.LastAccess.Before(start) || ps.LastAccess.After(time.Now()) {
+			t.Errorf("%s: expected last access after %v, got: %v", p, start, ps.LastAccess)
+		}
+	}
+
+	admin := httptest.NewServer(s.AdminHttpHandler())
+	defer admin.Close()
+	var got map[string]metadataserver.PathStats
+	if err := json.Unmarshal([]byte(adminRequest(t, http.MethodGet, admin.URL+"/stats", "")), &got); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if diff := cmp.Diff(stats, got, cmpopts.EquateApproxTime(0)); diff != "" {
+		t.Errorf("admin stats mismatch (-want +got):\n%s", diff)
+	}
+
+	s.Reset()
+	if got := s.Stats(); len(got) != 0 {
+		t.Errorf("expected no stats after reset, got: %v", got)
+	}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/project/project-id", nil))
+	if got := s.Stats()["project/project-id"].Requests; got != 1 {
+		t.Errorf("expected the counters to restart after reset, got: %d", got)
+	}
+}
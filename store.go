@@ -0,0 +1,206 @@
+package metadataserver
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// SetValue sets a metadata value at the path relative to the server's endpoint.
+// The value is served instead of the value of the handler registered at the same path.
+// If no handler is registered at the path, the server starts serving the value at that path.
+//
+// It is safe to call SetValue while the server is running.
+func (s *Server) SetValue(path, value string) {
+	s.setValue(path, value, AuditSourceAPI)
+}
+
+func (s *Server) setValue(path, value, source string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.values == nil {
+		s.values = make(map[string]string)
+	}
+	key := s.resolveKey(path)
+	old := s.values[key]
+	s.values[key] = value
+	s.auditLocked(source, ActionSet, key, old, value)
+	s.publishLocked(ChangeEvent{Time: s.now(), Path: key, OldValue: old, Value: value})
+}
+
+// GetValue returns the metadata value that the server serves at the path relative to the server's endpoint.
+// The value set with [Server.SetValue] takes precedence over the value returned by the handler.
+// Handlers set with [WithFuncHandlers] are called with a GET request to the path.
+// It returns false if there is no value or handler defined for the path or if the handler fails.
+func (s *Server) GetValue(path string) (string, bool) {
+	key := s.resolveKey(path)
+	if v, ok := s.storedValue(key); ok {
+		return v, true
+	}
+	r, err := http.NewRequest(http.MethodGet, s.config.Endpoint+"/"+key, nil)
+	if err != nil {
+		return "", false
+	}
+	if rt := s.matchRoute(r, key); rt != nil {
+		v, err := rt.value(r)
+		return v, err == nil
+	}
+	return "", false
+}
+
+// DeleteValue removes the metadata value set with [Server.SetValue] at the path.
+// Handler registered at the same path becomes served again.
+func (s *Server) DeleteValue(path string) {
+	s.deleteValue(path, AuditSourceAPI)
+}
+
+func (s *Server) deleteValue(path, source string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := s.resolveKey(path)
+	if old, ok := s.values[key]; ok {
+		delete(s.values, key)
+		s.auditLocked(source, ActionDelete, key, old, "")
+		s.publishLocked(ChangeEvent{Time: s.now(), Path: key, OldValue: old, Deleted: true})
+	}
+}
+
+func (s *Server) storedValue(key string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.values[key]
+	return v, ok
+}
+
+// SetStatus makes the server to respond with the HTTP status code at the path relative to the server's endpoint.
+// Use status 0 to restore serving the metadata value at the path.
+//
+// It is safe to call SetStatus while the server is running.
+func (s *Server) SetStatus(path string, status int) {
+	s.setStatus(path, status, AuditSourceAPI)
+}
+
+func (s *Server) setStatus(path string, status int, source string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := s.resolveKey(path)
+	s.auditLocked(source, ActionStatus, key, statusText(s.statuses[key]), statusText(status))
+	if status == 0 {
+		delete(s.statuses, key)
+		return
+	}
+	if s.statuses == nil {
+		s.statuses = make(map[string]int)
+	}
+	s.statuses[key] = status
+}
+
+func (s *Server) forcedStatus(key string) (int, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	status, ok := s.statuses[key]
+	return status, ok
+}
+
+// DisablePath makes the server to respond with 404 (Not Found) at the path relative to the server's endpoint
+// until the path is enabled with [Server.EnablePath].
+//
+// It is safe to call DisablePath while the server is running.
+func (s *Server) DisablePath(path string) {
+	s.disablePath(path, AuditSourceAPI)
+}
+
+func (s *Server) disablePath(path, source string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.disabled == nil {
+		s.disabled = make(map[string]bool)
+	}
+	key := s.resolveKey(path)
+	s.disabled[key] = true
+	s.auditLocked(source, ActionDisable, key, "", "")
+}
+
+// EnablePath restores serving the metadata at the path that was disabled with [Server.DisablePath].
+func (s *Server) EnablePath(path string) {
+	s.enablePath(path, AuditSourceAPI)
+}
+
+func (s *Server) enablePath(path, source string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := s.resolveKey(path)
+	delete(s.disabled, key)
+	s.auditLocked(source, ActionEnable, key, "", "")
+}
+
+// PathEnabled reports whether the path is not disabled with [Server.DisablePath].
+func (s *Server) PathEnabled(path string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return !s.disabled[s.resolveKey(path)]
+}
+
+// Paths returns sorted paths of the served metadata relative to the server's endpoint.
+// The paths include paths of the configured handlers and of the values set with [Server.SetValue].
+func (s *Server) Paths() []string {
+	seen := make(map[string]bool)
+	s.mu.RLock()
+	for k := range s.config.Handlers {
+		seen[normalizeKey(k)] = true
+	}
+	for k := range s.config.FuncHandlers {
+		seen[normalizeKey(k)] = true
+	}
+	for k := range s.config.BytesHandlers {
+		seen[normalizeKey(k)] = true
+	}
+	for k := range s.config.ResponseHandlers {
+		seen[normalizeKey(k)] = true
+	}
+	for k := range s.config.StatefulHandlers {
+		seen[normalizeKey(k)] = true
+	}
+	for k := range s.config.parsed {
+		seen[normalizeKey(k)] = true
+	}
+	for k := range s.aliasMap() {
+		seen[k] = true
+	}
+	for k := range s.config.StreamHandlers {
+		seen[normalizeKey(k)] = true
+	}
+	for k := range s.values {
+		seen[k] = true
+	}
+	s.mu.RUnlock()
+	paths := make([]string, 0, len(seen))
+	for k := range seen {
+		paths = append(paths, k)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// keyOf returns the metadata path relative to the server's endpoint for the URL path.
+// It returns false if the URL path is outside of the endpoint.
+func (s *Server) keyOf(urlPath string) (string, bool) {
+	rest, ok := strings.CutPrefix(urlPath, s.config.Endpoint)
+	if !ok || (rest != "" && rest[0] != '/' && !strings.HasSuffix(s.config.Endpoint, "/")) {
+		return "", false
+	}
+	return normalizeKey(rest), true
+}
+
+// resolveKey returns the normalized key of the path. If the key is an alias, it returns the key that the alias refers to.
+func (s *Server) resolveKey(path string) string {
+	key := normalizeKey(path)
+	if target, ok := s.aliasMap()[key]; ok {
+		return target
+	}
+	return key
+}
+
+func normalizeKey(path string) string {
+	return strings.Trim(path, "/")
+}
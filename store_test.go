@@ -0,0 +1,157 @@
+package metadataserver_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/minherz/metadataserver"
+)
+
+func TestSetValue(t *testing.T) {
+	s, err := metadataserver.New(metadataserver.WithHandlers(map[string]metadataserver.Metadata{
+		"instance/zone": func() string { return "us-central1-a" },
+	}))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	ts := httptest.NewServer(s.HttpHandler())
+	defer ts.Close()
+
+	tests := []struct {
+		name       string
+		path       string
+		value      string
+		wantStatus int
+		want       string
+	}{
+		{
+			name:       "handler_value",
+			path:       "instance/zone",
+			wantStatus: http.StatusOK,
+			want:       "us-central1-a",
+		},
+		{
+			name:       "override_handler",
+			path:       "instance/zone",
+			value:      "europe-west1-b",
+			wantStatus: http.StatusOK,
+			want:       "europe-west1-b",
+		},
+		{
+			name:       "new_path",
+			path:       "/instance/attributes/my-flag/",
+			value:      "true",
+			wantStatus: http.StatusOK,
+			want:       "true",
+		},
+		{
+			name:       "unknown_path",
+			path:       "instance/attributes/unknown",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.value != "" {
+				s.SetValue(test.path, test.value)
+			}
+			got, ok := s.GetValue(test.path)
+			if ok != (test.wantStatus == http.StatusOK) || got != test.want {
+				t.Errorf("GetValue(%q) = %q, %v; want %q", test.path, got, ok, test.want)
+			}
+			res, err := http.Get(ts.URL + metadataserver.DefaultEndpoint + "/" + test.path)
+			if err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			data, _ := io.ReadAll(res.Body)
+			res.Body.Close()
+			if res.StatusCode != test.wantStatus {
+				t.Errorf("expected status %d, got: %d", test.wantStatus, res.StatusCode)
+			}
+			if test.wantStatus == http.StatusOK && string(data) != test.want {
+				t.Errorf("expected response %q, got: %q", test.want, string(data))
+			}
+		})
+	}
+
+	s.DeleteValue("instance/zone")
+	if got, _ := s.GetValue("instance/zone"); got != "us-central1-a" {
+		t.Errorf("expected handler value after delete, got: %q", got)
+	}
+}
+
+func TestDisablePath(t *testing.T) {
+	s, err := metadataserver.New()
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	ts := httptest.NewServer(s.HttpHandler())
+	defer ts.Close()
+	admin := httptest.NewServer(s.AdminHttpHandler())
+	defer admin.Close()
+	url := ts.URL + metadataserver.DefaultEndpoint + "/project/project-id"
+
+	s.DisablePath("project/project-id")
+	if got := getStatus(t, url); got != http.StatusNotFound {
+		t.Errorf("expected status %d, got: %d", http.StatusNotFound, got)
+	}
+	adminRequest(t, http.MethodPost, admin.URL+"/enable/project/project-id", "")
+	if got := getStatus(t, url); got != http.StatusOK {
+		t.Errorf("expected status %d, got: %d", http.StatusOK, got)
+	}
+	adminRequest(t, http.MethodPost, admin.URL+"/disable/project/project-id", "")
+	if s.PathEnabled("project/project-id") {
+		t.Errorf("expected path to be disabled")
+	}
+}
+
+func TestSnapshotDuringChanges(t *testing.T) {
+	s, err := metadataserver.New()
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			v := strconv.Itoa(i)
+			s.SetValue("instance/attributes/a", v)
+			s.SetValue("instance/attributes/b", v)
+		}
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		// "a" is set before "b", so a consistent snapshot has "a" equal to "b" or one step ahead
+		snapshot := s.Snapshot()
+		a, _ := strconv.Atoi(snapshot.Values["instance/attributes/a"])
+		b, _ := strconv.Atoi(snapshot.Values["instance/attributes/b"])
+		if a-b != 0 && a-b != 1 {
+			t.Fatalf("expected consistent snapshot, got a=%d and b=%d", a, b)
+		}
+	}
+
+	s.SetStatus("instance/zone", http.StatusServiceUnavailable)
+	s.DisablePath("instance/hostname")
+	snapshot := s.Snapshot()
+	if got := snapshot.Statuses["instance/zone"]; got != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got: %d", http.StatusServiceUnavailable, got)
+	}
+	if diff := cmp.Diff([]string{"instance/hostname"}, snapshot.Disabled); diff != "" {
+		t.Errorf("disabled paths mismatch (-want +got):\n%s", diff)
+	}
+	if snapshot.Configuration.Handlers["project/project-id"] == nil {
+		t.Errorf("expected the configuration in the snapshot")
+	}
+	snapshot.Values["instance/attributes/a"] = "changed"
+	if got, _ := s.GetValue("instance/attributes/a"); got != "199" {
+		t.Errorf("expected changes of the snapshot not to affect the server, got: %q", got)
+	}
+}
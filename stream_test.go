@@ -0,0 +1,63 @@
+package metadataserver_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestStreamHandlers(t *testing.T) {
+	large := strings.Repeat("x", 4<<20)
+	s, err := metadataserver.New(metadataserver.WithStreamHandlers(map[string]metadataserver.StreamMetadata{
+		"instance/attributes/user-data": func() io.Reader { return strings.NewReader(large) },
+	}))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/instance/attributes/user-data", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status %d, got: %d", http.StatusOK, rec.Code)
+	}
+	if rec.Body.Len() != len(large) {
+		t.Errorf("expected %d bytes, got: %d", len(large), rec.Body.Len())
+	}
+	if v, ok := s.GetValue("instance/attributes/user-data"); !ok || len(v) != len(large) {
+		t.Errorf("expected value of %d bytes, got: %d", len(large), len(v))
+	}
+}
+
+func TestFileHandlers(t *testing.T) {
+	c, err := metadataserver.NewConfigFromFile("test/fixtures/config_file_handlers.json")
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	s, err := metadataserver.New(metadataserver.WithConfiguration(c))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"instance/attributes/startup-script", http.StatusOK, "#!/bin/bash\necho \"startup\"\n"},
+		{"instance/attributes/missing", http.StatusInternalServerError, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/"+test.path, nil))
+			if rec.Code != test.wantStatus {
+				t.Errorf("expected status %d, got: %d", test.wantStatus, rec.Code)
+			}
+			if test.wantStatus == http.StatusOK && rec.Body.String() != test.wantBody {
+				t.Errorf("expected response %q, got: %q", test.wantBody, rec.Body.String())
+			}
+		})
+	}
+}
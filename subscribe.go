@@ -0,0 +1,125 @@
+package metadataserver
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// subscriptionBuffer is the number of change events that are buffered for each subscriber.
+const subscriptionBuffer = 16
+
+// ChangeEvent describes a change of the metadata value made at runtime.
+type ChangeEvent struct {
+	Time     time.Time `json:"time"`
+	Path     string    `json:"path"`
+	OldValue string    `json:"oldValue,omitempty"`
+	Value    string    `json:"value,omitempty"`
+	Deleted  bool      `json:"deleted,omitempty"`
+}
+
+type subscription struct {
+	prefix string
+	ch     chan ChangeEvent
+}
+
+// Subscribe returns a channel that receives events about changes of values at the paths
+// that start with the path prefix. Use empty prefix to receive events about all changes.
+// The alias paths (see [WithAliases]) subscribe to the events of their target paths.
+// Events are emitted when values are changed with [Server.SetValue], [Server.DeleteValue] or [Server.Reset].
+// Changes of values returned by handlers are not tracked.
+//
+// The channel is buffered. Events are dropped if the subscriber does not read them in time.
+// Call [Server.Unsubscribe] to stop receiving events.
+func (s *Server) Subscribe(pathPrefix string) <-chan ChangeEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub := &subscription{prefix: s.resolveKey(pathPrefix), ch: make(chan ChangeEvent, subscriptionBuffer)}
+	s.subscriptions = append(s.subscriptions, sub)
+	return sub.ch
+}
+
+// Unsubscribe stops sending events to the channel returned by [Server.Subscribe] and closes it.
+func (s *Server) Unsubscribe(ch <-chan ChangeEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, sub := range s.subscriptions {
+		if sub.ch == ch {
+			close(sub.ch)
+			s.subscriptions = append(s.subscriptions[:i], s.subscriptions[i+1:]...)
+			return
+		}
+	}
+}
+
+func (sub *subscription) matches(key string) bool {
+	return sub.prefix == "" || key == sub.prefix || strings.HasPrefix(key, sub.prefix+"/")
+}
+
+// publishLocked sends the event to all matching subscribers.
+// The caller must hold s.mu.
+func (s *Server) publishLocked(e ChangeEvent) {
+	s.events.emit(Event{Time: e.Time, Type: EventChange, Change: &e})
+	for _, sub := range s.subscriptions {
+		if !sub.matches(e.Path) {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+		}
+	}
+}
+
+// waitForChange blocks until the value at the key is changed, the timeout expires or the request is canceled.
+// For directories it blocks until any value under the key is changed.
+// It does not block if the last_etag query parameter differs from the entity tag of the current value
+// that the current function returns; the function returns an empty tag if the current value is unknown.
+// It implements wait_for_change query parameter of the metadata request.
+func (s *Server) waitForChange(r *http.Request, key string, dir bool, current func() string) {
+	ctx := r.Context()
+	query := r.URL.Query()
+	if sec, err := strconv.Atoi(query.Get("timeout_sec")); err == nil && sec > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(sec)*time.Second)
+		defer cancel()
+	}
+	// subscribe before the current value is read, so changes made in between are not missed
+	ch := s.Subscribe(key)
+	defer s.Unsubscribe(ch)
+	if last := query.Get("last_etag"); last != "" {
+		if tag := current(); tag != "" && strings.Trim(tag, `"`) != strings.Trim(last, `"`) {
+			return
+		}
+	}
+	s.handlerLogger.DebugContext(ctx, "waiting for metadata change", slog.String("handler", r.URL.Path))
+	for {
+		select {
+		case e := <-ch:
+			if dir || e.Path == key {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// currentETag returns the entity tag of the current value of the route
+// or an empty tag if the value cannot be read without side effects, e.g. streamed metadata and stateful handlers.
+func (s *Server) currentETag(r *http.Request, rt *route) string {
+	if v, ok := s.storedValue(rt.key); ok {
+		return etag(v)
+	}
+	if !rt.valueListed() || (rt.handler == nil && rt.fn == nil && rt.response == nil && rt.bytes == nil) {
+		return ""
+	}
+	v, err := rt.value(r)
+	if err != nil {
+		return ""
+	}
+	return etag(v)
+}
@@ -0,0 +1,178 @@
+package metadataserver_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/minherz/metadataserver"
+)
+
+func TestSubscribe(t *testing.T) {
+	s, err := metadataserver.New()
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	ch := s.Subscribe("instance/attributes")
+	s.SetValue("instance/attributes/my-flag", "on")
+	s.SetValue("project/attributes/my-flag", "on")
+	s.SetValue("instance/attributes/my-flag", "off")
+	s.DeleteValue("instance/attributes/my-flag")
+	s.Unsubscribe(ch)
+
+	var got []metadataserver.ChangeEvent
+	for e := range ch {
+		got = append(got, e)
+	}
+	want := []metadataserver.ChangeEvent{
+		{Path: "instance/attributes/my-flag", Value: "on"},
+		{Path: "instance/attributes/my-flag", OldValue: "on", Value: "off"},
+		{Path: "instance/attributes/my-flag", OldValue: "off", Deleted: true},
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(metadataserver.ChangeEvent{}, "Time")); diff != "" {
+		t.Errorf("events mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWaitForChange(t *testing.T) {
+	s, err := metadataserver.New()
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	s.SetValue("instance/maintenance-event", "NONE")
+	ts := httptest.NewServer(s.HttpHandler())
+	defer ts.Close()
+
+	result := make(chan string)
+	go func() {
+		res, err := http.Get(ts.URL + metadataserver.DefaultEndpoint + "/instance/maintenance-event?wait_for_change=true")
+		if err != nil {
+			t.Errorf("expected no errors, got: %v", err)
+			result <- ""
+			return
+		}
+		defer res.Body.Close()
+		data, _ := io.ReadAll(res.Body)
+		result <- string(data)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	s.SetValue("instance/maintenance-event", "MIGRATE_ON_HOST_MAINTENANCE")
+	select {
+	case got := <-result:
+		if got != "MIGRATE_ON_HOST_MAINTENANCE" {
+			t.Errorf("expected changed value, got: %q", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected request to return after change")
+	}
+
+	res, err := http.Get(ts.URL + metadataserver.DefaultEndpoint + "/instance/maintenance-event?wait_for_change=true&timeout_sec=1")
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected status %d after timeout, got: %d", http.StatusOK, res.StatusCode)
+	}
+}
+
+func TestSubscribeAlias(t *testing.T) {
+	s, err := metadataserver.New(metadataserver.WithAliases(map[string]string{"zone": "instance/zone"}))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	ch := s.Subscribe("zone")
+	s.SetValue("instance/zone", "projects/123456789/zones/us-east1-b")
+	s.Unsubscribe(ch)
+
+	var got []string
+	for e := range ch {
+		got = append(got, e.Path)
+	}
+	if diff := cmp.Diff([]string{"instance/zone"}, got); diff != "" {
+		t.Errorf("events mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// serveAsync serves the request in a goroutine and returns the channel that receives the response.
+func serveAsync(s *metadataserver.Server, r *http.Request) <-chan *httptest.ResponseRecorder {
+	result := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		rec := httptest.NewRecorder()
+		s.HttpHandler().ServeHTTP(rec, r)
+		result <- rec
+	}()
+	return result
+}
+
+func TestWaitForChangeLastETag(t *testing.T) {
+	s, err := metadataserver.New()
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	s.SetValue("instance/maintenance-event", "NONE")
+	rec := httptest.NewRecorder()
+	s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/instance/maintenance-event", nil))
+	tag := strings.Trim(rec.Header().Get("ETag"), `"`)
+	if tag == "" {
+		t.Fatalf("expected ETag header, got: %v", rec.Header())
+	}
+	path := metadataserver.DefaultEndpoint + "/instance/maintenance-event?wait_for_change=true&last_etag=" + tag
+
+	// the current value has the last tag, so the request waits for the change
+	result := serveAsync(s, httptest.NewRequest(http.MethodGet, path, nil))
+	select {
+	case rec := <-result:
+		t.Fatalf("expected request to wait, got: %q", rec.Body.String())
+	case <-time.After(50 * time.Millisecond):
+	}
+	s.SetValue("instance/maintenance-event", "TERMINATE_ON_HOST_MAINTENANCE")
+	select {
+	case rec := <-result:
+		if got := rec.Body.String(); got != "TERMINATE_ON_HOST_MAINTENANCE" {
+			t.Errorf("expected changed value, got: %q", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected request to return after change")
+	}
+
+	// the value has changed since the last tag, so the request returns immediately
+	select {
+	case rec := <-serveAsync(s, httptest.NewRequest(http.MethodGet, path, nil)):
+		if got := rec.Body.String(); got != "TERMINATE_ON_HOST_MAINTENANCE" {
+			t.Errorf("expected current value, got: %q", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected request with outdated last_etag to return immediately")
+	}
+}
+
+func TestWaitForChangeDirectory(t *testing.T) {
+	s, err := metadataserver.New(metadataserver.WithHandlers(map[string]metadataserver.Metadata{
+		"instance/attributes/a": func() string { return "1" },
+	}))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	result := serveAsync(s, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/instance/attributes/?wait_for_change=true", nil))
+	select {
+	case rec := <-result:
+		t.Fatalf("expected request to wait, got: %q", rec.Body.String())
+	case <-time.After(50 * time.Millisecond):
+	}
+	s.SetValue("project/attributes/b", "2")
+	s.SetValue("instance/attributes/b", "2")
+	select {
+	case rec := <-result:
+		if got, want := rec.Body.String(), "a\nb\n"; got != want {
+			t.Errorf("expected listing %q, got: %q", want, got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected request to return after change under the directory")
+	}
+}
@@ -0,0 +1,204 @@
+package metadataserver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// templateMetadata serves the value rendered from the template.
+// The template can reference values of other metadata with {{.Value "KEY"}}.
+type templateMetadata struct {
+	s    *Server
+	tmpl *template.Template
+}
+
+// templateData is the data of the executed template.
+type templateData struct {
+	s *Server
+	r *http.Request
+	// visiting are the keys of the templates that are being rendered, used to detect reference cycles
+	visiting map[string]bool
+}
+
+// templateFuncs are the functions available in the templates in addition to the predefined ones.
+// "base" returns the last segment of the value, e.g. the zone name of "projects/123/zones/us-central1-a".
+// "split" splits the value by the separator, e.g. the comma-separated scopes of the query parameter.
+var templateFuncs = template.FuncMap{
+	"base":  path.Base,
+	"split": strings.Split,
+}
+
+// parseTemplate parses the template of the metadata at the key.
+func parseTemplate(key, text string) (*template.Template, error) {
+	return template.New(key).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+}
+
+func (m *templateMetadata) Serve(ctx context.Context, r *http.Request) (Response, error) {
+	v, err := m.render(&templateData{s: m.s, r: r, visiting: make(map[string]bool)})
+	return Response{Body: v}, err
+}
+
+func (m *templateMetadata) render(d *templateData) (string, error) {
+	key := normalizeKey(m.tmpl.Name())
+	if d.visiting[key] {
+		return "", fmt.Errorf("reference cycle at %q", key)
+	}
+	d.visiting[key] = true
+	defer delete(d.visiting, key)
+	var buf bytes.Buffer
+	if err := m.tmpl.Execute(&buf, d); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Value returns the value of the metadata at the key including values set with [Server.SetValue].
+func (d *templateData) Value(key string) (string, error) {
+	key = d.s.resolveKey(key)
+	if v, ok := d.s.storedValue(key); ok {
+		return v, nil
+	}
+	rt := d.s.matchRoute(d.r, key)
+	if rt == nil {
+		return "", fmt.Errorf("no metadata at %q", key)
+	}
+	switch m := rt.response.(type) {
+	case *templateMetadata:
+		return m.render(d)
+	case *exprMetadata:
+		return m.render(d)
+	}
+	return rt.value(d.r.WithContext(context.WithValue(d.r.Context(), referenceKey{}, true)))
+}
+
+// referenceKey is the context key that marks the requests of the metadata that templates reference.
+type referenceKey struct{}
+
+// isReference reports whether the metadata is evaluated for the template that references it
+// rather than for the request of its path.
+func isReference(ctx context.Context) bool {
+	v, _ := ctx.Value(referenceKey{}).(bool)
+	return v
+}
+
+// Query returns the first value of the query parameter of the request, e.g. {{.Query "audience"}}.
+// It returns an empty string if the request does not have the parameter.
+func (d *templateData) Query(name string) string {
+	if d.r == nil || d.r.URL == nil {
+		return ""
+	}
+	return d.r.URL.Query().Get(name)
+}
+
+// templateRefs returns the keys that the template references with {{.Value "KEY"}}.
+func templateRefs(tmpl *template.Template) []string {
+	var refs []string
+	var walk func(n parse.Node)
+	walk = func(n parse.Node) {
+		switch n := n.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Nodes {
+				walk(c)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Cmds {
+				walk(c)
+			}
+		case *parse.CommandNode:
+			if len(n.Args) == 2 {
+				if f, ok := n.Args[0].(*parse.FieldNode); ok && strings.Join(f.Ident, ".") == "Value" {
+					if s, ok := n.Args[1].(*parse.StringNode); ok {
+						refs = append(refs, normalizeKey(s.Text))
+					}
+				}
+			}
+			for _, c := range n.Args {
+				walk(c)
+			}
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		}
+	}
+	if tmpl.Tree != nil {
+		walk(tmpl.Tree.Root)
+	}
+	return refs
+}
+
+// checkReferenceCycles returns an error if the parsed values, e.g. the templates and the expressions,
+// reference each other in a cycle.
+func checkReferenceCycles(parsed map[string]parsedValue) error {
+	refs := make(map[string][]string, len(parsed))
+	for k, pv := range parsed {
+		if pv.kind.refs != nil {
+			refs[normalizeKey(k)] = pv.kind.refs(pv.value)
+		}
+	}
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int)
+	var path []string
+	var visit func(key string) error
+	visit = func(key string) error {
+		switch state[key] {
+		case visiting:
+			start := 0
+			for i, k := range path {
+				if k == key {
+					start = i
+				}
+			}
+			return fmt.Errorf("metadata %q: reference cycle %s", key, strings.Join(append(path[start:], key), " -> "))
+		case visited:
+			return nil
+		}
+		state[key] = visiting
+		path = append(path, key)
+		for _, ref := range refs[key] {
+			if err := visit(ref); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[key] = visited
+		return nil
+	}
+	keys := make([]string, 0, len(refs))
+	for k := range refs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := visit(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
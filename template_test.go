@@ -0,0 +1,76 @@
+package metadataserver_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestTemplateValues(t *testing.T) {
+	s, err := metadataserver.New(metadataserver.WithConfigFile("test/fixtures/config_template.json"))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	get := func(path string) string {
+		rec := httptest.NewRecorder()
+		s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/"+path, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("expected status %d, got: %d", http.StatusOK, rec.Code)
+		}
+		return rec.Body.String()
+	}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"instance/machine-type", "projects/test-project-id/machineTypes/e2-medium"},
+		{"instance/attributes/cluster-location", "us-central1-a"},
+		{"instance/attributes/summary", "projects/test-project-id/machineTypes/e2-medium in projects/123456789/zones/us-central1-a"},
+	}
+	for _, test := range tests {
+		if got := get(test.path); got != test.want {
+			t.Errorf("%s: expected %q, got: %q", test.path, test.want, got)
+		}
+	}
+
+	s.SetValue("project/project-id", "other-project")
+	want := "projects/other-project/machineTypes/e2-medium in projects/123456789/zones/us-central1-a"
+	if got := get("instance/attributes/summary"); got != want {
+		t.Errorf("expected %q after change, got: %q", want, got)
+	}
+	if got, _ := s.GetValue("instance/machine-type"); got != "projects/other-project/machineTypes/e2-medium" {
+		t.Errorf("expected value to follow the change, got: %q", got)
+	}
+}
+
+func TestTemplateQuery(t *testing.T) {
+	s, err := metadataserver.New(metadataserver.WithConfigFile("test/fixtures/config_template.json"))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"instance/service-accounts/default/identity?audience=https://example.com", "token for https://example.com"},
+		{"instance/service-accounts/default/identity", "token for default"},
+		{"instance/service-accounts/default/scopes-list?scopes=https://www.googleapis.com/auth/cloud-platform,https://www.googleapis.com/auth/userinfo.email", "cloud-platform userinfo.email"},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/"+test.path, nil))
+		if rec.Code != http.StatusOK || rec.Body.String() != test.want {
+			t.Errorf("%s: expected %q, got: %d %q", test.path, test.want, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestTemplateCycle(t *testing.T) {
+	_, err := metadataserver.New(metadataserver.WithConfigFile("test/fixtures/config_template_cycle.json"))
+	want := `metadata "a": reference cycle a -> b -> c -> a`
+	if err == nil || err.Error() != want {
+		t.Errorf("expected error %q, got: %v", want, err)
+	}
+}
@@ -0,0 +1,153 @@
+package metadataserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// terraformInstanceType is the Terraform resource type of Compute Engine instances.
+const terraformInstanceType = "google_compute_instance"
+
+// terraformModule is a module in the JSON output of "terraform show -json".
+type terraformModule struct {
+	Resources []struct {
+		Address string          `json:"address"`
+		Type    string          `json:"type"`
+		Values  json.RawMessage `json:"values"`
+	} `json:"resources"`
+	ChildModules []terraformModule `json:"child_modules"`
+}
+
+// terraformInstance is a subset of the google_compute_instance resource attributes.
+type terraformInstance struct {
+	Name                  string            `json:"name"`
+	Project               string            `json:"project"`
+	Zone                  string            `json:"zone"`
+	MachineType           string            `json:"machine_type"`
+	InstanceID            string            `json:"instance_id"`
+	Hostname              string            `json:"hostname"`
+	Description           string            `json:"description"`
+	CPUPlatform           string            `json:"cpu_platform"`
+	Tags                  []string          `json:"tags"`
+	Metadata              map[string]string `json:"metadata"`
+	MetadataStartupScript string            `json:"metadata_startup_script"`
+	NetworkInterface      []struct {
+		Network      string `json:"network"`
+		NetworkIP    string `json:"network_ip"`
+		AccessConfig []struct {
+			NatIP string `json:"nat_ip"`
+		} `json:"access_config"`
+	} `json:"network_interface"`
+	BootDisk []struct {
+		DeviceName string `json:"device_name"`
+		Mode       string `json:"mode"`
+	} `json:"boot_disk"`
+	ServiceAccount []struct {
+		Email  string   `json:"email"`
+		Scopes []string `json:"scopes"`
+	} `json:"service_account"`
+	Scheduling []struct {
+		AutomaticRestart  *bool  `json:"automatic_restart"`
+		OnHostMaintenance string `json:"on_host_maintenance"`
+		Preemptible       bool   `json:"preemptible"`
+	} `json:"scheduling"`
+}
+
+// NewConfigFromTerraform instantiates a new `Configuration` object from a google_compute_instance resource
+// in the JSON output of "terraform show -json" for a state or a plan file.
+// The address selects the resource, e.g. "module.app.google_compute_instance.vm".
+// If the address is empty, the input must contain exactly one google_compute_instance resource.
+func NewConfigFromTerraform(r io.Reader, address string) (*Configuration, error) {
+	var tf struct {
+		Values struct {
+			RootModule terraformModule `json:"root_module"`
+		} `json:"values"`
+		PlannedValues struct {
+			RootModule terraformModule `json:"root_module"`
+		} `json:"planned_values"`
+	}
+	if err := json.NewDecoder(r).Decode(&tf); err != nil {
+		return nil, err
+	}
+	var found []json.RawMessage
+	for _, m := range []terraformModule{tf.Values.RootModule, tf.PlannedValues.RootModule} {
+		found = append(found, m.instances(address)...)
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("no %s resource %q is found", terraformInstanceType, address)
+	}
+	if len(found) > 1 {
+		return nil, fmt.Errorf("found %d %s resources, use the address to select one", len(found), terraformInstanceType)
+	}
+	var ti terraformInstance
+	if err := json.Unmarshal(found[0], &ti); err != nil {
+		return nil, err
+	}
+	return ti.description().configuration()
+}
+
+// instances returns values of the instance resources in the module and its child modules that match the address.
+func (m *terraformModule) instances(address string) []json.RawMessage {
+	var found []json.RawMessage
+	for _, res := range m.Resources {
+		if res.Type == terraformInstanceType && (address == "" || res.Address == address) {
+			found = append(found, res.Values)
+		}
+	}
+	for _, child := range m.ChildModules {
+		found = append(found, child.instances(address)...)
+	}
+	return found
+}
+
+// description converts the Terraform attributes to the Compute Engine instance resource.
+func (ti *terraformInstance) description() *instanceDescription {
+	d := &instanceDescription{
+		ID:          ti.InstanceID,
+		Name:        ti.Name,
+		Hostname:    ti.Hostname,
+		Description: ti.Description,
+		CPUPlatform: ti.CPUPlatform,
+	}
+	zone := ti.Zone
+	if ti.Project != "" && zone != "" && !strings.Contains(zone, "/") {
+		zone = "projects/" + ti.Project + "/zones/" + zone
+	}
+	d.Zone = zone
+	d.MachineType = ti.MachineType
+	if strings.Contains(zone, "/") && ti.MachineType != "" && !strings.Contains(ti.MachineType, "/") {
+		d.MachineType = zone + "/machineTypes/" + ti.MachineType
+	}
+	d.Tags.Items = ti.Tags
+	for k, v := range ti.Metadata {
+		d.Metadata.Items = append(d.Metadata.Items, instanceMetadataItem{Key: k, Value: v})
+	}
+	if ti.MetadataStartupScript != "" {
+		d.Metadata.Items = append(d.Metadata.Items, instanceMetadataItem{Key: "startup-script", Value: ti.MetadataStartupScript})
+	}
+	for _, ni := range ti.NetworkInterface {
+		network := ni.Network
+		if ti.Project != "" && network != "" && !strings.Contains(network, "/") {
+			network = "projects/" + ti.Project + "/global/networks/" + network
+		}
+		d.NetworkInterfaces = append(d.NetworkInterfaces, instanceNetworkInterface{Network: network, NetworkIP: ni.NetworkIP})
+		last := &d.NetworkInterfaces[len(d.NetworkInterfaces)-1]
+		for _, ac := range ni.AccessConfig {
+			last.AccessConfigs = append(last.AccessConfigs, instanceAccessConfig{NatIP: ac.NatIP, Type: "ONE_TO_ONE_NAT"})
+		}
+	}
+	for _, disk := range ti.BootDisk {
+		d.Disks = append(d.Disks, instanceDisk{DeviceName: disk.DeviceName, Mode: disk.Mode, Type: "PERSISTENT"})
+	}
+	for _, sa := range ti.ServiceAccount {
+		d.ServiceAccounts = append(d.ServiceAccounts, instanceServiceAccount{Email: sa.Email, Scopes: sa.Scopes})
+	}
+	for _, sc := range ti.Scheduling {
+		d.Scheduling.AutomaticRestart = sc.AutomaticRestart
+		d.Scheduling.OnHostMaintenance = sc.OnHostMaintenance
+		d.Scheduling.Preemptible = sc.Preemptible
+	}
+	return d
+}
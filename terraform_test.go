@@ -0,0 +1,88 @@
+package metadataserver_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/minherz/metadataserver"
+)
+
+func TestNewConfigFromTerraform(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:    "root module",
+			address: "google_compute_instance.web",
+			want: map[string]string{
+				"project/project-id":                    "my-project",
+				"instance/id":                           "987654321",
+				"instance/name":                         "web",
+				"instance/hostname":                     "web.europe-west1-b.c.my-project.internal",
+				"instance/zone":                         "projects/my-project/zones/europe-west1-b",
+				"instance/machine-type":                 "projects/my-project/zones/europe-west1-b/machineTypes/e2-small",
+				"instance/tags":                         `["web"]`,
+				"instance/attributes/enable-oslogin":    "TRUE",
+				"instance/attributes/startup-script":    "echo web",
+				"instance/network-interfaces/0/ip":      "10.132.0.5",
+				"instance/network-interfaces/0/network": "projects/my-project/global/networks/default",
+				"instance/network-interfaces/0/access-configs/0/external-ip":              "35.0.0.2",
+				"instance/network-interfaces/0/access-configs/0/type":                     "ONE_TO_ONE_NAT",
+				"instance/disks/0/device-name":                                            "persistent-disk-0",
+				"instance/disks/0/mode":                                                   "READ_WRITE",
+				"instance/disks/0/type":                                                   "PERSISTENT",
+				"instance/service-accounts/default/email":                                 "web@my-project.iam.gserviceaccount.com",
+				"instance/service-accounts/default/scopes":                                "https://www.googleapis.com/auth/cloud-platform",
+				"instance/service-accounts/web@my-project.iam.gserviceaccount.com/email":  "web@my-project.iam.gserviceaccount.com",
+				"instance/service-accounts/web@my-project.iam.gserviceaccount.com/scopes": "https://www.googleapis.com/auth/cloud-platform",
+				"instance/scheduling/automatic-restart":                                   "FALSE",
+				"instance/scheduling/on-host-maintenance":                                 "TERMINATE",
+				"instance/scheduling/preemptible":                                         "TRUE",
+			},
+		},
+		{
+			name:    "child module",
+			address: "module.db.google_compute_instance.db",
+			want: map[string]string{
+				"project/project-id":              "my-project",
+				"instance/name":                   "db",
+				"instance/hostname":               "db.europe-west1-c.c.my-project.internal",
+				"instance/zone":                   "projects/my-project/zones/europe-west1-c",
+				"instance/machine-type":           "projects/my-project/zones/europe-west1-c/machineTypes/n2-standard-4",
+				"instance/scheduling/preemptible": "FALSE",
+			},
+		},
+		{name: "ambiguous", address: "", wantErr: true},
+		{name: "missing", address: "google_compute_instance.missing", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := os.Open("test/fixtures/terraform_state.json")
+			if err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			defer f.Close()
+			c, err := metadataserver.NewConfigFromTerraform(f, test.address)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			got := make(map[string]string)
+			for k, h := range c.Handlers {
+				got[k] = h()
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("metadata mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package metadataserver
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// throttleInterval is the period at which throttled responses are written.
+const throttleInterval = 100 * time.Millisecond
+
+// WithBandwidthLimit sets a new server to write response bodies at no more than the given number of bytes per second.
+// Use it to reproduce clients that time out while reading the response body.
+// The limit is disabled when the rate is 0.
+func WithBandwidthLimit(bytesPerSecond int) Option {
+	return func(s *Server) {
+		s.bandwidthLimit = bytesPerSecond
+	}
+}
+
+// WithFirstByteDelay sets a new server to wait for the given duration before it writes the first byte of the response.
+// Unlike a delay of the whole request, the request is read and the response is computed before the delay.
+func WithFirstByteDelay(d time.Duration) Option {
+	return func(s *Server) {
+		s.firstByteDelay = d
+	}
+}
+
+func (s *Server) throttle(next http.Handler) http.Handler {
+	if s.bandwidthLimit <= 0 && s.firstByteDelay <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tw := &throttledResponseWriter{ResponseWriter: w, ctx: r.Context(), delay: s.firstByteDelay}
+		if s.bandwidthLimit > 0 {
+			tw.chunk = max(1, s.bandwidthLimit*int(throttleInterval)/int(time.Second))
+		}
+		next.ServeHTTP(tw, r)
+	})
+}
+
+// throttledResponseWriter delays the first byte of the response and writes the body in chunks
+// which size is limited per [throttleInterval].
+type throttledResponseWriter struct {
+	http.ResponseWriter
+	ctx     context.Context
+	delay   time.Duration
+	chunk   int
+	started bool
+	// flushed is true if a chunk of the body has been written
+	flushed bool
+}
+
+// start waits for the first byte delay once.
+func (w *throttledResponseWriter) start() error {
+	if w.started {
+		return nil
+	}
+	w.started = true
+	return w.sleep(w.delay)
+}
+
+func (w *throttledResponseWriter) sleep(d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-w.ctx.Done():
+		return w.ctx.Err()
+	}
+}
+
+func (w *throttledResponseWriter) WriteHeader(status int) {
+	if w.start() != nil {
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *throttledResponseWriter) Write(b []byte) (int, error) {
+	if err := w.start(); err != nil {
+		return 0, err
+	}
+	if w.chunk == 0 {
+		return w.ResponseWriter.Write(b)
+	}
+	rc := http.NewResponseController(w.ResponseWriter)
+	written := 0
+	for written < len(b) {
+		if w.flushed {
+			if err := w.sleep(throttleInterval); err != nil {
+				return written, err
+			}
+		}
+		n, err := w.ResponseWriter.Write(b[written:min(len(b), written+w.chunk)])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		rc.Flush()
+		w.flushed = true
+	}
+	return written, nil
+}
+
+func (w *throttledResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
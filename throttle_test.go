@@ -0,0 +1,63 @@
+package metadataserver_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestFirstByteDelay(t *testing.T) {
+	s, err := metadataserver.New(metadataserver.WithFirstByteDelay(200 * time.Millisecond))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	ts := httptest.NewServer(s.HttpHandler())
+	defer ts.Close()
+	client := &http.Client{Timeout: 100 * time.Millisecond}
+	if _, err := client.Get(ts.URL + metadataserver.DefaultEndpoint + "/project/project-id"); err == nil {
+		t.Errorf("expected client to time out")
+	}
+	start := time.Now()
+	if got := getStatus(t, ts.URL+metadataserver.DefaultEndpoint+"/project/project-id"); got != http.StatusOK {
+		t.Errorf("expected status %d, got: %d", http.StatusOK, got)
+	}
+	if d := time.Since(start); d < 200*time.Millisecond {
+		t.Errorf("expected response after 200ms, got: %v", d)
+	}
+}
+
+func TestBandwidthLimit(t *testing.T) {
+	value := strings.Repeat("x", 300)
+	s, err := metadataserver.New(
+		metadataserver.WithHandlers(map[string]metadataserver.Metadata{"large": func() string { return value }}),
+		metadataserver.WithCompressionThreshold(-1),
+		metadataserver.WithBandwidthLimit(1000),
+	)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	ts := httptest.NewServer(s.HttpHandler())
+	defer ts.Close()
+	start := time.Now()
+	resp, err := http.Get(ts.URL + metadataserver.DefaultEndpoint + "/large")
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if string(body) != value {
+		t.Errorf("expected %d bytes, got: %d", len(value), len(body))
+	}
+	// 300 bytes at 100 bytes per 100ms are written in three chunks
+	if d := time.Since(start); d < 200*time.Millisecond {
+		t.Errorf("expected body to be read in at least 200ms, got: %v", d)
+	}
+}
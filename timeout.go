@@ -0,0 +1,85 @@
+package metadataserver
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"path"
+	"time"
+)
+
+// WithHandlerTimeout sets a new server to respond with 504 (Gateway Timeout) if evaluation of the metadata
+// at the paths takes longer than the timeout. Paths are relative to the server's endpoint and can use patterns
+// supported by [path.Match]. If no paths are defined the timeout applies to all metadata.
+// The context of the request is canceled when the timeout expires, so handlers that receive it can stop early.
+// Requests that wait for changes (wait_for_change=true) are not limited.
+// If more than one timeout applies to the path, the first one is used.
+func WithHandlerTimeout(timeout time.Duration, paths ...string) Option {
+	return func(s *Server) {
+		s.handlerTimeouts = append(s.handlerTimeouts, handlerTimeout{timeout: timeout, paths: paths})
+	}
+}
+
+type handlerTimeout struct {
+	timeout time.Duration
+	paths   []string
+}
+
+// timeoutOf returns the timeout of the metadata at the key or zero if no timeout applies.
+func (s *Server) timeoutOf(key string) time.Duration {
+	for _, ht := range s.handlerTimeouts {
+		if len(ht.paths) == 0 {
+			return ht.timeout
+		}
+		for _, p := range ht.paths {
+			if ok, _ := path.Match(normalizeKey(p), key); ok {
+				return ht.timeout
+			}
+		}
+	}
+	return 0
+}
+
+// limitHandlerTime serves the request in a separate goroutine and responds with 504 if it is not served within the timeout.
+// The response is buffered and written only if the request is served in time.
+// A panic of the handler is recovered in that goroutine and re-panicked in the goroutine of the request,
+// so it is handled by [Server.recoverPanics] instead of crashing the process.
+func (s *Server) limitHandlerTime(next http.Handler) http.Handler {
+	if len(s.handlerTimeouts) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, ok := s.keyOf(r.URL.Path)
+		if !ok || (r.URL.RawQuery != "" && r.URL.Query().Get("wait_for_change") == "true") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		timeout := s.timeoutOf(key)
+		if timeout <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		tw := newResponseBuffer()
+		// done is buffered, so the goroutine does not leak when the request times out
+		done := make(chan any, 1)
+		go func() {
+			defer func() {
+				done <- recover()
+			}()
+			next.ServeHTTP(tw, r.WithContext(ctx))
+		}()
+		select {
+		case v := <-done:
+			if v != nil {
+				panic(v)
+			}
+			tw.copyTo(w)
+		case <-ctx.Done():
+			s.handlerLogger.WarnContext(r.Context(), "metadata handler timed out",
+				slog.String("handler", r.URL.Path), slog.Duration("timeout", timeout))
+			http.Error(w, http.StatusText(http.StatusGatewayTimeout), http.StatusGatewayTimeout)
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package metadataserver_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestHandlerTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	s, err := metadataserver.New(
+		metadataserver.WithHandlers(map[string]metadataserver.Metadata{
+			"instance/hung":      func() string { <-release; return "late" },
+			"instance/slow":      func() string { time.Sleep(20 * time.Millisecond); return "slow" },
+			"project/project-id": func() string { return "test-project-id" },
+		}),
+		metadataserver.WithFuncHandlers(map[string]metadataserver.MetadataFunc{
+			"instance/aware": func(ctx context.Context, r *http.Request) (string, error) {
+				<-ctx.Done()
+				return "", ctx.Err()
+			},
+		}),
+		metadataserver.WithHandlerTimeout(time.Second, "instance/slow"),
+		metadataserver.WithHandlerTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"instance/hung", http.StatusGatewayTimeout, "Gateway Timeout\n"},
+		{"instance/aware", http.StatusGatewayTimeout, "Gateway Timeout\n"},
+		{"instance/slow", http.StatusOK, "slow"},
+		{"project/project-id", http.StatusOK, "test-project-id"},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/"+test.path, nil))
+			if rec.Code != test.wantStatus {
+				t.Errorf("expected status %d, got: %d", test.wantStatus, rec.Code)
+			}
+			if got := rec.Body.String(); got != test.wantBody {
+				t.Errorf("expected body %q, got: %q", test.wantBody, got)
+			}
+		})
+	}
+}
+
+func TestHandlerTimeoutPanic(t *testing.T) {
+	s, err := metadataserver.New(
+		metadataserver.WithHandlers(map[string]metadataserver.Metadata{
+			"instance/zone": func() string { panic("no zone") },
+		}),
+		metadataserver.WithHandlerTimeout(time.Second))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/instance/zone", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got: %d", http.StatusInternalServerError, rec.Code)
+	}
+	var pe *metadataserver.HandlerPanicError
+	if err := s.State().LastError; !errors.As(err, &pe) || pe.Value != "no zone" {
+		t.Errorf("expected HandlerPanicError with %q, got: %v", "no zone", err)
+	}
+}
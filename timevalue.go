@@ -0,0 +1,98 @@
+package metadataserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// WithClock sets a new server with the clock that time values are generated from.
+// The clock also stamps the change events, the audit log and the request history.
+// By default the server uses [time.Now]. Use it to freeze or shift the time in tests.
+func WithClock(now func() time.Time) Option {
+	return func(s *Server) {
+		s.clock = now
+	}
+}
+
+// now returns the current time of the server's clock.
+func (s *Server) now() time.Time {
+	if s.clock != nil {
+		return s.clock()
+	}
+	return time.Now()
+}
+
+// timeFormats are the names of the predefined formats of the time values.
+var timeFormats = map[string]string{
+	"rfc3339":     time.RFC3339,
+	"rfc3339nano": time.RFC3339Nano,
+	"rfc1123":     time.RFC1123,
+	"date":        time.DateOnly,
+	"datetime":    time.DateTime,
+}
+
+// timeValue is the definition of the time value: {"format": "rfc3339", "offset": "-5m"}.
+// The format is one of the names in timeFormats, "unix", "unixmilli" or a Go time layout.
+// The default format is "rfc3339". The time is in UTC.
+type timeValue struct {
+	layout string
+	offset time.Duration
+}
+
+// newTimeValue parses the JSON definition of the time value.
+func newTimeValue(v any) (*timeValue, error) {
+	spec, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("expected object, got %T", v)
+	}
+	t := &timeValue{layout: "rfc3339"}
+	for k, fv := range spec {
+		s, ok := fv.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s must be a string, got %v", k, fv)
+		}
+		switch k {
+		case "format":
+			if s == "" {
+				return nil, fmt.Errorf("format must not be empty")
+			}
+			t.layout = s
+		case "offset":
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid offset: %w", err)
+			}
+			t.offset = d
+		default:
+			return nil, fmt.Errorf("unknown field %q", k)
+		}
+	}
+	return t, nil
+}
+
+func (t *timeValue) format(now time.Time) string {
+	now = now.Add(t.offset).UTC()
+	switch t.layout {
+	case "unix":
+		return strconv.FormatInt(now.Unix(), 10)
+	case "unixmilli":
+		return strconv.FormatInt(now.UnixMilli(), 10)
+	}
+	if layout, ok := timeFormats[t.layout]; ok {
+		return now.Format(layout)
+	}
+	return now.Format(t.layout)
+}
+
+// timeMetadata serves the time value relative to the server's clock at the time of the request.
+type timeMetadata struct {
+	s *Server
+	t *timeValue
+}
+
+func (m *timeMetadata) Serve(ctx context.Context, r *http.Request) (Response, error) {
+	return Response{Body: m.t.format(m.s.now())}, nil
+}
@@ -0,0 +1,65 @@
+package metadataserver_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestTimeValues(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	s, err := metadataserver.New(
+		metadataserver.WithConfigFile("test/fixtures/config_time.json"),
+		metadataserver.WithClock(func() time.Time { return now }),
+	)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"instance/attributes/now", "2024-03-01T12:00:00Z"},
+		{"instance/attributes/boot-time", "2024-03-01T11:55:00Z"},
+		{"instance/attributes/token-expiry", "1709298000"},
+		{"instance/attributes/maintenance-date", "2024-03-03"},
+	}
+	for _, test := range tests {
+		if got, _ := s.GetValue(test.path); got != test.want {
+			t.Errorf("%s: expected %q, got: %q", test.path, test.want, got)
+		}
+	}
+
+	now = now.Add(time.Hour)
+	if got, _ := s.GetValue("instance/attributes/boot-time"); got != "2024-03-01T12:55:00Z" {
+		t.Errorf("expected value to follow the clock, got: %q", got)
+	}
+}
+
+func TestTimeValueErrors(t *testing.T) {
+	tests := []struct {
+		time string
+		want string
+	}{
+		{`"now"`, `invalid time of metadata "a": expected object, got string`},
+		{`{"offset": "soon"}`, `invalid time of metadata "a": invalid offset: time: invalid duration "soon"`},
+		{`{"offset": 5}`, `invalid time of metadata "a": offset must be a string, got 5`},
+		{`{"zone": "UTC"}`, `invalid time of metadata "a": unknown field "zone"`},
+	}
+	for _, test := range tests {
+		t.Run(test.time, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "config.json")
+			data := `{"metadata": {"a": {"time": ` + test.time + `}}}`
+			if err := os.WriteFile(name, []byte(data), 0o600); err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			_, err := metadataserver.NewConfigFromFile(name)
+			if err == nil || err.Error() != test.want {
+				t.Errorf("expected error %q, got: %v", test.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package metadataserver
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+)
+
+// IdentityPath is the pattern of the metadata paths that serve service account identity tokens.
+const IdentityPath = "instance/service-accounts/*/identity"
+
+// ErrInvalidStatus is returned when the HTTP status code is outside of 100-999.
+var ErrInvalidStatus error = errors.New("invalid HTTP status")
+
+// FailTokenEndpoint makes the server to respond with the status to the next count requests at
+// the access and identity token paths (see [TokenPath] and [IdentityPath]).
+// After that the token endpoints recover. Zero status means 503 (Service Unavailable).
+// Zero count cancels the failures that were not served yet.
+// Use it to test how the clients retry refreshing credentials.
+// It returns [ErrInvalidStatus] if the status is not zero and is outside of 100-999.
+//
+// It is safe to call FailTokenEndpoint while the server is running.
+func (s *Server) FailTokenEndpoint(status, count int) error {
+	return s.failTokenEndpoint(status, count, AuditSourceAPI)
+}
+
+func (s *Server) failTokenEndpoint(status, count int, source string) error {
+	if status == 0 {
+		status = http.StatusServiceUnavailable
+	}
+	if !validStatus(status) {
+		return fmt.Errorf("%w %d", ErrInvalidStatus, status)
+	}
+	if count < 0 {
+		count = 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.auditLocked(source, ActionFailToken, "", "", fmt.Sprintf("%d x%d", status, count))
+	s.tokenFailureStatus = status
+	s.tokenFailures.Store(int64(count))
+	return nil
+}
+
+// takeTokenFailure returns the status of the failure if the token endpoint should fail.
+func (s *Server) takeTokenFailure() (int, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for {
+		n := s.tokenFailures.Load()
+		if n <= 0 {
+			return 0, false
+		}
+		if s.tokenFailures.CompareAndSwap(n, n-1) {
+			return s.tokenFailureStatus, true
+		}
+	}
+}
+
+func (s *Server) failTokenRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.tokenFailures.Load() <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key, ok := s.keyOf(r.URL.Path)
+		if !ok || !isTokenKey(key) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		status, ok := s.takeTokenFailure()
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		s.handlerLogger.DebugContext(r.Context(), "token request is failed",
+			slog.String("path", r.URL.Path), slog.Int("status", status))
+		http.Error(w, http.StatusText(status), status)
+	})
+}
+
+// isTokenKey reports whether the metadata at the key is an access or identity token.
+func isTokenKey(key string) bool {
+	if matched, _ := path.Match(TokenPath, key); matched {
+		return true
+	}
+	matched, _ := path.Match(IdentityPath, key)
+	return matched
+}
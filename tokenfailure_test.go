@@ -0,0 +1,84 @@
+package metadataserver_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestFailTokenEndpoint(t *testing.T) {
+	s, err := metadataserver.New(metadataserver.WithServiceAccounts(metadataserver.ServiceAccount{Email: "sa@example.com"}))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	get := func(path string) int {
+		rec := httptest.NewRecorder()
+		s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/"+path, nil))
+		return rec.Code
+	}
+	if err := s.FailTokenEndpoint(http.StatusInternalServerError, 2); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if got := get("instance/service-accounts/default/email"); got != http.StatusOK {
+		t.Errorf("expected status %d for non-token path, got: %d", http.StatusOK, got)
+	}
+	want := []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusOK}
+	for i, w := range want {
+		if got := get("instance/service-accounts/default/token"); got != w {
+			t.Errorf("request %d: expected status %d, got: %d", i, w, got)
+		}
+	}
+
+	if err := s.FailTokenEndpoint(0, 1); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if got := get("instance/service-accounts/sa@example.com/token"); got != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got: %d", http.StatusServiceUnavailable, got)
+	}
+	if err := s.FailTokenEndpoint(0, 5); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	s.Reset()
+	if got := get("instance/service-accounts/default/token"); got != http.StatusOK {
+		t.Errorf("expected status %d after reset, got: %d", http.StatusOK, got)
+	}
+	for _, status := range []int{99, 1000} {
+		if err := s.FailTokenEndpoint(status, 1); !errors.Is(err, metadataserver.ErrInvalidStatus) {
+			t.Errorf("status %d: expected %v, got: %v", status, metadataserver.ErrInvalidStatus, err)
+		}
+	}
+	if got := get("instance/service-accounts/default/token"); got != http.StatusOK {
+		t.Errorf("expected status %d after invalid status, got: %d", http.StatusOK, got)
+	}
+}
+
+func TestAdminFailToken(t *testing.T) {
+	s, err := metadataserver.New(metadataserver.WithServiceAccounts(metadataserver.ServiceAccount{Email: "sa@example.com"}))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	s.AdminHttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/fail-token?status=429&count=1", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d, got: %d", http.StatusNoContent, rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/instance/service-accounts/default/token", nil))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d, got: %d", http.StatusTooManyRequests, rec.Code)
+	}
+	for _, q := range []string{"status=42", "status=1000", "status=abc", "count=-1"} {
+		rec = httptest.NewRecorder()
+		s.AdminHttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/fail-token?"+q, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got: %d", q, http.StatusBadRequest, rec.Code)
+		}
+	}
+	log := s.AuditLog()
+	if len(log) != 1 || log[0].Action != metadataserver.ActionFailToken || log[0].Value != "429 x1" {
+		t.Errorf("expected fail-token audit record, got: %+v", log)
+	}
+}
@@ -0,0 +1,100 @@
+package metadataserver
+
+import (
+	"maps"
+	"net/http"
+	"path"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// TokenStats describes the access and identity tokens that the server issued.
+// Use it to assert that the application requested exactly the scopes and audiences it should.
+type TokenStats struct {
+	AccessTokens   int `json:"accessTokens"`
+	IdentityTokens int `json:"identityTokens"`
+	// Accounts counts the tokens per service account as it is requested, e.g. "default" or the account's email.
+	Accounts map[string]int `json:"accounts"`
+	// Scopes counts the access tokens per scope of the "scopes" query parameter.
+	// Tokens requested without the parameter are not counted per scope.
+	Scopes map[string]int `json:"scopes"`
+	// Audiences counts the identity tokens per value of the "audience" query parameter.
+	Audiences map[string]int `json:"audiences"`
+}
+
+// TokenStats returns the statistics of the access and identity tokens that the server issued.
+// A token is issued when the GET request at the token path (see [TokenPath] and [IdentityPath]) is responded with 200 (OK).
+// The requests at the aliases of the token paths and at the paths of the profiles are counted too.
+func (s *Server) TokenStats() TokenStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stats := TokenStats{
+		AccessTokens:   s.tokenStats.AccessTokens,
+		IdentityTokens: s.tokenStats.IdentityTokens,
+		Accounts:       make(map[string]int, len(s.tokenStats.Accounts)),
+		Scopes:         make(map[string]int, len(s.tokenStats.Scopes)),
+		Audiences:      make(map[string]int, len(s.tokenStats.Audiences)),
+	}
+	maps.Copy(stats.Accounts, s.tokenStats.Accounts)
+	maps.Copy(stats.Scopes, s.tokenStats.Scopes)
+	maps.Copy(stats.Audiences, s.tokenStats.Audiences)
+	return stats
+}
+
+// tokenType returns "access" or "identity" if the key is the path of the access or identity token
+// or an empty string otherwise.
+func tokenType(key string) string {
+	if matched, _ := path.Match(TokenPath, key); matched {
+		return "access"
+	}
+	if matched, _ := path.Match(IdentityPath, key); matched {
+		return "identity"
+	}
+	return ""
+}
+
+// countToken counts the token of the type at the key if the request was responded with the issued token.
+// The key is resolved from the aliases and the profile's path prefix, see [Server.routeRequest].
+// The audiences are not recorded in the metric because their number is unbounded.
+func (s *Server) countToken(r *http.Request, key, tokenType string, status int) {
+	if status != http.StatusOK {
+		return
+	}
+	account := strings.Split(key, "/")[2]
+	q := r.URL.Query()
+	var scopes []string
+	if v := q.Get("scopes"); v != "" && tokenType == "access" {
+		for _, scope := range strings.Split(v, ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	audience := q.Get("audience")
+	s.mu.Lock()
+	if s.tokenStats.Accounts == nil {
+		s.tokenStats.Accounts = make(map[string]int)
+		s.tokenStats.Scopes = make(map[string]int)
+		s.tokenStats.Audiences = make(map[string]int)
+	}
+	s.tokenStats.Accounts[account]++
+	if tokenType == "access" {
+		s.tokenStats.AccessTokens++
+		for _, scope := range scopes {
+			s.tokenStats.Scopes[scope]++
+		}
+	} else {
+		s.tokenStats.IdentityTokens++
+		if audience != "" {
+			s.tokenStats.Audiences[audience]++
+		}
+	}
+	s.mu.Unlock()
+	if s.issuedTokens != nil {
+		s.issuedTokens.Add(r.Context(), 1, metric.WithAttributes(
+			attribute.String("token.type", tokenType),
+			attribute.String("service_account", account)))
+	}
+}
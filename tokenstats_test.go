@@ -0,0 +1,78 @@
+package metadataserver_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestTokenStats(t *testing.T) {
+	s, err := metadataserver.New(
+		metadataserver.WithConfigFile("test/fixtures/config_template.json"),
+		metadataserver.WithServiceAccounts(metadataserver.ServiceAccount{
+			Email:  "app@test-project-id.iam.gserviceaccount.com",
+			Scopes: []string{"https://www.googleapis.com/auth/cloud-platform", "https://www.googleapis.com/auth/pubsub"},
+		}),
+		metadataserver.WithAliases(map[string]string{"token": "instance/service-accounts/default/token"}),
+		metadataserver.WithProfiles(metadataserver.Profile{Name: "vm-1", PathPrefix: "/vm-1"}),
+	)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	ts := httptest.NewServer(s.HttpHandler())
+	defer ts.Close()
+
+	paths := []string{
+		"instance/service-accounts/default/token",
+		"instance/service-accounts/default/token?scopes=https://www.googleapis.com/auth/pubsub",
+		"instance/service-accounts/app@test-project-id.iam.gserviceaccount.com/token?scopes=https://www.googleapis.com/auth/pubsub,https://www.googleapis.com/auth/cloud-platform",
+		"instance/service-accounts/default/identity?audience=https://api.example.com",
+		"instance/service-accounts/default/identity?audience=https://api.example.com",
+		// rejected requests do not issue tokens
+		"instance/service-accounts/default/token?scopes=https://www.googleapis.com/auth/devstorage.read_only",
+		"instance/service-accounts/default/email",
+		// the alias and the profile's path prefix are resolved
+		"token",
+		"/vm-1" + metadataserver.DefaultEndpoint + "/instance/service-accounts/default/identity?audience=https://vm-1.example.com",
+	}
+	for _, p := range paths {
+		if !strings.HasPrefix(p, "/") {
+			p = metadataserver.DefaultEndpoint + "/" + p
+		}
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+p, nil)
+		req.Header.Set("Metadata-Flavor", "Google")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("expected no errors, got: %v", err)
+		}
+		res.Body.Close()
+	}
+
+	want := metadataserver.TokenStats{
+		AccessTokens:   4,
+		IdentityTokens: 3,
+		Accounts: map[string]int{
+			"default": 6,
+			"app@test-project-id.iam.gserviceaccount.com": 1,
+		},
+		Scopes: map[string]int{
+			"https://www.googleapis.com/auth/pubsub":         2,
+			"https://www.googleapis.com/auth/cloud-platform": 1,
+		},
+		Audiences: map[string]int{"https://api.example.com": 2, "https://vm-1.example.com": 1},
+	}
+	if diff := cmp.Diff(want, s.TokenStats()); diff != "" {
+		t.Errorf("token stats mismatch (-want +got):\n%s", diff)
+	}
+
+	s.Reset()
+	want = metadataserver.TokenStats{Accounts: map[string]int{}, Scopes: map[string]int{}, Audiences: map[string]int{}}
+	if diff := cmp.Diff(want, s.TokenStats()); diff != "" {
+		t.Errorf("token stats mismatch after reset (-want +got):\n%s", diff)
+	}
+}
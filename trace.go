@@ -0,0 +1,60 @@
+package metadataserver
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+type traceIDKey struct{}
+
+// traceID returns the trace ID of the request that is propagated using W3C Trace Context
+// or Google Cloud X-Cloud-Trace-Context headers. It returns empty string if no trace is propagated.
+func traceID(r *http.Request) string {
+	if tp := r.Header.Get("Traceparent"); tp != "" {
+		// version-traceid-parentid-flags
+		parts := strings.Split(tp, "-")
+		if len(parts) == 4 && len(parts[1]) == 32 {
+			return parts[1]
+		}
+	}
+	if tc := r.Header.Get("X-Cloud-Trace-Context"); tc != "" {
+		// TRACE_ID/SPAN_ID;o=OPTIONS
+		id, _, _ := strings.Cut(tc, "/")
+		id, _, _ = strings.Cut(id, ";")
+		return id
+	}
+	return ""
+}
+
+// propagateTraceID stores the trace ID of the request in the request's context
+// so it is added to all log records emitted while serving the request.
+func propagateTraceID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := traceID(r); id != "" {
+			r = r.WithContext(context.WithValue(r.Context(), traceIDKey{}, id))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// traceLogHandler adds the trace ID from the context to log records.
+type traceLogHandler struct {
+	slog.Handler
+}
+
+func (h traceLogHandler) Handle(ctx context.Context, rec slog.Record) error {
+	if id, ok := ctx.Value(traceIDKey{}).(string); ok {
+		rec.AddAttrs(slog.String("traceId", id))
+	}
+	return h.Handler.Handle(ctx, rec)
+}
+
+func (h traceLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return traceLogHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h traceLogHandler) WithGroup(name string) slog.Handler {
+	return traceLogHandler{h.Handler.WithGroup(name)}
+}
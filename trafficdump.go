@@ -0,0 +1,182 @@
+package metadataserver
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// WithTrafficDump sets a new server to write the served requests to the file when it stops,
+// e.g. to keep the metadata traffic of the test as a CI artifact for post-mortem debugging.
+// If the file name ends with ".har", the file is an HTTP Archive that can be opened in browser tools
+// and replayed with [ParseHAR] and [WithReplay]. Otherwise the file is a JSON object with
+// the "requests" of the request history and the "captures" of [WithCapture].
+//
+// HAR entries include headers and bodies only if the capture is enabled with [WithCapture];
+// otherwise they are built from the request history. Both keep a limited number of the most recent requests.
+func WithTrafficDump(path string) Option {
+	return func(s *Server) {
+		s.trafficDump = path
+	}
+}
+
+// jsonTrafficDump is the content of the JSON traffic dump.
+type jsonTrafficDump struct {
+	Requests []RequestRecord `json:"requests"`
+	Captures []Capture       `json:"captures,omitempty"`
+}
+
+// harLog is the HTTP Archive. See http://www.softwareishard.com/blog/har-12-spec/.
+type harLog struct {
+	Log struct {
+		Version string `json:"version"`
+		Creator struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"creator"`
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            int         `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         struct {
+		Send    int `json:"send"`
+		Wait    int `json:"wait"`
+		Receive int `json:"receive"`
+	} `json:"timings"`
+}
+
+type harRequest struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Headers     []harHeader `json:"headers"`
+	QueryString []harHeader `json:"queryString"`
+	Cookies     []harHeader `json:"cookies"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Headers     []harHeader `json:"headers"`
+	Cookies     []harHeader `json:"cookies"`
+	Content     struct {
+		Size     int    `json:"size"`
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text"`
+	} `json:"content"`
+	RedirectURL string `json:"redirectURL"`
+	HeadersSize int    `json:"headersSize"`
+	BodySize    int    `json:"bodySize"`
+}
+
+type harHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// dumpTraffic writes the traffic to the file set with [WithTrafficDump].
+func (s *Server) dumpTraffic() error {
+	if s.trafficDump == "" {
+		return nil
+	}
+	var v any
+	if strings.EqualFold(filepath.Ext(s.trafficDump), ".har") {
+		v = s.harLog()
+	} else {
+		v = jsonTrafficDump{Requests: s.History(), Captures: s.Captures()}
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.trafficDump, data, 0o644)
+}
+
+// harLog returns the HTTP Archive of the captures or of the request history if the capture is not enabled.
+func (s *Server) harLog() harLog {
+	var har harLog
+	har.Log.Version = "1.2"
+	har.Log.Creator.Name = "metadataserver"
+	har.Log.Creator.Version = Version()
+	har.Log.Entries = []harEntry{}
+	base := "http://" + s.server.Addr
+	if s.capture == nil {
+		for _, rec := range s.History() {
+			e := newHAREntry(rec.Time)
+			e.Request.Method = rec.Method
+			e.Request.URL = base + rec.Path
+			e.Response.Status = rec.Status
+			e.Response.StatusText = http.StatusText(rec.Status)
+			har.Log.Entries = append(har.Log.Entries, e)
+		}
+		return har
+	}
+	for _, c := range s.Captures() {
+		req, err := http.ReadRequest(bufio.NewReader(strings.NewReader(c.Request)))
+		if err != nil {
+			continue
+		}
+		e := newHAREntry(c.Time)
+		e.Request.Method = req.Method
+		e.Request.URL = base + req.URL.RequestURI()
+		e.Request.Headers = harHeaders(req.Header)
+		for k, vs := range req.URL.Query() {
+			for _, v := range vs {
+				e.Request.QueryString = append(e.Request.QueryString, harHeader{Name: k, Value: v})
+			}
+		}
+		res, err := http.ReadResponse(bufio.NewReader(strings.NewReader(c.Response)), req)
+		if err == nil {
+			body, _ := io.ReadAll(res.Body)
+			e.Response.Status = res.StatusCode
+			e.Response.StatusText = http.StatusText(res.StatusCode)
+			e.Response.Headers = harHeaders(res.Header)
+			e.Response.Content.Size = len(body)
+			e.Response.Content.MimeType = res.Header.Get("Content-Type")
+			e.Response.Content.Text = string(body)
+			e.Response.BodySize = len(body)
+		}
+		har.Log.Entries = append(har.Log.Entries, e)
+	}
+	return har
+}
+
+// newHAREntry returns the entry with empty lists and unknown sizes as the HAR format requires.
+func newHAREntry(t time.Time) harEntry {
+	e := harEntry{StartedDateTime: t}
+	e.Request.HTTPVersion = "HTTP/1.1"
+	e.Request.Headers = []harHeader{}
+	e.Request.QueryString = []harHeader{}
+	e.Request.Cookies = []harHeader{}
+	e.Request.HeadersSize = -1
+	e.Response.HTTPVersion = "HTTP/1.1"
+	e.Response.Headers = []harHeader{}
+	e.Response.Cookies = []harHeader{}
+	e.Response.HeadersSize = -1
+	e.Response.BodySize = -1
+	return e
+}
+
+func harHeaders(h http.Header) []harHeader {
+	headers := make([]harHeader, 0, len(h))
+	for k, vs := range h {
+		for _, v := range vs {
+			headers = append(headers, harHeader{Name: k, Value: v})
+		}
+	}
+	return headers
+}
@@ -0,0 +1,116 @@
+package metadataserver_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+// serveTraffic starts the server, sends requests at the paths and stops the server.
+func serveTraffic(t *testing.T, s *metadataserver.Server, paths ...string) {
+	t.Helper()
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	// keep-alives are disabled because the spare connections of the client keep Stop waiting until the timeout
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	for _, p := range paths {
+		req, _ := http.NewRequest(http.MethodGet, "http://"+s.State().Address+metadataserver.DefaultEndpoint+"/"+p, nil)
+		req.Header.Set("Metadata-Flavor", "Google")
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("expected no errors, got: %v", err)
+		}
+		res.Body.Close()
+	}
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+}
+
+func TestTrafficDumpJSON(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "traffic.json")
+	s, err := metadataserver.New(
+		metadataserver.WithAddress("127.0.0.1"),
+		metadataserver.WithPort(0),
+		metadataserver.WithCapture(10, nil),
+		metadataserver.WithTrafficDump(name),
+	)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	serveTraffic(t, s, "project/project-id", "instance/missing")
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	var dump struct {
+		Requests []metadataserver.RequestRecord `json:"requests"`
+		Captures []metadataserver.Capture       `json:"captures"`
+	}
+	if err := json.Unmarshal(data, &dump); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if len(dump.Requests) != 2 || len(dump.Captures) != 2 {
+		t.Fatalf("expected 2 requests and 2 captures, got: %+v", dump)
+	}
+	if got := dump.Requests[1]; got.Path != metadataserver.DefaultEndpoint+"/instance/missing" || got.Status != http.StatusNotFound {
+		t.Errorf("unexpected request record: %+v", got)
+	}
+}
+
+func TestTrafficDumpHAR(t *testing.T) {
+	tests := []struct {
+		name     string
+		capture  bool
+		wantBody string
+	}{
+		{"with capture", true, "test-project-id"},
+		{"from history", false, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "traffic.har")
+			opts := []metadataserver.Option{
+				metadataserver.WithAddress("127.0.0.1"),
+				metadataserver.WithPort(0),
+				metadataserver.WithTrafficDump(name),
+			}
+			if test.capture {
+				opts = append(opts, metadataserver.WithCapture(10, nil))
+			}
+			s, err := metadataserver.New(opts...)
+			if err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			serveTraffic(t, s, "project/project-id?alt=text")
+
+			f, err := os.Open(name)
+			if err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			defer f.Close()
+			exchanges, err := metadataserver.ParseHAR(f)
+			if err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			if len(exchanges) != 1 {
+				t.Fatalf("expected 1 exchange, got: %d", len(exchanges))
+			}
+			e := exchanges[0]
+			wantURI := metadataserver.DefaultEndpoint + "/project/project-id"
+			if test.capture {
+				wantURI += "?alt=text"
+			}
+			if e.Method != http.MethodGet || e.URI != wantURI || e.Status != http.StatusOK || string(e.Body) != test.wantBody {
+				t.Errorf("unexpected exchange: %s %s %d %q", e.Method, e.URI, e.Status, e.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package metadataserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Tree assembles the values of the handlers that do not depend on the request into a nested map
+// like the response to the recursive metadata request, e.g. the value at "instance/zone" is tree["instance"]["zone"].
+// Keys with wildcards and handlers that need a request or a server, like [MetadataFunc], templates and expressions,
+// are not included; use [Server.TreeJSON] to get all values that the server serves.
+// If a key is both a value and a directory, the directory is kept.
+func (c *Configuration) Tree() map[string]any {
+	values := make(map[string]string)
+	for k, h := range c.Handlers {
+		values[k] = h()
+	}
+	for k, h := range c.BytesHandlers {
+		b, _ := h()
+		values[k] = string(b)
+	}
+	for k, h := range c.StreamHandlers {
+		body := h()
+		b, err := io.ReadAll(body)
+		if c, ok := body.(io.Closer); ok {
+			c.Close()
+		}
+		if err == nil {
+			values[k] = string(b)
+		}
+	}
+	tree := make(map[string]any)
+	for k, v := range values {
+		k = normalizeKey(k)
+		if k == "" || strings.Contains(k, wildcardSegment) || strings.Contains(k, "{") {
+			continue
+		}
+		insertTree(tree, strings.Split(k, "/"), v)
+	}
+	return tree
+}
+
+// TreeJSON returns the JSON document of all metadata under the prefix as the server responds
+// to the recursive request, including values set with [Server.SetValue] and aliases.
+// Empty prefix returns all metadata of the server.
+func (s *Server) TreeJSON(prefix string) ([]byte, error) {
+	key := s.resolveKey(prefix)
+	r, err := http.NewRequest(http.MethodGet, s.config.Endpoint+"/"+key+"/", nil)
+	if err != nil {
+		return nil, err
+	}
+	values := s.subtreeValues(r, key, true)
+	if len(values) == 0 {
+		return nil, fmt.Errorf("no metadata under %q", key)
+	}
+	tree := make(map[string]any)
+	for k, v := range values {
+		insertTree(tree, strings.Split(k, "/"), v)
+	}
+	return json.Marshal(tree)
+}
@@ -0,0 +1,96 @@
+package metadataserver_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/minherz/metadataserver"
+)
+
+func TestConfigurationTree(t *testing.T) {
+	c := metadataserver.NewConfiguration(map[string]metadataserver.Metadata{
+		"project/project-id":               func() string { return "test-project" },
+		"instance/zone":                    func() string { return "us-central1-a" },
+		"instance/attributes/env":          func() string { return "prod" },
+		"instance/disks/*/type":            func() string { return "PERSISTENT" },
+		"instance/network-interfaces":      func() string { return "ignored" },
+		"instance/network-interfaces/0/ip": func() string { return "10.0.0.2" },
+	})
+	c.BytesHandlers = map[string]metadataserver.BytesMetadata{
+		"instance/attributes/config": func() ([]byte, string) { return []byte(`{"a":1}`), "application/json" },
+	}
+	want := map[string]any{
+		"project": map[string]any{"project-id": "test-project"},
+		"instance": map[string]any{
+			"zone": "us-central1-a",
+			"attributes": map[string]any{
+				"env":    "prod",
+				"config": `{"a":1}`,
+			},
+			"network-interfaces": map[string]any{
+				"0": map[string]any{"ip": "10.0.0.2"},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, c.Tree()); diff != "" {
+		t.Errorf("tree mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestTreeJSON(t *testing.T) {
+	s, err := metadataserver.New(metadataserver.WithHandlers(map[string]metadataserver.Metadata{
+		"project/project-id":      func() string { return "test-project" },
+		"instance/zone":           func() string { return "us-central1-a" },
+		"instance/attributes/env": func() string { return "prod" },
+	}))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	s.SetValue("instance/attributes/owner", "team")
+	tests := []struct {
+		prefix  string
+		want    map[string]any
+		wantErr bool
+	}{
+		{
+			prefix: "",
+			want: map[string]any{
+				"project": map[string]any{"project-id": "test-project"},
+				"instance": map[string]any{
+					"zone":       "us-central1-a",
+					"attributes": map[string]any{"env": "prod", "owner": "team"},
+				},
+			},
+		},
+		{
+			prefix: "instance/attributes/",
+			want:   map[string]any{"env": "prod", "owner": "team"},
+		},
+		{
+			prefix:  "missing",
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.prefix, func(t *testing.T) {
+			data, err := s.TreeJSON(test.prefix)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got: %s", data)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			var got map[string]any
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("tree mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
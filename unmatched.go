@@ -0,0 +1,58 @@
+package metadataserver
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sort"
+)
+
+// maxUnmatchedPaths is the maximum number of distinct unmatched paths that the server tracks.
+const maxUnmatchedPaths = 1000
+
+// UnmatchedRequest describes requests at a path that does not match any metadata.
+type UnmatchedRequest struct {
+	Path  string `json:"path"`
+	Count int    `json:"count"`
+}
+
+// UnmatchedRequests returns the paths of the requests that did not match any metadata and the number of the requests
+// sorted by path. Use it to see which metadata the code under test needs but the configuration does not define.
+// The requests at paths disabled with [Server.DisablePath] are not included.
+// The server also logs the unmatched requests when it stops.
+func (s *Server) UnmatchedRequests() []UnmatchedRequest {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	unmatched := make([]UnmatchedRequest, 0, len(s.unmatched))
+	for p, n := range s.unmatched {
+		unmatched = append(unmatched, UnmatchedRequest{Path: p, Count: n})
+	}
+	sort.Slice(unmatched, func(i, j int) bool { return unmatched[i].Path < unmatched[j].Path })
+	return unmatched
+}
+
+// recordUnmatched counts the request that does not match any metadata.
+func (s *Server) recordUnmatched(r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.unmatched[r.URL.Path]; !ok && len(s.unmatched) >= maxUnmatchedPaths {
+		return
+	}
+	if s.unmatched == nil {
+		s.unmatched = make(map[string]int)
+	}
+	s.unmatched[r.URL.Path]++
+}
+
+// logUnmatched logs the unmatched requests.
+func (s *Server) logUnmatched(ctx context.Context) {
+	unmatched := s.UnmatchedRequests()
+	if len(unmatched) == 0 {
+		return
+	}
+	attrs := make([]any, 0, len(unmatched))
+	for _, u := range unmatched {
+		attrs = append(attrs, slog.Int(u.Path, u.Count))
+	}
+	s.logger.WarnContext(ctx, "requests did not match any metadata", slog.Group("unmatched", attrs...))
+}
@@ -0,0 +1,53 @@
+package metadataserver_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/minherz/metadataserver"
+)
+
+func TestUnmatchedRequests(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := context.Background()
+	s, err := metadataserver.New(
+		metadataserver.WithLogger(slog.New(slog.NewTextHandler(&buf, nil))),
+		metadataserver.WithAddress("127.0.0.1"),
+		metadataserver.WithPort(freePort()))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if err := s.Start(ctx); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	for _, p := range []string{"instance/zone", "project/project-id", "instance/zone", "instance/name"} {
+		rec := httptest.NewRecorder()
+		s.HttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/"+p, nil))
+	}
+	s.DisablePath("project/project-id")
+	s.HttpHandler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, metadataserver.DefaultEndpoint+"/project/project-id", nil))
+
+	want := []metadataserver.UnmatchedRequest{
+		{Path: "/computeMetadata/v1/instance/name", Count: 1},
+		{Path: "/computeMetadata/v1/instance/zone", Count: 2},
+	}
+	if diff := cmp.Diff(want, s.UnmatchedRequests()); diff != "" {
+		t.Errorf("unmatched requests mismatch (-want +got):\n%s", diff)
+	}
+	if err := s.Stop(ctx); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if got := buf.String(); !strings.Contains(got, "unmatched./computeMetadata/v1/instance/zone=2") {
+		t.Errorf("expected unmatched requests in the log, got: %q", got)
+	}
+	s.Reset()
+	if got := s.UnmatchedRequests(); len(got) != 0 {
+		t.Errorf("expected no unmatched requests after reset, got: %v", got)
+	}
+}
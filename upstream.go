@@ -0,0 +1,52 @@
+package metadataserver
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+)
+
+// WithUpstream sets a new server to proxy requests that do not match any metadata to the upstream server
+// at the URL, e.g. "http://169.254.169.254".
+// It allows to override a few metadata values while serving the rest from a real metadata server.
+// New returns an error if the URL is invalid.
+func WithUpstream(rawURL string) Option {
+	return func(s *Server) {
+		s.upstreamURL = rawURL
+	}
+}
+
+// newUpstream creates a reverse proxy to the upstream server or returns nil if no upstream is configured.
+func (s *Server) newUpstream() (*httputil.ReverseProxy, error) {
+	if s.upstreamURL == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(s.upstreamURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream URL %q: %w", s.upstreamURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid upstream URL %q: expected absolute http or https URL", s.upstreamURL)
+	}
+	proxy := httputil.NewSingleHostReverseProxy(u)
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		s.handlerLogger.ErrorContext(r.Context(), "error proxying request to upstream",
+			slog.String("path", r.URL.Path), slog.String("error", err.Error()))
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	return proxy, nil
+}
+
+// notFound responds to requests that do not match any metadata.
+// The requests are proxied to the upstream server if it is configured.
+func (s *Server) notFound(w http.ResponseWriter, r *http.Request) {
+	s.recordUnmatched(r)
+	if s.upstream == nil {
+		http.NotFound(w, r)
+		return
+	}
+	s.handlerLogger.DebugContext(r.Context(), "request is proxied to upstream", slog.String("path", r.URL.Path))
+	s.upstream.ServeHTTP(w, r)
+}
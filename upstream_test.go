@@ -0,0 +1,85 @@
+package metadataserver_test
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestUpstream(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			http.Error(w, "missing header", http.StatusForbidden)
+			return
+		}
+		io.WriteString(w, "upstream "+r.URL.Path)
+	}))
+	defer upstream.Close()
+	s, err := metadataserver.New(metadataserver.WithUpstream(upstream.URL))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	ts := httptest.NewServer(s.HttpHandler())
+	defer ts.Close()
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{metadataserver.DefaultEndpoint + "/project/project-id", "test-project-id"},
+		{metadataserver.DefaultEndpoint + "/instance/zone", "upstream " + metadataserver.DefaultEndpoint + "/instance/zone"},
+		{"/other", "upstream /other"},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, ts.URL+test.path, nil)
+			req.Header.Set("Metadata-Flavor", "Google")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != test.want {
+				t.Errorf("expected response %q, got: %q", test.want, string(body))
+			}
+		})
+	}
+}
+
+func TestUpstreamEncodedResponse(t *testing.T) {
+	value := strings.Repeat("x", 4096)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		io.WriteString(gz, value)
+		gz.Close()
+	}))
+	defer upstream.Close()
+	s, err := metadataserver.New(metadataserver.WithUpstream(upstream.URL))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	ts := httptest.NewServer(s.HttpHandler())
+	defer ts.Close()
+	resp, err := http.Get(ts.URL + metadataserver.DefaultEndpoint + "/instance/attributes/user-data")
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != value {
+		t.Errorf("expected %d bytes of the upstream value, got: %d", len(value), len(body))
+	}
+}
+
+func TestUpstreamInvalidURL(t *testing.T) {
+	if _, err := metadataserver.New(metadataserver.WithUpstream("169.254.169.254")); err == nil {
+		t.Errorf("expected error for URL without scheme")
+	}
+}
@@ -0,0 +1,244 @@
+package metadataserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// metadataSources are the fields of a metadata definition that define where the value comes from.
+var metadataSources = append(append([]string{"value", "env", "file"}, valueKindFields()...), "counter", "plugin")
+
+// ValidateConfigFile checks the JSON configuration file and returns all problems that it finds.
+// Unlike [NewConfigFromFile] it does not stop at the first problem.
+// If the file has no other problems, the values of the instance identity are checked with [Configuration.CheckConsistency].
+// It returns nil if the configuration is valid. The problems of the file's content match [ErrConfigInvalid] with [errors.Is].
+func ValidateConfigFile(name string) []error {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return []error{err}
+	}
+	var jc jsonConfiguration
+	if err := json.Unmarshal(data, &jc); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			line := bytes.Count(data[:syntaxErr.Offset], []byte("\n")) + 1
+			return []error{configError(fmt.Errorf("line %d: %w", line, err))}
+		}
+		return []error{configError(err)}
+	}
+	var errs []error
+	for _, p := range []struct {
+		name  string
+		value int
+	}{{"port", jc.Port}, {"adminPort", jc.AdminPort}} {
+		if p.value < 0 || p.value > 65535 {
+			errs = append(errs, fmt.Errorf("%s: %d is out of range", p.name, p.value))
+		}
+	}
+	if err := checkAddress(normalizeAddress(jc.Address)); err != nil {
+		errs = append(errs, fmt.Errorf("address: %w", err))
+	}
+	if jc.AdminPort > 0 && jc.AdminPort == jc.Port {
+		errs = append(errs, fmt.Errorf("adminPort: %d is the same as port", jc.AdminPort))
+	}
+	if jc.ShutdownTimeout < 0 {
+		errs = append(errs, fmt.Errorf("shutdownTimeout: %d is negative", jc.ShutdownTimeout))
+	}
+	if jc.ProjectNumber < 0 {
+		errs = append(errs, fmt.Errorf("projectNumber: %d is negative", jc.ProjectNumber))
+	}
+	keys := make([]string, 0, len(jc.Handlers))
+	for k := range jc.Handlers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		errs = append(errs, validateMetadata(k, jc.Handlers[k], filepath.Dir(name))...)
+		if dataMap, ok := jc.Handlers[k].(map[string]any); ok {
+			if v, ok := dataMap["value"]; ok {
+				if err := checkProjectValue(k, fmt.Sprintf("%v", v), jc.ProjectID, jc.ProjectNumber); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+	}
+	errs = append(errs, checkPaths(keys)...)
+	for i, jp := range jc.Profiles {
+		if jp.Name == "" {
+			errs = append(errs, fmt.Errorf("profiles[%d]: name is required", i))
+		}
+		if jp.Port < 0 || jp.Port > 65535 {
+			errs = append(errs, fmt.Errorf("profiles[%d]: port %d is out of range", i, jp.Port))
+		}
+		for _, cidr := range jp.Clients {
+			if _, err := parseClientRange(cidr); err != nil {
+				errs = append(errs, fmt.Errorf("profiles[%d]: invalid client range %q: %w", i, cidr, err))
+			}
+		}
+		keys := make([]string, 0, len(jp.Handlers))
+		for k := range jp.Handlers {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			for _, err := range validateMetadata(k, jp.Handlers[k], filepath.Dir(name)) {
+				errs = append(errs, fmt.Errorf("profiles[%d]: %w", i, err))
+			}
+		}
+		for _, err := range checkPaths(keys) {
+			errs = append(errs, fmt.Errorf("profiles[%d]: %w", i, err))
+		}
+	}
+	for i, jsa := range jc.ServiceAccounts {
+		if jsa.Email == "" {
+			errs = append(errs, fmt.Errorf("serviceAccounts[%d]: email is required", i))
+		}
+		if jsa.TokenLifetime != "" {
+			if _, err := time.ParseDuration(jsa.TokenLifetime); err != nil {
+				errs = append(errs, fmt.Errorf("serviceAccounts[%d]: invalid tokenLifetime: %w", i, err))
+			}
+		}
+	}
+	if err := checkRedirectStatus(jc.DirectoryRedirect); err != nil {
+		errs = append(errs, fmt.Errorf("directoryRedirect: %w", err))
+	}
+	for i, rd := range jc.Redirects {
+		if rd.From == "" || rd.To == "" {
+			errs = append(errs, fmt.Errorf("redirects[%d]: from and to are required", i))
+		}
+		if err := checkRedirectStatus(rd.Status); err != nil {
+			errs = append(errs, fmt.Errorf("redirects[%d]: %w", i, err))
+		}
+	}
+	for i, jcp := range jc.Cache {
+		if jcp.CacheControl == "" && jcp.Expires == "" {
+			errs = append(errs, fmt.Errorf("cache[%d]: one of [cacheControl expires] is required", i))
+		}
+		if jcp.Expires != "" {
+			if _, err := time.ParseDuration(jcp.Expires); err != nil {
+				errs = append(errs, fmt.Errorf("cache[%d]: invalid expires: %w", i, err))
+			}
+		}
+		for _, p := range jcp.Paths {
+			if _, err := path.Match(p, ""); err != nil {
+				errs = append(errs, fmt.Errorf("cache[%d]: invalid path pattern %q: %w", i, p, err))
+			}
+		}
+	}
+	for i, wh := range jc.Webhooks {
+		if u, err := url.Parse(wh.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("webhooks[%d]: invalid URL %q", i, wh.URL))
+		}
+		for _, p := range wh.Paths {
+			if _, err := path.Match(p, ""); err != nil {
+				errs = append(errs, fmt.Errorf("webhooks[%d]: invalid path pattern %q: %w", i, p, err))
+			}
+		}
+	}
+	for i, rh := range jc.Headers {
+		for _, p := range rh.Paths {
+			if _, err := path.Match(p, ""); err != nil {
+				errs = append(errs, fmt.Errorf("headers[%d]: invalid path pattern %q: %w", i, p, err))
+			}
+		}
+	}
+	if len(errs) == 0 {
+		if c, err := NewConfigFromFile(name); err == nil {
+			errs = c.CheckConsistency()
+		}
+	}
+	for i, err := range errs {
+		errs[i] = configError(err)
+	}
+	return errs
+}
+
+// validateMetadata returns problems of the metadata definition at the key.
+func validateMetadata(key string, v any, baseDir string) []error {
+	dataMap, ok := v.(map[string]any)
+	if !ok {
+		return []error{fmt.Errorf("metadata %q: expected object, got %T", key, v)}
+	}
+	var errs []error
+	var sources []string
+	for _, src := range metadataSources {
+		if _, ok := dataMap[src]; ok {
+			sources = append(sources, src)
+		}
+	}
+	if cases, ok := dataMap["cases"]; ok {
+		if _, err := newConditionalMetadata(cases, dataMap["value"]); err != nil {
+			errs = append(errs, fmt.Errorf("metadata %q: invalid cases: %w", key, err))
+		}
+		if len(sources) > 1 || (len(sources) == 1 && sources[0] != "value") {
+			errs = append(errs, fmt.Errorf("metadata %q: only value is allowed with cases", key))
+		}
+	} else {
+		switch len(sources) {
+		case 0:
+			errs = append(errs, fmt.Errorf("metadata %q: one of %v is required", key, metadataSources))
+		case 1:
+		default:
+			errs = append(errs, fmt.Errorf("metadata %q: only one of %v is allowed", key, sources))
+		}
+	}
+	for field, fv := range dataMap {
+		switch field {
+		case "value", "cases":
+		case "counter":
+			if _, err := newCounterFromSpec(fv); err != nil {
+				errs = append(errs, fmt.Errorf("metadata %q: invalid counter: %w", key, err))
+			}
+		case "env", "file", "plugin":
+			if s, ok := fv.(string); !ok || s == "" {
+				errs = append(errs, fmt.Errorf("metadata %q: %s must be a non-empty string", key, field))
+			} else if field != "env" {
+				if !filepath.IsAbs(s) {
+					s = filepath.Join(baseDir, s)
+				}
+				if _, err := os.Stat(s); err != nil {
+					errs = append(errs, fmt.Errorf("metadata %q: %w", key, err))
+				}
+			}
+		case "symbol":
+			if _, ok := dataMap["plugin"]; !ok {
+				errs = append(errs, fmt.Errorf("metadata %q: symbol is supported only for plugin", key))
+			}
+		case "ttl":
+			if _, ok := dataMap["env"]; !ok {
+				errs = append(errs, fmt.Errorf("metadata %q: ttl is supported only for env", key))
+			}
+			if _, err := time.ParseDuration(fmt.Sprintf("%v", fv)); err != nil {
+				errs = append(errs, fmt.Errorf("metadata %q: invalid ttl: %w", key, err))
+			}
+		default:
+			if kind := valueKindOf(field); kind != nil {
+				if _, err := kind.parse(key, fv); err != nil {
+					errs = append(errs, fmt.Errorf("metadata %q: invalid %s: %w", key, kind.name, err))
+				}
+				continue
+			}
+			errs = append(errs, fmt.Errorf("metadata %q: unknown field %q", key, field))
+		}
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errs
+}
+
+// checkPaths returns the errors of the metadata keys that are served at the same path or hide the metadata under them.
+func checkPaths(keys []string) []error {
+	var t routeTrie
+	conflicts := newRouteConflicts()
+	for _, k := range keys {
+		conflicts.insert(&t, k, &route{key: normalizeKey(k)})
+	}
+	return conflicts.errors(&t)
+}
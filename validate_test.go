@@ -0,0 +1,93 @@
+package metadataserver_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/minherz/metadataserver"
+)
+
+func TestValidateConfigFile(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{
+			path: "test/fixtures/config_mixed_handlers.json",
+		},
+		{
+			path: "test/fixtures/config_invalid.json",
+			want: []string{
+				`address: invalid IPv6 address: ParseAddr("fd00::zz"): each colon-separated field must have at least one digit (at "zz")`,
+				"adminPort: 8080 is the same as port",
+				"shutdownTimeout: -1 is negative",
+				`metadata "both": only one of [value env] is allowed`,
+				`metadata "cases": invalid cases: case 0: value is required`,
+				`metadata "cases": only value is allowed with cases`,
+				`metadata "empty": one of [value env file template expr time counter plugin] is required`,
+				`metadata "expr": invalid expression: at 15: unexpected end of expression`,
+				`metadata "file": stat test/fixtures/missing.txt: no such file or directory`,
+				`metadata "literal": expected object, got string`,
+				`metadata "project/project-id": value "other-project" contradicts the project "test-project"`,
+				`metadata "ttl": invalid ttl: time: invalid duration "forever"`,
+				`metadata "ttl": ttl is supported only for env`,
+				`metadata "unknown": unknown field "color"`,
+				"directoryRedirect: status 200 is not a redirect",
+				"redirects[0]: from and to are required",
+				"redirects[0]: status 404 is not a redirect",
+				"cache[0]: one of [cacheControl expires] is required",
+				`cache[0]: invalid path pattern "[": syntax error in pattern`,
+				`webhooks[0]: invalid URL "receiver:8080"`,
+				`webhooks[0]: invalid path pattern "[": syntax error in pattern`,
+			},
+		},
+		{
+			path: "test/fixtures/missing.json",
+			want: []string{"open test/fixtures/missing.json: no such file or directory"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			var got []string
+			for _, err := range metadataserver.ValidateConfigFile(test.path) {
+				got = append(got, err.Error())
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("diagnostics mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestValidateConfigFilePaths(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "config.json")
+	config := `{
+		"metadata": {
+			"instance/zone": {"value": "a"},
+			"/instance/zone/": {"value": "b"}
+		},
+		"profiles": [{
+			"name": "dev",
+			"metadata": {
+				"project": {"value": "a"},
+				"project/project-id": {"value": "b"}
+			}
+		}]
+	}`
+	if err := os.WriteFile(name, []byte(config), 0o644); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	want := []string{
+		`metadata "/instance/zone/" and "instance/zone" are served at the same path`,
+		`profiles[0]: metadata "project" hides the metadata under it, e.g. "project/project-id"`,
+	}
+	var got []string
+	for _, err := range metadataserver.ValidateConfigFile(name) {
+		got = append(got, err.Error())
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("diagnostics mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,84 @@
+package metadataserver
+
+import (
+	"fmt"
+	"text/template"
+)
+
+// valueKind is a kind of the metadata values of the configuration file that the server evaluates for each request,
+// e.g. the templates that reference other metadata. The kinds in [valueKinds] are parsed and validated
+// from the field of the metadata definition, listed in [Server.Paths] and served by the handlers that the kind returns.
+type valueKind struct {
+	// field is the field of the metadata definition, e.g. "template"; it is also the source of the metadata
+	field string
+	// name describes the kind in the errors, e.g. "expression"
+	name string
+	// parse parses the field's value of the metadata at the key
+	parse func(key string, v any) (any, error)
+	// handler returns the handler that serves the parsed value with the server
+	handler func(s *Server, v any) Handler
+	// refs returns the keys of the metadata that the parsed value references or nil if the kind cannot reference metadata
+	refs func(v any) []string
+}
+
+// parsedValue is the parsed value of the metadata of the kind.
+type parsedValue struct {
+	kind  *valueKind
+	value any
+}
+
+// valueKinds are the kinds of the values that the server evaluates for each request.
+var valueKinds = []*valueKind{
+	{
+		field: "template",
+		name:  "template",
+		parse: func(key string, v any) (any, error) { return parseTemplate(key, fmt.Sprintf("%v", v)) },
+		handler: func(s *Server, v any) Handler {
+			return &templateMetadata{s: s, tmpl: v.(*template.Template)}
+		},
+		refs: func(v any) []string { return templateRefs(v.(*template.Template)) },
+	},
+	{
+		field:   "expr",
+		name:    "expression",
+		parse:   func(key string, v any) (any, error) { return parseExpr(key, fmt.Sprintf("%v", v)) },
+		handler: func(s *Server, v any) Handler { return &exprMetadata{s: s, expr: v.(*expr)} },
+		refs:    func(v any) []string { return v.(*expr).refs() },
+	},
+	{
+		field:   "time",
+		name:    "time",
+		parse:   func(_ string, v any) (any, error) { return newTimeValue(v) },
+		handler: func(s *Server, v any) Handler { return &timeMetadata{s: s, t: v.(*timeValue)} },
+	},
+}
+
+// definedKind returns the first kind of the values that the metadata definition defines and the value of its field
+// or nil if the definition does not define such values.
+func definedKind(dataMap map[string]any) (*valueKind, any) {
+	for _, kind := range valueKinds {
+		if v, ok := dataMap[kind.field]; ok {
+			return kind, v
+		}
+	}
+	return nil, nil
+}
+
+// valueKindFields returns the fields of the metadata definitions that define the values of the kinds.
+func valueKindFields() []string {
+	fields := make([]string, len(valueKinds))
+	for i, kind := range valueKinds {
+		fields[i] = kind.field
+	}
+	return fields
+}
+
+// valueKindOf returns the kind of the values defined by the field or nil if the field does not define such values.
+func valueKindOf(field string) *valueKind {
+	for _, kind := range valueKinds {
+		if kind.field == field {
+			return kind
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package metadataserver
+
+import (
+	"runtime/debug"
+)
+
+// modulePath is the path of the package's module.
+const modulePath = "github.com/minherz/metadataserver"
+
+// BuildInfo describes the build of the program that runs the server.
+type BuildInfo struct {
+	// Version is the version of the package's module, e.g. "v0.3.0" or "(devel)" for local builds.
+	Version   string `json:"version"`
+	GoVersion string `json:"goVersion"`
+	// Revision and Modified describe the VCS state of the main module when the program was built.
+	Revision string `json:"revision,omitempty"`
+	Modified bool   `json:"modified,omitempty"`
+}
+
+// Version returns the version of the package's module or "(devel)" if the version is unknown.
+func Version() string {
+	return ReadBuildInfo().Version
+}
+
+// ReadBuildInfo returns the build information of the running program (see [debug.ReadBuildInfo]).
+func ReadBuildInfo() BuildInfo {
+	info := BuildInfo{Version: "(devel)"}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.GoVersion = bi.GoVersion
+	mods := append([]*debug.Module{&bi.Main}, bi.Deps...)
+	for _, m := range mods {
+		if m.Path != modulePath {
+			continue
+		}
+		if m.Replace != nil {
+			m = m.Replace
+		}
+		if m.Version != "" {
+			info.Version = m.Version
+		}
+		break
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Revision = s.Value
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+	return info
+}
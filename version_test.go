@@ -0,0 +1,30 @@
+package metadataserver_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestVersion(t *testing.T) {
+	if got := metadataserver.Version(); got == "" {
+		t.Errorf("expected version, got empty string")
+	}
+	s, err := metadataserver.New()
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	s.AdminHttpHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+	var got metadataserver.BuildInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	if got.Version != metadataserver.Version() || got.GoVersion != runtime.Version() {
+		t.Errorf("unexpected build info: %+v", got)
+	}
+}
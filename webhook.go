@@ -0,0 +1,92 @@
+package metadataserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"path"
+	"time"
+)
+
+// webhookTimeout is the maximum time to deliver a webhook event.
+const webhookTimeout = 5 * time.Second
+
+// Webhook describes a URL that is notified when metadata is requested at one of the paths.
+// Paths are relative to the server's endpoint and can use patterns supported by [path.Match].
+// If no paths are defined the URL is notified about all requests.
+//
+// The event is sent using POST request with [RequestRecord] in JSON format.
+type Webhook struct {
+	URL   string   `json:"url"`
+	Paths []string `json:"paths,omitempty"`
+}
+
+// WithWebhook sets a new server with a webhook that is notified when metadata is requested at one of the paths.
+//
+// Mind the order of options when use with [WithConfiguration] and [WithConfigFile].
+func WithWebhook(url string, paths ...string) Option {
+	return func(s *Server) {
+		if s.config == nil {
+			s.config = NewConfiguration(DefaultConfigurationHandlers)
+		}
+		s.config.Webhooks = append(s.config.Webhooks, Webhook{URL: url, Paths: paths})
+	}
+}
+
+func (wh Webhook) matches(key string) bool {
+	if len(wh.Paths) == 0 {
+		return true
+	}
+	for _, p := range wh.Paths {
+		if ok, _ := path.Match(normalizeKey(p), key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) notifyWebhooks(record RequestRecord) {
+	if len(s.config.Webhooks) == 0 {
+		return
+	}
+	key, ok := s.keyOf(record.Path)
+	if !ok {
+		return
+	}
+	var body []byte
+	for _, wh := range s.config.Webhooks {
+		if !wh.matches(key) {
+			continue
+		}
+		if body == nil {
+			var err error
+			if body, err = json.Marshal(record); err != nil {
+				s.logger.Error("failed to marshal webhook event", slog.String("error", err.Error()))
+				return
+			}
+		}
+		go s.sendWebhook(wh.URL, body)
+	}
+}
+
+func (s *Server) sendWebhook(url string, body []byte) {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		s.logger.ErrorContext(ctx, "failed to create webhook request", slog.String("url", url), slog.String("error", err.Error()))
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "failed to send webhook event", slog.String("url", url), slog.String("error", err.Error()))
+		return
+	}
+	res.Body.Close()
+	if res.StatusCode >= http.StatusBadRequest {
+		s.logger.ErrorContext(ctx, "webhook event is rejected", slog.String("url", url), slog.Int("status", res.StatusCode))
+	}
+}
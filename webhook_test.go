@@ -0,0 +1,51 @@
+package metadataserver_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestWebhook(t *testing.T) {
+	events := make(chan metadataserver.RequestRecord, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var record metadataserver.RequestRecord
+		if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+			t.Errorf("expected no errors, got: %v", err)
+		}
+		events <- record
+	}))
+	defer receiver.Close()
+
+	s, err := metadataserver.New(
+		metadataserver.WithHandlers(map[string]metadataserver.Metadata{
+			"instance/zone": func() string { return "us-central1-a" },
+			"instance/service-accounts/default/token": func() string { return "token" },
+		}),
+		metadataserver.WithWebhook(receiver.URL, "instance/service-accounts/*/token"))
+	if err != nil {
+		t.Fatalf("expected no errors, got: %v", err)
+	}
+	ts := httptest.NewServer(s.HttpHandler())
+	defer ts.Close()
+
+	getStatus(t, ts.URL+metadataserver.DefaultEndpoint+"/instance/zone")
+	getStatus(t, ts.URL+metadataserver.DefaultEndpoint+"/instance/service-accounts/default/token")
+	select {
+	case got := <-events:
+		if want := metadataserver.DefaultEndpoint + "/instance/service-accounts/default/token"; got.Path != want {
+			t.Errorf("expected event for %q, got: %q", want, got.Path)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected webhook event")
+	}
+	select {
+	case got := <-events:
+		t.Errorf("unexpected event: %+v", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,103 @@
+package metadataserver
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Paths of the location metadata.
+const (
+	ZonePath   = "instance/zone"
+	RegionPath = "instance/region"
+)
+
+// DefaultProjectNumber is the project number of the fully-qualified zone and region
+// when the configuration does not define the project number.
+const DefaultProjectNumber = 123456789012
+
+// WithZone sets a new server with the zone of the simulated instance, e.g. "us-central1-a".
+// The server serves the fully-qualified zone "projects/NUMBER/zones/ZONE" at [ZonePath]
+// and the region "projects/NUMBER/regions/REGION" at [RegionPath].
+//
+// Mind the order of options when use with [WithConfiguration] and [WithConfigFile].
+func WithZone(zone string) Option {
+	return func(s *Server) {
+		if s.config == nil {
+			s.config = NewConfiguration(DefaultConfigurationHandlers)
+		}
+		s.config.Zone = zone
+	}
+}
+
+// applyZone adds the handlers of the zone and the region to the configuration.
+// If the zone is not configured, the region is derived from the literal value at [ZonePath].
+// It returns an error if the handlers of the configuration contradict the zone.
+func (c *Configuration) applyZone() error {
+	values := make(map[string]string, 2)
+	if c.Zone != "" {
+		zone := path.Base(c.Zone)
+		region, ok := zoneRegion(zone)
+		if !ok {
+			return fmt.Errorf("zone %q: expected a zone name like \"us-central1-a\"", c.Zone)
+		}
+		number := c.ProjectNumber
+		if number == 0 {
+			number = DefaultProjectNumber
+		}
+		prefix := "projects/" + strconv.FormatInt(number, 10)
+		values[ZonePath] = prefix + "/zones/" + zone
+		values[RegionPath] = prefix + "/regions/" + region
+	} else if zone, ok := c.literals[ZonePath]; ok && c.Source(RegionPath) == "" {
+		dir, name := path.Split(zone)
+		region, ok := zoneRegion(name)
+		if !ok {
+			return nil
+		}
+		if strings.HasSuffix(dir, "/zones/") {
+			dir = strings.TrimSuffix(dir, "zones/") + "regions/"
+		}
+		values[RegionPath] = dir + region
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	handlers := make(map[string]Metadata, len(c.Handlers)+len(values))
+	for k, h := range c.Handlers {
+		handlers[k] = h
+	}
+	if c.literals == nil {
+		c.literals = make(map[string]string)
+	}
+	if c.sources == nil {
+		c.sources = make(map[string]string)
+	}
+	for k, v := range values {
+		if h, ok := handlers[k]; ok {
+			if got := h(); path.Base(got) != path.Base(v) {
+				return fmt.Errorf("metadata %q: value %q contradicts the zone %q", k, got, c.Zone)
+			}
+		} else if c.Source(k) != "" {
+			return fmt.Errorf("metadata %q: the handler conflicts with the zone", k)
+		}
+		handlers[k] = func() string {
+			return v
+		}
+		c.literals[k] = v
+		if _, ok := c.sources[k]; !ok {
+			c.sources[k] = "zone"
+		}
+	}
+	c.Handlers = handlers
+	return nil
+}
+
+// zoneRegion returns the region of the zone, e.g. "us-central1" for "us-central1-a".
+func zoneRegion(zone string) (string, bool) {
+	i := strings.LastIndexByte(zone, '-')
+	if i <= 0 || i == len(zone)-1 {
+		return "", false
+	}
+	return zone[:i], true
+}
@@ -0,0 +1,84 @@
+package metadataserver_test
+
+import (
+	"testing"
+
+	"github.com/minherz/metadataserver"
+)
+
+func TestZone(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []metadataserver.Option
+		want map[string]string
+	}{
+		{
+			name: "zone",
+			opts: []metadataserver.Option{metadataserver.WithZone("europe-west1-b")},
+			want: map[string]string{
+				metadataserver.ZonePath:   "projects/123456789012/zones/europe-west1-b",
+				metadataserver.RegionPath: "projects/123456789012/regions/europe-west1",
+			},
+		},
+		{
+			name: "zone of the project",
+			opts: []metadataserver.Option{metadataserver.WithProject("my-project", 42), metadataserver.WithZone("us-central1-a")},
+			want: map[string]string{
+				metadataserver.ZonePath:   "projects/42/zones/us-central1-a",
+				metadataserver.RegionPath: "projects/42/regions/us-central1",
+			},
+		},
+		{
+			name: "region derived from zone metadata",
+			opts: []metadataserver.Option{metadataserver.WithConfigFile("test/fixtures/config_aliases.json")},
+			want: map[string]string{
+				metadataserver.RegionPath: "projects/123456789/regions/us-central1",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := metadataserver.New(test.opts...)
+			if err != nil {
+				t.Fatalf("expected no errors, got: %v", err)
+			}
+			for path, want := range test.want {
+				if got, ok := s.GetValue(path); !ok || got != want {
+					t.Errorf("%s: expected %q, got: %q", path, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestZoneErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []metadataserver.Option
+		want string
+	}{
+		{
+			name: "invalid zone",
+			opts: []metadataserver.Option{metadataserver.WithZone("zone")},
+			want: `zone "zone": expected a zone name like "us-central1-a"`,
+		},
+		{
+			name: "contradicting zone metadata",
+			opts: []metadataserver.Option{
+				metadataserver.WithHandlers(map[string]metadataserver.Metadata{
+					metadataserver.ZonePath: func() string { return "projects/123456789012/zones/us-east1-b" },
+				}),
+				metadataserver.WithZone("us-central1-a"),
+			},
+			want: `metadata "instance/zone": value "projects/123456789012/zones/us-east1-b" contradicts the zone "us-central1-a"`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := metadataserver.New(test.opts...)
+			if err == nil || err.Error() != test.want {
+				t.Errorf("expected error %q, got: %v", test.want, err)
+			}
+		})
+	}
+}